@@ -1,131 +1,74 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"sanctor/internal/database"
-	"sanctor/internal/group"
-	"sanctor/internal/picture"
-	"sanctor/internal/post"
-	"sanctor/internal/user"
-	"sanctor/internal/auth"
-)
-
-type Response struct {
-	Message string `json:"message"`
-	Status  string `json:"status"`
-}
+	"os/signal"
+	"syscall"
+	"time"
 
-func enableCORS(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-}
+	"sanctor/internal/config"
+	"sanctor/pkg/server"
+)
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
-	w.Header().Set("Content-Type", "application/json")
-	
-	response := Response{
-		Message: "Sanctor API is running",
-		Status:  "healthy",
+func main() {
+	flags := flag.NewFlagSet("sanctor", flag.ExitOnError)
+	printConfig := flags.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+	cfg, err := config.Load(flags, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	
-	json.NewEncoder(w).Encode(response)
-}
 
-func main() {
-	// Initialize database connection if DATABASE_URL is set
-	var db *database.DB
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL != "" {
-		log.Println("Connecting to database...")
-		var err error
-		db, err = database.NewFromURL(databaseURL)
+	if *printConfig {
+		dump, err := cfg.Dump()
 		if err != nil {
-			log.Printf("⚠️  Failed to connect to database: %v", err)
-			log.Println("⚠️  Falling back to in-memory storage")
-			db = nil
-		} else {
-			defer db.Close()
-
-			// Run auto-migration for all models
-			if err := db.AutoMigrate(&user.User{}, &group.Group{}, &group.UserGroup{}, &post.Post{}, &picture.Picture{}); err != nil {
-				log.Printf("⚠️  Failed to migrate database: %v", err)
-			}
-
-			log.Println("Initializing modules with database...")
-			user.InitWithDatabase(db)
-			group.InitWithDatabase(db)
-			log.Println("✅ Database initialized successfully")
+			log.Fatalf("Failed to print configuration: %v", err)
 		}
-	} else {
-		log.Println("⚠️  No DATABASE_URL found, using in-memory storage")
+		fmt.Print(dump)
+		return
 	}
 
-	// Health check endpoints
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/api/health", healthHandler)
-
-	// User endpoints
-	http.HandleFunc("/api/users", user.GetUsers)
-	http.HandleFunc("/api/users/get", user.GetUser)
-	http.HandleFunc("/api/users/create", user.CreateUser)
-	http.HandleFunc("/api/users/update", user.UpdateUser)
-	http.HandleFunc("/api/users/delete", user.DeleteUser)
-
-	// Group endpoints
-	http.HandleFunc("/api/groups", group.GetGroups)
-	http.HandleFunc("/api/groups/get", group.GetGroup)
-	http.HandleFunc("/api/groups/create", group.CreateGroup)
-	http.HandleFunc("/api/groups/update", group.UpdateGroup)
-	http.HandleFunc("/api/groups/delete", group.DeleteGroup)
-
-	// Group membership endpoints
-	http.HandleFunc("/api/groups/members/add", group.AddUserToGroup)
-	http.HandleFunc("/api/groups/members/remove", group.RemoveUserFromGroup)
-	http.HandleFunc("/api/groups/members", group.GetGroupMembers)
-	http.HandleFunc("/api/users/groups", group.GetUserGroups)
-
-	// Group messaging endpoints
-	http.HandleFunc("/api/groups/messages/send", group.SendGroupMessage)
+	if args := flags.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			log.Fatalf("Unknown command %q", args[0])
+		}
+		if err := migrate(cfg, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// Post endpoints - use database if available
-	var postService *post.Service
-	if db != nil {
-		postGormRepo := post.NewGormRepository(db)
-		postService = post.NewServiceWithGorm(postGormRepo)
-		log.Println("✅ Posts initialized with database")
-	} else {
-		postRepo := post.NewRepository()
-		postService = post.NewService(postRepo)
-		log.Println("⚠️  Posts using in-memory storage")
+	srv, err := server.New(server.Options{Config: cfg})
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
 	}
-	postHandler := post.NewHandler(postService)
-	http.HandleFunc("/api/posts", postHandler.GetPosts)
-	http.HandleFunc("/api/posts/get", postHandler.GetPost)
-	http.HandleFunc("/api/posts/create", postHandler.CreatePost)
-	http.HandleFunc("/api/posts/update", postHandler.UpdatePost)
-	http.HandleFunc("/api/posts/delete", postHandler.DeletePost)
 
-	// Initialize shared user service
-	userRepo := user.NewRepository()
-	userService := user.NewService(userRepo)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Auth endpoints
-	authRepo := auth.NewRepository()
-	authService := auth.NewService(authRepo, userService)
-	authHandler := auth.NewHandler(authService)
-	http.HandleFunc("/api/auth/register", authHandler.Register)
-	http.HandleFunc("/api/auth/login", authHandler.Login)
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-served:
+		srv.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		stop()
+		log.Println("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("⚠️  Shutdown did not complete cleanly: %v", err)
+		}
 	}
+}
 
-	fmt.Printf("Server starting on port %s...\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
-}
\ No newline at end of file
+// shutdownTimeout is how long in-flight requests get to finish after
+// SIGINT or SIGTERM
+const shutdownTimeout = 30 * time.Second
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"sanctor/internal/app"
+	"sanctor/internal/config"
+	"sanctor/internal/database"
+)
+
+const migrateUsage = `usage: api migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and whether they are applied
+  redo        roll back the last migration and apply it again`
+
+// migrate runs the migrate subcommand against the configured database
+func migrate(cfg *config.Config, args []string) error {
+	steps := 1
+	switch {
+	case len(args) == 1 && (args[0] == "up" || args[0] == "down" || args[0] == "status" || args[0] == "redo"):
+	case len(args) == 2 && args[0] == "down":
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("down takes a positive number of migrations, got %q", args[1])
+		}
+		steps = n
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	db, err := app.ConnectDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := app.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		printMigrations("Applied", applied)
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		printMigrations("Rolled back", reverted)
+		return err
+	case "redo":
+		redone, err := migrator.Redo(ctx)
+		if redone != nil {
+			fmt.Printf("Redid %03d_%s\n", redone.Version, redone.Name)
+		} else if err == nil {
+			fmt.Println("No migrations applied")
+		}
+		return err
+	default:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(statuses)
+		return nil
+	}
+}
+
+// printMigrations lists the migrations a command changed
+func printMigrations(verb string, migrations []database.Migration) {
+	if len(migrations) == 0 {
+		fmt.Println("Nothing to do")
+	}
+	for _, migration := range migrations {
+		fmt.Printf("%s %03d_%s\n", verb, migration.Version, migration.Name)
+	}
+}
+
+// printStatus prints the migration table
+func printStatus(statuses []database.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "-"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", status.Version, status.Name, status.State, appliedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,115 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sanctor/internal/auth"
+	"sanctor/internal/authctx"
+)
+
+// Handler handles HTTP requests for account deactivation and deletion
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new account handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// DeletionResponse tells the user when their account will be deleted
+type DeletionResponse struct {
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt"`
+}
+
+// Deactivate deactivates the caller's account
+func (h *Handler) Deactivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	if err := h.service.Deactivate(r.Context(), userID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reactivate reactivates a deactivated account with its email and password
+// and signs the user in
+func (h *Handler) Reactivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req auth.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ClientInfo = auth.RequestClientInfo(r)
+
+	resp, err := h.service.Reactivate(r.Context(), req)
+	if err != nil {
+		var throttled *auth.ThrottleError
+		switch {
+		case errors.As(err, &throttled):
+			w.Header().Set("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, err)
+		case errors.Is(err, auth.ErrAccountDisabled):
+			writeError(w, http.StatusForbidden, err)
+		default:
+			writeError(w, http.StatusUnauthorized, err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ScheduleDeletion deactivates the caller's account and schedules its deletion
+func (h *Handler) ScheduleDeletion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	at, err := h.service.ScheduleDeletion(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, &DeletionResponse{DeletionScheduledAt: at})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,168 @@
+package account
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"sanctor/internal/auth"
+	"sanctor/internal/database"
+	"sanctor/internal/group"
+	"sanctor/internal/post"
+	"sanctor/internal/user"
+)
+
+// DeletionGracePeriod is how long a user has to change their mind after
+// asking for their account to be deleted
+const DeletionGracePeriod = 30 * 24 * time.Hour
+
+// Service manages the lifecycle of a user's account across modules:
+// deactivation hides the user's posts and signs them out, and deletion
+// removes everything they own.
+type Service struct {
+	users  *user.Service
+	auth   *auth.Service
+	posts  *post.Service
+	groups *group.Service
+	tx     database.Transactor
+}
+
+// NewService creates a new account service. Deletions run as units of work
+// on tx, which must match the repositories' storage.
+func NewService(users *user.Service, authService *auth.Service, posts *post.Service, groups *group.Service, tx database.Transactor) *Service {
+	return &Service{
+		users:  users,
+		auth:   authService,
+		posts:  posts,
+		groups: groups,
+		tx:     tx,
+	}
+}
+
+// Deactivate deactivates a user's own account in one unit of work: they are
+// signed out everywhere and their posts are hidden until they reactivate it
+func (s *Service) Deactivate(ctx context.Context, userID string) error {
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.users.Deactivate(ctx, userID, user.DeactivatedBySelf); err != nil {
+			return err
+		}
+		return s.suspend(ctx, userID)
+	})
+}
+
+// DeactivateByAdmin deactivates an account on an administrator's behalf in
+// one unit of work. The owner cannot reactivate it; only an administrator can.
+func (s *Service) DeactivateByAdmin(ctx context.Context, userID string) error {
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.users.Deactivate(ctx, userID, user.DeactivatedByAdmin); err != nil {
+			return err
+		}
+		return s.suspend(ctx, userID)
+	})
+}
+
+// Reactivate signs a user back in with their password, reactivating an
+// account they deactivated and showing their posts again
+func (s *Service) Reactivate(ctx context.Context, req auth.LoginRequest) (*auth.AuthResponse, error) {
+	return s.auth.ReactivateAccount(ctx, req)
+}
+
+// Reactivated shows the posts of a user who reactivated their account. It is
+// registered as the auth service's reactivation hook, so it runs in the same
+// unit of work as the reactivation.
+func (s *Service) Reactivated(ctx context.Context, userID string) error {
+	return s.posts.SetUserPostsHidden(ctx, userID, false)
+}
+
+// ScheduleDeletion deactivates a user's account and schedules it for
+// deletion once the grace period is over. Reactivating cancels it.
+func (s *Service) ScheduleDeletion(ctx context.Context, userID string) (time.Time, error) {
+	at := time.Now().Add(DeletionGracePeriod)
+	err := s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.users.ScheduleDeletion(ctx, userID, at); err != nil {
+			return err
+		}
+		return s.suspend(ctx, userID)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	log.Printf("🗑️  Deletion of user %s scheduled for %s", userID, at.Format(time.RFC3339))
+	return at, nil
+}
+
+// suspend hides the posts of a deactivated user and revokes their credentials
+func (s *Service) suspend(ctx context.Context, userID string) error {
+	if err := s.posts.SetUserPostsHidden(ctx, userID, true); err != nil {
+		return err
+	}
+	return s.auth.RevokeAllCredentials(ctx, userID)
+}
+
+// ProcessDeletions deletes every account whose grace period is over. It is
+// run periodically by the digestion cron.
+func (s *Service) ProcessDeletions(ctx context.Context) error {
+	now := time.Now()
+	due, err := s.users.DueForDeletion(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, u := range due {
+		deleted, err := s.deleteIfDue(ctx, u.ID, now)
+		if err != nil {
+			log.Printf("⚠️  Failed to delete user %s: %v", u.ID, err)
+			continue
+		}
+		if deleted {
+			log.Printf("🗑️  Deleted user %s after the grace period", u.ID)
+		}
+	}
+	return nil
+}
+
+// deleteIfDue deletes a user if their deletion is still scheduled before
+// now, and reports whether it did. The user is locked while this is checked
+// and carried out, so a reactivation that came after they were found due, or
+// another run of the cron, cannot race with the deletion.
+func (s *Service) deleteIfDue(ctx context.Context, userID string, now time.Time) (bool, error) {
+	deleted := false
+	err := s.tx.Transaction(ctx, func(ctx context.Context) error {
+		u, err := s.users.GetUserForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if u.DeletionScheduledAt == nil || !u.DeletionScheduledAt.Before(now) {
+			return nil
+		}
+		if err := s.Delete(ctx, userID); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// Delete removes a user and everything they own right away, in one unit of
+// work: their authentication data, their group memberships (handing over or
+// deleting groups they own), their posts and pictures, and the user. If any
+// step fails nothing is deleted, and the next run of the deletion cron tries
+// again.
+func (s *Service) Delete(ctx context.Context, userID string) error {
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.auth.DeleteUserData(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.groups.RemoveUserFromAllGroups(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.posts.DeleteUserPosts(ctx, userID); err != nil {
+			return err
+		}
+		return s.users.DeleteUser(ctx, userID)
+	})
+}
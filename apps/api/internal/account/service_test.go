@@ -0,0 +1,301 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sanctor/internal/auth"
+	"sanctor/internal/database"
+	"sanctor/internal/group"
+	"sanctor/internal/mail"
+	"sanctor/internal/post"
+	"sanctor/internal/university"
+	"sanctor/internal/user"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingAuthRepository fails to list API keys, a step of revoking
+// a user's credentials
+type failingAuthRepository struct {
+	auth.Repository
+}
+
+func (r failingAuthRepository) FindAPIKeysByUser(ctx context.Context, userID string) ([]*auth.APIKey, error) {
+	return nil, errInjected
+}
+
+// failingGroupRepository fails to list a user's memberships, the step of
+// account deletion that follows removing their authentication data
+type failingGroupRepository struct {
+	group.Repository
+}
+
+func (r failingGroupRepository) GetUserGroups(ctx context.Context, userID string) ([]*group.UserGroup, error) {
+	return nil, errInjected
+}
+
+type fixture struct {
+	accounts *Service
+	users    *user.Service
+	auth     *auth.Service
+	posts    *post.Service
+
+	userID string
+	token  string
+	postID string
+}
+
+// newFixture builds in-memory services around a registered user who has
+// one post. A failing step is injected into the auth or group repository.
+func newFixture(t *testing.T, failAuth, failGroups bool) *fixture {
+	t.Helper()
+	ctx := context.Background()
+
+	universities, err := university.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := database.NewMemoryTransactor()
+	var authRepo auth.Repository = auth.NewRepository()
+	if failAuth {
+		authRepo = failingAuthRepository{authRepo}
+	}
+	var groupRepo group.Repository = group.NewRepository()
+	if failGroups {
+		groupRepo = failingGroupRepository{groupRepo}
+	}
+
+	f := &fixture{
+		users: user.NewService(user.NewRepository(), tx),
+		posts: post.NewService(post.NewRepository(), tx),
+	}
+	f.auth = auth.NewService(authRepo, tx, f.users, mail.NewLogSender(), universities, auth.Config{})
+	f.accounts = NewService(f.users, f.auth, f.posts, group.NewService(groupRepo, tx), tx)
+	f.auth.SetReactivationHook(f.accounts.Reactivated)
+
+	resp, err := f.auth.Register(ctx, auth.RegisterRequest{
+		Email:     "ada@example.com",
+		Username:  "ada",
+		Password:  "analytical-engine-1843",
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.token = resp.Token
+	if f.userID, err = f.auth.ValidateToken(ctx, f.token); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := f.posts.CreatePost(ctx, &post.Post{UserID: f.userID, Address: "1 Main St"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.postID = p.ID
+	return f
+}
+
+// assertUntouched checks that a failed unit of work left the account as it was
+func (f *fixture) assertUntouched(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+
+	u, err := f.users.GetUser(ctx, f.userID)
+	if err != nil {
+		t.Fatalf("user is gone: %v", err)
+	}
+	if !u.IsActive || u.DeletionScheduledAt != nil {
+		t.Errorf("user was changed: active=%v deletionScheduledAt=%v", u.IsActive, u.DeletionScheduledAt)
+	}
+	if _, err := f.auth.ValidateToken(ctx, f.token); err != nil {
+		t.Errorf("session was revoked: %v", err)
+	}
+	if p, err := f.posts.GetPost(ctx, f.postID); err != nil || p == nil {
+		t.Errorf("post is not visible: %v", err)
+	}
+}
+
+func TestUnitsOfWorkRollBack(t *testing.T) {
+	tests := []struct {
+		name       string
+		failAuth   bool
+		failGroups bool
+		run        func(ctx context.Context, f *fixture) error
+	}{
+		{
+			name:     "deactivate",
+			failAuth: true,
+			run: func(ctx context.Context, f *fixture) error {
+				return f.accounts.Deactivate(ctx, f.userID)
+			},
+		},
+		{
+			name:     "deactivate by an admin",
+			failAuth: true,
+			run: func(ctx context.Context, f *fixture) error {
+				return f.accounts.DeactivateByAdmin(ctx, f.userID)
+			},
+		},
+		{
+			name:     "schedule deletion",
+			failAuth: true,
+			run: func(ctx context.Context, f *fixture) error {
+				_, err := f.accounts.ScheduleDeletion(ctx, f.userID)
+				return err
+			},
+		},
+		{
+			name:       "delete",
+			failGroups: true,
+			run: func(ctx context.Context, f *fixture) error {
+				return f.accounts.Delete(ctx, f.userID)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, tt.failAuth, tt.failGroups)
+			if err := tt.run(context.Background(), f); !errors.Is(err, errInjected) {
+				t.Fatalf("got error %v, want the injected failure", err)
+			}
+			f.assertUntouched(t)
+		})
+	}
+}
+
+func TestDeleteRemovesEverything(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, false, false)
+
+	if err := f.accounts.Delete(ctx, f.userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.users.GetUser(ctx, f.userID); err == nil {
+		t.Error("user still exists")
+	}
+	if _, err := f.auth.ValidateToken(ctx, f.token); err == nil {
+		t.Error("session still valid")
+	}
+	if p, _ := f.posts.GetPost(ctx, f.postID); p != nil {
+		t.Error("post still exists")
+	}
+}
+
+func TestDeactivateByAdmin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, false, false)
+
+	if err := f.accounts.DeactivateByAdmin(ctx, f.userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.auth.ValidateToken(ctx, f.token); err == nil {
+		t.Error("session still valid")
+	}
+	if p, _ := f.posts.GetPost(ctx, f.postID); p != nil {
+		t.Error("post still visible")
+	}
+	if err := f.users.Reactivate(ctx, f.userID); !errors.Is(err, user.ErrDeactivatedByAdmin) {
+		t.Errorf("got error %v, want the owner unable to reactivate", err)
+	}
+}
+
+func TestAdminActivationKeepsScheduledDeletion(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, false, false)
+
+	at, err := f.accounts.ScheduleDeletion(ctx, f.userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.users.SetActive(ctx, f.userID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.users.SetActive(ctx, f.userID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := f.users.GetUser(ctx, f.userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DeletionScheduledAt == nil || !u.DeletionScheduledAt.Equal(at) {
+		t.Errorf("deletion is scheduled at %v, want %v", u.DeletionScheduledAt, at)
+	}
+	if u.IsActive || u.DeactivatedBy != user.DeactivatedBySelf {
+		t.Errorf("active=%v deactivatedBy=%q, want deactivated by the user", u.IsActive, u.DeactivatedBy)
+	}
+
+	// The owner can still change their mind
+	if err := f.users.Reactivate(ctx, f.userID); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ = f.users.GetUser(ctx, f.userID); !u.IsActive || u.DeletionScheduledAt != nil {
+		t.Errorf("reactivation left active=%v deletionScheduledAt=%v", u.IsActive, u.DeletionScheduledAt)
+	}
+}
+
+func TestDeleteIfDue(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare runs after the user was found due for deletion
+		prepare     func(ctx context.Context, f *fixture) error
+		wantDeleted bool
+		wantExists  bool
+	}{
+		{name: "due", wantDeleted: true},
+		{
+			name:       "reactivated meanwhile",
+			wantExists: true,
+			prepare: func(ctx context.Context, f *fixture) error {
+				return f.users.Reactivate(ctx, f.userID)
+			},
+		},
+		{
+			name:       "rescheduled meanwhile",
+			wantExists: true,
+			prepare: func(ctx context.Context, f *fixture) error {
+				return f.users.ScheduleDeletion(ctx, f.userID, time.Now().Add(time.Hour))
+			},
+		},
+		{
+			name: "deleted by another run",
+			prepare: func(ctx context.Context, f *fixture) error {
+				return f.accounts.Delete(ctx, f.userID)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t, false, false)
+			if err := f.users.ScheduleDeletion(ctx, f.userID, time.Now().Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			due, err := f.users.DueForDeletion(ctx, now)
+			if err != nil || len(due) != 1 {
+				t.Fatalf("got %d users due, %v, want 1", len(due), err)
+			}
+			if tt.prepare != nil {
+				if err := tt.prepare(ctx, f); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			deleted, _ := f.accounts.deleteIfDue(ctx, f.userID, now)
+			if deleted != tt.wantDeleted {
+				t.Errorf("deleted=%v, want %v", deleted, tt.wantDeleted)
+			}
+			if _, err := f.users.GetUser(ctx, f.userID); (err == nil) != tt.wantExists {
+				t.Errorf("user exists=%v, want %v", err == nil, tt.wantExists)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"sanctor/internal/account"
+	"sanctor/internal/auth"
+	"sanctor/internal/authctx"
+	"sanctor/internal/group"
+	"sanctor/internal/post"
+	"sanctor/internal/user"
+)
+
+// Handler serves the /api/admin routes. Role checks happen in middleware;
+// every action is logged with the acting user for auditing.
+type Handler struct {
+	users    *user.Service
+	auth     *auth.Service
+	posts    *post.Service
+	groups   *group.Service
+	accounts *account.Service
+}
+
+// NewHandler creates a new admin handler
+func NewHandler(users *user.Service, authService *auth.Service, posts *post.Service, groups *group.Service, accounts *account.Service) *Handler {
+	return &Handler{
+		users:    users,
+		auth:     authService,
+		posts:    posts,
+		groups:   groups,
+		accounts: accounts,
+	}
+}
+
+// UserRequest identifies the user an admin action applies to
+type UserRequest struct {
+	UserID string `json:"userId"`
+}
+
+// RoleRequest changes a user's site-wide role
+type RoleRequest struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"`
+}
+
+// UserList is one page of users
+type UserList struct {
+	Users []*user.AdminUser `json:"users"`
+	Total int               `json:"total"`
+}
+
+// ListUsers lists and searches users. Query parameters: q, limit, offset.
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	users, total, err := h.users.SearchUsers(r.Context(), query.Get("q"), limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	list := &UserList{Users: make([]*user.AdminUser, 0, len(users)), Total: total}
+	for _, u := range users {
+		list.Users = append(list.Users, u.ToAdminUser())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// DeactivateUser deactivates an account, hides its posts and signs it out everywhere
+func (h *Handler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.withUser(w, r, func(actorID, userID string) error {
+		if actorID == userID {
+			return errors.New("you cannot deactivate your own account")
+		}
+		if err := h.accounts.DeactivateByAdmin(r.Context(), userID); err != nil {
+			return err
+		}
+		log.Printf("🛡️  Admin %s deactivated user %s", actorID, userID)
+		return nil
+	})
+}
+
+// ActivateUser reactivates a deactivated account. An account its owner
+// scheduled for deletion stays deactivated until the owner reactivates it.
+func (h *Handler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	h.withUser(w, r, func(actorID, userID string) error {
+		if err := h.users.SetActive(r.Context(), userID, true); err != nil {
+			return err
+		}
+		u, err := h.users.GetUser(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if !u.IsActive {
+			log.Printf("🛡️  Admin %s lifted the block on user %s, who remains scheduled for deletion", actorID, userID)
+			return nil
+		}
+		if err := h.posts.SetUserPostsHidden(r.Context(), userID, false); err != nil {
+			return err
+		}
+		log.Printf("🛡️  Admin %s reactivated user %s", actorID, userID)
+		return nil
+	})
+}
+
+// VerifyUser marks a user's email address as verified
+func (h *Handler) VerifyUser(w http.ResponseWriter, r *http.Request) {
+	h.withUser(w, r, func(actorID, userID string) error {
+		u, err := h.users.GetUser(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if err := h.users.MarkEmailVerified(r.Context(), userID, u.Email); err != nil {
+			return err
+		}
+		log.Printf("🛡️  Admin %s force-verified user %s", actorID, userID)
+		return nil
+	})
+}
+
+// SetRole changes a user's site-wide role. The user's sessions are revoked
+// so that new tokens carry the new role.
+func (h *Handler) SetRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("userId is required"))
+		return
+	}
+	if req.UserID == actorID {
+		writeError(w, http.StatusBadRequest, errors.New("you cannot change your own role"))
+		return
+	}
+
+	if err := h.users.SetRole(r.Context(), req.UserID, req.Role); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.auth.RevokeAllSessions(r.Context(), req.UserID, ""); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("🛡️  Admin %s set role of user %s to %s", actorID, req.UserID, req.Role)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeletePost deletes any post
+func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	h.withID(w, r, func(actorID, id string) error {
+		if err := h.posts.RemovePost(r.Context(), id); err != nil {
+			return err
+		}
+		log.Printf("🛡️  Moderator %s deleted post %s", actorID, id)
+		return nil
+	})
+}
+
+// DeleteGroup deletes any group
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	h.withID(w, r, func(actorID, id string) error {
+		if err := h.groups.RemoveGroup(r.Context(), id); err != nil {
+			return err
+		}
+		log.Printf("🛡️  Moderator %s deleted group %s", actorID, id)
+		return nil
+	})
+}
+
+// withUser decodes a UserRequest and runs an action on that user
+func (h *Handler) withUser(w http.ResponseWriter, r *http.Request, action func(actorID, userID string) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("userId is required"))
+		return
+	}
+
+	if err := action(actorID, req.UserID); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withID runs a delete action on the resource named by the id query parameter
+func (h *Handler) withID(w http.ResponseWriter, r *http.Request, action func(actorID, id string) error) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(actorID, id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, post.ErrPostNotFound) || errors.Is(err, group.ErrGroupNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
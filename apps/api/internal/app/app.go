@@ -0,0 +1,392 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"sanctor/internal/account"
+	"sanctor/internal/auth"
+	"sanctor/internal/config"
+	"sanctor/internal/database"
+	"sanctor/internal/digestion"
+	"sanctor/internal/featureflag"
+	"sanctor/internal/group"
+	"sanctor/internal/mail"
+	"sanctor/internal/oidc"
+	"sanctor/internal/passwordpolicy"
+	"sanctor/internal/post"
+	"sanctor/internal/pubsub"
+	"sanctor/internal/university"
+	"sanctor/internal/user"
+	"sanctor/internal/webauthn"
+	"sanctor/migrations"
+)
+
+// App is the composition root: every repository and service is built once
+// from the configuration and shared by the handlers that need it
+type App struct {
+	Config       *config.Config
+	DB           *database.DB // nil when data is kept in memory
+	Mailer       mail.Sender
+	Universities *university.Registry
+	Users        *user.Service
+	Groups       *group.Service
+	Messaging    *group.Messaging
+	Posts        *post.Service
+	Auth         *auth.Service
+	Accounts     *account.Service
+	Flags        *featureflag.Store
+
+	cron *digestion.Cron
+}
+
+// New builds the application from cfg. A non-nil mailer replaces the sender
+// configured in cfg.Mail, so embedders can capture outgoing email.
+func New(cfg *config.Config, mailer mail.Sender) (*App, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	// Load token signing keys first: a misconfigured production server must not start
+	keys, err := auth.LoadKeys(keyConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+
+	hasher, err := passwordHasher(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure password hashing: %w", err)
+	}
+	policy, err := passwordPolicy(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure password policy: %w", err)
+	}
+
+	a := &App{Config: cfg, Mailer: mailer}
+	if a.Mailer == nil {
+		if a.Mailer, err = mail.New(mailConfig(cfg.Mail)); err != nil {
+			return nil, fmt.Errorf("failed to configure mail delivery: %w", err)
+		}
+	}
+
+	if cfg.University.RegistryFile != "" {
+		a.Universities, err = university.LoadFile(cfg.University.RegistryFile)
+		log.Printf("✅ Loading university registry from %s", cfg.University.RegistryFile)
+	} else {
+		a.Universities, err = university.Default()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load university registry: %w", err)
+	}
+
+	if a.DB, err = openDatabase(cfg.Database); err != nil {
+		return nil, err
+	}
+
+	// Repositories: Postgres when a database is connected, in memory otherwise
+	var (
+		userRepo  user.Repository
+		groupRepo group.Repository
+		authRepo  auth.Repository
+		tx        database.Transactor
+	)
+	if a.DB != nil {
+		tx = a.DB
+		userRepo = user.NewPostgresRepository(a.DB)
+		groupRepo = group.NewPostgresRepository(a.DB)
+		authRepo = auth.NewPostgresRepository(a.DB)
+		a.Posts = post.NewServiceWithGorm(post.NewGormRepository(a.DB), tx)
+	} else {
+		tx = database.NewMemoryTransactor()
+		userRepo = user.NewRepository()
+		groupRepo = group.NewRepository()
+		authRepo = auth.NewRepository()
+		a.Posts = post.NewService(post.NewRepository(), tx)
+	}
+
+	a.Users = user.NewService(userRepo, tx)
+	a.Users.SetPasswordHasher(hasher)
+	a.Users.SetPasswordPolicy(policy)
+	a.Groups = group.NewService(groupRepo, tx)
+	a.Messaging = group.NewMessaging(pubsub.NewPubSub(), a.Groups)
+	a.Auth = auth.NewService(authRepo, tx, a.Users, a.Mailer, a.Universities, auth.Config{
+		AppURL:          cfg.Server.AppURL,
+		AccessTokenTTL:  time.Duration(cfg.Auth.TokenExpiry) * time.Hour,
+		RefreshTokenTTL: time.Duration(cfg.Auth.RefreshExpiry) * 24 * time.Hour,
+		Keys:            keys,
+	})
+	a.Auth.SetBootstrapAdmins(cfg.Auth.AdminEmails)
+	a.Users.SetEmailChangeHook(a.Auth.EmailChanged)
+
+	for _, providerConfig := range cfg.OIDC.Providers {
+		provider, err := oidc.NewProvider(oidc.Config{
+			Name:         providerConfig.Name,
+			DisplayName:  providerConfig.DisplayName,
+			Issuer:       providerConfig.Issuer,
+			ClientID:     providerConfig.ClientID,
+			ClientSecret: providerConfig.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       providerConfig.Scopes,
+		}, nil)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("failed to configure login providers: %w", err)
+		}
+		a.Auth.AddOIDCProvider(provider)
+		log.Printf("✅ Login provider %s enabled", provider.Name())
+	}
+
+	relyingParty, err := relyingParty(cfg.WebAuthn)
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to configure passkeys: %w", err)
+	}
+	if relyingParty != nil {
+		a.Auth.SetRelyingParty(relyingParty)
+		log.Printf("✅ Passkeys enabled for %s", relyingParty.ID)
+	}
+
+	a.Flags = a.featureFlags(cfg)
+
+	// Account lifecycle - deletion is scheduled and carried out by the cron
+	a.Accounts = account.NewService(a.Users, a.Auth, a.Posts, a.Groups, tx)
+	a.Auth.SetReactivationHook(a.Accounts.Reactivated)
+	a.cron = digestion.NewCron()
+	a.cron.Register("account deletions", a.Accounts.ProcessDeletions)
+	a.cron.Start()
+
+	return a, nil
+}
+
+// Close stops background jobs and closes the database connection
+func (a *App) Close() error {
+	if a.cron != nil {
+		a.cron.Stop()
+	}
+	if a.Flags != nil {
+		a.Flags.Close()
+	}
+	if a.DB != nil {
+		return a.DB.Close()
+	}
+	return nil
+}
+
+// ErrNoDatabase is returned by ConnectDatabase when no database is configured
+var ErrNoDatabase = errors.New("no database configured: set DATABASE_URL or DB_HOST")
+
+// ConnectDatabase connects to the configured database
+func ConnectDatabase(cfg config.DatabaseConfig) (*database.DB, error) {
+	pool := database.PoolConfig{
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.ConnMaxLifetime) * time.Minute,
+	}
+
+	var db *database.DB
+	var err error
+	switch {
+	case cfg.URL != "":
+		log.Println("Connecting to database...")
+		db, err = database.NewFromURL(cfg.URL, pool)
+	case cfg.Host != "":
+		log.Printf("Connecting to database at %s...", cfg.Host)
+		db, err = database.New(database.Config{
+			Host:     cfg.Host,
+			Port:     strconv.Itoa(cfg.Port),
+			User:     cfg.User,
+			Password: cfg.Password,
+			DBName:   cfg.DBName,
+			SSLMode:  cfg.SSLMode,
+			Pool:     pool,
+		})
+	default:
+		return nil, ErrNoDatabase
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetTimeouts(database.Timeouts{
+		Read:        time.Duration(cfg.ReadTimeout) * time.Second,
+		Write:       time.Duration(cfg.WriteTimeout) * time.Second,
+		Transaction: time.Duration(cfg.TransactionTimeout) * time.Second,
+	})
+	return db, nil
+}
+
+// NewMigrator returns a migrator for the migrations bundled with the API
+func NewMigrator(db *database.DB) (*database.Migrator, error) {
+	return database.NewMigrator(db, migrations.FS)
+}
+
+// openDatabase connects to the configured database and, unless disabled,
+// applies pending migrations. It returns nil, and data is kept in memory,
+// when no database is configured or the connection fails. Migrations that
+// cannot be loaded or applied stop startup rather than leave the API
+// running against a schema it does not expect.
+func openDatabase(cfg config.DatabaseConfig) (*database.DB, error) {
+	db, err := ConnectDatabase(cfg)
+	if errors.Is(err, ErrNoDatabase) {
+		log.Println("⚠️  No database configured, using in-memory storage")
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to connect to database: %v", err)
+		log.Println("⚠️  Falling back to in-memory storage")
+		return nil, nil
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	ctx := context.Background()
+	if cfg.MigrateOnStart {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		if len(applied) > 0 {
+			log.Printf("✅ Applied %d database migrations", len(applied))
+		}
+	} else if statuses, err := migrator.Status(ctx); err == nil {
+		pending := 0
+		for _, status := range statuses {
+			if status.State == database.MigrationPending {
+				pending++
+			}
+		}
+		if pending > 0 {
+			log.Printf("⚠️  %d database migrations are pending; run `migrate up`", pending)
+		}
+	}
+	log.Println("✅ Database initialized successfully")
+	return db, nil
+}
+
+// featureFlags loads the flags from the configured source and watches it for
+// changes. A source that cannot be read at startup leaves the defaults in
+// effect until it can.
+func (a *App) featureFlags(cfg *config.Config) *featureflag.Store {
+	var source featureflag.Source
+	switch cfg.Flags.Source {
+	case "file":
+		source = featureflag.NewFileSource(cfg.Flags.File)
+	case "postgres":
+		if a.DB == nil {
+			log.Println("⚠️  Feature flags need a database, using the defaults")
+			break
+		}
+		source = featureflag.NewPostgresSource(a.DB)
+	}
+
+	store := featureflag.NewStore(source, cfg.Server.Env, featureflag.Defaults)
+	store.SetResolver(a.flagSubject)
+	if err := store.Reload(context.Background()); err != nil {
+		log.Printf("⚠️  Failed to load feature flags from %s: %v", source, err)
+	}
+	store.Watch(time.Duration(cfg.Flags.ReloadInterval) * time.Second)
+	return store
+}
+
+// flagSubject describes a user for feature flag targeting
+func (a *App) flagSubject(ctx context.Context, userID string) featureflag.Subject {
+	subject := featureflag.Subject{UserID: userID}
+	u, err := a.Users.GetUser(ctx, userID)
+	if err != nil || !u.IsUniversityVerified() {
+		return subject
+	}
+	if university, ok := a.Universities.LookupEmail(u.UniversityEmail); ok {
+		subject.University = university.ID
+	}
+	return subject
+}
+
+// keyConfig picks the token signing keys out of the configuration
+func keyConfig(cfg *config.Config) auth.KeyConfig {
+	return auth.KeyConfig{
+		Env:              cfg.Server.Env,
+		Secret:           cfg.Auth.JWTSecret,
+		SigningKeyFile:   cfg.Auth.SigningKeyFile,
+		SigningKeyID:     cfg.Auth.SigningKeyID,
+		VerificationKeys: cfg.Auth.VerificationKeys,
+		Issuer:           cfg.Auth.Issuer,
+		Audience:         cfg.Auth.Audience,
+	}
+}
+
+// mailConfig converts the mail settings for the mail package
+func mailConfig(cfg config.MailConfig) mail.Config {
+	return mail.Config{
+		Driver:       cfg.Driver,
+		From:         cfg.From,
+		OutboxDir:    cfg.OutboxDir,
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUser:     cfg.SMTPUser,
+		SMTPPassword: cfg.SMTPPassword,
+	}
+}
+
+// passwordHasher builds the configured password hashing algorithm
+func passwordHasher(cfg config.PasswordConfig) (user.PasswordHasher, error) {
+	switch cfg.Hasher {
+	case "argon2id":
+		params := user.DefaultArgon2idParams
+		params.Memory = uint32(cfg.Argon2Memory)
+		params.Iterations = uint32(cfg.Argon2Iterations)
+		params.Parallelism = uint8(cfg.Argon2Parallelism)
+		return user.NewArgon2idHasher(params), nil
+	case "bcrypt":
+		return user.NewBcryptHasher(cfg.BcryptCost)
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", cfg.Hasher)
+	}
+}
+
+// passwordPolicy builds the rules new passwords are checked against
+func passwordPolicy(cfg config.PasswordConfig) (*passwordpolicy.Policy, error) {
+	policy := passwordpolicy.Default()
+	policy.MinLength = cfg.MinLength
+	policy.MaxLength = cfg.MaxLength
+	policy.MinScore = cfg.MinStrength
+	for _, rule := range cfg.Require {
+		switch rule {
+		case "uppercase":
+			policy.RequireUpper = true
+		case "lowercase":
+			policy.RequireLower = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		default:
+			return nil, fmt.Errorf("unknown password rule %q", rule)
+		}
+	}
+
+	if cfg.BreachedFile != "" {
+		list, err := passwordpolicy.LoadBreachFile(cfg.BreachedFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Loaded %d breached password hashes from %s", list.Len(), cfg.BreachedFile)
+		policy.Breached = list
+	}
+	return policy, nil
+}
+
+// relyingParty builds the passkey relying party. It returns nil when none
+// is configured, leaving passkeys scoped to the web app's URL.
+func relyingParty(cfg config.WebAuthnConfig) (*webauthn.RelyingParty, error) {
+	if cfg.RPID == "" {
+		return nil, nil
+	}
+	return webauthn.NewRelyingParty(cfg.RPID, cfg.RPName, cfg.Origins)
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"sanctor/internal/account"
+	"sanctor/internal/admin"
+	"sanctor/internal/auth"
+	"sanctor/internal/featureflag"
+	"sanctor/internal/group"
+	"sanctor/internal/middleware"
+	"sanctor/internal/post"
+	"sanctor/internal/university"
+	"sanctor/internal/user"
+)
+
+// Response is the body of the health check
+type Response struct {
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+func enableCORS(w *http.ResponseWriter) {
+	(*w).Header().Set("Access-Control-Allow-Origin", "*")
+	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+	w.Header().Set("Content-Type", "application/json")
+
+	response := Response{
+		Message: "Sanctor API is running",
+		Status:  "healthy",
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// Routes returns the API's HTTP handler, with every route bound to the
+// application's shared services
+func (a *App) Routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// Health check endpoints
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/api/health", healthHandler)
+
+	authn := middleware.NewAuthenticator(a.Auth)
+
+	// scoped protects a route with a session token or an API key granted scope
+	scoped := func(scope string, h http.HandlerFunc) http.Handler {
+		return authn.AuthenticateScoped(scope)(h)
+	}
+
+	// readable opens a route to everyone; API keys need scope to read it
+	readable := func(scope string, h http.HandlerFunc) http.Handler {
+		return authn.AuthenticateOptional(scope)(h)
+	}
+
+	// Optionally restrict posting and messaging to users with a verified email
+	requireVerified := scoped
+	if a.Config.Auth.RequireVerifiedEmail {
+		verified := middleware.RequireVerified(a.Users)
+		requireVerified = func(scope string, h http.HandlerFunc) http.Handler {
+			return authn.AuthenticateScoped(scope)(verified(h))
+		}
+		log.Println("Posting and group messaging require a verified email")
+	}
+
+	// User endpoints (mutating routes require a bearer token)
+	userHandler := user.NewHandler(a.Users)
+	mux.Handle("/api/users", readable(auth.ScopeUsersRead, userHandler.GetUsers))
+	mux.Handle("/api/users/get", readable(auth.ScopeUsersRead, userHandler.GetUser))
+	mux.Handle("/api/users/update", scoped(auth.ScopeUsersWrite, userHandler.UpdateUser))
+
+	// Group endpoints (mutating routes require a bearer token)
+	groupHandler := group.NewHandler(a.Groups, a.Messaging)
+	mux.Handle("/api/groups", readable(auth.ScopeGroupsRead, groupHandler.GetGroups))
+	mux.Handle("/api/groups/get", readable(auth.ScopeGroupsRead, groupHandler.GetGroup))
+	mux.Handle("/api/groups/create", scoped(auth.ScopeGroupsWrite, groupHandler.CreateGroup))
+	mux.Handle("/api/groups/update", scoped(auth.ScopeGroupsWrite, groupHandler.UpdateGroup))
+	mux.Handle("/api/groups/delete", scoped(auth.ScopeGroupsWrite, groupHandler.DeleteGroup))
+
+	// Group membership endpoints
+	mux.Handle("/api/groups/members/add", scoped(auth.ScopeGroupsWrite, groupHandler.AddUserToGroup))
+	mux.Handle("/api/groups/members/remove", scoped(auth.ScopeGroupsWrite, groupHandler.RemoveUserFromGroup))
+	mux.Handle("/api/groups/members", readable(auth.ScopeGroupsRead, groupHandler.GetGroupMembers))
+	mux.Handle("/api/users/groups", readable(auth.ScopeGroupsRead, groupHandler.GetUserGroups))
+
+	// Group messaging endpoints
+	groupMessaging := a.Flags.Require(featureflag.GroupMessaging)
+	mux.Handle("/api/groups/messages/send", requireVerified(auth.ScopeGroupsWrite, groupMessaging(http.HandlerFunc(groupHandler.SendGroupMessage)).ServeHTTP))
+
+	// Post endpoints
+	postHandler := post.NewHandler(a.Posts)
+	mux.Handle("/api/posts", readable(auth.ScopePostsRead, postHandler.GetPosts))
+	mux.Handle("/api/posts/get", readable(auth.ScopePostsRead, postHandler.GetPost))
+	mux.Handle("/api/posts/create", requireVerified(auth.ScopePostsWrite, postHandler.CreatePost))
+	mux.Handle("/api/posts/update", scoped(auth.ScopePostsWrite, postHandler.UpdatePost))
+	mux.Handle("/api/posts/delete", scoped(auth.ScopePostsWrite, postHandler.DeletePost))
+
+	// Post application endpoints
+	mux.Handle("/api/posts/applications", scoped(auth.ScopePostsRead, postHandler.ListApplications))
+	mux.Handle("/api/posts/applications/create", requireVerified(auth.ScopePostsWrite, postHandler.Apply))
+	mux.Handle("/api/posts/applications/accept", scoped(auth.ScopePostsWrite, postHandler.AcceptApplication))
+	mux.Handle("/api/posts/applications/reject", scoped(auth.ScopePostsWrite, postHandler.RejectApplication))
+
+	mux.HandleFunc("/api/universities", university.NewHandler(a.Universities).ListUniversities)
+
+	// Auth endpoints
+	authHandler := auth.NewHandler(a.Auth)
+	mux.HandleFunc("/.well-known/jwks.json", authHandler.JWKS)
+	mux.HandleFunc("/api/auth/register", authHandler.Register)
+	mux.HandleFunc("/api/auth/login", authHandler.Login)
+	mux.HandleFunc("/api/auth/login/2fa", authHandler.LoginTwoFactor)
+	mux.HandleFunc("/api/auth/magic-link", authHandler.RequestMagicLink)
+	mux.HandleFunc("/api/auth/magic-link/verify", authHandler.MagicLinkLogin)
+	mux.HandleFunc("/api/auth/passkeys/login/start", authHandler.StartPasskeyLogin)
+	mux.HandleFunc("/api/auth/passkeys/login/finish", authHandler.FinishPasskeyLogin)
+	mux.HandleFunc("/api/auth/oidc/providers", authHandler.GetOIDCProviders)
+	mux.HandleFunc("/api/auth/oidc/login", authHandler.StartOIDCLogin)
+	mux.HandleFunc("/api/auth/oidc/callback", authHandler.OIDCCallback)
+	mux.HandleFunc("/api/auth/refresh", authHandler.Refresh)
+	mux.HandleFunc("/api/auth/password/forgot", authHandler.ForgotPassword)
+	mux.HandleFunc("/api/auth/password/reset", authHandler.ResetPassword)
+	mux.Handle("/api/users/password", authn.AuthenticateFunc(authHandler.ChangePassword))
+	mux.HandleFunc("/api/auth/verify-email", authHandler.VerifyEmail)
+	mux.Handle("/api/auth/verify-email/resend", authn.AuthenticateFunc(authHandler.ResendVerification))
+	mux.Handle("/api/auth/university/verify", authn.AuthenticateFunc(authHandler.StartUniversityVerification))
+	mux.HandleFunc("/api/auth/university/confirm", authHandler.ConfirmUniversityEmail)
+	mux.Handle("/api/auth/2fa/enroll", authn.AuthenticateFunc(authHandler.EnrollTwoFactor))
+	mux.Handle("/api/auth/2fa/confirm", authn.AuthenticateFunc(authHandler.ConfirmTwoFactor))
+	mux.Handle("/api/auth/2fa/disable", authn.AuthenticateFunc(authHandler.DisableTwoFactor))
+	mux.Handle("/api/auth/2fa/recovery-codes", authn.AuthenticateFunc(authHandler.RegenerateRecoveryCodes))
+	mux.Handle("/api/auth/passkeys", authn.AuthenticateFunc(authHandler.GetPasskeys))
+	mux.Handle("/api/auth/passkeys/register/start", authn.AuthenticateFunc(authHandler.StartPasskeyRegistration))
+	mux.Handle("/api/auth/passkeys/register/finish", authn.AuthenticateFunc(authHandler.FinishPasskeyRegistration))
+	mux.Handle("/api/auth/passkeys/delete", authn.AuthenticateFunc(authHandler.DeletePasskey))
+	mux.Handle("/api/auth/api-keys", authn.AuthenticateFunc(authHandler.GetAPIKeys))
+	mux.Handle("/api/auth/api-keys/create", authn.AuthenticateFunc(authHandler.CreateAPIKey))
+	mux.Handle("/api/auth/api-keys/revoke", authn.AuthenticateFunc(authHandler.RevokeAPIKey))
+	mux.Handle("/api/auth/logout", authn.AuthenticateFunc(authHandler.Logout))
+	mux.Handle("/api/auth/sessions", authn.AuthenticateFunc(authHandler.GetSessions))
+	mux.Handle("/api/auth/sessions/revoke", authn.AuthenticateFunc(authHandler.RevokeSession))
+	mux.Handle("/api/auth/sessions/revoke-all", authn.AuthenticateFunc(authHandler.RevokeAllSessions))
+	mux.Handle("/api/auth/history", authn.AuthenticateFunc(authHandler.GetLoginHistory))
+
+	// Account lifecycle
+	accountHandler := account.NewHandler(a.Accounts)
+	mux.Handle("/api/users/deactivate", authn.AuthenticateFunc(accountHandler.Deactivate))
+	mux.HandleFunc("/api/users/reactivate", accountHandler.Reactivate)
+	mux.Handle("/api/users/delete", authn.AuthenticateFunc(accountHandler.ScheduleDeletion))
+
+	// Admin endpoints - session tokens only, gated on the site-wide role
+	requireRole := func(role string, h http.HandlerFunc) http.Handler {
+		return authn.Authenticate(middleware.RequireRole(role)(h))
+	}
+	adminHandler := admin.NewHandler(a.Users, a.Auth, a.Posts, a.Groups, a.Accounts)
+	mux.Handle("/api/admin/users", requireRole(user.RoleModerator, adminHandler.ListUsers))
+	mux.Handle("/api/admin/users/deactivate", requireRole(user.RoleAdmin, adminHandler.DeactivateUser))
+	mux.Handle("/api/admin/users/activate", requireRole(user.RoleAdmin, adminHandler.ActivateUser))
+	mux.Handle("/api/admin/users/verify", requireRole(user.RoleAdmin, adminHandler.VerifyUser))
+	mux.Handle("/api/admin/users/role", requireRole(user.RoleAdmin, adminHandler.SetRole))
+	mux.Handle("/api/admin/posts/delete", requireRole(user.RoleModerator, adminHandler.DeletePost))
+	mux.Handle("/api/admin/groups/delete", requireRole(user.RoleModerator, adminHandler.DeleteGroup))
+	mux.Handle("/api/admin/auth/unlock", requireRole(user.RoleAdmin, authHandler.UnlockLogin))
+	mux.Handle("/api/admin/flags", requireRole(user.RoleAdmin, featureflag.NewHandler(a.Flags).GetFlags))
+
+	handler := middleware.Timeout(time.Duration(a.Config.Server.RequestTimeout) * time.Second)(mux)
+	return middleware.TrustProxies(a.Config.Server.TrustedProxies)(handler)
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of the short-lived tokens handed to users
+const (
+	purposeEmailVerification      = "email_verification"
+	purposeUniversityVerification = "university_verification"
+	purposeTwoFactorChallenge     = "two_factor_challenge"
+	purposeMagicLink              = "magic_link"
+)
+
+// actionClaims are carried by signed tokens that authorize one specific
+// action, such as confirming an email address. The user ID travels in the
+// standard "sub" claim rather than "userId", so an action token can never
+// pass ParseJWT as an access token.
+type actionClaims struct {
+	Purpose      string `json:"purpose"`
+	Email        string `json:"email,omitempty"`
+	UniversityID string `json:"universityId,omitempty"`
+	// Reactivate marks a two-factor challenge that reactivates the account
+	// once the code checks out
+	Reactivate bool `json:"reactivate,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// signActionToken signs claims for a single purpose, valid for ttl. The
+// user ID is taken from claims.Subject.
+func (s *Service) signActionToken(claims actionClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	return s.keys.sign(claims)
+}
+
+// parseActionToken validates a token created by signActionToken for the given purpose
+func (s *Service) parseActionToken(tokenStr, purpose string) (*actionClaims, error) {
+	claims := &actionClaims{}
+	if err := s.keys.parse(tokenStr, claims); err != nil || claims.Purpose != purpose || claims.Subject == "" {
+		return nil, errors.New("invalid or expired token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrAlreadyVerified          = errors.New("email address is already verified")
+	ErrInvalidResetToken        = errors.New("invalid or expired password reset token")
+	ErrNotUniversityEmail       = errors.New("email address is not on one of the university's domains")
+	ErrTwoFactorNotFound        = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorEnabled         = errors.New("two-factor authentication is already enabled")
+	ErrInvalidTwoFactorCode     = errors.New("invalid two-factor code")
+	ErrInvalidChallenge         = errors.New("invalid or expired login challenge")
+	ErrUnknownProvider          = errors.New("unknown login provider")
+	ErrIdentityNotFound         = errors.New("identity not linked")
+	ErrInvalidOIDCState         = errors.New("invalid or expired login attempt, please try again")
+	ErrEmailNotVerified         = errors.New("the provider did not confirm your email address")
+	ErrOIDCProvider             = errors.New("the login provider could not confirm who you are")
+	ErrInvalidCredentials       = errors.New("invalid email or password")
+	ErrCredentialsRequired      = errors.New("email and password are required")
+	ErrAccountDisabled          = errors.New("this account has been deactivated")
+	ErrLoginAttemptNotFound     = errors.New("no failed login attempts recorded")
+	ErrAPIKeyNotFound           = errors.New("API key not found")
+	ErrInvalidAPIKey            = errors.New("invalid, expired or revoked API key")
+	ErrInvalidScope             = errors.New("unknown scope")
+	ErrTooManyAPIKeys           = errors.New("too many active API keys, revoke one first")
+	ErrInvalidMagicLink         = errors.New("invalid or expired sign-in link")
+	ErrMagicLinkBrowser         = errors.New("open the sign-in link in the browser you requested it from")
+	ErrPasskeyNotFound          = errors.New("passkey not found")
+	ErrPasskeyExists            = errors.New("this passkey is already registered")
+	ErrInvalidPasskey           = errors.New("passkey sign-in failed, please try again")
+	ErrInvalidPasskeyCeremony   = errors.New("invalid or expired passkey request, please try again")
+	ErrTooManyPasskeys          = errors.New("too many passkeys, remove one first")
+	ErrPasskeysUnavailable      = errors.New("passkeys are not available on this server")
+)
+
+// ThrottleError reports that an action was attempted too often
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("too many requests, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
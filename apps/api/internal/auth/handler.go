@@ -2,7 +2,18 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"sanctor/internal/authctx"
+	"sanctor/internal/passwordpolicy"
+	"sanctor/internal/university"
+	"sanctor/internal/user"
 )
 
 // Handler handles HTTP requests for authentication
@@ -27,12 +38,31 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	req.ClientInfo = RequestClientInfo(r)
 
-	resp, err := h.service.Login(req)
+	resp, err := h.service.Login(r.Context(), req)
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		var throttled *ThrottleError
+		if errors.As(err, &throttled) {
+			writeThrottled(w, throttled)
+			return
+		}
+		switch {
+		case errors.Is(err, ErrAccountDisabled):
+			writeError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrCredentialsRequired):
+			writeError(w, http.StatusBadRequest, err)
+		case errors.Is(err, ErrInvalidCredentials),
+			errors.Is(err, ErrInvalidTwoFactorCode),
+			errors.Is(err, ErrInvalidChallenge):
+			writeError(w, http.StatusUnauthorized, err)
+		default:
+			// A storage or signing failure is not the caller's fault and its
+			// detail is not theirs to see
+			log.Printf("⚠️  Login failed: %v", err)
+			writeError(w, http.StatusInternalServerError, errors.New("login failed, please try again later"))
+		}
 		return
 	}
 	json.NewEncoder(w).Encode(resp)
@@ -50,13 +80,1023 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	req.ClientInfo = RequestClientInfo(r)
+
+	resp, err := h.service.Register(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ClientInfo = RequestClientInfo(r)
 
-	resp, err := h.service.Register(req)
+	resp, err := h.service.Refresh(r.Context(), req)
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 	json.NewEncoder(w).Encode(resp)
 }
+
+// Logout revokes the caller's current session
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, ok := authctx.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	if err := h.service.Logout(r.Context(), identity.SessionID); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSessions lists the caller's active sessions
+func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, ok := authctx.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	sessions, err := h.service.ListSessions(r.Context(), identity.UserID, identity.SessionID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// GetLoginHistory lists the caller's recent sign-in attempts. Query parameter: limit.
+func (h *Handler) GetLoginHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := h.service.GetLoginHistory(r.Context(), userID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// RevokeSession revokes one of the caller's sessions
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, ok := authctx.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeSession(r.Context(), identity.UserID, id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions signs the caller out of every session. Pass
+// keepCurrent=true to stay signed in on the current device.
+func (h *Handler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, ok := authctx.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	exceptSessionID := ""
+	if r.URL.Query().Get("keepCurrent") == "true" {
+		exceptSessionID = identity.SessionID
+	}
+	if err := h.service.RevokeAllSessions(r.Context(), identity.UserID, exceptSessionID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateAPIKey issues a new API key for the caller. The key is only shown
+// in this response.
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(r.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, ErrTooManyAPIKeys) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// GetAPIKeys lists the caller's active API keys
+func (h *Handler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	keys, err := h.service.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey revokes one of the caller's API keys
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "API key ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeAPIKey(r.Context(), userID, id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartPasskeyRegistration returns the options for adding a passkey to the
+// caller's account once they confirm their password and two-factor code
+func (h *Handler) StartPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req StartPasskeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ceremony, err := h.service.StartPasskeyRegistration(r.Context(), userID, req)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ceremony)
+}
+
+// FinishPasskeyRegistration stores the passkey the caller's authenticator created
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req PasskeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	passkey, err := h.service.FinishPasskeyRegistration(r.Context(), userID, req)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(passkey)
+}
+
+// GetPasskeys lists the caller's passkeys
+func (h *Handler) GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	passkeys, err := h.service.ListPasskeys(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(passkeys)
+}
+
+// DeletePasskey removes one of the caller's passkeys
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Passkey ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeletePasskey(r.Context(), userID, id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartPasskeyLogin returns the options for signing in with a passkey
+func (h *Handler) StartPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ceremony, err := h.service.StartPasskeyLogin(r.Context())
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ceremony)
+}
+
+// FinishPasskeyLogin exchanges a passkey assertion for tokens
+func (h *Handler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ClientInfo = RequestClientInfo(r)
+
+	resp, err := h.service.FinishPasskeyLogin(r.Context(), req)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writePasskeyError maps passkey errors to status codes
+func writePasskeyError(w http.ResponseWriter, err error) {
+	var throttled *ThrottleError
+	switch {
+	case errors.As(err, &throttled):
+		writeThrottled(w, throttled)
+	case errors.Is(err, ErrInvalidPasskey), errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrInvalidTwoFactorCode):
+		writeError(w, http.StatusUnauthorized, err)
+	case errors.Is(err, ErrAccountDisabled):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, ErrPasskeyExists), errors.Is(err, ErrTooManyPasskeys):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, ErrPasskeysUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+// VerifyEmail confirms a user's email address with a token from a verification email
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), req.Token); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email address verified"})
+}
+
+// ResendVerification sends the caller a new verification email
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	if err := h.service.ResendVerification(r.Context(), userID); err != nil {
+		var throttled *ThrottleError
+		switch {
+		case errors.As(err, &throttled):
+			writeThrottled(w, throttled)
+		case errors.Is(err, ErrAlreadyVerified):
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the address belongs to an account.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.service.ForgotPassword(r.Context(), req)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account exists for that address, a password reset link has been sent",
+	})
+}
+
+// magicLinkBindingCookie ties a sign-in link to the browser that requested it
+const magicLinkBindingCookie = "sanctor_magic_link"
+
+// RequestMagicLink emails a passwordless sign-in link. The response is the
+// same whether or not an account exists for the address.
+func (h *Handler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.BindToBrowser {
+		binding, err := generateToken()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		req.Binding = binding
+		http.SetCookie(w, &http.Cookie{
+			Name:     magicLinkBindingCookie,
+			Value:    binding,
+			Path:     "/api/auth/magic-link",
+			MaxAge:   int(magicLinkTTL / time.Second),
+			HttpOnly: true,
+			Secure:   isHTTPS(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	h.service.RequestMagicLink(r.Context(), req)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account exists for that address, a sign-in link has been sent",
+	})
+}
+
+// MagicLinkLogin exchanges the token from a sign-in link for a token pair
+func (h *Handler) MagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MagicLinkLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ClientInfo = RequestClientInfo(r)
+	if cookie, err := r.Cookie(magicLinkBindingCookie); err == nil {
+		req.Binding = cookie.Value
+	}
+
+	resp, err := h.service.LoginWithMagicLink(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMagicLinkBrowser):
+			writeError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrAccountDisabled):
+			writeError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrInvalidMagicLink):
+			writeError(w, http.StatusUnauthorized, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkBindingCookie,
+		Path:     "/api/auth/magic-link",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ResetPassword sets a new password with a token from a reset email
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset, please log in again"})
+}
+
+// ChangePassword changes the caller's password and signs out their other sessions
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, ok := authctx.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ChangePassword(r.Context(), identity.UserID, identity.SessionID, req); err != nil {
+		var throttled *ThrottleError
+		if errors.As(err, &throttled) {
+			writeThrottled(w, throttled)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed, your other sessions have been signed out"})
+}
+
+// LoginTwoFactor exchanges a login challenge token and a second factor code
+// for a token pair
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ClientInfo = RequestClientInfo(r)
+
+	resp, err := h.service.VerifyTwoFactorLogin(r.Context(), req)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// EnrollTwoFactor starts TOTP setup and returns the secret and provisioning URI
+func (h *Handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	enrollment, err := h.service.EnrollTwoFactor(r.Context(), userID)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// ConfirmTwoFactor enables 2FA with a first code from the authenticator and
+// returns the recovery codes
+func (h *Handler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.withTwoFactorCode(w, r, func(userID, code string) (interface{}, error) {
+		codes, err := h.service.ConfirmTwoFactor(r.Context(), userID, code)
+		if err != nil {
+			return nil, err
+		}
+		return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+	})
+}
+
+// DisableTwoFactor turns 2FA off
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.withTwoFactorCode(w, r, func(userID, code string) (interface{}, error) {
+		return nil, h.service.DisableTwoFactor(r.Context(), userID, code)
+	})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.withTwoFactorCode(w, r, func(userID, code string) (interface{}, error) {
+		codes, err := h.service.RegenerateRecoveryCodes(r.Context(), userID, code)
+		if err != nil {
+			return nil, err
+		}
+		return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+	})
+}
+
+// withTwoFactorCode decodes a TwoFactorCodeRequest for the authenticated
+// caller and writes the result of fn, or 204 when it returns nothing
+func (h *Handler) withTwoFactorCode(w http.ResponseWriter, r *http.Request, fn func(userID, code string) (interface{}, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := fn(userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeTwoFactorError maps two-factor errors to status codes
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	var throttled *ThrottleError
+	switch {
+	case errors.As(err, &throttled):
+		writeThrottled(w, throttled)
+	case errors.Is(err, ErrInvalidTwoFactorCode), errors.Is(err, ErrInvalidChallenge):
+		writeError(w, http.StatusUnauthorized, err)
+	case errors.Is(err, ErrAccountDisabled):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, ErrTwoFactorEnabled):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, ErrTwoFactorNotFound):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// oidcBindingCookie ties a provider login to the browser that started it
+const oidcBindingCookie = "sanctor_oidc"
+
+// GetOIDCProviders lists the external login providers
+func (h *Handler) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.service.OIDCProviders())
+}
+
+// StartOIDCLogin redirects the browser to an external provider's login page
+func (h *Handler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authURL, binding, err := h.service.StartOIDCLogin(r.Context(), r.URL.Query().Get("provider"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    binding,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidcLoginTTL / time.Second),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback is where providers send the browser back to. It finishes the
+// login and hands the result to the web app in the URL fragment, which
+// browsers never send to servers.
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Path:     "/api/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := r.URL.Query()
+	result := url.Values{}
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("⚠️  Login provider returned an error: %q", providerError)
+		result.Set("error", oidcErrorProvider)
+		http.Redirect(w, r, h.service.appURL+"/auth/callback#"+result.Encode(), http.StatusFound)
+		return
+	}
+
+	req := OIDCCallbackRequest{
+		State:      query.Get("state"),
+		Code:       query.Get("code"),
+		ClientInfo: RequestClientInfo(r),
+	}
+	if cookie, err := r.Cookie(oidcBindingCookie); err == nil {
+		req.Binding = cookie.Value
+	}
+
+	resp, err := h.service.CompleteOIDCLogin(r.Context(), req)
+	switch {
+	case err != nil:
+		code := oidcErrorCode(err)
+		log.Printf("⚠️  Provider login failed (%s): %v", code, err)
+		result.Set("error", code)
+	case resp.TwoFactorRequired:
+		result.Set("twoFactorRequired", "true")
+		result.Set("challengeToken", resp.ChallengeToken)
+	default:
+		result.Set("token", resp.Token)
+		result.Set("refreshToken", resp.RefreshToken)
+		result.Set("expiresAt", resp.ExpiresAt)
+	}
+	http.Redirect(w, r, h.service.appURL+"/auth/callback#"+result.Encode(), http.StatusFound)
+}
+
+// Error codes OIDCCallback hands the app in the redirect fragment. The
+// details stay in the server log, since the fragment ends up in the
+// browser history.
+const (
+	oidcErrorInvalidState    = "invalid_state"
+	oidcErrorProvider        = "provider_error"
+	oidcErrorAccountDisabled = "account_disabled"
+	oidcErrorServer          = "server_error"
+)
+
+// oidcErrorCode maps a failed provider login to the code reported to the app
+func oidcErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidOIDCState):
+		return oidcErrorInvalidState
+	case errors.Is(err, ErrOIDCProvider), errors.Is(err, ErrUnknownProvider), errors.Is(err, ErrEmailNotVerified):
+		return oidcErrorProvider
+	case errors.Is(err, ErrAccountDisabled):
+		return oidcErrorAccountDisabled
+	default:
+		return oidcErrorServer
+	}
+}
+
+// StartUniversityVerification sends a confirmation link to the caller's
+// university email address
+func (h *Handler) StartUniversityVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+
+	var req UniversityVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.StartUniversityVerification(r.Context(), userID, req); err != nil {
+		var throttled *ThrottleError
+		switch {
+		case errors.As(err, &throttled):
+			writeThrottled(w, throttled)
+		case errors.Is(err, university.ErrUnknownUniversity):
+			writeError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrNotUniversityEmail):
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConfirmUniversityEmail completes university verification with a token from
+// a confirmation email
+func (h *Handler) ConfirmUniversityEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ConfirmUniversityEmail(r.Context(), req.Token); err != nil {
+		if errors.Is(err, user.ErrUniversityEmailTaken) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "University email verified"})
+}
+
+// UnlockLogin lifts a login lockout for an account or client address (admin only)
+func (h *Handler) UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req UnlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UnlockLogin(r.Context(), req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS publishes the public keys Sanctor tokens are signed with, so other
+// services can verify them without sharing a secret
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	json.NewEncoder(w).Encode(h.service.keys.JWKS())
+}
+
+// RequestClientInfo extracts the caller's user agent and IP address. The
+// address is the connection's; middleware.TrustProxies replaces it with the
+// forwarded one for requests that came through a trusted proxy.
+func RequestClientInfo(r *http.Request) ClientInfo {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	return ClientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: ip,
+	}
+}
+
+// isHTTPS reports whether the client reached the API over TLS.
+// X-Forwarded-Proto only reaches handlers from trusted proxies.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// writeError writes a JSON error response. A rejected password also lists
+// the broken rules under "fields", keyed by request field.
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := map[string]interface{}{"error": err.Error()}
+	var invalid *passwordpolicy.ValidationError
+	if errors.As(err, &invalid) {
+		body["fields"] = invalid.Fields()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeThrottled writes a 429 response with a Retry-After header
+func writeThrottled(w http.ResponseWriter, err *ThrottleError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(err.RetryAfter.Seconds())+1))
+	writeError(w, http.StatusTooManyRequests, err)
+}
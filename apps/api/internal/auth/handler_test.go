@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingTwoFactorRepository fails to look up a user's 2FA settings, a step
+// of every password login
+type failingTwoFactorRepository struct {
+	Repository
+}
+
+func (r failingTwoFactorRepository) FindTwoFactor(ctx context.Context, userID string) (*TwoFactor, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+func TestLoginHandlerStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		failRepo   bool
+		wantStatus int
+		wantError  string
+	}{
+		{name: "signed in", body: `{"email":"ada@example.com","password":"` + testPassword + `"}`, wantStatus: http.StatusOK},
+		{name: "wrong password", body: `{"email":"ada@example.com","password":"wrong-password"}`, wantStatus: http.StatusUnauthorized, wantError: ErrInvalidCredentials.Error()},
+		{name: "unknown account", body: `{"email":"nobody@example.com","password":"wrong-password"}`, wantStatus: http.StatusUnauthorized, wantError: ErrInvalidCredentials.Error()},
+		{name: "missing password", body: `{"email":"ada@example.com"}`, wantStatus: http.StatusBadRequest, wantError: ErrCredentialsRequired.Error()},
+		{name: "storage failure", body: `{"email":"ada@example.com","password":"` + testPassword + `"}`, failRepo: true, wantStatus: http.StatusInternalServerError, wantError: "login failed, please try again later"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.register(t, "ada@example.com", "ada")
+			if tt.failRepo {
+				env.auth.repo = failingTwoFactorRepository{env.repo}
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			NewHandler(env.auth).Login(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.wantError {
+				t.Errorf("got error %q, want %q", body.Error, tt.wantError)
+			}
+		})
+	}
+}
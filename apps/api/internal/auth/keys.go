@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultJWTSecret is the development fallback for JWT_SECRET
+const defaultJWTSecret = "your-secret-key"
+
+// KeyConfig describes the keys tokens are signed and verified with
+type KeyConfig struct {
+	// Env is the deployment environment; "production" refuses the default secret
+	Env string
+	// Secret is the HS256 secret. Without a signing key it signs tokens;
+	// with one it only keeps verifying tokens issued before the switch.
+	Secret string
+	// SigningKeyFile is a PEM private key (RSA or Ed25519) used to sign tokens
+	SigningKeyFile string
+	// SigningKeyID overrides the key ID, which defaults to the key's RFC 7638 thumbprint
+	SigningKeyID string
+	// VerificationKeys are older keys that tokens may still be signed with,
+	// as PEM file paths optionally prefixed with "kid=".
+	VerificationKeys []string
+	// Issuer and Audience are set as the iss and aud claims of access
+	// tokens, and an access token must carry them to be accepted. Empty
+	// leaves the claim out.
+	Issuer   string
+	Audience string
+}
+
+// jwk is a verification key, identified by key ID
+type jwk struct {
+	id     string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// KeySet signs Sanctor tokens with one key and verifies them against every
+// key that is still trusted, so keys can rotate without signing everyone out
+type KeySet struct {
+	signingMethod jwt.SigningMethod
+	signingKeyID  string
+	signingKey    interface{}
+	verification  map[string]*jwk
+	secret        []byte // HS256 secret, nil once it is no longer trusted
+	issuer        string
+	audience      string
+}
+
+func mustLoadKeys(config KeyConfig) *KeySet {
+	ks, err := LoadKeys(config)
+	if err != nil {
+		panic(err)
+	}
+	return ks
+}
+
+// LoadKeys builds a key set from configuration
+func LoadKeys(config KeyConfig) (*KeySet, error) {
+	secretIsDefault := config.Secret == "" || config.Secret == defaultJWTSecret
+	ks := &KeySet{
+		verification: make(map[string]*jwk),
+		issuer:       config.Issuer,
+		audience:     config.Audience,
+	}
+
+	if config.SigningKeyFile == "" {
+		if secretIsDefault && config.Env == "production" {
+			return nil, errors.New("refusing to start in production with the default JWT secret: set JWT_SIGNING_KEY_FILE or JWT_SECRET")
+		}
+		secret := config.Secret
+		if secret == "" {
+			secret = defaultJWTSecret
+		}
+		ks.signingMethod = jwt.SigningMethodHS256
+		ks.signingKey = []byte(secret)
+		ks.secret = []byte(secret)
+		return ks, nil
+	}
+
+	private, err := readPrivateKey(config.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newJWK(config.SigningKeyID, private.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", config.SigningKeyFile, err)
+	}
+	ks.signingMethod = signer.method
+	ks.signingKeyID = signer.id
+	ks.signingKey = private
+	ks.verification[signer.id] = signer
+
+	for _, entry := range config.VerificationKeys {
+		id, path := "", strings.TrimSpace(entry)
+		if i := strings.Index(path, "="); i > 0 {
+			id, path = path[:i], path[i+1:]
+		}
+		public, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := newJWK(id, public)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ks.verification[key.id] = key
+	}
+
+	// Keep accepting HS256 tokens while they expire, unless the secret was never set
+	if !secretIsDefault {
+		ks.secret = []byte(config.Secret)
+	}
+	return ks, nil
+}
+
+// sign signs claims with the current signing key
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingMethod, claims)
+	if ks.signingKeyID != "" {
+		token.Header["kid"] = ks.signingKeyID
+	}
+	return token.SignedString(ks.signingKey)
+}
+
+// parse verifies a token against the trusted keys and decodes its claims
+func (ks *KeySet) parse(tokenStr string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, ks.keyFunc, opts...)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// accessClaims returns the registered claims of an access token issued at
+// now and valid for ttl
+func (ks *KeySet) accessClaims(now time.Time, ttl time.Duration) jwt.RegisteredClaims {
+	claims := jwt.RegisteredClaims{
+		Issuer:    ks.issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	if ks.audience != "" {
+		claims.Audience = jwt.ClaimStrings{ks.audience}
+	}
+	return claims
+}
+
+// parseAccess verifies an access token like parse, and also requires the
+// configured issuer and audience
+func (ks *KeySet) parseAccess(tokenStr string, claims jwt.Claims) error {
+	var opts []jwt.ParserOption
+	if ks.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(ks.issuer))
+	}
+	if ks.audience != "" {
+		opts = append(opts, jwt.WithAudience(ks.audience))
+	}
+	return ks.parse(tokenStr, claims, opts...)
+}
+
+// keyFunc picks the verification key for a token. The algorithm must match
+// the key, so a public key can never be used as an HMAC secret.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if ks.secret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return ks.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public verification keys as a JWK Set (RFC 7517)
+func (ks *KeySet) JWKS() map[string]interface{} {
+	set := make([]map[string]string, 0, len(ks.verification))
+	for _, key := range ks.verification {
+		set = append(set, key.export())
+	}
+	return map[string]interface{}{"keys": set}
+}
+
+// newJWK wraps a public key, deriving its key ID from the RFC 7638
+// thumbprint unless one is given
+func newJWK(id string, public crypto.PublicKey) (*jwk, error) {
+	key := &jwk{public: public}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("unsupported key type, use RSA or Ed25519")
+	}
+
+	if id == "" {
+		// Thumbprint input is the required members in lexicographic order
+		members := key.export()
+		delete(members, "kid")
+		delete(members, "use")
+		delete(members, "alg")
+		canonical, _ := json.Marshal(members) // encoding/json sorts map keys
+		sum := sha256.Sum256(canonical)
+		id = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	key.id = id
+	return key, nil
+}
+
+// export encodes the key as a JWK
+func (k *jwk) export() map[string]string {
+	members := map[string]string{"kid": k.id, "use": "sig", "alg": k.method.Alg()}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		members["kty"] = "RSA"
+		members["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		members["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		members["kty"] = "OKP"
+		members["crv"] = "Ed25519"
+		members["x"] = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return members
+}
+
+// readPrivateKey reads a PKCS#8 or PKCS#1 PEM private key
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported private key", path)
+	}
+	return signer, nil
+}
+
+// readPublicKey reads a PEM public key. A private key is accepted too, in
+// which case its public half is used.
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	signer, err := readPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// readPEM reads the first PEM block of a file
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey stores a private key as a PKCS#8 PEM file and returns its path
+func writeKey(t *testing.T, name string, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeySetParse(t *testing.T) {
+	current, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, old, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const secret = "a-secret-from-before-the-switch"
+	ks, err := LoadKeys(KeyConfig{
+		Secret:           secret,
+		SigningKeyFile:   writeKey(t, "current.pem", current),
+		VerificationKeys: []string{"old=" + writeKey(t, "old.pem", old)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(current.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(expiresIn time.Duration) jwt.Claims {
+		return jwt.RegisteredClaims{Subject: "user-1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn))}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.Claims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr bool
+	}{
+		{
+			name: "current key",
+			token: func() string {
+				signed, err := ks.sign(claims(time.Minute))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			name:  "previous key",
+			token: func() string { return sign(jwt.SigningMethodEdDSA, "old", old, claims(time.Minute)) },
+		},
+		{
+			name:  "legacy secret",
+			token: func() string { return sign(jwt.SigningMethodHS256, "", []byte(secret), claims(time.Minute)) },
+		},
+		{
+			name:    "expired",
+			token:   func() string { return sign(jwt.SigningMethodEdDSA, "old", old, claims(-time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name:    "no kid",
+			token:   func() string { return sign(jwt.SigningMethodEdDSA, "", old, claims(time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			token:   func() string { return sign(jwt.SigningMethodEdDSA, "retired", old, claims(time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name:    "algorithm does not match the kid",
+			token:   func() string { return sign(jwt.SigningMethodEdDSA, ks.signingKeyID, old, claims(time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name:    "key not in the set",
+			token:   func() string { return sign(jwt.SigningMethodRS256, ks.signingKeyID, stranger, claims(time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name: "public key as HMAC secret",
+			token: func() string {
+				return sign(jwt.SigningMethodHS256, ks.signingKeyID, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), claims(time.Minute))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "other HMAC algorithm",
+			token:   func() string { return sign(jwt.SigningMethodHS512, "", []byte(secret), claims(time.Minute)) },
+			wantErr: true,
+		},
+		{
+			name: "alg none",
+			token: func() string {
+				return sign(jwt.SigningMethodNone, ks.signingKeyID, jwt.UnsafeAllowNoneSignatureType, claims(time.Minute))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ks.parse(tt.token(), &jwt.RegisteredClaims{})
+			if tt.wantErr && err == nil {
+				t.Fatal("token was accepted")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestKeySetDropsDefaultSecret(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := LoadKeys(KeyConfig{SigningKeyFile: writeKey(t, "current.pem", key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "user-1"}).SignedString([]byte(defaultJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.parse(token, &jwt.RegisteredClaims{}); err == nil {
+		t.Fatal("token signed with the default secret was accepted")
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writeKey(t, "current.pem", key)
+
+	tests := []struct {
+		name    string
+		config  KeyConfig
+		wantAlg string
+		wantErr bool
+	}{
+		{name: "development default", config: KeyConfig{}, wantAlg: "HS256"},
+		{name: "production default secret", config: KeyConfig{Env: "production", Secret: defaultJWTSecret}, wantErr: true},
+		{name: "production without secret", config: KeyConfig{Env: "production"}, wantErr: true},
+		{name: "production secret", config: KeyConfig{Env: "production", Secret: "s3cret"}, wantAlg: "HS256"},
+		{name: "production signing key", config: KeyConfig{Env: "production", SigningKeyFile: keyFile}, wantAlg: "EdDSA"},
+		{name: "missing signing key", config: KeyConfig{SigningKeyFile: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: true},
+		{
+			name:    "missing verification key",
+			config:  KeyConfig{SigningKeyFile: keyFile, VerificationKeys: []string{"old=" + filepath.Join(t.TempDir(), "missing.pem")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := LoadKeys(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadKeys succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alg := ks.signingMethod.Alg(); alg != tt.wantAlg {
+				t.Errorf("got algorithm %s, want %s", alg, tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestParseJWTChecksIssuerAndAudience(t *testing.T) {
+	const secret = "a-secret-shared-by-every-deployment"
+	keys := func(issuer, audience string) *KeySet {
+		t.Helper()
+		ks, err := LoadKeys(KeyConfig{Secret: secret, Issuer: issuer, Audience: audience})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ks
+	}
+
+	tests := []struct {
+		name    string
+		issuing *KeySet
+		parsing *KeySet
+		wantErr bool
+	}{
+		{name: "matching claims", issuing: keys("https://api.sanctor.app", "sanctor-web"), parsing: keys("https://api.sanctor.app", "sanctor-web")},
+		{name: "nothing configured", issuing: keys("", ""), parsing: keys("", "")},
+		{name: "other issuer", issuing: keys("https://staging.sanctor.app", "sanctor-web"), parsing: keys("https://api.sanctor.app", "sanctor-web"), wantErr: true},
+		{name: "other audience", issuing: keys("https://api.sanctor.app", "sanctor-admin"), parsing: keys("https://api.sanctor.app", "sanctor-web"), wantErr: true},
+		{name: "no issuer", issuing: keys("", "sanctor-web"), parsing: keys("https://api.sanctor.app", "sanctor-web"), wantErr: true},
+		{name: "no audience", issuing: keys("https://api.sanctor.app", ""), parsing: keys("https://api.sanctor.app", "sanctor-web"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			_, resp := env.register(t, "ada@example.com", "ada")
+			claims, err := env.auth.ParseJWT(ctx, resp.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env.auth.keys = tt.issuing
+			token, err := env.auth.GenerateJWT(claims.UserID, claims.SessionID, claims.Role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env.auth.keys = tt.parsing
+			parsed, err := env.auth.ParseJWT(ctx, token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("token was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Issuer != tt.parsing.issuer {
+				t.Errorf("got issuer %q, want %q", parsed.Issuer, tt.parsing.issuer)
+			}
+		})
+	}
+}
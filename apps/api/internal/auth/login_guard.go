@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"sanctor/internal/user"
+)
+
+// lockoutPolicy decides how failed logins for one key slow down and
+// eventually block further attempts
+type lockoutPolicy struct {
+	freeAttempts int           // failures allowed before backoff starts
+	baseDelay    time.Duration // wait after the first failure past freeAttempts, doubled for each one after
+	lockAfter    int           // failures that lock the key
+	lockDuration time.Duration
+	resetAfter   time.Duration // a quiet period after which failures are forgotten
+}
+
+var (
+	// accountLockout applies per email address, whether or not an account
+	// exists for it, so lockouts reveal nothing about which accounts exist
+	accountLockout = lockoutPolicy{
+		freeAttempts: 3,
+		baseDelay:    time.Second,
+		lockAfter:    10,
+		lockDuration: 15 * time.Minute,
+		resetAfter:   time.Hour,
+	}
+
+	// ipLockout applies per client address and is looser, since many users
+	// can share one address
+	ipLockout = lockoutPolicy{
+		freeAttempts: 10,
+		baseDelay:    time.Second,
+		lockAfter:    50,
+		lockDuration: 15 * time.Minute,
+		resetAfter:   time.Hour,
+	}
+)
+
+// retryAfter returns how long a key must wait before its next attempt
+func (p lockoutPolicy) retryAfter(attempt *LoginAttempt, now time.Time) time.Duration {
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		return attempt.LockedUntil.Sub(now)
+	}
+	if now.Sub(attempt.LastFailureAt) > p.resetAfter || attempt.Failures <= p.freeAttempts {
+		return 0
+	}
+
+	delay := p.baseDelay << uint(attempt.Failures-p.freeAttempts-1)
+	if delay <= 0 || delay > p.lockDuration {
+		delay = p.lockDuration
+	}
+	if wait := attempt.LastFailureAt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// recordFailure counts a failed attempt and reports whether it locked the key
+func (p lockoutPolicy) recordFailure(attempt *LoginAttempt, now time.Time) bool {
+	if now.Sub(attempt.LastFailureAt) > p.resetAfter ||
+		(attempt.LockedUntil != nil && !now.Before(*attempt.LockedUntil)) {
+		attempt.Failures = 0
+		attempt.LockedUntil = nil
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	if attempt.Failures >= p.lockAfter && attempt.LockedUntil == nil {
+		lockedUntil := now.Add(p.lockDuration)
+		attempt.LockedUntil = &lockedUntil
+		return true
+	}
+	return false
+}
+
+// loginKey is a lockout key with the policy that applies to it
+type loginKey struct {
+	key    string
+	policy lockoutPolicy
+}
+
+// loginKeys returns the lockout keys for a login attempt
+func loginKeys(email string, client ClientInfo) (string, string) {
+	return "account:" + user.NormalizeEmail(email), "ip:" + client.IPAddress
+}
+
+// checkLoginAllowed fails with a ThrottleError while either key is backing
+// off or locked, without counting an attempt
+func (s *Service) checkLoginAllowed(ctx context.Context, accountKey, ipKey string) error {
+	now := time.Now()
+	var wait time.Duration
+	for _, check := range []loginKey{{accountKey, accountLockout}, {ipKey, ipLockout}} {
+		attempt, err := s.repo.FindLoginAttempt(ctx, check.key)
+		if errors.Is(err, ErrLoginAttemptNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if w := check.policy.retryAfter(attempt, now); w > wait {
+			wait = w
+		}
+	}
+
+	if wait > 0 {
+		return &ThrottleError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// beginLoginAttempt counts a login attempt against the client address and
+// the account before the password is checked. While either key is backing
+// off or locked it fails with a ThrottleError and counts nothing. Checking
+// and counting are one atomic step per key, so parallel guesses cannot all
+// pass the check before any of them is counted.
+func (s *Service) beginLoginAttempt(ctx context.Context, accountKey, ipKey string) error {
+	// Count the attempt even if the client hangs up without waiting for it
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+	var counted []loginKey
+	for _, record := range []loginKey{{ipKey, ipLockout}, {accountKey, accountLockout}} {
+		var wait time.Duration
+		var locked bool
+		attempt, err := s.repo.UpdateLoginAttempt(ctx, record.key, func(attempt *LoginAttempt) {
+			if wait = record.policy.retryAfter(attempt, now); wait > 0 {
+				return
+			}
+			locked = record.policy.recordFailure(attempt, now)
+		})
+		if err == nil && wait > 0 {
+			err = &ThrottleError{RetryAfter: wait}
+		}
+		if err != nil {
+			for _, c := range counted {
+				s.giveBackLoginAttempt(ctx, c.key, c.policy)
+			}
+			return err
+		}
+		counted = append(counted, record)
+		if locked {
+			log.Printf("🔒 Login locked for %s after %d failed attempts, until %s",
+				record.key, attempt.Failures, attempt.LockedUntil.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// loginSucceeded settles an attempt counted by beginLoginAttempt whose
+// password was right. The account's failures are forgotten. The client
+// address only gets this attempt back: its earlier failures may have been
+// guesses at other accounts, and signing in to one account of one's own
+// must not clear them.
+func (s *Service) loginSucceeded(ctx context.Context, accountKey, ipKey string) error {
+	if err := s.repo.DeleteLoginAttempt(ctx, accountKey); err != nil {
+		return err
+	}
+	s.giveBackLoginAttempt(ctx, ipKey, ipLockout)
+	return nil
+}
+
+// giveBackLoginAttempt uncounts one attempt of a key that turned out not to
+// be a failure, lifting the lock if that attempt was the one that set it
+func (s *Service) giveBackLoginAttempt(ctx context.Context, key string, policy lockoutPolicy) {
+	_, err := s.repo.UpdateLoginAttempt(ctx, key, func(attempt *LoginAttempt) {
+		if attempt.Failures > 0 {
+			attempt.Failures--
+		}
+		if attempt.Failures < policy.lockAfter {
+			attempt.LockedUntil = nil
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to give back a login attempt for %s: %v", key, err)
+	}
+}
+
+// UnlockLogin clears the failed-login state of an account and/or a client
+// address, lifting any backoff or lockout
+func (s *Service) UnlockLogin(ctx context.Context, req UnlockRequest) error {
+	if req.Email == "" && req.IPAddress == "" {
+		return errors.New("email or ipAddress is required")
+	}
+
+	accountKey, ipKey := loginKeys(req.Email, ClientInfo{IPAddress: req.IPAddress})
+	if req.Email != "" {
+		if err := s.repo.DeleteLoginAttempt(ctx, accountKey); err != nil {
+			return err
+		}
+		log.Printf("🔓 Login unlocked for %s", accountKey)
+	}
+	if req.IPAddress != "" {
+		if err := s.repo.DeleteLoginAttempt(ctx, ipKey); err != nil {
+			return err
+		}
+		log.Printf("🔓 Login unlocked for %s", ipKey)
+	}
+	return nil
+}
+
+// checkDummyPassword spends the same time as a real password check, so
+// response times do not reveal whether an account exists
+func (s *Service) checkDummyPassword(password string) {
+	s.userService.CheckDummyPassword(password)
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	// The wait after each number of failed logins for one account
+	steps := map[int]time.Duration{
+		1:  0,
+		3:  0,
+		4:  time.Second,
+		5:  2 * time.Second,
+		9:  32 * time.Second,
+		10: accountLockout.lockDuration,
+	}
+
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+	accountKey, ipKey := loginKeys("ada@example.com", ClientInfo{})
+
+	for failures := 1; failures <= accountLockout.lockAfter; failures++ {
+		if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: "wrong-password"}); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure %d: got error %v, want ErrInvalidCredentials", failures, err)
+		}
+
+		wait := env.loginWait(t, accountKey, ipKey)
+		if want, ok := steps[failures]; ok && (wait > want || wait < want-time.Second) {
+			t.Errorf("after %d failures: got wait %v, want %v", failures, wait, want)
+		}
+		if failures < accountLockout.lockAfter {
+			env.waitOutBackoff(t, accountKey, wait)
+		}
+	}
+
+	// Locked: even the right password is refused until the lock expires
+	var throttled *ThrottleError
+	if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: testPassword}); !errors.As(err, &throttled) {
+		t.Fatalf("got error %v while locked, want a ThrottleError", err)
+	}
+	env.waitOutBackoff(t, accountKey, accountLockout.lockDuration)
+	if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: testPassword}); err != nil {
+		t.Fatalf("got error %v after the lock expired", err)
+	}
+}
+
+func TestLoginSuccessResetsFailures(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+	accountKey, ipKey := loginKeys("ada@example.com", ClientInfo{})
+
+	fail := func() {
+		t.Helper()
+		for i := 0; i < accountLockout.freeAttempts; i++ {
+			if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: "wrong-password"}); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("got error %v, want ErrInvalidCredentials", err)
+			}
+		}
+	}
+
+	fail()
+	if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+	// The address keeps its failures, which may have been made against
+	// other accounts; only the successful attempt is given back
+	ipAttempt, err := env.repo.FindLoginAttempt(ctx, ipKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ipAttempt.Failures != accountLockout.freeAttempts {
+		t.Errorf("got %d failures for the address, want %d", ipAttempt.Failures, accountLockout.freeAttempts)
+	}
+
+	fail()
+	if wait := env.loginWait(t, accountKey, ipKey); wait != 0 {
+		t.Errorf("got wait %v, want the failures before the successful login forgotten", wait)
+	}
+}
+
+func TestConcurrentGuessesAreThrottled(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+	accountKey, _ := loginKeys("ada@example.com", ClientInfo{})
+
+	// Every guess is counted before its password is checked, so only those
+	// made before backoff starts get to a password check
+	const guesses = 20
+	var checked atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: "wrong-password"})
+			var throttled *ThrottleError
+			switch {
+			case errors.Is(err, ErrInvalidCredentials):
+				checked.Add(1)
+			case !errors.As(err, &throttled):
+				t.Errorf("got error %v, want ErrInvalidCredentials or a ThrottleError", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want := int32(accountLockout.freeAttempts + 1); checked.Load() != want {
+		t.Errorf("%d guesses had their password checked, want %d", checked.Load(), want)
+	}
+	attempt, err := env.repo.FindLoginAttempt(ctx, accountKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int32(attempt.Failures) != checked.Load() {
+		t.Errorf("got %d failures, want one per checked guess", attempt.Failures)
+	}
+}
+
+// loginWait returns how long the next login for the keys has to wait
+func (env *testEnv) loginWait(t *testing.T, accountKey, ipKey string) time.Duration {
+	t.Helper()
+	err := env.auth.checkLoginAllowed(context.Background(), accountKey, ipKey)
+	var throttled *ThrottleError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0
+}
+
+// waitOutBackoff moves the last failure and any lock of a key back by
+// wait, as if that much time had passed
+func (env *testEnv) waitOutBackoff(t *testing.T, key string, wait time.Duration) {
+	t.Helper()
+	_, err := env.repo.UpdateLoginAttempt(context.Background(), key, func(attempt *LoginAttempt) {
+		attempt.LastFailureAt = attempt.LastFailureAt.Add(-wait)
+		if attempt.LockedUntil != nil {
+			lockedUntil := attempt.LockedUntil.Add(-wait)
+			attempt.LockedUntil = &lockedUntil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,21 +1,294 @@
 package auth
 
-import "time"
+import (
+	"strings"
+	"time"
 
-// Model represents authentication data
+	"sanctor/internal/webauthn"
+)
+
+// Model represents an authentication session. A session is created on every
+// login and owns the chain of refresh tokens rotated from it, so the session
+// ID doubles as the refresh token family ID.
 type Model struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"userId"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refreshToken"`
-	ExpiresAt    time.Time `json:"expiresAt"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID         string     `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID     string     `json:"userId" gorm:"type:uuid;not null;index"`
+	UserAgent  string     `json:"userAgent" gorm:"type:varchar(500)"`
+	IPAddress  string     `json:"ipAddress" gorm:"type:varchar(64)"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null"`
+	CreatedAt  time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// TableName overrides the GORM table name for sessions
+func (Model) TableName() string {
+	return "auth_sessions"
+}
+
+// IsActive reports whether the session can still be used
+func (m *Model) IsActive() bool {
+	return m.RevokedAt == nil && time.Now().Before(m.ExpiresAt)
+}
+
+// RefreshToken represents a single refresh token issued for a session.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        string     `json:"id" gorm:"type:uuid;primaryKey"`
+	SessionID string     `json:"sessionId" gorm:"type:uuid;not null;index"`
+	UserID    string     `json:"userId" gorm:"type:uuid;not null;index"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expiresAt" gorm:"not null"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// PasswordResetToken represents a single-use password reset token.
+// Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        string     `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID    string     `json:"userId" gorm:"type:uuid;not null;index"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expiresAt" gorm:"not null"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// MagicLink records a passwordless sign-in link. The link itself is a signed
+// token whose ID is the record's ID; the record makes it single use and,
+// when BindingHash is set, ties it to the browser that asked for it.
+type MagicLink struct {
+	ID          string     `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID      string     `json:"userId" gorm:"type:uuid;not null;index"`
+	BindingHash string     `json:"-" gorm:"type:varchar(64)"`
+	ExpiresAt   time.Time  `json:"expiresAt" gorm:"not null"`
+	UsedAt      *time.Time `json:"usedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for magic links
+func (MagicLink) TableName() string {
+	return "auth_magic_links"
+}
+
+// UniversityVerification records a university confirmation link that was
+// mailed and not opened yet. The link is a signed token whose ID is the
+// record's ID; taking the record when the link is opened makes it single use.
+type UniversityVerification struct {
+	ID        string    `json:"-" gorm:"type:uuid;primaryKey"`
+	UserID    string    `json:"-" gorm:"type:uuid;not null;index"`
+	ExpiresAt time.Time `json:"-" gorm:"not null;index"`
+	CreatedAt time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for university verifications
+func (UniversityVerification) TableName() string {
+	return "auth_university_verifications"
+}
+
+// TwoFactor holds a user's TOTP second factor. It is pending until the user
+// proves their authenticator works by confirming a first code.
+type TwoFactor struct {
+	UserID       string     `json:"userId" gorm:"type:uuid;primaryKey"`
+	Secret       string     `json:"-" gorm:"type:varchar(64);not null"`
+	LastUsedStep int64      `json:"-" gorm:"not null;default:0"`
+	ConfirmedAt  *time.Time `json:"confirmedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for second factors
+func (TwoFactor) TableName() string {
+	return "auth_two_factors"
+}
+
+// IsEnabled reports whether the second factor has been confirmed
+func (t *TwoFactor) IsEnabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// RecoveryCode represents a one-time code that stands in for a TOTP code
+// when the user has lost their authenticator. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        string     `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID    string     `json:"userId" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);not null"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for recovery codes
+func (RecoveryCode) TableName() string {
+	return "auth_recovery_codes"
+}
+
+// OIDCIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's stable subject identifier
+type OIDCIdentity struct {
+	ID        string    `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID    string    `json:"userId" gorm:"type:uuid;not null;index"`
+	Provider  string    `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_oidc_provider_subject"`
+	Subject   string    `json:"subject" gorm:"type:varchar(255);not null;uniqueIndex:idx_oidc_provider_subject"`
+	Email     string    `json:"email" gorm:"type:varchar(255)"`
+	CreatedAt time.Time `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for linked identities
+func (OIDCIdentity) TableName() string {
+	return "auth_oidc_identities"
+}
+
+// LoginAttempt tracks recent failed logins for one key: an account
+// ("account:<email>") or a client address ("ip:<address>")
+type LoginAttempt struct {
+	Key           string     `json:"key" gorm:"type:varchar(300);primaryKey"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// TableName overrides the GORM table name for login attempts
+func (LoginAttempt) TableName() string {
+	return "auth_login_attempts"
+}
+
+// APIKey represents a personal access token for scripts and integrations.
+// Only the SHA-256 hash of the key is stored; Prefix keeps enough of it to
+// tell keys apart in listings.
+type APIKey struct {
+	ID         string     `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID     string     `json:"userId" gorm:"type:uuid;not null;index"`
+	Name       string     `json:"name" gorm:"type:varchar(100);not null"`
+	Prefix     string     `json:"prefix" gorm:"type:varchar(32);not null"`
+	KeyHash    string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Scopes     string     `json:"-" gorm:"type:text;not null"` // comma-separated
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// TableName overrides the GORM table name for API keys
+func (APIKey) TableName() string {
+	return "auth_api_keys"
+}
+
+// IsActive reports whether the key can still be used
+func (k *APIKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// ScopeList returns the scopes granted to the key
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// Passkey is a WebAuthn credential a user signs in with instead of a
+// password. Only the public key is stored; the private key never leaves the
+// user's authenticator.
+type Passkey struct {
+	ID           string     `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID       string     `json:"-" gorm:"type:uuid;not null;index"`
+	CredentialID string     `json:"-" gorm:"type:varchar(1400);not null;uniqueIndex"` // base64url
+	PublicKey    []byte     `json:"-" gorm:"type:bytea;not null"`                     // COSE_Key
+	SignCount    int64      `json:"-" gorm:"not null;default:0"`
+	Transports   string     `json:"-" gorm:"type:varchar(200)"` // comma-separated
+	Name         string     `json:"name" gorm:"type:varchar(100);not null"`
+	BackedUp     bool       `json:"backedUp" gorm:"not null;default:false"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for passkeys
+func (Passkey) TableName() string {
+	return "auth_passkeys"
+}
+
+// TransportList returns how the browser can reach the passkey's authenticator
+func (p *Passkey) TransportList() []string {
+	if p.Transports == "" {
+		return nil
+	}
+	return strings.Split(p.Transports, ",")
+}
+
+// PasskeyChallenge is a started WebAuthn ceremony, kept between handing out
+// the options and receiving the authenticator's response. Only the hash of
+// the ceremony ID is stored. UserID is empty for a login.
+type PasskeyChallenge struct {
+	IDHash    string    `json:"-" gorm:"type:varchar(64);primaryKey"`
+	UserID    string    `json:"-" gorm:"type:varchar(36);not null;default:''"`
+	Challenge []byte    `json:"-" gorm:"type:bytea;not null"`
+	ExpiresAt time.Time `json:"-" gorm:"not null;index"`
+	CreatedAt time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for passkey challenges
+func (PasskeyChallenge) TableName() string {
+	return "auth_passkey_challenges"
+}
+
+// OIDCLoginState is what the API remembers between redirecting a browser to
+// a provider and the provider redirecting it back. It is keyed by the hash
+// of the state parameter and is single use.
+type OIDCLoginState struct {
+	StateHash   string    `json:"-" gorm:"type:varchar(64);primaryKey"`
+	Provider    string    `json:"-" gorm:"type:varchar(50);not null"`
+	Nonce       string    `json:"-" gorm:"type:varchar(100);not null"`
+	Verifier    string    `json:"-" gorm:"type:varchar(100);not null"`
+	BindingHash string    `json:"-" gorm:"type:varchar(64);not null"`
+	ExpiresAt   time.Time `json:"-" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// TableName overrides the GORM table name for pending provider logins
+func (OIDCLoginState) TableName() string {
+	return "auth_oidc_login_states"
+}
+
+// Login methods recorded in the login history
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodTwoFactor = "two_factor"
+	LoginMethodOIDC      = "oidc"
+	LoginMethodMagicLink = "magic_link"
+	LoginMethodPasskey   = "passkey"
+	LoginMethodRegister  = "register"
+)
+
+// LoginEvent records one sign-in attempt. UserID is empty for attempts
+// against an email address that has no account.
+type LoginEvent struct {
+	ID            string    `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID        string    `json:"-" gorm:"type:uuid;index"`
+	Method        string    `json:"method" gorm:"type:varchar(50);not null"`
+	Success       bool      `json:"success" gorm:"not null"`
+	FailureReason string    `json:"failureReason,omitempty" gorm:"type:varchar(100)"`
+	UserAgent     string    `json:"userAgent" gorm:"type:varchar(500)"`
+	IPAddress     string    `json:"ipAddress" gorm:"type:varchar(64)"`
+	NewDevice     bool      `json:"newDevice" gorm:"not null;default:false"`
+	CreatedAt     time.Time `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+// TableName overrides the GORM table name for login events
+func (LoginEvent) TableName() string {
+	return "auth_login_events"
+}
+
+// ClientInfo describes the device a request came from. It is filled in by
+// the handlers, never decoded from the request body.
+type ClientInfo struct {
+	UserAgent string `json:"-"`
+	IPAddress string `json:"-"`
 }
 
 // LoginRequest represents login credentials
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	ClientInfo
 }
 
 // RegisterRequest represents registration data
@@ -25,11 +298,179 @@ type RegisterRequest struct {
 	Password  string `json:"password"`
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
+	ClientInfo
 }
 
-// AuthResponse represents authentication response
-type AuthResponse struct {
-	Token        string `json:"token"`
+// RefreshRequest represents a token refresh request
+type RefreshRequest struct {
 	RefreshToken string `json:"refreshToken"`
-	ExpiresAt    string `json:"expiresAt"`
+	ClientInfo
+}
+
+// VerifyEmailRequest represents an email verification request
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest represents a request for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// MagicLinkRequest asks for a sign-in link by email. With BindToBrowser set,
+// the link only works in the browser that asked for it.
+type MagicLinkRequest struct {
+	Email         string `json:"email"`
+	BindToBrowser bool   `json:"bindToBrowser"`
+	Binding       string `json:"-"`
+}
+
+// MagicLinkLoginRequest exchanges a token from a sign-in link for tokens
+type MagicLinkLoginRequest struct {
+	Token   string `json:"token"`
+	Binding string `json:"-"`
+	ClientInfo
+}
+
+// ResetPasswordRequest represents a password reset with a token from the reset email
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// ChangePasswordRequest represents a password change by a signed-in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// UniversityVerificationRequest asks to prove enrollment at a university
+// through an address on one of its email domains
+type UniversityVerificationRequest struct {
+	UniversityID string `json:"universityId"`
+	Email        string `json:"email"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code or a recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLoginRequest completes a login that was answered with a two-factor challenge
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	ClientInfo
+}
+
+// TwoFactorEnrollment is returned when a user starts setting up 2FA
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// RecoveryCodesResponse lists freshly generated recovery codes. They are
+// shown once and cannot be retrieved again.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// UnlockRequest asks to clear the failed-login state of an account, a
+// client address, or both
+type UnlockRequest struct {
+	Email     string `json:"email"`
+	IPAddress string `json:"ipAddress"`
+}
+
+// CreateAPIKeyRequest represents a request for a new API key. ExpiresInDays
+// of zero creates a key that does not expire.
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+// APIKeyInfo represents an API key as shown to its owner
+type APIKeyInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedAPIKey is returned once, when a key is created. The key itself
+// cannot be retrieved again.
+type CreatedAPIKey struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+// PasskeyCeremony is returned when a passkey registration or login starts.
+// PublicKey goes to navigator.credentials.create() or .get(); CeremonyID
+// comes back with the result.
+type PasskeyCeremony struct {
+	CeremonyID string      `json:"ceremonyId"`
+	PublicKey  interface{} `json:"publicKey"`
+}
+
+// StartPasskeyRegistrationRequest re-authenticates the user before a passkey
+// is added
+type StartPasskeyRegistrationRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code,omitempty"` // required when two-factor authentication is on
+}
+
+// PasskeyRegistrationRequest finishes registering a passkey
+type PasskeyRegistrationRequest struct {
+	CeremonyID string                          `json:"ceremonyId"`
+	Name       string                          `json:"name"`
+	Credential webauthn.RegistrationCredential `json:"credential"`
+}
+
+// PasskeyLoginRequest finishes signing in with a passkey
+type PasskeyLoginRequest struct {
+	CeremonyID string                            `json:"ceremonyId"`
+	Credential webauthn.AuthenticationCredential `json:"credential"`
+	ClientInfo
+}
+
+// OIDCProviderInfo describes a login provider for the login page
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	LoginURL    string `json:"loginUrl"`
+}
+
+// OIDCCallbackRequest carries the parameters the provider redirected back
+// with, plus the browser binding cookie set when the login started
+type OIDCCallbackRequest struct {
+	State   string
+	Code    string
+	Binding string
+	ClientInfo
+}
+
+// SessionInfo represents an active session as shown to its owner
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IPAddress  string    `json:"ipAddress"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// AuthResponse represents authentication response. When the account has
+// two-factor authentication enabled, Login only fills in ChallengeToken,
+// which must be exchanged together with a code for the real tokens.
+type AuthResponse struct {
+	Token             string `json:"token,omitempty"`
+	RefreshToken      string `json:"refreshToken,omitempty"`
+	ExpiresAt         string `json:"expiresAt,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
 }
@@ -1,31 +1,1053 @@
 package auth
 
-// Repository handles authentication data persistence
-type Repository struct {
-	sessions map[string]*Model
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"sanctor/internal/database"
+)
+
+// InMemoryRepository handles authentication data persistence in memory.
+// Every change registers how to undo it, so a unit of work that fails is
+// rolled back as a whole.
+type InMemoryRepository struct {
+	sessions      map[string]*Model                  // sessionID -> session
+	refreshTokens map[string]*RefreshToken           // tokenHash -> refresh token
+	resetTokens   map[string]*PasswordResetToken     // tokenHash -> reset token
+	magicLinks    map[string]*MagicLink              // ID -> magic link
+	universities  map[string]*UniversityVerification // ID -> university confirmation link
+	twoFactors    map[string]*TwoFactor              // userID -> second factor
+	recoveryCodes map[string][]*RecoveryCode         // userID -> recovery codes
+	identities    map[string]*OIDCIdentity           // provider + "|" + subject -> identity
+	loginAttempts map[string]*LoginAttempt           // key -> failed login attempts
+	apiKeys       map[string]*APIKey                 // keyHash -> API key
+	passkeys      map[string]*Passkey                // credentialID -> passkey
+	challenges    map[string]*PasskeyChallenge       // IDHash -> passkey challenge
+	oidcLogins    map[string]*OIDCLoginState         // StateHash -> pending provider login
+	loginEvents   []*LoginEvent                      // oldest first
+	mu            sync.RWMutex
 }
 
-// NewRepository creates a new auth repository
-func NewRepository() *Repository {
-	return &Repository{
-		sessions: make(map[string]*Model),
+// NewRepository creates a new in-memory auth repository
+func NewRepository() Repository {
+	return &InMemoryRepository{
+		sessions:      make(map[string]*Model),
+		refreshTokens: make(map[string]*RefreshToken),
+		resetTokens:   make(map[string]*PasswordResetToken),
+		magicLinks:    make(map[string]*MagicLink),
+		universities:  make(map[string]*UniversityVerification),
+		twoFactors:    make(map[string]*TwoFactor),
+		recoveryCodes: make(map[string][]*RecoveryCode),
+		identities:    make(map[string]*OIDCIdentity),
+		loginAttempts: make(map[string]*LoginAttempt),
+		apiKeys:       make(map[string]*APIKey),
+		passkeys:      make(map[string]*Passkey),
+		challenges:    make(map[string]*PasskeyChallenge),
+		oidcLogins:    make(map[string]*OIDCLoginState),
+		loginEvents:   make([]*LoginEvent, 0),
 	}
 }
 
 // CreateSession stores a new authentication session
-func (r *Repository) CreateSession(session *Model) error {
-	r.sessions[session.Token] = session
+func (r *InMemoryRepository) CreateSession(ctx context.Context, session *Model) error {
+	if session == nil {
+		return errors.New("session cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sessions[session.ID] = session
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.sessions, session.ID)
+	})
+	return nil
+}
+
+// FindSession retrieves a session by ID
+func (r *InMemoryRepository) FindSession(ctx context.Context, id string) (*Model, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, exists := r.sessions[id]
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// FindSessionsByUser retrieves all sessions belonging to a user
+func (r *InMemoryRepository) FindSessionsByUser(ctx context.Context, userID string) ([]*Model, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := make([]*Model, 0)
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+// TouchSession records recent activity on a session
+func (r *InMemoryRepository) TouchSession(ctx context.Context, id string, seenAt time.Time, client ClientInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, exists := r.sessions[id]
+	if !exists {
+		return ErrSessionNotFound
+	}
+	previous := *session
+	session.LastSeenAt = seenAt
+	if client.UserAgent != "" {
+		session.UserAgent = client.UserAgent
+	}
+	if client.IPAddress != "" {
+		session.IPAddress = client.IPAddress
+	}
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		session.LastSeenAt = previous.LastSeenAt
+		session.UserAgent = previous.UserAgent
+		session.IPAddress = previous.IPAddress
+	})
+	return nil
+}
+
+// RevokeSession marks a session, and with it every refresh token in its family, as revoked
+func (r *InMemoryRepository) RevokeSession(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, exists := r.sessions[id]
+	if !exists {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+		database.OnRollback(ctx, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			session.RevokedAt = nil
+		})
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of a user except exceptID
+func (r *InMemoryRepository) RevokeUserSessions(ctx context.Context, userID, exceptID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var revoked []*Model
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.ID != exceptID && session.RevokedAt == nil {
+			revokedAt := now
+			session.RevokedAt = &revokedAt
+			revoked = append(revoked, session)
+		}
+	}
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, session := range revoked {
+			session.RevokedAt = nil
+		}
+	})
+	return nil
+}
+
+// DeleteSession removes a session and its refresh tokens
+func (r *InMemoryRepository) DeleteSession(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, existed := r.sessions[id]
+	delete(r.sessions, id)
+	tokens := deleteWhere(r.refreshTokens, func(t *RefreshToken) bool { return t.SessionID == id })
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existed {
+			r.sessions[id] = session
+		}
+		restore(r.refreshTokens, tokens)
+	})
+	return nil
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *InMemoryRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	if token == nil {
+		return errors.New("refresh token cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refreshTokens[token.TokenHash] = token
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.refreshTokens, token.TokenHash)
+	})
+	return nil
+}
+
+// FindByToken retrieves a refresh token by its hash
+func (r *InMemoryRepository) FindByToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	token, exists := r.refreshTokens[tokenHash]
+	if !exists {
+		return nil, ErrInvalidRefreshToken
+	}
+	copied := *token
+	return &copied, nil
+}
+
+// MarkRefreshTokenUsed records that a refresh token has been exchanged.
+// It fails with ErrRefreshTokenReused if the token was already used.
+func (r *InMemoryRepository) MarkRefreshTokenUsed(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.refreshTokens {
+		if token.ID != id {
+			continue
+		}
+		if token.UsedAt != nil {
+			return ErrRefreshTokenReused
+		}
+		token.UsedAt = &usedAt
+		database.OnRollback(ctx, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			token.UsedAt = nil
+		})
+		return nil
+	}
+	return ErrInvalidRefreshToken
+}
+
+// CreatePasswordReset stores a new password reset token
+func (r *InMemoryRepository) CreatePasswordReset(ctx context.Context, token *PasswordResetToken) error {
+	if token == nil {
+		return errors.New("reset token cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resetTokens[token.TokenHash] = token
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.resetTokens, token.TokenHash)
+	})
+	return nil
+}
+
+// FindPasswordReset retrieves a password reset token by its hash
+func (r *InMemoryRepository) FindPasswordReset(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	token, exists := r.resetTokens[tokenHash]
+	if !exists {
+		return nil, ErrInvalidResetToken
+	}
+	copied := *token
+	return &copied, nil
+}
+
+// MarkPasswordResetUsed consumes a password reset token. It fails with
+// ErrInvalidResetToken if the token was already used.
+func (r *InMemoryRepository) MarkPasswordResetUsed(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.resetTokens {
+		if token.ID != id {
+			continue
+		}
+		if token.UsedAt != nil {
+			return ErrInvalidResetToken
+		}
+		token.UsedAt = &usedAt
+		database.OnRollback(ctx, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			token.UsedAt = nil
+		})
+		return nil
+	}
+	return ErrInvalidResetToken
+}
+
+// InvalidatePasswordResets consumes every outstanding reset token of a user
+func (r *InMemoryRepository) InvalidatePasswordResets(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var used []*PasswordResetToken
+	for _, token := range r.resetTokens {
+		if token.UserID == userID && token.UsedAt == nil {
+			usedAt := now
+			token.UsedAt = &usedAt
+			used = append(used, token)
+		}
+	}
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, token := range used {
+			token.UsedAt = nil
+		}
+	})
+	return nil
+}
+
+// CreateMagicLink stores a new magic link
+func (r *InMemoryRepository) CreateMagicLink(ctx context.Context, link *MagicLink) error {
+	if link == nil {
+		return errors.New("magic link cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.magicLinks[link.ID] = link
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.magicLinks, link.ID)
+	})
+	return nil
+}
+
+// FindMagicLink retrieves a magic link by ID
+func (r *InMemoryRepository) FindMagicLink(ctx context.Context, id string) (*MagicLink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	link, exists := r.magicLinks[id]
+	if !exists {
+		return nil, ErrInvalidMagicLink
+	}
+	copied := *link
+	return &copied, nil
+}
+
+// MarkMagicLinkUsed consumes a magic link. It fails with ErrInvalidMagicLink
+// if the link was already used.
+func (r *InMemoryRepository) MarkMagicLinkUsed(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link, exists := r.magicLinks[id]
+	if !exists || link.UsedAt != nil {
+		return ErrInvalidMagicLink
+	}
+	link.UsedAt = &usedAt
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		link.UsedAt = nil
+	})
+	return nil
+}
+
+// InvalidateMagicLinks consumes every outstanding magic link of a user
+func (r *InMemoryRepository) InvalidateMagicLinks(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var used []*MagicLink
+	for _, link := range r.magicLinks {
+		if link.UserID == userID && link.UsedAt == nil {
+			usedAt := now
+			link.UsedAt = &usedAt
+			used = append(used, link)
+		}
+	}
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, link := range used {
+			link.UsedAt = nil
+		}
+	})
+	return nil
+}
+
+// CreateUniversityVerification stores a mailed university confirmation link
+// and drops expired ones
+func (r *InMemoryRepository) CreateUniversityVerification(ctx context.Context, verification *UniversityVerification) error {
+	if verification == nil {
+		return errors.New("university verification cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	expired := deleteWhere(r.universities, func(v *UniversityVerification) bool { return now.After(v.ExpiresAt) })
+	copied := *verification
+	r.universities[verification.ID] = &copied
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.universities, verification.ID)
+		restore(r.universities, expired)
+	})
+	return nil
+}
+
+// TakeUniversityVerification removes and returns a university confirmation
+// link
+func (r *InMemoryRepository) TakeUniversityVerification(ctx context.Context, id string) (*UniversityVerification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	verification, exists := r.universities[id]
+	if !exists {
+		return nil, ErrInvalidVerificationToken
+	}
+	delete(r.universities, id)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.universities[id] = verification
+	})
+	return verification, nil
+}
+
+// SaveTwoFactor creates or replaces a user's second factor
+func (r *InMemoryRepository) SaveTwoFactor(ctx context.Context, twoFactor *TwoFactor) error {
+	if twoFactor == nil {
+		return errors.New("two-factor cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID := twoFactor.UserID
+	previous, existed := r.twoFactors[userID]
+	copied := *twoFactor
+	r.twoFactors[userID] = &copied
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existed {
+			r.twoFactors[userID] = previous
+		} else {
+			delete(r.twoFactors, userID)
+		}
+	})
+	return nil
+}
+
+// FindTwoFactor retrieves a user's second factor
+func (r *InMemoryRepository) FindTwoFactor(ctx context.Context, userID string) (*TwoFactor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	twoFactor, exists := r.twoFactors[userID]
+	if !exists {
+		return nil, ErrTwoFactorNotFound
+	}
+	copied := *twoFactor
+	return &copied, nil
+}
+
+// MarkTwoFactorStepUsed records the time step of an accepted TOTP code. It
+// fails with ErrInvalidTwoFactorCode if that step or a later one was already used.
+func (r *InMemoryRepository) MarkTwoFactorStepUsed(ctx context.Context, userID string, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	twoFactor, exists := r.twoFactors[userID]
+	if !exists {
+		return ErrTwoFactorNotFound
+	}
+	if twoFactor.LastUsedStep >= step {
+		return ErrInvalidTwoFactorCode
+	}
+	previous := twoFactor.LastUsedStep
+	twoFactor.LastUsedStep = step
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		twoFactor.LastUsedStep = previous
+	})
 	return nil
 }
 
-// FindByToken retrieves a session by token
-func (r *Repository) FindByToken(token string) (*Model, error) {
-	// TODO: Implement token lookup
-	return nil, nil
+// DeleteTwoFactor removes a user's second factor and recovery codes
+func (r *InMemoryRepository) DeleteTwoFactor(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	twoFactor, hadTwoFactor := r.twoFactors[userID]
+	recoveryCodes, hadRecoveryCodes := r.recoveryCodes[userID]
+	delete(r.twoFactors, userID)
+	delete(r.recoveryCodes, userID)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if hadTwoFactor {
+			r.twoFactors[userID] = twoFactor
+		}
+		if hadRecoveryCodes {
+			r.recoveryCodes[userID] = recoveryCodes
+		}
+	})
+	return nil
 }
 
-// DeleteSession removes a session
-func (r *Repository) DeleteSession(token string) error {
-	delete(r.sessions, token)
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones
+func (r *InMemoryRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codes []*RecoveryCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, existed := r.recoveryCodes[userID]
+	r.recoveryCodes[userID] = codes
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existed {
+			r.recoveryCodes[userID] = previous
+		} else {
+			delete(r.recoveryCodes, userID)
+		}
+	})
 	return nil
 }
+
+// UseRecoveryCode consumes one of a user's recovery codes. It fails with
+// ErrInvalidTwoFactorCode if no unused code matches.
+func (r *InMemoryRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, code := range r.recoveryCodes[userID] {
+		if code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &usedAt
+			database.OnRollback(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				code.UsedAt = nil
+			})
+			return nil
+		}
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// CreateOIDCIdentity links an external identity to a user
+func (r *InMemoryRepository) CreateOIDCIdentity(ctx context.Context, identity *OIDCIdentity) error {
+	if identity == nil {
+		return errors.New("identity cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identity.Provider + "|" + identity.Subject
+	if _, exists := r.identities[key]; exists {
+		return errors.New("identity already linked")
+	}
+	r.identities[key] = identity
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.identities, key)
+	})
+	return nil
+}
+
+// FindOIDCIdentity retrieves the identity a provider knows by subject
+func (r *InMemoryRepository) FindOIDCIdentity(ctx context.Context, provider, subject string) (*OIDCIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	identity, exists := r.identities[provider+"|"+subject]
+	if !exists {
+		return nil, ErrIdentityNotFound
+	}
+	copied := *identity
+	return &copied, nil
+}
+
+// FindLoginAttempt retrieves the failed login state for a key
+func (r *InMemoryRepository) FindLoginAttempt(ctx context.Context, key string) (*LoginAttempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attempt, exists := r.loginAttempts[key]
+	if !exists {
+		return nil, ErrLoginAttemptNotFound
+	}
+	copied := *attempt
+	return &copied, nil
+}
+
+// UpdateLoginAttempt applies fn to the failed login state for a key,
+// starting from an empty one, stores the result and returns a copy of it.
+// Concurrent updates of one key run one after the other.
+func (r *InMemoryRepository) UpdateLoginAttempt(ctx context.Context, key string, fn func(attempt *LoginAttempt)) (*LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, existed := r.loginAttempts[key]
+	attempt := &LoginAttempt{Key: key}
+	if existed {
+		copied := *previous
+		attempt = &copied
+	}
+	fn(attempt)
+	r.loginAttempts[key] = attempt
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existed {
+			r.loginAttempts[key] = previous
+		} else {
+			delete(r.loginAttempts, key)
+		}
+	})
+
+	copied := *attempt
+	return &copied, nil
+}
+
+// DeleteLoginAttempt clears the failed login state for a key
+func (r *InMemoryRepository) DeleteLoginAttempt(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, existed := r.loginAttempts[key]
+	delete(r.loginAttempts, key)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existed {
+			r.loginAttempts[key] = attempt
+		}
+	})
+	return nil
+}
+
+// CreateAPIKey stores a new API key
+func (r *InMemoryRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if key == nil {
+		return errors.New("API key cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.apiKeys[key.KeyHash] = key
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.apiKeys, key.KeyHash)
+	})
+	return nil
+}
+
+// FindAPIKey retrieves an API key by its hash
+func (r *InMemoryRepository) FindAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, exists := r.apiKeys[keyHash]
+	if !exists {
+		return nil, ErrAPIKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// FindAPIKeysByUser retrieves all API keys belonging to a user
+func (r *InMemoryRepository) FindAPIKeysByUser(ctx context.Context, userID string) ([]*APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*APIKey, 0)
+	for _, key := range r.apiKeys {
+		if key.UserID == userID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (r *InMemoryRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.apiKeys {
+		if key.ID == id {
+			previous := key.LastUsedAt
+			key.LastUsedAt = &usedAt
+			database.OnRollback(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				key.LastUsedAt = previous
+			})
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// RevokeAPIKey marks an API key as revoked
+func (r *InMemoryRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.apiKeys {
+		if key.ID == id {
+			if key.RevokedAt == nil {
+				now := time.Now()
+				key.RevokedAt = &now
+				database.OnRollback(ctx, func() {
+					r.mu.Lock()
+					defer r.mu.Unlock()
+					key.RevokedAt = nil
+				})
+			}
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// CreatePasskey stores a new passkey
+func (r *InMemoryRepository) CreatePasskey(ctx context.Context, passkey *Passkey) error {
+	if passkey == nil {
+		return errors.New("passkey cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.passkeys[passkey.CredentialID]; exists {
+		return ErrPasskeyExists
+	}
+	r.passkeys[passkey.CredentialID] = passkey
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.passkeys, passkey.CredentialID)
+	})
+	return nil
+}
+
+// FindPasskey retrieves a passkey by its credential ID
+func (r *InMemoryRepository) FindPasskey(ctx context.Context, credentialID string) (*Passkey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	passkey, exists := r.passkeys[credentialID]
+	if !exists {
+		return nil, ErrPasskeyNotFound
+	}
+	copied := *passkey
+	return &copied, nil
+}
+
+// FindPasskeysByUser retrieves all passkeys of a user, oldest first
+func (r *InMemoryRepository) FindPasskeysByUser(ctx context.Context, userID string) ([]*Passkey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	passkeys := make([]*Passkey, 0)
+	for _, passkey := range r.passkeys {
+		if passkey.UserID == userID {
+			copied := *passkey
+			passkeys = append(passkeys, &copied)
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].CreatedAt.Before(passkeys[j].CreatedAt)
+	})
+	return passkeys, nil
+}
+
+// UpdatePasskeyUsage records a sign-in with a passkey
+func (r *InMemoryRepository) UpdatePasskeyUsage(ctx context.Context, id string, signCount int64, backedUp bool, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, passkey := range r.passkeys {
+		if passkey.ID == id {
+			previous := *passkey
+			passkey.SignCount = signCount
+			passkey.BackedUp = backedUp
+			passkey.LastUsedAt = &usedAt
+			database.OnRollback(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				passkey.SignCount = previous.SignCount
+				passkey.BackedUp = previous.BackedUp
+				passkey.LastUsedAt = previous.LastUsedAt
+			})
+			return nil
+		}
+	}
+	return ErrPasskeyNotFound
+}
+
+// DeletePasskey removes one of a user's passkeys
+func (r *InMemoryRepository) DeletePasskey(ctx context.Context, userID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for credentialID, passkey := range r.passkeys {
+		if passkey.ID == id && passkey.UserID == userID {
+			delete(r.passkeys, credentialID)
+			database.OnRollback(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.passkeys[credentialID] = passkey
+			})
+			return nil
+		}
+	}
+	return ErrPasskeyNotFound
+}
+
+// CreatePasskeyChallenge stores a started passkey ceremony and drops
+// expired ones
+func (r *InMemoryRepository) CreatePasskeyChallenge(ctx context.Context, challenge *PasskeyChallenge) error {
+	if challenge == nil {
+		return errors.New("passkey challenge cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	expired := deleteWhere(r.challenges, func(c *PasskeyChallenge) bool { return now.After(c.ExpiresAt) })
+	copied := *challenge
+	r.challenges[challenge.IDHash] = &copied
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.challenges, challenge.IDHash)
+		restore(r.challenges, expired)
+	})
+	return nil
+}
+
+// TakePasskeyChallenge removes and returns a started passkey ceremony
+func (r *InMemoryRepository) TakePasskeyChallenge(ctx context.Context, idHash string) (*PasskeyChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge, exists := r.challenges[idHash]
+	if !exists {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+	delete(r.challenges, idHash)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.challenges[idHash] = challenge
+	})
+	return challenge, nil
+}
+
+// CreateOIDCLoginState stores a pending provider login and drops expired ones
+func (r *InMemoryRepository) CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error {
+	if state == nil {
+		return errors.New("login state cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	expired := deleteWhere(r.oidcLogins, func(s *OIDCLoginState) bool { return now.After(s.ExpiresAt) })
+	copied := *state
+	r.oidcLogins[state.StateHash] = &copied
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.oidcLogins, state.StateHash)
+		restore(r.oidcLogins, expired)
+	})
+	return nil
+}
+
+// TakeOIDCLoginState removes and returns a pending provider login
+func (r *InMemoryRepository) TakeOIDCLoginState(ctx context.Context, stateHash string) (*OIDCLoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, exists := r.oidcLogins[stateHash]
+	if !exists {
+		return nil, ErrInvalidOIDCState
+	}
+	delete(r.oidcLogins, stateHash)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.oidcLogins[stateHash] = state
+	})
+	return state, nil
+}
+
+// CreateLoginEvent appends an entry to the login history
+func (r *InMemoryRepository) CreateLoginEvent(ctx context.Context, event *LoginEvent) error {
+	if event == nil {
+		return errors.New("login event cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.loginEvents = append(r.loginEvents, event)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.loginEvents = removeEvents(r.loginEvents, func(e *LoginEvent) bool { return e == event })
+	})
+	return nil
+}
+
+// FindLoginEventsByUser retrieves a user's most recent login events, newest first
+func (r *InMemoryRepository) FindLoginEventsByUser(ctx context.Context, userID string, limit int) ([]*LoginEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := make([]*LoginEvent, 0)
+	for i := len(r.loginEvents) - 1; i >= 0 && len(events) < limit; i-- {
+		if event := r.loginEvents[i]; event.UserID == userID {
+			copied := *event
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
+
+// HasLoggedInFrom reports whether a user has signed in successfully from a user agent before
+func (r *InMemoryRepository) HasLoggedInFrom(ctx context.Context, userID, userAgent string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, event := range r.loginEvents {
+		if event.UserID == userID && event.Success && event.UserAgent == userAgent {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteUserData removes everything stored about a user, for account
+// deletion. Pending provider logins are not tied to an account and expire
+// within minutes. Login attempts are kept by email address, so the service
+// clears the user's.
+func (r *InMemoryRepository) DeleteUserData(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := deleteWhere(r.sessions, func(s *Model) bool { return s.UserID == userID })
+	refreshTokens := deleteWhere(r.refreshTokens, func(t *RefreshToken) bool { return t.UserID == userID })
+	resetTokens := deleteWhere(r.resetTokens, func(t *PasswordResetToken) bool { return t.UserID == userID })
+	magicLinks := deleteWhere(r.magicLinks, func(l *MagicLink) bool { return l.UserID == userID })
+	universities := deleteWhere(r.universities, func(v *UniversityVerification) bool { return v.UserID == userID })
+	identities := deleteWhere(r.identities, func(i *OIDCIdentity) bool { return i.UserID == userID })
+	apiKeys := deleteWhere(r.apiKeys, func(k *APIKey) bool { return k.UserID == userID })
+	passkeys := deleteWhere(r.passkeys, func(p *Passkey) bool { return p.UserID == userID })
+	challenges := deleteWhere(r.challenges, func(c *PasskeyChallenge) bool { return c.UserID == userID })
+	twoFactor, hadTwoFactor := r.twoFactors[userID]
+	recoveryCodes, hadRecoveryCodes := r.recoveryCodes[userID]
+	delete(r.twoFactors, userID)
+	delete(r.recoveryCodes, userID)
+
+	var events []*LoginEvent
+	r.loginEvents = removeEvents(r.loginEvents, func(e *LoginEvent) bool {
+		if e.UserID == userID {
+			events = append(events, e)
+			return true
+		}
+		return false
+	})
+
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		restore(r.sessions, sessions)
+		restore(r.refreshTokens, refreshTokens)
+		restore(r.resetTokens, resetTokens)
+		restore(r.magicLinks, magicLinks)
+		restore(r.universities, universities)
+		restore(r.identities, identities)
+		restore(r.apiKeys, apiKeys)
+		restore(r.passkeys, passkeys)
+		restore(r.challenges, challenges)
+		if hadTwoFactor {
+			r.twoFactors[userID] = twoFactor
+		}
+		if hadRecoveryCodes {
+			r.recoveryCodes[userID] = recoveryCodes
+		}
+		// Put back only this user's events, so events written meanwhile stay
+		r.loginEvents = append(r.loginEvents, events...)
+		sort.SliceStable(r.loginEvents, func(i, j int) bool {
+			return r.loginEvents[i].CreatedAt.Before(r.loginEvents[j].CreatedAt)
+		})
+	})
+	return nil
+}
+
+// removeEvents returns events without the ones that match, keeping the order
+func removeEvents(events []*LoginEvent, match func(*LoginEvent) bool) []*LoginEvent {
+	kept := make([]*LoginEvent, 0, len(events))
+	for _, event := range events {
+		if !match(event) {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+// deleteWhere removes the entries of m that match and returns them
+func deleteWhere[K comparable, V any](m map[K]V, match func(V) bool) map[K]V {
+	removed := make(map[K]V)
+	for key, value := range m {
+		if match(value) {
+			removed[key] = value
+			delete(m, key)
+		}
+	}
+	return removed
+}
+
+// restore puts entries removed by deleteWhere back
+func restore[K comparable, V any](m map[K]V, entries map[K]V) {
+	for key, value := range entries {
+		m[key] = value
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Repository defines the interface for authentication data access
+type Repository interface {
+	CreateSession(ctx context.Context, session *Model) error
+	FindSession(ctx context.Context, id string) (*Model, error)
+	FindSessionsByUser(ctx context.Context, userID string) ([]*Model, error)
+	TouchSession(ctx context.Context, id string, seenAt time.Time, client ClientInfo) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userID, exceptID string) error
+	DeleteSession(ctx context.Context, id string) error
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindByToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id string, usedAt time.Time) error
+	CreatePasswordReset(ctx context.Context, token *PasswordResetToken) error
+	FindPasswordReset(ctx context.Context, tokenHash string) (*PasswordResetToken, error)
+	MarkPasswordResetUsed(ctx context.Context, id string, usedAt time.Time) error
+	InvalidatePasswordResets(ctx context.Context, userID string) error
+	CreateMagicLink(ctx context.Context, link *MagicLink) error
+	FindMagicLink(ctx context.Context, id string) (*MagicLink, error)
+	MarkMagicLinkUsed(ctx context.Context, id string, usedAt time.Time) error
+	InvalidateMagicLinks(ctx context.Context, userID string) error
+	CreateUniversityVerification(ctx context.Context, verification *UniversityVerification) error
+	TakeUniversityVerification(ctx context.Context, id string) (*UniversityVerification, error)
+	SaveTwoFactor(ctx context.Context, twoFactor *TwoFactor) error
+	FindTwoFactor(ctx context.Context, userID string) (*TwoFactor, error)
+	MarkTwoFactorStepUsed(ctx context.Context, userID string, step int64) error
+	DeleteTwoFactor(ctx context.Context, userID string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codes []*RecoveryCode) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string, usedAt time.Time) error
+	CreateOIDCIdentity(ctx context.Context, identity *OIDCIdentity) error
+	FindOIDCIdentity(ctx context.Context, provider, subject string) (*OIDCIdentity, error)
+	FindLoginAttempt(ctx context.Context, key string) (*LoginAttempt, error)
+	UpdateLoginAttempt(ctx context.Context, key string, fn func(attempt *LoginAttempt)) (*LoginAttempt, error)
+	DeleteLoginAttempt(ctx context.Context, key string) error
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	FindAPIKey(ctx context.Context, keyHash string) (*APIKey, error)
+	FindAPIKeysByUser(ctx context.Context, userID string) ([]*APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+	RevokeAPIKey(ctx context.Context, id string) error
+	CreatePasskey(ctx context.Context, passkey *Passkey) error
+	FindPasskey(ctx context.Context, credentialID string) (*Passkey, error)
+	FindPasskeysByUser(ctx context.Context, userID string) ([]*Passkey, error)
+	UpdatePasskeyUsage(ctx context.Context, id string, signCount int64, backedUp bool, usedAt time.Time) error
+	DeletePasskey(ctx context.Context, userID, id string) error
+	CreatePasskeyChallenge(ctx context.Context, challenge *PasskeyChallenge) error
+	TakePasskeyChallenge(ctx context.Context, idHash string) (*PasskeyChallenge, error)
+	CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error
+	TakeOIDCLoginState(ctx context.Context, stateHash string) (*OIDCLoginState, error)
+	CreateLoginEvent(ctx context.Context, event *LoginEvent) error
+	FindLoginEventsByUser(ctx context.Context, userID string, limit int) ([]*LoginEvent, error)
+	HasLoggedInFrom(ctx context.Context, userID, userAgent string) (bool, error)
+	DeleteUserData(ctx context.Context, userID string) error
+}
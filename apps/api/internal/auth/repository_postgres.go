@@ -0,0 +1,991 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"sanctor/internal/database"
+)
+
+// PostgresRepository implements Repository interface for PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a new PostgreSQL auth repository
+func NewPostgresRepository(db *database.DB) Repository {
+	return &PostgresRepository{db: db}
+}
+
+// CreateSession stores a new authentication session
+func (r *PostgresRepository) CreateSession(ctx context.Context, session *Model) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if session == nil {
+		return errors.New("session cannot be nil")
+	}
+
+	query := `
+		INSERT INTO auth_sessions (
+			id, user_id, user_agent, ip_address, last_seen_at,
+			expires_at, created_at, revoked_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.ExecContext(ctx, query, session.ID, session.UserID, session.UserAgent, session.IPAddress,
+		session.LastSeenAt, session.ExpiresAt, session.CreatedAt, session.RevokedAt)
+	return err
+}
+
+// FindSession retrieves a session by ID
+func (r *PostgresRepository) FindSession(ctx context.Context, id string) (*Model, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	session := &Model{}
+	query := `SELECT id, user_id, user_agent, ip_address, last_seen_at,
+	                 expires_at, created_at, revoked_at
+	          FROM auth_sessions WHERE id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&session.ID, &session.UserID, &session.UserAgent,
+		&session.IPAddress, &session.LastSeenAt, &session.ExpiresAt, &session.CreatedAt,
+		&session.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// FindSessionsByUser retrieves all sessions belonging to a user
+func (r *PostgresRepository) FindSessionsByUser(ctx context.Context, userID string) ([]*Model, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	query := `SELECT id, user_id, user_agent, ip_address, last_seen_at,
+	                 expires_at, created_at, revoked_at
+	          FROM auth_sessions WHERE user_id = $1 ORDER BY last_seen_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Model{}
+	for rows.Next() {
+		session := &Model{}
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent,
+			&session.IPAddress, &session.LastSeenAt, &session.ExpiresAt, &session.CreatedAt,
+			&session.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records recent activity on a session
+func (r *PostgresRepository) TouchSession(ctx context.Context, id string, seenAt time.Time, client ClientInfo) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE auth_sessions SET
+			last_seen_at = $2,
+			user_agent = COALESCE(NULLIF($3, ''), user_agent),
+			ip_address = COALESCE(NULLIF($4, ''), ip_address)
+		WHERE id = $1
+	`
+	result, err := r.db.ExecContext(ctx, query, id, seenAt, client.UserAgent, client.IPAddress)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSession marks a session, and with it every refresh token in its family, as revoked
+func (r *PostgresRepository) RevokeSession(ctx context.Context, id string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_sessions SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of a user except exceptID
+func (r *PostgresRepository) RevokeUserSessions(ctx context.Context, userID, exceptID string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_sessions SET revoked_at = $3
+	          WHERE user_id = $1 AND id::text <> $2 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID, exceptID, time.Now())
+	return err
+}
+
+// DeleteSession removes a session and its refresh tokens
+func (r *PostgresRepository) DeleteSession(ctx context.Context, id string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE session_id = $1`, id); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM auth_sessions WHERE id = $1`, id)
+	return err
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *PostgresRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if token == nil {
+		return errors.New("refresh token cannot be nil")
+	}
+
+	query := `
+		INSERT INTO refresh_tokens (id, session_id, user_id, token_hash, expires_at, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.ExecContext(ctx, query, token.ID, token.SessionID, token.UserID, token.TokenHash,
+		token.ExpiresAt, token.UsedAt, token.CreatedAt)
+	return err
+}
+
+// FindByToken retrieves a refresh token by its hash
+func (r *PostgresRepository) FindByToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	token := &RefreshToken{}
+	query := `SELECT id, session_id, user_id, token_hash, expires_at, used_at, created_at
+	          FROM refresh_tokens WHERE token_hash = $1`
+
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&token.ID, &token.SessionID, &token.UserID,
+		&token.TokenHash, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// MarkRefreshTokenUsed records that a refresh token has been exchanged.
+// The conditional update makes concurrent exchanges of the same token
+// fail with ErrRefreshTokenReused for every caller but one.
+func (r *PostgresRepository) MarkRefreshTokenUsed(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE refresh_tokens SET used_at = $2 WHERE id = $1 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+// CreatePasswordReset stores a new password reset token
+func (r *PostgresRepository) CreatePasswordReset(ctx context.Context, token *PasswordResetToken) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if token == nil {
+		return errors.New("reset token cannot be nil")
+	}
+
+	query := `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.ExecContext(ctx, query, token.ID, token.UserID, token.TokenHash,
+		token.ExpiresAt, token.UsedAt, token.CreatedAt)
+	return err
+}
+
+// FindPasswordReset retrieves a password reset token by its hash
+func (r *PostgresRepository) FindPasswordReset(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	token := &PasswordResetToken{}
+	query := `SELECT id, user_id, token_hash, expires_at, used_at, created_at
+	          FROM password_reset_tokens WHERE token_hash = $1`
+
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&token.ID, &token.UserID, &token.TokenHash,
+		&token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// MarkPasswordResetUsed consumes a password reset token. It fails with
+// ErrInvalidResetToken if the token was already used.
+func (r *PostgresRepository) MarkPasswordResetUsed(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE password_reset_tokens SET used_at = $2 WHERE id = $1 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrInvalidResetToken
+	}
+	return nil
+}
+
+// InvalidatePasswordResets consumes every outstanding reset token of a user
+func (r *PostgresRepository) InvalidatePasswordResets(ctx context.Context, userID string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE password_reset_tokens SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID, time.Now())
+	return err
+}
+
+// CreateMagicLink stores a new magic link
+func (r *PostgresRepository) CreateMagicLink(ctx context.Context, link *MagicLink) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if link == nil {
+		return errors.New("magic link cannot be nil")
+	}
+
+	query := `
+		INSERT INTO auth_magic_links (id, user_id, binding_hash, expires_at, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.ExecContext(ctx, query, link.ID, link.UserID, link.BindingHash,
+		link.ExpiresAt, link.UsedAt, link.CreatedAt)
+	return err
+}
+
+// FindMagicLink retrieves a magic link by ID
+func (r *PostgresRepository) FindMagicLink(ctx context.Context, id string) (*MagicLink, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	link := &MagicLink{}
+	query := `SELECT id, user_id, binding_hash, expires_at, used_at, created_at
+	          FROM auth_magic_links WHERE id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&link.ID, &link.UserID, &link.BindingHash,
+		&link.ExpiresAt, &link.UsedAt, &link.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// MarkMagicLinkUsed consumes a magic link. It fails with ErrInvalidMagicLink
+// if the link was already used.
+func (r *PostgresRepository) MarkMagicLinkUsed(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_magic_links SET used_at = $2 WHERE id = $1 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrInvalidMagicLink
+	}
+	return nil
+}
+
+// InvalidateMagicLinks consumes every outstanding magic link of a user
+func (r *PostgresRepository) InvalidateMagicLinks(ctx context.Context, userID string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_magic_links SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID, time.Now())
+	return err
+}
+
+// CreateUniversityVerification stores a mailed university confirmation link
+// and drops expired ones
+func (r *PostgresRepository) CreateUniversityVerification(ctx context.Context, verification *UniversityVerification) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if verification == nil {
+		return errors.New("university verification cannot be nil")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM auth_university_verifications WHERE expires_at < $1`, time.Now()); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO auth_university_verifications (id, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := r.db.ExecContext(ctx, query, verification.ID, verification.UserID,
+		verification.ExpiresAt, verification.CreatedAt)
+	return err
+}
+
+// TakeUniversityVerification removes and returns a university confirmation
+// link. Of two concurrent calls only one gets it.
+func (r *PostgresRepository) TakeUniversityVerification(ctx context.Context, id string) (*UniversityVerification, error) {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	verification := &UniversityVerification{}
+	query := `DELETE FROM auth_university_verifications WHERE id = $1
+	          RETURNING id, user_id, expires_at, created_at`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&verification.ID, &verification.UserID,
+		&verification.ExpiresAt, &verification.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return verification, nil
+}
+
+// SaveTwoFactor creates or replaces a user's second factor
+func (r *PostgresRepository) SaveTwoFactor(ctx context.Context, twoFactor *TwoFactor) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if twoFactor == nil {
+		return errors.New("two-factor cannot be nil")
+	}
+
+	query := `
+		INSERT INTO auth_two_factors (user_id, secret, last_used_step, confirmed_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_used_step = EXCLUDED.last_used_step,
+			confirmed_at = EXCLUDED.confirmed_at,
+			created_at = EXCLUDED.created_at
+	`
+	_, err := r.db.ExecContext(ctx, query, twoFactor.UserID, twoFactor.Secret, twoFactor.LastUsedStep,
+		twoFactor.ConfirmedAt, twoFactor.CreatedAt)
+	return err
+}
+
+// FindTwoFactor retrieves a user's second factor
+func (r *PostgresRepository) FindTwoFactor(ctx context.Context, userID string) (*TwoFactor, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	twoFactor := &TwoFactor{}
+	query := `SELECT user_id, secret, last_used_step, confirmed_at, created_at
+	          FROM auth_two_factors WHERE user_id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&twoFactor.UserID, &twoFactor.Secret,
+		&twoFactor.LastUsedStep, &twoFactor.ConfirmedAt, &twoFactor.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTwoFactorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return twoFactor, nil
+}
+
+// MarkTwoFactorStepUsed records the time step of an accepted TOTP code. The
+// conditional update rejects a code replayed within its validity window.
+func (r *PostgresRepository) MarkTwoFactorStepUsed(ctx context.Context, userID string, step int64) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_two_factors SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// DeleteTwoFactor removes a user's second factor and recovery codes
+func (r *PostgresRepository) DeleteTwoFactor(ctx context.Context, userID string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM auth_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM auth_two_factors WHERE user_id = $1`, userID)
+	return err
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones
+func (r *PostgresRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codes []*RecoveryCode) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM auth_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO auth_recovery_codes (id, user_id, code_hash, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	for _, code := range codes {
+		if _, err := r.db.ExecContext(ctx, query, code.ID, code.UserID, code.CodeHash, code.UsedAt, code.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes one of a user's recovery codes. It fails with
+// ErrInvalidTwoFactorCode if no unused code matches.
+func (r *PostgresRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string, usedAt time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_recovery_codes SET used_at = $3
+	          WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash, usedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// CreateOIDCIdentity links an external identity to a user
+func (r *PostgresRepository) CreateOIDCIdentity(ctx context.Context, identity *OIDCIdentity) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if identity == nil {
+		return errors.New("identity cannot be nil")
+	}
+
+	query := `
+		INSERT INTO auth_oidc_identities (id, user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.ExecContext(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.Subject,
+		identity.Email, identity.CreatedAt)
+	return err
+}
+
+// FindOIDCIdentity retrieves the identity a provider knows by subject
+func (r *PostgresRepository) FindOIDCIdentity(ctx context.Context, provider, subject string) (*OIDCIdentity, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	identity := &OIDCIdentity{}
+	query := `SELECT id, user_id, provider, subject, email, created_at
+	          FROM auth_oidc_identities WHERE provider = $1 AND subject = $2`
+
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(&identity.ID, &identity.UserID,
+		&identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// FindLoginAttempt retrieves the failed login state for a key
+func (r *PostgresRepository) FindLoginAttempt(ctx context.Context, key string) (*LoginAttempt, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	attempt := &LoginAttempt{}
+	query := `SELECT key, failures, last_failure_at, locked_until
+	          FROM auth_login_attempts WHERE key = $1`
+
+	err := r.db.QueryRowContext(ctx, query, key).Scan(&attempt.Key, &attempt.Failures,
+		&attempt.LastFailureAt, &attempt.LockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, ErrLoginAttemptNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// UpdateLoginAttempt applies fn to the failed login state for a key,
+// starting from an empty one, stores the result and returns it. The row is
+// locked while fn runs, so concurrent failures of one key all count.
+func (r *PostgresRepository) UpdateLoginAttempt(ctx context.Context, key string, fn func(attempt *LoginAttempt)) (*LoginAttempt, error) {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	attempt := &LoginAttempt{}
+	err := r.db.Transaction(ctx, func(ctx context.Context) error {
+		// Make sure there is a row to lock
+		_, err := r.db.ExecContext(ctx, `
+			INSERT INTO auth_login_attempts (key, failures, last_failure_at)
+			VALUES ($1, 0, $2)
+			ON CONFLICT (key) DO NOTHING
+		`, key, time.Time{})
+		if err != nil {
+			return err
+		}
+
+		query := `SELECT key, failures, last_failure_at, locked_until
+		          FROM auth_login_attempts WHERE key = $1 FOR UPDATE`
+		err = r.db.QueryRowContext(ctx, query, key).Scan(&attempt.Key, &attempt.Failures,
+			&attempt.LastFailureAt, &attempt.LockedUntil)
+		if err != nil {
+			return err
+		}
+
+		fn(attempt)
+		_, err = r.db.ExecContext(ctx, `
+			UPDATE auth_login_attempts SET failures = $2, last_failure_at = $3, locked_until = $4
+			WHERE key = $1
+		`, key, attempt.Failures, attempt.LastFailureAt, attempt.LockedUntil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// DeleteLoginAttempt clears the failed login state for a key
+func (r *PostgresRepository) DeleteLoginAttempt(ctx context.Context, key string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM auth_login_attempts WHERE key = $1`, key)
+	return err
+}
+
+// CreateAPIKey stores a new API key
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if key == nil {
+		return errors.New("API key cannot be nil")
+	}
+
+	query := `
+		INSERT INTO auth_api_keys (
+			id, user_id, name, prefix, key_hash, scopes,
+			expires_at, last_used_at, created_at, revoked_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := r.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes,
+		key.ExpiresAt, key.LastUsedAt, key.CreatedAt, key.RevokedAt)
+	return err
+}
+
+// FindAPIKey retrieves an API key by its hash
+func (r *PostgresRepository) FindAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	key := &APIKey{}
+	query := `SELECT id, user_id, name, prefix, key_hash, scopes,
+	                 expires_at, last_used_at, created_at, revoked_at
+	          FROM auth_api_keys WHERE key_hash = $1`
+
+	err := r.db.QueryRowContext(ctx, query, keyHash).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix,
+		&key.KeyHash, &key.Scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// FindAPIKeysByUser retrieves all API keys belonging to a user
+func (r *PostgresRepository) FindAPIKeysByUser(ctx context.Context, userID string) ([]*APIKey, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	query := `SELECT id, user_id, name, prefix, key_hash, scopes,
+	                 expires_at, last_used_at, created_at, revoked_at
+	          FROM auth_api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key := &APIKey{}
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes,
+			&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// TouchAPIKey records when an API key was last used
+func (r *PostgresRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_api_keys SET last_used_at = $2 WHERE id = $1`, id, usedAt)
+	return err
+}
+
+// RevokeAPIKey marks an API key as revoked
+func (r *PostgresRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// CreatePasskey stores a new passkey
+func (r *PostgresRepository) CreatePasskey(ctx context.Context, passkey *Passkey) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if passkey == nil {
+		return errors.New("passkey cannot be nil")
+	}
+
+	query := `
+		INSERT INTO auth_passkeys (
+			id, user_id, credential_id, public_key, sign_count, transports,
+			name, backed_up, last_used_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (credential_id) DO NOTHING
+	`
+	result, err := r.db.ExecContext(ctx, query, passkey.ID, passkey.UserID, passkey.CredentialID, passkey.PublicKey,
+		passkey.SignCount, passkey.Transports, passkey.Name, passkey.BackedUp, passkey.LastUsedAt, passkey.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrPasskeyExists
+	}
+	return nil
+}
+
+// FindPasskey retrieves a passkey by its credential ID
+func (r *PostgresRepository) FindPasskey(ctx context.Context, credentialID string) (*Passkey, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	passkey := &Passkey{}
+	query := `SELECT id, user_id, credential_id, public_key, sign_count, transports,
+	                 name, backed_up, last_used_at, created_at
+	          FROM auth_passkeys WHERE credential_id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, credentialID).Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID,
+		&passkey.PublicKey, &passkey.SignCount, &passkey.Transports, &passkey.Name, &passkey.BackedUp,
+		&passkey.LastUsedAt, &passkey.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrPasskeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// FindPasskeysByUser retrieves all passkeys of a user, oldest first
+func (r *PostgresRepository) FindPasskeysByUser(ctx context.Context, userID string) ([]*Passkey, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	query := `SELECT id, user_id, credential_id, public_key, sign_count, transports,
+	                 name, backed_up, last_used_at, created_at
+	          FROM auth_passkeys WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []*Passkey{}
+	for rows.Next() {
+		passkey := &Passkey{}
+		if err := rows.Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID,
+			&passkey.PublicKey, &passkey.SignCount, &passkey.Transports, &passkey.Name, &passkey.BackedUp,
+			&passkey.LastUsedAt, &passkey.CreatedAt); err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+// UpdatePasskeyUsage records a sign-in with a passkey
+func (r *PostgresRepository) UpdatePasskeyUsage(ctx context.Context, id string, signCount int64, backedUp bool, usedAt time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE auth_passkeys SET sign_count = $2, backed_up = $3, last_used_at = $4 WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id, signCount, backedUp, usedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// DeletePasskey removes one of a user's passkeys
+func (r *PostgresRepository) DeletePasskey(ctx context.Context, userID, id string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM auth_passkeys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// CreatePasskeyChallenge stores a started passkey ceremony and drops
+// expired ones
+func (r *PostgresRepository) CreatePasskeyChallenge(ctx context.Context, challenge *PasskeyChallenge) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if challenge == nil {
+		return errors.New("passkey challenge cannot be nil")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM auth_passkey_challenges WHERE expires_at < $1`, time.Now()); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO auth_passkey_challenges (id_hash, user_id, challenge, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, challenge.IDHash, challenge.UserID, challenge.Challenge,
+		challenge.ExpiresAt, challenge.CreatedAt)
+	return err
+}
+
+// TakePasskeyChallenge removes and returns a started passkey ceremony. Of
+// two concurrent calls only one gets it.
+func (r *PostgresRepository) TakePasskeyChallenge(ctx context.Context, idHash string) (*PasskeyChallenge, error) {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	challenge := &PasskeyChallenge{}
+	query := `DELETE FROM auth_passkey_challenges WHERE id_hash = $1
+	          RETURNING id_hash, user_id, challenge, expires_at, created_at`
+
+	err := r.db.QueryRowContext(ctx, query, idHash).Scan(&challenge.IDHash, &challenge.UserID,
+		&challenge.Challenge, &challenge.ExpiresAt, &challenge.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// CreateOIDCLoginState stores a pending provider login and drops expired ones
+func (r *PostgresRepository) CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if state == nil {
+		return errors.New("login state cannot be nil")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM auth_oidc_login_states WHERE expires_at < $1`, time.Now()); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO auth_oidc_login_states (state_hash, provider, nonce, verifier, binding_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.ExecContext(ctx, query, state.StateHash, state.Provider, state.Nonce, state.Verifier,
+		state.BindingHash, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+// TakeOIDCLoginState removes and returns a pending provider login. Of two
+// concurrent calls only one gets it.
+func (r *PostgresRepository) TakeOIDCLoginState(ctx context.Context, stateHash string) (*OIDCLoginState, error) {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	state := &OIDCLoginState{}
+	query := `DELETE FROM auth_oidc_login_states WHERE state_hash = $1
+	          RETURNING state_hash, provider, nonce, verifier, binding_hash, expires_at, created_at`
+
+	err := r.db.QueryRowContext(ctx, query, stateHash).Scan(&state.StateHash, &state.Provider, &state.Nonce,
+		&state.Verifier, &state.BindingHash, &state.ExpiresAt, &state.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// CreateLoginEvent appends an entry to the login history
+func (r *PostgresRepository) CreateLoginEvent(ctx context.Context, event *LoginEvent) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if event == nil {
+		return errors.New("login event cannot be nil")
+	}
+
+	query := `
+		INSERT INTO auth_login_events (
+			id, user_id, method, success, failure_reason,
+			user_agent, ip_address, new_device, created_at
+		) VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.ExecContext(ctx, query, event.ID, event.UserID, event.Method, event.Success, event.FailureReason,
+		event.UserAgent, event.IPAddress, event.NewDevice, event.CreatedAt)
+	return err
+}
+
+// FindLoginEventsByUser retrieves a user's most recent login events, newest first
+func (r *PostgresRepository) FindLoginEventsByUser(ctx context.Context, userID string, limit int) ([]*LoginEvent, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	query := `SELECT id, user_id, method, success, failure_reason,
+	                 user_agent, ip_address, new_device, created_at
+	          FROM auth_login_events WHERE user_id = $1
+	          ORDER BY created_at DESC LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*LoginEvent{}
+	for rows.Next() {
+		event := &LoginEvent{}
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Method, &event.Success, &event.FailureReason,
+			&event.UserAgent, &event.IPAddress, &event.NewDevice, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// HasLoggedInFrom reports whether a user has signed in successfully from a user agent before
+func (r *PostgresRepository) HasLoggedInFrom(ctx context.Context, userID, userAgent string) (bool, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	var exists bool
+	query := `SELECT EXISTS (
+	              SELECT 1 FROM auth_login_events
+	              WHERE user_id = $1 AND success AND user_agent = $2
+	          )`
+	err := r.db.QueryRowContext(ctx, query, userID, userAgent).Scan(&exists)
+	return exists, err
+}
+
+// DeleteUserData removes everything stored about a user, for account
+// deletion. Pending provider logins are not tied to an account and expire
+// within minutes. Login attempts are kept by email address, so the service
+// clears the user's.
+func (r *PostgresRepository) DeleteUserData(ctx context.Context, userID string) error {
+	tables := []string{
+		"refresh_tokens", "auth_sessions", "password_reset_tokens", "auth_magic_links",
+		"auth_university_verifications", "auth_two_factors", "auth_recovery_codes", "auth_oidc_identities", "auth_api_keys",
+		"auth_passkeys", "auth_passkey_challenges", "auth_login_events",
+	}
+	return r.db.Transaction(ctx, func(ctx context.Context) error {
+		for _, table := range tables {
+			if _, err := r.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"sanctor/internal/database"
+)
+
+// seedRepository returns an in-memory repository holding one of each record
+// for user "ada", including expired ones that creating new records clears
+func seedRepository(t *testing.T) *InMemoryRepository {
+	t.Helper()
+	ctx := context.Background()
+	repo := NewRepository().(*InMemoryRepository)
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+
+	steps := []error{
+		repo.CreateSession(ctx, &Model{ID: "session", UserID: "ada", ExpiresAt: now.Add(time.Hour)}),
+		repo.CreateRefreshToken(ctx, &RefreshToken{ID: "refresh", SessionID: "session", UserID: "ada", TokenHash: "refresh-hash"}),
+		repo.CreatePasswordReset(ctx, &PasswordResetToken{ID: "reset", UserID: "ada", TokenHash: "reset-hash"}),
+		repo.CreateMagicLink(ctx, &MagicLink{ID: "link", UserID: "ada"}),
+		repo.CreateUniversityVerification(ctx, &UniversityVerification{ID: "university", UserID: "ada", ExpiresAt: expired}),
+		repo.SaveTwoFactor(ctx, &TwoFactor{UserID: "ada", Secret: "secret", LastUsedStep: 1}),
+		repo.ReplaceRecoveryCodes(ctx, "ada", []*RecoveryCode{{ID: "code", UserID: "ada", CodeHash: "code-hash"}}),
+		repo.CreateOIDCIdentity(ctx, &OIDCIdentity{ID: "identity", UserID: "ada", Provider: "google", Subject: "1"}),
+		repo.CreateAPIKey(ctx, &APIKey{ID: "key", UserID: "ada", KeyHash: "key-hash"}),
+		repo.CreatePasskey(ctx, &Passkey{ID: "passkey", UserID: "ada", CredentialID: "credential"}),
+		repo.CreatePasskeyChallenge(ctx, &PasskeyChallenge{IDHash: "challenge", UserID: "ada", ExpiresAt: expired}),
+		repo.CreateOIDCLoginState(ctx, &OIDCLoginState{StateHash: "state", ExpiresAt: expired}),
+		repo.CreateLoginEvent(ctx, &LoginEvent{ID: "event", UserID: "ada", Success: true, CreatedAt: expired}),
+	}
+	_, err := repo.UpdateLoginAttempt(ctx, "account:ada@example.com", func(a *LoginAttempt) { a.Failures = 2 })
+	steps = append(steps, err)
+	for _, err := range steps {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+// repositoryState is a deep copy of everything an in-memory repository holds
+type repositoryState struct {
+	Sessions      map[string]Model
+	RefreshTokens map[string]RefreshToken
+	ResetTokens   map[string]PasswordResetToken
+	MagicLinks    map[string]MagicLink
+	Universities  map[string]UniversityVerification
+	TwoFactors    map[string]TwoFactor
+	RecoveryCodes map[string][]RecoveryCode
+	Identities    map[string]OIDCIdentity
+	LoginAttempts map[string]LoginAttempt
+	APIKeys       map[string]APIKey
+	Passkeys      map[string]Passkey
+	Challenges    map[string]PasskeyChallenge
+	OIDCLogins    map[string]OIDCLoginState
+	LoginEvents   []LoginEvent
+}
+
+// snapshot copies the repository's state, so later changes to the stored
+// records do not show in it
+func snapshot(repo *InMemoryRepository) repositoryState {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	state := repositoryState{
+		Sessions:      copyValues(repo.sessions),
+		RefreshTokens: copyValues(repo.refreshTokens),
+		ResetTokens:   copyValues(repo.resetTokens),
+		MagicLinks:    copyValues(repo.magicLinks),
+		Universities:  copyValues(repo.universities),
+		TwoFactors:    copyValues(repo.twoFactors),
+		RecoveryCodes: make(map[string][]RecoveryCode),
+		Identities:    copyValues(repo.identities),
+		LoginAttempts: copyValues(repo.loginAttempts),
+		APIKeys:       copyValues(repo.apiKeys),
+		Passkeys:      copyValues(repo.passkeys),
+		Challenges:    copyValues(repo.challenges),
+		OIDCLogins:    copyValues(repo.oidcLogins),
+	}
+	for userID, codes := range repo.recoveryCodes {
+		for _, code := range codes {
+			state.RecoveryCodes[userID] = append(state.RecoveryCodes[userID], *code)
+		}
+	}
+	for _, event := range repo.loginEvents {
+		state.LoginEvents = append(state.LoginEvents, *event)
+	}
+	return state
+}
+
+// copyValues copies the records a map points to
+func copyValues[K comparable, V any](m map[K]*V) map[K]V {
+	copied := make(map[K]V, len(m))
+	for key, value := range m {
+		copied[key] = *value
+	}
+	return copied
+}
+
+func TestInMemoryRepositoryRollsBack(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		change func(ctx context.Context, repo *InMemoryRepository) error
+	}{
+		{"create session", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateSession(ctx, &Model{ID: "new", UserID: "ada"})
+		}},
+		{"touch session", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.TouchSession(ctx, "session", now, ClientInfo{UserAgent: "curl", IPAddress: "192.0.2.1"})
+		}},
+		{"revoke session", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.RevokeSession(ctx, "session")
+		}},
+		{"revoke user sessions", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.RevokeUserSessions(ctx, "ada", "")
+		}},
+		{"delete session", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.DeleteSession(ctx, "session")
+		}},
+		{"create refresh token", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateRefreshToken(ctx, &RefreshToken{ID: "new", SessionID: "session", UserID: "ada", TokenHash: "new-hash"})
+		}},
+		{"mark refresh token used", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.MarkRefreshTokenUsed(ctx, "refresh", now)
+		}},
+		{"create password reset", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreatePasswordReset(ctx, &PasswordResetToken{ID: "new", UserID: "ada", TokenHash: "new-hash"})
+		}},
+		{"mark password reset used", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.MarkPasswordResetUsed(ctx, "reset", now)
+		}},
+		{"invalidate password resets", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.InvalidatePasswordResets(ctx, "ada")
+		}},
+		{"create magic link", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateMagicLink(ctx, &MagicLink{ID: "new", UserID: "ada"})
+		}},
+		{"mark magic link used", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.MarkMagicLinkUsed(ctx, "link", now)
+		}},
+		{"invalidate magic links", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.InvalidateMagicLinks(ctx, "ada")
+		}},
+		{"create university verification", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateUniversityVerification(ctx, &UniversityVerification{ID: "new", UserID: "ada", ExpiresAt: now.Add(time.Hour)})
+		}},
+		{"take university verification", func(ctx context.Context, repo *InMemoryRepository) error {
+			_, err := repo.TakeUniversityVerification(ctx, "university")
+			return err
+		}},
+		{"replace two-factor", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.SaveTwoFactor(ctx, &TwoFactor{UserID: "ada", Secret: "other"})
+		}},
+		{"save first two-factor", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.SaveTwoFactor(ctx, &TwoFactor{UserID: "grace", Secret: "secret"})
+		}},
+		{"mark two-factor step used", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.MarkTwoFactorStepUsed(ctx, "ada", 2)
+		}},
+		{"delete two-factor", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.DeleteTwoFactor(ctx, "ada")
+		}},
+		{"replace recovery codes", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.ReplaceRecoveryCodes(ctx, "ada", []*RecoveryCode{{ID: "new", UserID: "ada", CodeHash: "new-hash"}})
+		}},
+		{"use recovery code", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.UseRecoveryCode(ctx, "ada", "code-hash", now)
+		}},
+		{"create OIDC identity", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateOIDCIdentity(ctx, &OIDCIdentity{ID: "new", UserID: "ada", Provider: "github", Subject: "1"})
+		}},
+		{"update login attempt", func(ctx context.Context, repo *InMemoryRepository) error {
+			_, err := repo.UpdateLoginAttempt(ctx, "account:ada@example.com", func(a *LoginAttempt) { a.Failures++ })
+			return err
+		}},
+		{"create login attempt", func(ctx context.Context, repo *InMemoryRepository) error {
+			_, err := repo.UpdateLoginAttempt(ctx, "ip:192.0.2.1", func(a *LoginAttempt) { a.Failures++ })
+			return err
+		}},
+		{"delete login attempt", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.DeleteLoginAttempt(ctx, "account:ada@example.com")
+		}},
+		{"create API key", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateAPIKey(ctx, &APIKey{ID: "new", UserID: "ada", KeyHash: "new-hash"})
+		}},
+		{"touch API key", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.TouchAPIKey(ctx, "key", now)
+		}},
+		{"revoke API key", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.RevokeAPIKey(ctx, "key")
+		}},
+		{"create passkey", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreatePasskey(ctx, &Passkey{ID: "new", UserID: "ada", CredentialID: "new-credential"})
+		}},
+		{"update passkey usage", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.UpdatePasskeyUsage(ctx, "passkey", 7, true, now)
+		}},
+		{"delete passkey", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.DeletePasskey(ctx, "ada", "passkey")
+		}},
+		{"create passkey challenge", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreatePasskeyChallenge(ctx, &PasskeyChallenge{IDHash: "new", ExpiresAt: now.Add(time.Hour)})
+		}},
+		{"take passkey challenge", func(ctx context.Context, repo *InMemoryRepository) error {
+			_, err := repo.TakePasskeyChallenge(ctx, "challenge")
+			return err
+		}},
+		{"create OIDC login state", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateOIDCLoginState(ctx, &OIDCLoginState{StateHash: "new", ExpiresAt: now.Add(time.Hour)})
+		}},
+		{"take OIDC login state", func(ctx context.Context, repo *InMemoryRepository) error {
+			_, err := repo.TakeOIDCLoginState(ctx, "state")
+			return err
+		}},
+		{"create login event", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.CreateLoginEvent(ctx, &LoginEvent{ID: "new", UserID: "ada", CreatedAt: now})
+		}},
+		{"delete user data", func(ctx context.Context, repo *InMemoryRepository) error {
+			return repo.DeleteUserData(ctx, "ada")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := seedRepository(t)
+			before := snapshot(repo)
+
+			errRollback := errors.New("roll back")
+			err := database.NewMemoryTransactor().Transaction(context.Background(), func(ctx context.Context) error {
+				if err := tt.change(ctx, repo); err != nil {
+					t.Fatal(err)
+				}
+				if reflect.DeepEqual(snapshot(repo), before) {
+					t.Fatal("the change did nothing")
+				}
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				t.Fatalf("got error %v, want the unit of work to fail", err)
+			}
+
+			if after := snapshot(repo); !reflect.DeepEqual(after, before) {
+				t.Errorf("the change was not undone:\ngot  %+v\nwant %+v", after, before)
+			}
+		})
+	}
+}
+
+func TestDeleteUserDataRollbackKeepsOtherEvents(t *testing.T) {
+	repo := seedRepository(t)
+	other := &LoginEvent{ID: "other", UserID: "grace", Success: true, CreatedAt: time.Now()}
+
+	err := database.NewMemoryTransactor().Transaction(context.Background(), func(ctx context.Context) error {
+		if err := repo.DeleteUserData(ctx, "ada"); err != nil {
+			return err
+		}
+		// Another request signs in while the deletion is in progress
+		if err := repo.CreateLoginEvent(context.Background(), other); err != nil {
+			return err
+		}
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("the unit of work succeeded")
+	}
+
+	for _, userID := range []string{"ada", "grace"} {
+		events, err := repo.FindLoginEventsByUser(context.Background(), userID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Errorf("%s: got %d login events, want 1", userID, len(events))
+		}
+	}
+}
@@ -1,100 +1,254 @@
 package auth
 
 import (
+	"context"
 	"errors"
-	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"sanctor/internal/database"
+	"sanctor/internal/mail"
+	"sanctor/internal/oidc"
+	"sanctor/internal/university"
 	"sanctor/internal/user"
+	"sanctor/internal/webauthn"
 )
 
-// Service handles authentication business logic
-// JWT secret (should be loaded from config/env)
-var jwtSecret = []byte(getJWTSecret())
+// Config holds the settings a Service is created with. Zero fields fall
+// back to development defaults.
+type Config struct {
+	// AppURL is the base URL of the web app, used to build links in emails
+	// and to scope passkeys by default
+	AppURL string
+	// AccessTokenTTL and RefreshTokenTTL are how long tokens are valid
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Keys signs and verifies tokens; the development HS256 secret by default
+	Keys *KeySet
+}
+
+// Default token lifetimes. Refresh tokens slide with every rotation, but a
+// session can never outlive sessionTTL.
+const (
+	defaultAppURL          = "http://localhost:3000"
+	defaultAccessTokenTTL  = 24 * time.Hour
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+	sessionTTL             = 30 * 24 * time.Hour
+)
+
+// Claims represents the claims carried by Sanctor access tokens
+type Claims struct {
+	UserID    string `json:"userId"`
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "your-secret-key"
+// lastSeenResolution limits how often token validation writes a session's last-seen time
+const lastSeenResolution = 5 * time.Minute
+
+// GenerateJWT creates a JWT token for a user session. The role is fixed for
+// the token's lifetime, so role changes revoke the user's sessions.
+func (s *Service) GenerateJWT(userID, sessionID, role string) (string, error) {
+	claims := Claims{
+		UserID:           userID,
+		SessionID:        sessionID,
+		Role:             role,
+		RegisteredClaims: s.keys.accessClaims(time.Now(), s.accessTokenTTL),
 	}
-	return secret
+	return s.keys.sign(claims)
 }
 
-// GenerateJWT creates a JWT token for a user
-func GenerateJWT(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"userId": userID,
-		"exp":    time.Now().Add(24 * time.Hour).Unix(),
+// ParseJWT parses and validates a JWT token and returns its claims. Tokens
+// for another issuer or audience, and tokens whose session has been revoked
+// or has expired, are rejected.
+func (s *Service) ParseJWT(ctx context.Context, tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	if err := s.keys.parseAccess(tokenStr, claims); err != nil {
+		return nil, errors.New("invalid token")
+	}
+	if claims.UserID == "" {
+		return nil, errors.New("userId not found in token")
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	if err := s.checkSession(ctx, claims.SessionID); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
-// ValidateJWT parses and validates a JWT token
-func ValidateJWT(tokenStr string) (string, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		return "", errors.New("invalid token")
+// checkSession verifies that the session a token was issued for is still active
+func (s *Service) checkSession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return errors.New("session not found in token")
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", errors.New("invalid claims")
+
+	session, err := s.repo.FindSession(ctx, sessionID)
+	if err != nil || !session.IsActive() {
+		return ErrSessionRevoked
 	}
-	userID, ok := claims["userId"].(string)
-	if !ok {
-		return "", errors.New("userId not found in token")
+
+	if time.Since(session.LastSeenAt) > lastSeenResolution {
+		_ = s.repo.TouchSession(ctx, session.ID, time.Now(), ClientInfo{})
 	}
-	return userID, nil
+	return nil
 }
 
+// Service handles authentication business logic
 type Service struct {
-	repo        *Repository
-	userService *user.Service
+	repo               Repository
+	tx                 database.Transactor
+	userService        *user.Service
+	mailer             mail.Sender
+	universities       *university.Registry
+	verificationResend *throttle
+	passwordResets     *throttle
+	magicLinks         *throttle
+	twoFactorAttempts  *throttle
+	passwordChanges    *throttle
+	providers          map[string]*oidc.Provider
+	relyingParty       *webauthn.RelyingParty
+	bootstrapAdmins    map[string]bool
+	appURL             string
+	accessTokenTTL     time.Duration
+	refreshTokenTTL    time.Duration
+	keys               *KeySet
+	onReactivate       func(ctx context.Context, userID string) error
+	background         sync.WaitGroup
 }
 
-// NewService creates a new instance of the Service
-func NewService(repo *Repository, userService *user.Service) *Service {
+// NewService creates a new instance of the Service. Changes spanning
+// several writes run as units of work on tx, which must match the
+// repositories' storage.
+func NewService(repo Repository, tx database.Transactor, userService *user.Service, mailer mail.Sender, universities *university.Registry, config Config) *Service {
+	if config.AppURL == "" {
+		config.AppURL = defaultAppURL
+	}
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = defaultAccessTokenTTL
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+	if config.Keys == nil {
+		config.Keys = mustLoadKeys(KeyConfig{Secret: defaultJWTSecret})
+	}
+	appURL := strings.TrimRight(config.AppURL, "/")
+
 	return &Service{
-		repo:        repo,
-		userService: userService,
+		repo:               repo,
+		tx:                 tx,
+		userService:        userService,
+		mailer:             mailer,
+		universities:       universities,
+		verificationResend: newThrottle(time.Minute, time.Hour, 5),
+		passwordResets:     newThrottle(time.Minute, time.Hour, 5),
+		magicLinks:         newThrottle(time.Minute, time.Hour, 5),
+		twoFactorAttempts:  newThrottle(0, 5*time.Minute, 5),
+		passwordChanges:    newThrottle(0, 15*time.Minute, 5),
+		providers:          make(map[string]*oidc.Provider),
+		relyingParty:       defaultRelyingParty(appURL),
+		bootstrapAdmins:    make(map[string]bool),
+		appURL:             appURL,
+		accessTokenTTL:     config.AccessTokenTTL,
+		refreshTokenTTL:    config.RefreshTokenTTL,
+		keys:               config.Keys,
+	}
+}
+
+// goBackground runs fn outside the request, e.g. to send an email, and
+// tracks it so Wait can let it finish on shutdown
+func (s *Service) goBackground(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until the work started in the background is done or ctx
+// expires
+func (s *Service) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 // Login authenticates a user and returns a token
-func (s *Service) Login(req LoginRequest) (*AuthResponse, error) {
+func (s *Service) Login(ctx context.Context, req LoginRequest) (*AuthResponse, error) {
+	u, err := s.checkCredentials(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive {
+		s.recordLoginFailed(ctx, u.ID, LoginMethodPassword, req.ClientInfo, failureAccountDisabled)
+		return nil, ErrAccountDisabled
+	}
+	return s.startLogin(ctx, u.ID, LoginMethodPassword, req.ClientInfo)
+}
+
+// checkCredentials finds the user an email and password belong to, subject
+// to the login guard. Deactivated users are returned too; callers decide
+// whether they may sign in.
+func (s *Service) checkCredentials(ctx context.Context, req LoginRequest) (*user.User, error) {
 	if req.Email == "" || req.Password == "" {
-		return nil, errors.New("email and password are required")
+		return nil, ErrCredentialsRequired
+	}
+	// Count the attempt up front, refusing it while the account or client
+	// address is backing off; a right password gives it back below
+	accountKey, ipKey := loginKeys(req.Email, req.ClientInfo)
+	if err := s.beginLoginAttempt(ctx, accountKey, ipKey); err != nil {
+		var userID string
+		if u, findErr := s.userService.FindByEmail(ctx, req.Email); findErr == nil {
+			userID = u.ID
+		}
+		s.recordLoginFailed(ctx, userID, LoginMethodPassword, req.ClientInfo, failureReason(err))
+		return nil, err
 	}
-	// Find user by email
-	u, err := s.userService.FindByEmail(req.Email)
+	// Find user by email and check password; every failure looks the same
+	u, err := s.userService.FindByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, errors.New("user not found")
+		s.checkDummyPassword(req.Password)
+		s.recordLoginFailed(ctx, "", LoginMethodPassword, req.ClientInfo, failureUnknownAccount)
+		return nil, ErrInvalidCredentials
+	}
+	if !s.userService.CheckPasswordAndUpgrade(ctx, u, req.Password) {
+		s.recordLoginFailed(ctx, u.ID, LoginMethodPassword, req.ClientInfo, failureInvalidPassword)
+		return nil, ErrInvalidCredentials
 	}
-	// Check password
-	if !user.CheckPassword(req.Password, u.PasswordHash) {
-		return nil, errors.New("invalid password")
+	if err := s.loginSucceeded(ctx, accountKey, ipKey); err != nil {
+		return nil, err
 	}
-	// Generate JWT
-	token, err := GenerateJWT(u.ID)
+	return u, nil
+}
+
+// startLogin answers a successful first factor: with a two-factor challenge
+// when the user has 2FA enabled, otherwise with a new session
+func (s *Service) startLogin(ctx context.Context, userID, method string, client ClientInfo) (*AuthResponse, error) {
+	// Hold back the tokens until the second factor is verified
+	required, err := s.requiresTwoFactor(ctx, userID)
 	if err != nil {
-		return nil, errors.New("failed to generate token")
-	}
-	// Return response
-	return &AuthResponse{
-		Token:        token,
-		RefreshToken: "", // TODO: implement refresh token
-		ExpiresAt:    time.Now().Add(24 * time.Hour).Format(time.RFC3339),
-	}, nil
+		return nil, err
+	}
+	if required {
+		return s.twoFactorChallenge(userID, false)
+	}
+	// Record the sign-in, start a session and issue tokens
+	return s.completeLogin(ctx, userID, method, client)
 }
 
 // Register creates a new user and returns a token
-func (s *Service) Register(req RegisterRequest) (*AuthResponse, error) {
+func (s *Service) Register(ctx context.Context, req RegisterRequest) (*AuthResponse, error) {
 	if req.Email == "" || req.Username == "" || req.Password == "" {
 		return nil, errors.New("email, username, and password are required")
 	}
@@ -106,24 +260,21 @@ func (s *Service) Register(req RegisterRequest) (*AuthResponse, error) {
 		LastName:  req.LastName,
 		Password:  req.Password,
 	}
-	u, err := s.userService.CreateUser(userReq)
+	u, err := s.userService.CreateUser(ctx, userReq)
 	if err != nil {
 		return nil, err
 	}
-	// Generate JWT
-	token, err := GenerateJWT(u.ID)
-	if err != nil {
-		return nil, errors.New("failed to generate token")
-	}
-	// Return response
-	return &AuthResponse{
-		Token:        token,
-		RefreshToken: "", // TODO: implement refresh token
-		ExpiresAt:    time.Now().Add(24 * time.Hour).Format(time.RFC3339),
-	}, nil
+	// Ask the user to confirm their address; a mail failure must not fail registration
+	s.sendVerificationInBackground(ctx, u.ID)
+	// Record the sign-in, start a session and issue tokens
+	return s.completeLogin(ctx, u.ID, LoginMethodRegister, req.ClientInfo)
 }
 
 // ValidateToken validates a JWT token
-func (s *Service) ValidateToken(token string) (string, error) {
-	return ValidateJWT(token)
+func (s *Service) ValidateToken(ctx context.Context, token string) (string, error) {
+	claims, err := s.ParseJWT(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return claims.UserID, nil
 }
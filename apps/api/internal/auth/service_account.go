@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"sanctor/internal/user"
+)
+
+// ReactivateAccount signs a user back in to an account they deactivated
+// themselves, which reactivates it and cancels any scheduled deletion.
+// Nothing changes until the login is complete, including the second factor
+// when the user has 2FA enabled. Accounts deactivated by an administrator
+// stay disabled.
+func (s *Service) ReactivateAccount(ctx context.Context, req LoginRequest) (*AuthResponse, error) {
+	u, err := s.checkCredentials(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsActive {
+		return s.startLogin(ctx, u.ID, LoginMethodPassword, req.ClientInfo)
+	}
+	if u.DeactivatedBy == user.DeactivatedByAdmin {
+		s.recordLoginFailed(ctx, u.ID, LoginMethodPassword, req.ClientInfo, failureAccountDisabled)
+		return nil, ErrAccountDisabled
+	}
+
+	required, err := s.requiresTwoFactor(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		return s.twoFactorChallenge(u.ID, true)
+	}
+	return s.completeReactivation(ctx, u.ID, LoginMethodPassword, req.ClientInfo)
+}
+
+// completeReactivation reactivates an account once the user has passed
+// every factor, and starts the session
+func (s *Service) completeReactivation(ctx context.Context, userID, method string, client ClientInfo) (*AuthResponse, error) {
+	if err := s.reactivate(ctx, userID); err != nil {
+		if errors.Is(err, user.ErrDeactivatedByAdmin) {
+			s.recordLoginFailed(ctx, userID, method, client, failureAccountDisabled)
+			return nil, ErrAccountDisabled
+		}
+		return nil, err
+	}
+	log.Printf("🔓 User %s reactivated their account", userID)
+
+	return s.completeLogin(ctx, userID, method, client)
+}
+
+// SetReactivationHook registers fn to run in the same unit of work when a
+// user reactivates their account, e.g. to show their posts again
+func (s *Service) SetReactivationHook(fn func(ctx context.Context, userID string) error) {
+	s.onReactivate = fn
+}
+
+// reactivate reactivates an account together with the reactivation hook
+func (s *Service) reactivate(ctx context.Context, userID string) error {
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.userService.Reactivate(ctx, userID); err != nil {
+			return err
+		}
+		if s.onReactivate == nil {
+			return nil
+		}
+		return s.onReactivate(ctx, userID)
+	})
+}
+
+// DeleteUserData removes all authentication data of a user in one unit of
+// work, for account deletion, including the failed logins counted against
+// their email address
+func (s *Service) DeleteUserData(ctx context.Context, userID string) error {
+	u, err := s.userService.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.DeleteUserData(ctx, userID); err != nil {
+			return err
+		}
+		accountKey, _ := loginKeys(u.Email, ClientInfo{})
+		return s.repo.DeleteLoginAttempt(ctx, accountKey)
+	})
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sanctor/internal/user"
+)
+
+func TestReactivateAccount(t *testing.T) {
+	tests := []struct {
+		name          string
+		twoFactor     bool
+		by            string
+		password      string
+		wantErr       error
+		wantChallenge bool
+	}{
+		{name: "password", by: user.DeactivatedBySelf, password: testPassword},
+		{name: "wrong password", by: user.DeactivatedBySelf, password: "difference-engine-1822", wantErr: ErrInvalidCredentials},
+		{name: "two-factor", twoFactor: true, by: user.DeactivatedBySelf, password: testPassword, wantChallenge: true},
+		{name: "deactivated by an admin", by: user.DeactivatedByAdmin, password: testPassword, wantErr: ErrAccountDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+			var recoveryCode string
+			if tt.twoFactor {
+				recoveryCode = env.enableTwoFactor(t, userID)
+			}
+			if tt.by == user.DeactivatedBySelf {
+				if err := env.users.ScheduleDeletion(ctx, userID, time.Now().Add(time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := env.users.SetActive(ctx, userID, false); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := env.auth.ReactivateAccount(ctx, LoginRequest{Email: "ada@example.com", Password: tt.password})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				env.assertDeactivated(t, userID)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantChallenge {
+				if !resp.TwoFactorRequired || resp.Token != "" {
+					t.Fatalf("got %+v, want a two-factor challenge", resp)
+				}
+				// Nothing changes until the second factor checks out
+				env.assertDeactivated(t, userID)
+				_, err := env.auth.VerifyTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: resp.ChallengeToken, Code: "000000"})
+				if !errors.Is(err, ErrInvalidTwoFactorCode) {
+					t.Fatalf("got error %v for a wrong code, want ErrInvalidTwoFactorCode", err)
+				}
+				env.assertDeactivated(t, userID)
+
+				resp, err = env.auth.VerifyTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: resp.ChallengeToken, Code: recoveryCode})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if resp.Token == "" {
+				t.Fatalf("got %+v, want tokens", resp)
+			}
+			u, err := env.users.GetUser(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !u.IsActive || u.DeletionScheduledAt != nil {
+				t.Errorf("got active=%v deletionScheduledAt=%v, want the account reactivated", u.IsActive, u.DeletionScheduledAt)
+			}
+		})
+	}
+}
+
+func TestLoginChallengeDoesNotReactivate(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID, _ := env.register(t, "ada@example.com", "ada")
+	recoveryCode := env.enableTwoFactor(t, userID)
+	if err := env.users.Deactivate(ctx, userID, user.DeactivatedBySelf); err != nil {
+		t.Fatal(err)
+	}
+
+	// A challenge from a plain login must not stand in for a reactivation
+	challenge, err := env.auth.twoFactorChallenge(userID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.auth.VerifyTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: recoveryCode})
+	if !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("got error %v, want ErrAccountDisabled", err)
+	}
+	env.assertDeactivated(t, userID)
+}
+
+// assertDeactivated fails the test if a user's account is active
+func (env *testEnv) assertDeactivated(t *testing.T, userID string) {
+	t.Helper()
+	u, err := env.users.GetUser(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.IsActive {
+		t.Fatal("account was reactivated")
+	}
+}
+
+func TestDeleteUserDataForgetsFailedLogins(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID, _ := env.register(t, "ada@example.com", "ada")
+	if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: "wrong-password"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got error %v, want ErrInvalidCredentials", err)
+	}
+
+	if err := env.auth.DeleteUserData(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	accountKey, _ := loginKeys("ada@example.com", ClientInfo{})
+	if _, err := env.repo.FindLoginAttempt(ctx, accountKey); !errors.Is(err, ErrLoginAttemptNotFound) {
+		t.Errorf("got error %v, want the failed logins forgotten", err)
+	}
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix marks a bearer token as an API key rather than a JWT
+const apiKeyPrefix = "sanctor_pat_"
+
+// maxAPIKeysPerUser limits how many unrevoked keys a user can hold
+const maxAPIKeysPerUser = 25
+
+// Scopes that API keys can be limited to. Account management (sessions,
+// 2FA, API keys themselves) is never available to an API key.
+const (
+	ScopePostsRead   = "posts:read"
+	ScopePostsWrite  = "posts:write"
+	ScopeGroupsRead  = "groups:read"
+	ScopeGroupsWrite = "groups:write"
+	ScopeUsersRead   = "users:read"
+	ScopeUsersWrite  = "users:write"
+)
+
+var knownScopes = map[string]bool{
+	ScopePostsRead:   true,
+	ScopePostsWrite:  true,
+	ScopeGroupsRead:  true,
+	ScopeGroupsWrite: true,
+	ScopeUsersRead:   true,
+	ScopeUsersWrite:  true,
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// ParseAPIKey resolves a raw API key to its stored record. Revoked and
+// expired keys are rejected.
+func (s *Service) ParseAPIKey(ctx context.Context, raw string) (*APIKey, error) {
+	if !IsAPIKey(raw) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.FindAPIKey(ctx, hashToken(raw))
+	if err != nil || !key.IsActive() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > lastSeenResolution {
+		_ = s.repo.TouchAPIKey(ctx, key.ID, time.Now())
+	}
+	return key, nil
+}
+
+// CreateAPIKey issues a new API key limited to the requested scopes. The
+// raw key is only ever returned here.
+func (s *Service) CreateAPIKey(ctx context.Context, userID string, req CreateAPIKeyRequest) (*CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, errors.New("name is required and must be at most 100 characters")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	if req.ExpiresInDays < 0 {
+		return nil, errors.New("expiresInDays cannot be negative")
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !knownScopes[scope] {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+
+	existing, err := s.repo.FindAPIKeysByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	active := 0
+	for _, key := range existing {
+		if key.IsActive() {
+			active++
+		}
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, errors.New("failed to generate API key")
+	}
+	raw := apiKeyPrefix + secret
+
+	now := time.Now()
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(apiKeyPrefix)+6],
+		KeyHash:   hashToken(raw),
+		Scopes:    strings.Join(scopes, ","),
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateAPIKey(ctx, key); err != nil {
+		return nil, errors.New("failed to store API key")
+	}
+
+	return &CreatedAPIKey{APIKeyInfo: *apiKeyInfo(key), Key: raw}, nil
+}
+
+// ListAPIKeys returns a user's active API keys, newest first
+func (s *Service) ListAPIKeys(ctx context.Context, userID string) ([]*APIKeyInfo, error) {
+	keys, err := s.repo.FindAPIKeysByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]*APIKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		if key.IsActive() {
+			active = append(active, apiKeyInfo(key))
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.After(active[j].CreatedAt)
+	})
+	return active, nil
+}
+
+// RevokeAPIKey revokes one of a user's API keys
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	keys, err := s.repo.FindAPIKeysByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return s.repo.RevokeAPIKey(ctx, id)
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// apiKeyInfo converts a stored key to its owner-facing form
+func apiKeyInfo(key *APIKey) *APIKeyInfo {
+	return &APIKeyInfo{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
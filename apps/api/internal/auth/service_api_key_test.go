@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		wantScopes []string
+		wantErr    error
+	}{
+		{name: "known scopes", scopes: []string{ScopePostsWrite, ScopePostsRead}, wantScopes: []string{ScopePostsRead, ScopePostsWrite}},
+		{name: "repeated scope", scopes: []string{ScopeGroupsRead, ScopeGroupsRead}, wantScopes: []string{ScopeGroupsRead}},
+		{name: "no scopes", scopes: nil},
+		{name: "empty scope", scopes: []string{""}, wantErr: ErrInvalidScope},
+		{name: "unknown scope", scopes: []string{ScopePostsRead, "sessions:write"}, wantErr: ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+
+			created, err := env.auth.CreateAPIKey(ctx, userID, CreateAPIKeyRequest{Name: "laptop", Scopes: tt.scopes})
+			if tt.wantScopes == nil {
+				if err == nil {
+					t.Fatalf("CreateAPIKey() accepted scopes %q", tt.scopes)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("CreateAPIKey() error = %v, want %v", err, tt.wantErr)
+				}
+				if keys, _ := env.auth.ListAPIKeys(ctx, userID); len(keys) != 0 {
+					t.Errorf("a refused key was stored: %+v", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key, err := env.auth.ParseAPIKey(ctx, created.Key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := key.ScopeList(); !slices.Equal(got, tt.wantScopes) {
+				t.Errorf("scopes = %q, want %q", got, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     func(t *testing.T, env *testEnv, userID string) string
+		wantErr bool
+	}{
+		{
+			name: "active",
+			key: func(t *testing.T, env *testEnv, userID string) string {
+				return env.createAPIKey(t, userID)
+			},
+		},
+		{
+			name: "revoked",
+			key: func(t *testing.T, env *testEnv, userID string) string {
+				raw := env.createAPIKey(t, userID)
+				keys, err := env.auth.ListAPIKeys(context.Background(), userID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := env.auth.RevokeAPIKey(context.Background(), userID, keys[0].ID); err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			key: func(t *testing.T, env *testEnv, userID string) string {
+				return storeAPIKey(t, env, userID, time.Now().Add(-time.Minute))
+			},
+			wantErr: true,
+		},
+		{
+			name: "not yet expired",
+			key: func(t *testing.T, env *testEnv, userID string) string {
+				return storeAPIKey(t, env, userID, time.Now().Add(time.Hour))
+			},
+		},
+		{
+			name: "unknown",
+			key: func(t *testing.T, env *testEnv, userID string) string {
+				return apiKeyPrefix + "never-issued"
+			},
+			wantErr: true,
+		},
+		{
+			name: "session token",
+			key: func(t *testing.T, env *testEnv, userID string) string {
+				token, _ := env.login(t, "ada@example.com")
+				return token
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+
+			key, err := env.auth.ParseAPIKey(context.Background(), tt.key(t, env, userID))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAPIKey) {
+					t.Errorf("ParseAPIKey() error = %v, want %v", err, ErrInvalidAPIKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.UserID != userID {
+				t.Errorf("key belongs to %q, want %q", key.UserID, userID)
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKeyOfAnotherUser(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	adaID, _ := env.register(t, "ada@example.com", "ada")
+	charlesID, _ := env.register(t, "charles@example.com", "charles")
+	raw := env.createAPIKey(t, adaID)
+
+	keys, err := env.auth.ListAPIKeys(ctx, adaID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.auth.RevokeAPIKey(ctx, charlesID, keys[0].ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey() by another user error = %v, want %v", err, ErrAPIKeyNotFound)
+	}
+	if _, err := env.auth.ParseAPIKey(ctx, raw); err != nil {
+		t.Errorf("another user revoked the key: %v", err)
+	}
+}
+
+// storeAPIKey stores an API key expiring at expiresAt, which CreateAPIKey
+// cannot set in the past, and returns the raw key
+func storeAPIKey(t *testing.T, env *testEnv, userID string, expiresAt time.Time) string {
+	t.Helper()
+	raw := apiKeyPrefix + "stored-" + userID
+	err := env.repo.CreateAPIKey(context.Background(), &APIKey{
+		ID:        "stored-key",
+		UserID:    userID,
+		Name:      "stored",
+		Prefix:    raw[:len(apiKeyPrefix)+6],
+		KeyHash:   hashToken(raw),
+		Scopes:    ScopePostsRead,
+		ExpiresAt: &expiresAt,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
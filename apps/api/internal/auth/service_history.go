@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"sanctor/internal/mail"
+	"sanctor/internal/user"
+)
+
+// Login history limits
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// Failure reasons recorded in the login history
+const (
+	failureUnknownAccount  = "unknown_account"
+	failureInvalidPassword = "invalid_password"
+	failureInvalidCode     = "invalid_code"
+	failureAccountDisabled = "account_disabled"
+	failureLocked          = "locked"
+	failureWrongBrowser    = "wrong_browser"
+	failureInvalidPasskey  = "invalid_passkey"
+)
+
+// GetLoginHistory returns a user's most recent sign-in attempts, newest first
+func (s *Service) GetLoginHistory(ctx context.Context, userID string, limit int) ([]*LoginEvent, error) {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	return s.repo.FindLoginEventsByUser(ctx, userID, limit)
+}
+
+// completeLogin records a successful sign-in, warns the user when it comes
+// from a device they have not signed in from before, and starts the session
+func (s *Service) completeLogin(ctx context.Context, userID, method string, client ClientInfo) (*AuthResponse, error) {
+	u, err := s.userService.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive {
+		s.recordLoginFailed(ctx, userID, method, client, failureAccountDisabled)
+		return nil, ErrAccountDisabled
+	}
+
+	known, err := s.repo.HasLoggedInFrom(ctx, userID, client.UserAgent)
+	if err != nil {
+		log.Printf("Failed to look up login history for user %s: %v", userID, err)
+		known = true
+	}
+	// The first sign-in of an account is not worth a warning
+	newDevice := !known && u.LastLoginAt != nil
+
+	s.recordLoginEvent(ctx, &LoginEvent{
+		UserID:    userID,
+		Method:    method,
+		Success:   true,
+		NewDevice: newDevice,
+	}, client)
+	if err := s.userService.RecordLogin(ctx, userID, time.Now()); err != nil {
+		log.Printf("Failed to update last login of user %s: %v", userID, err)
+	}
+
+	if newDevice {
+		s.goBackground(func() {
+			if err := s.sendNewDeviceEmail(u, client); err != nil {
+				log.Printf("Failed to send new device notification to user %s: %v", userID, err)
+			}
+		})
+	}
+
+	return s.issueTokens(ctx, userID, client)
+}
+
+// recordLoginFailed records a failed sign-in attempt. userID is empty when
+// the attempt named an account that does not exist.
+func (s *Service) recordLoginFailed(ctx context.Context, userID, method string, client ClientInfo, reason string) {
+	s.recordLoginEvent(ctx, &LoginEvent{
+		UserID:        userID,
+		Method:        method,
+		FailureReason: reason,
+	}, client)
+}
+
+// recordLoginEvent stores a login event. The history is informational, so
+// a storage failure never fails the login itself.
+func (s *Service) recordLoginEvent(ctx context.Context, event *LoginEvent, client ClientInfo) {
+	event.ID = uuid.New().String()
+	event.UserAgent = client.UserAgent
+	event.IPAddress = client.IPAddress
+	event.CreatedAt = time.Now()
+
+	if err := s.repo.CreateLoginEvent(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("Failed to record login event: %v", err)
+	}
+}
+
+// failureReason maps a login error to the reason recorded in the history
+func failureReason(err error) string {
+	var throttled *ThrottleError
+	switch {
+	case errors.As(err, &throttled):
+		return failureLocked
+	case errors.Is(err, ErrAccountDisabled):
+		return failureAccountDisabled
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		return failureInvalidCode
+	default:
+		return failureInvalidPassword
+	}
+}
+
+// sendNewDeviceEmail tells a user about a sign-in from an unfamiliar device
+func (s *Service) sendNewDeviceEmail(u *user.User, client ClientInfo) error {
+	device := client.UserAgent
+	if device == "" {
+		device = "unknown device"
+	}
+
+	return s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "New sign-in to your Sanctor account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was just signed in to from a device you have not used before:\n\n"+
+			"  Time:    %s\n  Device:  %s\n  Address: %s\n\n"+
+			"If this was you, there is nothing to do. If not, reset your password at %s/forgot-password "+
+			"and review your active sessions at %s/settings/security.\n",
+			u.FullName(), time.Now().UTC().Format(time.RFC1123), device, client.IPAddress, s.appURL, s.appURL),
+	})
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewDeviceNotice(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+	const notice = "New sign-in to your Sanctor account"
+
+	login := func(userAgent string) {
+		t.Helper()
+		_, err := env.auth.Login(ctx, LoginRequest{
+			Email:      "ada@example.com",
+			Password:   testPassword,
+			ClientInfo: ClientInfo{UserAgent: userAgent, IPAddress: "192.0.2.1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The notice is sent in the background; shutdown waits for it
+		if err := env.auth.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notices := func() int {
+		n := 0
+		for _, subject := range env.outbox.subjects("ada@example.com") {
+			if subject == notice {
+				n++
+			}
+		}
+		return n
+	}
+
+	// register signed in without a user agent
+	login("")
+	if n := notices(); n != 0 {
+		t.Errorf("the registration device sent %d new device notices, want none", n)
+	}
+	login("phone")
+	if n := notices(); n != 1 {
+		t.Errorf("a new device sent %d new device notices, want one", n)
+	}
+	login("phone")
+	if n := notices(); n != 1 {
+		t.Errorf("a known device sent %d more new device notices, want none", n-1)
+	}
+}
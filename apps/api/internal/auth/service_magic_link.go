@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"sanctor/internal/mail"
+	"sanctor/internal/user"
+)
+
+// magicLinkTTL is how long a sign-in link stays valid
+const magicLinkTTL = 15 * time.Minute
+
+// RequestMagicLink emails a single-use sign-in link to the account registered
+// under an address. Like ForgotPassword it never reveals whether the account
+// exists. When req.Binding is set, only a browser presenting the same
+// binding can use the link.
+func (s *Service) RequestMagicLink(ctx context.Context, req MagicLinkRequest) {
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return
+	}
+
+	if ok, _ := s.magicLinks.Allow(user.NormalizeEmail(email)); !ok {
+		return
+	}
+
+	// The lookup outlives the request, so it must not be cancelled with it
+	ctx = context.WithoutCancel(ctx)
+	s.goBackground(func() {
+		u, err := s.userService.FindByEmail(ctx, email)
+		if err != nil || !u.IsActive {
+			return
+		}
+		if err := s.sendMagicLink(ctx, u, req.Binding); err != nil {
+			log.Printf("Failed to send sign-in link to user %s: %v", u.ID, err)
+		}
+	})
+}
+
+// LoginWithMagicLink exchanges a token from a sign-in link for a session.
+// The link is consumed, and since it proves the user controls the address,
+// the email is marked verified. Links mailed to a previous address are
+// rejected.
+func (s *Service) LoginWithMagicLink(ctx context.Context, req MagicLinkLoginRequest) (*AuthResponse, error) {
+	claims, err := s.parseActionToken(req.Token, purposeMagicLink)
+	if err != nil || claims.ID == "" {
+		return nil, ErrInvalidMagicLink
+	}
+
+	link, err := s.repo.FindMagicLink(ctx, claims.ID)
+	if err != nil || link.UserID != claims.Subject || link.UsedAt != nil || time.Now().After(link.ExpiresAt) {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// A bound link opened elsewhere stays valid for the right browser
+	if link.BindingHash != "" &&
+		subtle.ConstantTimeCompare([]byte(link.BindingHash), []byte(hashToken(req.Binding))) != 1 {
+		s.recordLoginFailed(ctx, link.UserID, LoginMethodMagicLink, req.ClientInfo, failureWrongBrowser)
+		return nil, ErrMagicLinkBrowser
+	}
+
+	if err := s.repo.MarkMagicLinkUsed(ctx, link.ID, time.Now()); err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// A link mailed to an address the user has since replaced proves nothing
+	err = s.userService.MarkEmailVerified(ctx, link.UserID, claims.Email)
+	if errors.Is(err, user.ErrEmailChanged) {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		log.Printf("Failed to mark email verified for user %s: %v", link.UserID, err)
+	}
+
+	return s.startLogin(ctx, link.UserID, LoginMethodMagicLink, req.ClientInfo)
+}
+
+// sendMagicLink issues a sign-in link for a user and mails it. Any earlier
+// links of the user stop working.
+func (s *Service) sendMagicLink(ctx context.Context, u *user.User, binding string) error {
+	if err := s.repo.InvalidateMagicLinks(ctx, u.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	link := &MagicLink{
+		ID:        uuid.New().String(),
+		UserID:    u.ID,
+		ExpiresAt: now.Add(magicLinkTTL),
+		CreatedAt: now,
+	}
+	if binding != "" {
+		link.BindingHash = hashToken(binding)
+	}
+	if err := s.repo.CreateMagicLink(ctx, link); err != nil {
+		return err
+	}
+
+	token, err := s.signActionToken(actionClaims{
+		Purpose:          purposeMagicLink,
+		Email:            u.Email,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID, ID: link.ID},
+	}, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	signInURL := fmt.Sprintf("%s/magic-link?token=%s", s.appURL, url.QueryEscape(token))
+	return s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Your Sanctor sign-in link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to sign in to Sanctor:\n\n%s\n\n"+
+			"The link works once and expires in %d minutes. If you did not ask to sign in, you can ignore this email.\n",
+			u.FullName(), signInURL, int(magicLinkTTL.Minutes())),
+	})
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"sanctor/internal/user"
+)
+
+func TestLoginWithMagicLink(t *testing.T) {
+	tests := []struct {
+		name string
+		// present returns the token and browser binding to sign in with
+		present func(t *testing.T, env *testEnv, userID string) (token, binding string)
+		wantErr error
+	}{
+		{
+			name: "fresh link",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				return env.requestMagicLink(t, "ada@example.com", ""), ""
+			},
+		},
+		{
+			name: "used twice",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				token := env.requestMagicLink(t, "ada@example.com", "")
+				env.loginWithMagicLink(t, token, "")
+				return token, ""
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "replaced by a newer link",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				token := env.requestMagicLink(t, "ada@example.com", "")
+				// Requests are throttled, so issue the newer link directly
+				u, err := env.users.GetUser(context.Background(), userID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := env.auth.sendMagicLink(context.Background(), u, ""); err != nil {
+					t.Fatal(err)
+				}
+				return token, ""
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "bound to this browser",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				return env.requestMagicLink(t, "ada@example.com", "browser-1"), "browser-1"
+			},
+		},
+		{
+			name: "bound to another browser",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				return env.requestMagicLink(t, "ada@example.com", "browser-1"), "browser-2"
+			},
+			wantErr: ErrMagicLinkBrowser,
+		},
+		{
+			name: "expired",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				link := &MagicLink{
+					ID:        uuid.New().String(),
+					UserID:    userID,
+					ExpiresAt: time.Now().Add(-time.Minute),
+					CreatedAt: time.Now().Add(-magicLinkTTL),
+				}
+				if err := env.repo.CreateMagicLink(context.Background(), link); err != nil {
+					t.Fatal(err)
+				}
+				token, err := env.auth.signActionToken(actionClaims{
+					Purpose:          purposeMagicLink,
+					Email:            "ada@example.com",
+					RegisteredClaims: jwt.RegisteredClaims{Subject: userID, ID: link.ID},
+				}, magicLinkTTL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token, ""
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "mailed to a replaced address",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				token := env.requestMagicLink(t, "ada@example.com", "")
+				if _, err := env.users.UpdateUser(context.Background(), userID, user.UpdateUserRequest{Email: "lovelace@example.com"}); err != nil {
+					t.Fatal(err)
+				}
+				return token, ""
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+		{
+			name: "verification link",
+			present: func(t *testing.T, env *testEnv, userID string) (string, string) {
+				return env.outbox.lastToken(t, "ada@example.com"), ""
+			},
+			wantErr: ErrInvalidMagicLink,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+
+			token, binding := tt.present(t, env, userID)
+			ctx := context.Background()
+			resp, err := env.auth.LoginWithMagicLink(ctx, MagicLinkLoginRequest{Token: token, Binding: binding})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := env.auth.ValidateToken(ctx, resp.Token); err != nil || got != userID {
+				t.Fatalf("signed in as %q (%v), want %s", got, err, userID)
+			}
+			// Opening the link proves the user controls the address
+			if u, _ := env.users.GetUser(ctx, userID); !u.IsVerified {
+				t.Error("signing in with a link did not verify the email address")
+			}
+		})
+	}
+}
+
+func TestRequestMagicLinkRevealsNothing(t *testing.T) {
+	env := newTestEnv(t)
+	userID, _ := env.register(t, "ada@example.com", "ada")
+	env.register(t, "grace@example.com", "grace")
+	if err := env.users.Deactivate(context.Background(), userID, user.DeactivatedBySelf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"nobody@example.com", "ada@example.com"} {
+		before := env.outbox.count(email)
+		env.auth.RequestMagicLink(context.Background(), MagicLinkRequest{Email: email})
+		if err := env.auth.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if env.outbox.count(email) != before {
+			t.Errorf("a sign-in link was mailed to %s", email)
+		}
+	}
+
+	// Addresses are matched without regard to case
+	env.requestMagicLink(t, "Grace@Example.com", "")
+}
+
+// requestMagicLink asks for a sign-in link and returns the token mailed for
+// it, failing the test if none was sent
+func (env *testEnv) requestMagicLink(t *testing.T, email, binding string) string {
+	t.Helper()
+	to := user.NormalizeEmail(email)
+	before := env.outbox.count(to)
+	env.auth.RequestMagicLink(context.Background(), MagicLinkRequest{Email: email, Binding: binding})
+	if err := env.auth.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if env.outbox.count(to) == before {
+		t.Fatalf("no sign-in link was mailed to %s", to)
+	}
+	return env.outbox.lastToken(t, to)
+}
+
+// loginWithMagicLink signs in with a link and fails the test if that does
+// not work
+func (env *testEnv) loginWithMagicLink(t *testing.T, token, binding string) *AuthResponse {
+	t.Helper()
+	resp, err := env.auth.LoginWithMagicLink(context.Background(), MagicLinkLoginRequest{Token: token, Binding: binding})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"sanctor/internal/oidc"
+	"sanctor/internal/user"
+)
+
+// oidcLoginTTL is how long a user has to finish signing in at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// AddOIDCProvider registers an external login provider
+func (s *Service) AddOIDCProvider(provider *oidc.Provider) {
+	s.providers[provider.Name()] = provider
+}
+
+// OIDCProviders lists the registered login providers
+func (s *Service) OIDCProviders() []*OIDCProviderInfo {
+	providers := make([]*OIDCProviderInfo, 0, len(s.providers))
+	for _, provider := range s.providers {
+		providers = append(providers, &OIDCProviderInfo{
+			Name:        provider.Name(),
+			DisplayName: provider.DisplayName(),
+			LoginURL:    "/api/auth/oidc/login?provider=" + provider.Name(),
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name < providers[j].Name
+	})
+	return providers
+}
+
+// StartOIDCLogin prepares an authorization code + PKCE login and returns the
+// provider URL to redirect to, and a binding value that must come back with
+// the callback (the handler keeps it in a cookie) so a login started in one
+// browser cannot be completed in another
+func (s *Service) StartOIDCLogin(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := generateToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := generateToken()
+	if err != nil {
+		return "", "", err
+	}
+	binding, err := generateToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	err = s.repo.CreateOIDCLoginState(ctx, &OIDCLoginState{
+		StateHash:   hashToken(state),
+		Provider:    provider.Name(),
+		Nonce:       nonce,
+		Verifier:    verifier,
+		BindingHash: hashToken(binding),
+		ExpiresAt:   now.Add(oidcLoginTTL),
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, binding, nil
+}
+
+// CompleteOIDCLogin finishes a provider login: it redeems the code, checks
+// the ID token and signs in the linked user, linking or creating one by
+// verified email on first use
+func (s *Service) CompleteOIDCLogin(ctx context.Context, req OIDCCallbackRequest) (*AuthResponse, error) {
+	if req.State == "" || req.Binding == "" {
+		return nil, ErrInvalidOIDCState
+	}
+	login, err := s.repo.TakeOIDCLoginState(ctx, hashToken(req.State))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(login.ExpiresAt) ||
+		subtle.ConstantTimeCompare([]byte(login.BindingHash), []byte(hashToken(req.Binding))) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	provider, ok := s.providers[login.Provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	token, err := provider.Exchange(ctx, req.Code, login.Verifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCProvider, err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, login.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCProvider, err)
+	}
+
+	userID, err := s.resolveOIDCUser(ctx, provider.Name(), claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startLogin(ctx, userID, LoginMethodOIDC+":"+provider.Name(), req.ClientInfo)
+}
+
+// resolveOIDCUser finds the user an external identity belongs to
+func (s *Service) resolveOIDCUser(ctx context.Context, providerName string, claims *oidc.IDTokenClaims) (string, error) {
+	identity, err := s.repo.FindOIDCIdentity(ctx, providerName, claims.Subject)
+	if err == nil {
+		if _, err := s.userService.GetUser(ctx, identity.UserID); err != nil {
+			return "", err
+		}
+		return identity.UserID, nil
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return "", err
+	}
+
+	// Linking by email is only safe when the provider vouches for the address
+	if !claims.IsEmailVerified() {
+		return "", ErrEmailNotVerified
+	}
+
+	var userID string
+	err = s.tx.Transaction(ctx, func(ctx context.Context) error {
+		u, err := s.linkOIDCUser(ctx, providerName, claims)
+		if err != nil {
+			return err
+		}
+		userID = u.ID
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Printf("🔗 Linked %s identity to user %s", providerName, userID)
+	return userID, nil
+}
+
+// linkOIDCUser finds or creates the user with the address a provider
+// vouches for and links the identity to them. It runs in a unit of work, so
+// an account is never left reset, or created, without the link.
+func (s *Service) linkOIDCUser(ctx context.Context, providerName string, claims *oidc.IDTokenClaims) (*user.User, error) {
+	u, err := s.userService.FindByEmail(ctx, claims.Email)
+	if err != nil {
+		if u, err = s.createOIDCUser(ctx, claims); err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Created user %s from %s login", u.ID, providerName)
+	} else if !u.IsVerified || u.VerifiedEmail != u.Email {
+		if err := s.resetUnprovenAccount(ctx, u.ID); err != nil {
+			return nil, err
+		}
+		log.Printf("🔐 Reset the credentials of unverified user %s before linking %s", u.ID, providerName)
+	}
+
+	if err := s.userService.MarkEmailVerified(ctx, u.ID, claims.Email); err != nil {
+		return nil, err
+	}
+	if school, ok := s.universities.LookupEmail(claims.Email); ok && !u.IsUniversityVerified() {
+		err := s.userService.SetUniversityVerified(ctx, u.ID, school.Name, claims.Email)
+		if err != nil && !errors.Is(err, user.ErrUniversityEmailTaken) {
+			return nil, err
+		}
+	}
+
+	err = s.repo.CreateOIDCIdentity(ctx, &OIDCIdentity{
+		ID:        uuid.New().String(),
+		UserID:    u.ID,
+		Provider:  providerName,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// resetUnprovenAccount throws away every way into an account whose owner
+// never proved they control its email address. Whoever registered it may
+// not be the person the provider vouches for, so their password, sessions,
+// API keys, two-factor secret and passkeys must not survive the link. All of
+// them go in one unit of work.
+func (s *Service) resetUnprovenAccount(ctx context.Context, userID string) error {
+	password, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.userService.ResetPassword(ctx, userID, password); err != nil {
+			return err
+		}
+		if err := s.RevokeAllCredentials(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.repo.DeleteTwoFactor(ctx, userID); err != nil {
+			return err
+		}
+		return s.deletePasskeys(ctx, userID)
+	})
+}
+
+var usernameUnsafe = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// createOIDCUser registers a user for a first-time provider login. The
+// account gets an unusable random password; the user can set a real one
+// through the password reset flow.
+func (s *Service) createOIDCUser(ctx context.Context, claims *oidc.IDTokenClaims) (*user.User, error) {
+	password, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.ToLower(strings.SplitN(claims.Email, "@", 2)[0])
+	base = usernameUnsafe.ReplaceAllString(base, "")
+	if len(base) > 14 {
+		base = base[:14]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	username := base
+	for i := 0; ; i++ {
+		taken, err := s.userService.UsernameTaken(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		if !taken {
+			break
+		}
+		if i == 10 {
+			return nil, errors.New("could not pick a username")
+		}
+		username = fmt.Sprintf("%s_%s", base, uuid.New().String()[:4])
+	}
+
+	return s.userService.CreateUser(ctx, user.CreateUserRequest{
+		Email:     claims.Email,
+		Username:  username,
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+		Password:  password,
+	})
+}
@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"sanctor/internal/oidc"
+)
+
+const (
+	fakeClientID = "sanctor"
+	fakeKeyID    = "campus-1"
+)
+
+// fakeProvider is an in-process OpenID Connect provider. It issues codes
+// for the grants a test prepares and redeems them for signed ID tokens.
+type fakeProvider struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]*oidcAttempt
+}
+
+// oidcAttempt is one login as the provider will answer it. Tests change it
+// to play an attacker or a misbehaving provider.
+type oidcAttempt struct {
+	state     string
+	binding   string
+	challenge string
+	claims    jwt.MapClaims
+	key       *ecdsa.PrivateKey
+	kid       string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key, grants: make(map[string]*oidcAttempt)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": fakeKeyID,
+			"use": "sig",
+			"crv": "P-256",
+			"x":   encode(key.PublicKey.X.FillBytes(make([]byte, 32))),
+			"y":   encode(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// token redeems a code, provided the PKCE verifier matches the challenge
+// the code was issued for
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	attempt, ok := p.grants[r.FormValue("code")]
+	delete(p.grants, r.FormValue("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != attempt.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, attempt.claims)
+	token.Header["kid"] = attempt.kid
+	idToken, err := token.SignedString(attempt.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// register adds the provider to an auth service as "campus"
+func (p *fakeProvider) register(t *testing.T, env *testEnv) {
+	t.Helper()
+	provider, err := oidc.NewProvider(oidc.Config{
+		Name:         "campus",
+		Issuer:       p.server.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+	}, p.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.auth.AddOIDCProvider(provider)
+}
+
+// begin starts a login and returns how the provider would answer it for
+// the user with the given email
+func (p *fakeProvider) begin(t *testing.T, env *testEnv, email string) *oidcAttempt {
+	t.Helper()
+	authURL, binding, err := env.auth.StartOIDCLogin(context.Background(), "campus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+
+	now := time.Now()
+	return &oidcAttempt{
+		state:     query.Get("state"),
+		binding:   binding,
+		challenge: query.Get("code_challenge"),
+		key:       p.key,
+		kid:       fakeKeyID,
+		claims: jwt.MapClaims{
+			"iss":            p.server.URL,
+			"aud":            fakeClientID,
+			"sub":            "campus|" + email,
+			"iat":            now.Unix(),
+			"exp":            now.Add(5 * time.Minute).Unix(),
+			"nonce":          query.Get("nonce"),
+			"email":          email,
+			"email_verified": true,
+		},
+	}
+}
+
+// finish issues a code for the attempt and completes the login with it
+func (p *fakeProvider) finish(env *testEnv, attempt *oidcAttempt) (*AuthResponse, error) {
+	code, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.grants[code] = attempt
+	p.mu.Unlock()
+
+	return env.auth.CompleteOIDCLogin(context.Background(), OIDCCallbackRequest{
+		State:   attempt.state,
+		Code:    code,
+		Binding: attempt.binding,
+	})
+}
+
+// errRejected stands for any error in tests that only need a login refused
+var errRejected = errors.New("rejected")
+
+func TestOIDCLogin(t *testing.T) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(a *oidcAttempt)
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			tamper: func(a *oidcAttempt) {},
+		},
+		{
+			name:   "email_verified as a string",
+			tamper: func(a *oidcAttempt) { a.claims["email_verified"] = "true" },
+		},
+		{
+			name:    "unknown state",
+			tamper:  func(a *oidcAttempt) { a.state = "forged" },
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name:    "other browser",
+			tamper:  func(a *oidcAttempt) { a.binding = "other-browser" },
+			wantErr: ErrInvalidOIDCState,
+		},
+		{
+			name:    "code issued for another PKCE challenge",
+			tamper:  func(a *oidcAttempt) { a.challenge = "attackers-challenge" },
+			wantErr: errRejected,
+		},
+		{
+			name:    "nonce mismatch",
+			tamper:  func(a *oidcAttempt) { a.claims["nonce"] = "replayed" },
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "signed with another key",
+			tamper:  func(a *oidcAttempt) { a.key = otherKey },
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "unknown key ID",
+			tamper:  func(a *oidcAttempt) { a.kid = "rotated-away" },
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name: "expired",
+			tamper: func(a *oidcAttempt) {
+				a.claims["iat"] = time.Now().Add(-time.Hour).Unix()
+				a.claims["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+			},
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "issued to another client",
+			tamper:  func(a *oidcAttempt) { a.claims["aud"] = "someone-else" },
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "other issuer",
+			tamper:  func(a *oidcAttempt) { a.claims["iss"] = "https://evil.example.com" },
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    "unverified email",
+			tamper:  func(a *oidcAttempt) { a.claims["email_verified"] = false },
+			wantErr: ErrEmailNotVerified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			provider := newFakeProvider(t)
+			provider.register(t, env)
+
+			attempt := provider.begin(t, env, "ada@example.edu")
+			tt.tamper(attempt)
+			resp, err := provider.finish(env, attempt)
+
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("login failed: %v", err)
+			case tt.wantErr == errRejected && err == nil,
+				tt.wantErr != nil && tt.wantErr != errRejected && !errors.Is(err, tt.wantErr):
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if code := oidcErrorCode(err); code == oidcErrorServer {
+					t.Errorf("the app is told %q for %v", code, err)
+				}
+				return
+			}
+
+			userID, err := env.auth.ValidateToken(context.Background(), resp.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := env.users.GetUser(context.Background(), userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Email != "ada@example.edu" || !u.IsVerified {
+				t.Errorf("got user %s verified=%v", u.Email, u.IsVerified)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackReportsFixedCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "provider error", query: "error=access_denied&error_description=%3Cscript%3E", want: oidcErrorProvider},
+		{name: "missing state", query: "code=abc", want: oidcErrorInvalidState},
+		{name: "unknown state", query: "code=abc&state=forged", want: oidcErrorInvalidState},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			r := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+tt.query, nil)
+			r.AddCookie(&http.Cookie{Name: oidcBindingCookie, Value: "binding"})
+			rec := httptest.NewRecorder()
+			NewHandler(env.auth).OIDCCallback(rec, r)
+
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fragment, err := url.ParseQuery(location.Fragment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fragment) != 1 || fragment.Get("error") != tt.want {
+				t.Errorf("redirected with %q, want only error=%s", location.Fragment, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: ErrInvalidOIDCState, want: oidcErrorInvalidState},
+		{err: fmt.Errorf("%w: %w", ErrOIDCProvider, oidc.ErrInvalidIDToken), want: oidcErrorProvider},
+		{err: ErrUnknownProvider, want: oidcErrorProvider},
+		{err: ErrEmailNotVerified, want: oidcErrorProvider},
+		{err: ErrAccountDisabled, want: oidcErrorAccountDisabled},
+		{err: errors.New("connection refused"), want: oidcErrorServer},
+	}
+
+	for _, tt := range tests {
+		if got := oidcErrorCode(tt.err); got != tt.want {
+			t.Errorf("oidcErrorCode(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCLinksExistingAccount(t *testing.T) {
+	tests := []struct {
+		name        string
+		verified    bool
+		wantRevoked bool
+	}{
+		// Someone registered the address without ever confirming it
+		{name: "unverified account", verified: false, wantRevoked: true},
+		{name: "verified account", verified: true, wantRevoked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			provider := newFakeProvider(t)
+			provider.register(t, env)
+
+			userID, registered := env.register(t, "ada@example.edu", "ada")
+			if tt.verified {
+				if err := env.auth.VerifyEmail(ctx, env.outbox.lastToken(t, "ada@example.edu")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			resp, err := provider.finish(env, provider.begin(t, env, "ada@example.edu"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked, err := env.auth.ValidateToken(ctx, resp.Token); err != nil || linked != userID {
+				t.Fatalf("signed in as %q (%v), want the existing user %q", linked, err, userID)
+			}
+
+			_, sessionErr := env.auth.ValidateToken(ctx, registered.Token)
+			_, passwordErr := env.auth.Login(ctx, LoginRequest{Email: "ada@example.edu", Password: testPassword})
+			if revoked := sessionErr != nil; revoked != tt.wantRevoked {
+				t.Errorf("earlier session revoked=%v, want %v", revoked, tt.wantRevoked)
+			}
+			if rejected := passwordErr != nil; rejected != tt.wantRevoked {
+				t.Errorf("earlier password rejected=%v (%v), want %v", rejected, passwordErr, tt.wantRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"sanctor/internal/mail"
+	"sanctor/internal/user"
+	"sanctor/internal/webauthn"
+)
+
+// maxPasskeysPerUser limits how many passkeys a user can register
+const maxPasskeysPerUser = 20
+
+// passkeyCeremonyTTL is how long a started ceremony can be finished; a
+// little longer than the browser gives the user
+const passkeyCeremonyTTL = webauthn.CeremonyTimeout + time.Minute
+
+// startPasskeyCeremony stores a new ceremony with a fresh challenge and
+// returns its ID. userID is empty for a login.
+func (s *Service) startPasskeyCeremony(ctx context.Context, userID string) (string, []byte, error) {
+	id, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	err = s.repo.CreatePasskeyChallenge(ctx, &PasskeyChallenge{
+		IDHash:    hashToken(id),
+		UserID:    userID,
+		Challenge: challenge,
+		ExpiresAt: now.Add(passkeyCeremonyTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return id, challenge, nil
+}
+
+// takePasskeyCeremony consumes the ceremony with the given ID
+func (s *Service) takePasskeyCeremony(ctx context.Context, id string) (*PasskeyChallenge, error) {
+	if id == "" {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+	ceremony, err := s.repo.TakePasskeyChallenge(ctx, hashToken(id))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(ceremony.ExpiresAt) {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+	return ceremony, nil
+}
+
+// defaultRelyingParty scopes passkeys to the web app's host
+func defaultRelyingParty(appURL string) *webauthn.RelyingParty {
+	u, err := url.Parse(appURL)
+	if err != nil {
+		return nil
+	}
+	rp, err := webauthn.NewRelyingParty(u.Hostname(), "Sanctor", []string{u.Scheme + "://" + u.Host})
+	if err != nil {
+		log.Printf("⚠️  Passkeys disabled: %v", err)
+		return nil
+	}
+	return rp
+}
+
+// SetRelyingParty replaces the site passkeys are scoped to. Changing the RP
+// ID orphans every registered passkey.
+func (s *Service) SetRelyingParty(rp *webauthn.RelyingParty) {
+	s.relyingParty = rp
+}
+
+// encodeCredentialID turns a raw credential ID into its stored form
+func encodeCredentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// StartPasskeyRegistration returns the options for creating a new passkey.
+// A passkey signs in on its own, so the user must re-authenticate first; a
+// stolen session is not enough to plant one. Passkeys the user already has
+// are excluded, so the same authenticator is not registered twice.
+func (s *Service) StartPasskeyRegistration(ctx context.Context, userID string, req StartPasskeyRegistrationRequest) (*PasskeyCeremony, error) {
+	if s.relyingParty == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+	if err := s.reauthenticate(ctx, userID, req.Password, req.Code); err != nil {
+		return nil, err
+	}
+
+	u, err := s.userService.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.FindPasskeysByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxPasskeysPerUser {
+		return nil, ErrTooManyPasskeys
+	}
+
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(existing))
+	for _, passkey := range existing {
+		id, err := base64.RawURLEncoding.DecodeString(passkey.CredentialID)
+		if err == nil {
+			exclude = append(exclude, webauthn.NewCredentialDescriptor(id, passkey.TransportList()))
+		}
+	}
+
+	ceremonyID, challenge, err := s.startPasskeyCeremony(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// The user handle is the user ID, which reveals nothing about the person
+	entity := webauthn.UserEntity{ID: []byte(u.ID), Name: u.Email, DisplayName: u.FullName()}
+	return &PasskeyCeremony{
+		CeremonyID: ceremonyID,
+		PublicKey:  s.relyingParty.CreationOptions(entity, challenge, exclude),
+	}, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response and stores
+// the new passkey. It only accepts a ceremony the same user opened by
+// re-authenticating in StartPasskeyRegistration.
+func (s *Service) FinishPasskeyRegistration(ctx context.Context, userID string, req PasskeyRegistrationRequest) (*Passkey, error) {
+	if s.relyingParty == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 100 {
+		return nil, errors.New("name must be at most 100 characters")
+	}
+
+	ceremony, err := s.takePasskeyCeremony(ctx, req.CeremonyID)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != userID {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+
+	credential, err := s.relyingParty.VerifyRegistration(&req.Credential, ceremony.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey := &Passkey{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		CredentialID: encodeCredentialID(credential.ID),
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Transports:   strings.Join(credential.Transports, ","),
+		Name:         name,
+		BackedUp:     credential.BackedUp,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.repo.CreatePasskey(ctx, passkey); err != nil {
+		return nil, err
+	}
+
+	// The notice outlives the request, so it must not be cancelled with it
+	ctx = context.WithoutCancel(ctx)
+	s.goBackground(func() {
+		u, err := s.userService.GetUser(ctx, userID)
+		if err != nil {
+			return
+		}
+		if err := s.sendPasskeyAddedEmail(u, name); err != nil {
+			log.Printf("Failed to send passkey notification to user %s: %v", userID, err)
+		}
+	})
+	log.Printf("🔐 Passkey %s registered for user %s", passkey.ID, userID)
+	return passkey, nil
+}
+
+// ListPasskeys returns a user's passkeys
+func (s *Service) ListPasskeys(ctx context.Context, userID string) ([]*Passkey, error) {
+	return s.repo.FindPasskeysByUser(ctx, userID)
+}
+
+// DeletePasskey removes one of a user's passkeys
+func (s *Service) DeletePasskey(ctx context.Context, userID, id string) error {
+	if err := s.repo.DeletePasskey(ctx, userID, id); err != nil {
+		return err
+	}
+	log.Printf("🗑️  Passkey %s removed from user %s", id, userID)
+	return nil
+}
+
+// deletePasskeys removes every passkey of a user. A passkey signs in on its
+// own, so one planted by whoever took over the account would otherwise
+// survive the owner taking it back.
+func (s *Service) deletePasskeys(ctx context.Context, userID string) error {
+	passkeys, err := s.repo.FindPasskeysByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, passkey := range passkeys {
+		if err := s.repo.DeletePasskey(ctx, userID, passkey.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartPasskeyLogin returns the options for signing in with a passkey. No
+// account is named: the browser offers whichever passkeys it holds for the
+// site, and the chosen one identifies the user.
+func (s *Service) StartPasskeyLogin(ctx context.Context) (*PasskeyCeremony, error) {
+	if s.relyingParty == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+
+	ceremonyID, challenge, err := s.startPasskeyCeremony(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyCeremony{
+		CeremonyID: ceremonyID,
+		PublicKey:  s.relyingParty.RequestOptions(challenge, nil),
+	}, nil
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and signs its owner in.
+// Passkeys require user verification (a PIN or biometric on the device), so
+// they count as both factors and skip the two-factor challenge.
+func (s *Service) FinishPasskeyLogin(ctx context.Context, req PasskeyLoginRequest) (*AuthResponse, error) {
+	if s.relyingParty == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+
+	ceremony, err := s.takePasskeyCeremony(ctx, req.CeremonyID)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != "" {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+
+	credentialID := encodeCredentialID(req.Credential.RawID)
+	if len(req.Credential.RawID) == 0 {
+		credentialID = req.Credential.ID
+	}
+	passkey, err := s.repo.FindPasskey(ctx, credentialID)
+	if err != nil {
+		s.recordLoginFailed(ctx, "", LoginMethodPasskey, req.ClientInfo, failureInvalidPasskey)
+		return nil, ErrInvalidPasskey
+	}
+	if handle := req.Credential.Response.UserHandle; len(handle) > 0 && string(handle) != passkey.UserID {
+		s.recordLoginFailed(ctx, passkey.UserID, LoginMethodPasskey, req.ClientInfo, failureInvalidPasskey)
+		return nil, ErrInvalidPasskey
+	}
+
+	assertion, err := s.relyingParty.VerifyAuthentication(&req.Credential, ceremony.Challenge, passkey.PublicKey)
+	if err != nil {
+		log.Printf("⚠️  Passkey %s of user %s rejected: %v", passkey.ID, passkey.UserID, err)
+		s.recordLoginFailed(ctx, passkey.UserID, LoginMethodPasskey, req.ClientInfo, failureInvalidPasskey)
+		return nil, ErrInvalidPasskey
+	}
+
+	// A counter that does not move forward suggests a cloned authenticator.
+	// Synced passkeys always report zero.
+	signCount := int64(assertion.SignCount)
+	if (signCount != 0 || passkey.SignCount != 0) && signCount <= passkey.SignCount {
+		log.Printf("⚠️  Passkey %s of user %s reused sign count %d (stored %d), possible clone",
+			passkey.ID, passkey.UserID, signCount, passkey.SignCount)
+		s.recordLoginFailed(ctx, passkey.UserID, LoginMethodPasskey, req.ClientInfo, failureInvalidPasskey)
+		return nil, ErrInvalidPasskey
+	}
+
+	if err := s.repo.UpdatePasskeyUsage(ctx, passkey.ID, signCount, assertion.BackedUp, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.completeLogin(ctx, passkey.UserID, LoginMethodPasskey, req.ClientInfo)
+}
+
+// sendPasskeyAddedEmail tells a user a passkey was added to their account
+func (s *Service) sendPasskeyAddedEmail(u *user.User, name string) error {
+	return s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "A passkey was added to your Sanctor account",
+		Body: fmt.Sprintf("Hi %s,\n\nA passkey named %q was just added to your account. It can sign you in without a password.\n\n"+
+			"If you did not do this, remove it at %s/settings/security and reset your password right away.\n",
+			u.FullName(), name, s.appURL),
+	})
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"sanctor/internal/webauthn"
+	"sanctor/internal/webauthn/webauthntest"
+)
+
+// enableTwoFactor turns on two-factor authentication for a user and
+// returns one of their recovery codes
+func (env *testEnv) enableTwoFactor(t *testing.T, userID string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := env.auth.EnrollTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totpCode(enrollment.Secret, totpStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := env.auth.ConfirmTwoFactor(ctx, userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recoveryCodes[0]
+}
+
+func TestPasskeyRegistrationRequiresReauthentication(t *testing.T) {
+	tests := []struct {
+		name      string
+		twoFactor bool
+		password  string
+		code      string
+		wantErr   error
+	}{
+		{name: "no password", wantErr: ErrInvalidCredentials},
+		{name: "wrong password", password: "difference-engine-1822", wantErr: ErrInvalidCredentials},
+		{name: "password", password: testPassword},
+		{name: "two-factor without code", twoFactor: true, password: testPassword, wantErr: ErrInvalidTwoFactorCode},
+		{name: "two-factor with wrong password", twoFactor: true, password: "difference-engine-1822", code: "recovery", wantErr: ErrInvalidCredentials},
+		{name: "two-factor with code", twoFactor: true, password: testPassword, code: "recovery"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+			code := tt.code
+			if tt.twoFactor {
+				recovery := env.enableTwoFactor(t, userID)
+				if code == "recovery" {
+					code = recovery
+				}
+			}
+
+			ceremony, err := env.auth.StartPasskeyRegistration(context.Background(), userID, StartPasskeyRegistrationRequest{
+				Password: tt.password,
+				Code:     code,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && ceremony.CeremonyID == "" {
+				t.Error("no ceremony was started")
+			}
+		})
+	}
+}
+
+// registerPasskey adds a passkey from a new software authenticator to a user
+func (env *testEnv) registerPasskey(t *testing.T, userID string) *webauthntest.Authenticator {
+	t.Helper()
+	ctx := context.Background()
+	rp := env.auth.relyingParty
+	authenticator := webauthntest.NewAuthenticator(rp.ID, rp.Origins[0])
+
+	ceremony, err := env.auth.StartPasskeyRegistration(ctx, userID, StartPasskeyRegistrationRequest{Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.auth.FinishPasskeyRegistration(ctx, userID, PasskeyRegistrationRequest{
+		CeremonyID: ceremony.CeremonyID,
+		Credential: *authenticator.Create(ceremony.PublicKey.(*webauthn.CreationOptions)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticator
+}
+
+func TestPasskeyAddedNotice(t *testing.T) {
+	env := newTestEnv(t)
+	userID, _ := env.register(t, "ada@example.com", "ada")
+	env.registerPasskey(t, userID)
+
+	// The notice is sent in the background; shutdown waits for it
+	if err := env.auth.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(env.outbox.subjects("ada@example.com"), "A passkey was added to your Sanctor account") {
+		t.Error("no passkey notice was sent")
+	}
+}
+
+// loginWithPasskey runs a whole passkey login with an authenticator
+func (env *testEnv) loginWithPasskey(t *testing.T, authenticator *webauthntest.Authenticator) (*AuthResponse, error) {
+	t.Helper()
+	ctx := context.Background()
+	ceremony, err := env.auth.StartPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env.auth.FinishPasskeyLogin(ctx, PasskeyLoginRequest{
+		CeremonyID: ceremony.CeremonyID,
+		Credential: *authenticator.Get(ceremony.PublicKey.(*webauthn.RequestOptions)),
+	})
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(a *webauthntest.Authenticator)
+		wantErr error
+	}{
+		{name: "valid", tamper: func(a *webauthntest.Authenticator) {}},
+		// A clone of the authenticator continues from an older counter
+		{name: "sign count went back", tamper: func(a *webauthntest.Authenticator) { a.SignCount = 0 }, wantErr: ErrInvalidPasskey},
+		{name: "other site", tamper: func(a *webauthntest.Authenticator) { a.RPID = "evil.example.com" }, wantErr: ErrInvalidPasskey},
+		{name: "other origin", tamper: func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example.com" }, wantErr: ErrInvalidPasskey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+			authenticator := env.registerPasskey(t, userID)
+			if _, err := env.loginWithPasskey(t, authenticator); err != nil {
+				t.Fatalf("first login failed: %v", err)
+			}
+
+			tt.tamper(authenticator)
+			resp, err := env.loginWithPasskey(t, authenticator)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if signedIn, err := env.auth.ValidateToken(context.Background(), resp.Token); err != nil || signedIn != userID {
+				t.Errorf("signed in as %q (%v), want %q", signedIn, err, userID)
+			}
+		})
+	}
+}
+
+func TestPasskeyCeremonyIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID, _ := env.register(t, "ada@example.com", "ada")
+	authenticator := env.registerPasskey(t, userID)
+
+	ceremony, err := env.auth.StartPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := PasskeyLoginRequest{
+		CeremonyID: ceremony.CeremonyID,
+		Credential: *authenticator.Get(ceremony.PublicKey.(*webauthn.RequestOptions)),
+	}
+	if _, err := env.auth.FinishPasskeyLogin(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Credential = *authenticator.Get(ceremony.PublicKey.(*webauthn.RequestOptions))
+	if _, err := env.auth.FinishPasskeyLogin(ctx, req); !errors.Is(err, ErrInvalidPasskeyCeremony) {
+		t.Fatalf("got error %v, want ErrInvalidPasskeyCeremony", err)
+	}
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"sanctor/internal/mail"
+	"sanctor/internal/user"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = 30 * time.Minute
+
+// ForgotPassword emails a password reset link to the account registered
+// under an address. It never reveals whether such an account exists: the
+// outcome is identical either way, and the lookup and delivery happen in the
+// background so response times do not differ either.
+func (s *Service) ForgotPassword(ctx context.Context, req ForgotPasswordRequest) {
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return
+	}
+
+	if ok, _ := s.passwordResets.Allow(user.NormalizeEmail(email)); !ok {
+		return
+	}
+
+	// The lookup outlives the request, so it must not be cancelled with it
+	ctx = context.WithoutCancel(ctx)
+	s.goBackground(func() {
+		u, err := s.userService.FindByEmail(ctx, email)
+		if err != nil {
+			return
+		}
+		if err := s.sendPasswordReset(ctx, u); err != nil {
+			log.Printf("Failed to send password reset email to user %s: %v", u.ID, err)
+		}
+	})
+}
+
+// ResetPassword sets a new password using a token from a reset email. In
+// one unit of work the token is consumed and every credential of the user
+// is revoked: sessions, API keys, unused sign-in and reset links, and
+// passkeys, which the user has to add again.
+func (s *Service) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	if req.Token == "" {
+		return ErrInvalidResetToken
+	}
+
+	token, err := s.repo.FindPasswordReset(ctx, hashToken(req.Token))
+	if err != nil || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	// Reject a weak password before the token is spent
+	if err := s.userService.ValidateNewPassword(ctx, token.UserID, req.NewPassword); err != nil {
+		return err
+	}
+
+	err = s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.MarkPasswordResetUsed(ctx, token.ID, time.Now()); err != nil {
+			return ErrInvalidResetToken
+		}
+		if err := s.userService.ResetPassword(ctx, token.UserID, req.NewPassword); err != nil {
+			return err
+		}
+		if err := s.revokeCredentials(ctx, token.UserID, ""); err != nil {
+			return err
+		}
+		return s.deletePasskeys(ctx, token.UserID)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Password reset for user %s, all credentials revoked", token.UserID)
+	return nil
+}
+
+// ChangePassword replaces a signed-in user's password after checking the
+// current one. In the same unit of work every other credential of the user
+// is revoked: other sessions with their refresh tokens, API keys, unused
+// sign-in and reset links, and passkeys. sessionID stays signed in.
+func (s *Service) ChangePassword(ctx context.Context, userID, sessionID string, req ChangePasswordRequest) error {
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		return errors.New("current and new password are required")
+	}
+	if req.CurrentPassword == req.NewPassword {
+		return errors.New("new password must be different from the current password")
+	}
+
+	// Someone holding a stolen session must not be able to guess the password
+	if ok, wait := s.passwordChanges.Allow(userID); !ok {
+		return &ThrottleError{RetryAfter: wait}
+	}
+
+	err := s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.userService.ChangePassword(ctx, userID, req.CurrentPassword, req.NewPassword); err != nil {
+			return err
+		}
+		if err := s.revokeCredentials(ctx, userID, sessionID); err != nil {
+			return err
+		}
+		return s.deletePasskeys(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The notice outlives the request, so it must not be cancelled with it
+	ctx = context.WithoutCancel(ctx)
+	s.goBackground(func() {
+		u, err := s.userService.GetUser(ctx, userID)
+		if err != nil {
+			return
+		}
+		if err := s.sendPasswordChangedEmail(u); err != nil {
+			log.Printf("Failed to send password change notification to user %s: %v", userID, err)
+		}
+	})
+
+	log.Printf("🔐 Password changed for user %s, other credentials revoked", userID)
+	return nil
+}
+
+// reauthenticate makes a signed-in user prove again who they are before a
+// sensitive change: their password, and a two-factor code when they have
+// two-factor authentication on. Password guesses share the throttle of
+// password changes, so a stolen session cannot be used to guess either.
+func (s *Service) reauthenticate(ctx context.Context, userID, password, code string) error {
+	if ok, wait := s.passwordChanges.Allow(userID); !ok {
+		return &ThrottleError{RetryAfter: wait}
+	}
+
+	ok, err := s.userService.VerifyPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	enabled, err := s.requiresTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return s.checkTwoFactorCode(ctx, userID, code)
+	}
+	return nil
+}
+
+// sendPasswordChangedEmail tells a user their password was changed
+func (s *Service) sendPasswordChangedEmail(u *user.User) error {
+	return s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Your Sanctor password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe password of your Sanctor account was just changed, your other devices were signed out, your API keys were revoked and your passkeys were removed.\n\n"+
+			"If you did not do this, reset your password at %s/forgot-password right away.\n",
+			u.FullName(), s.appURL),
+	})
+}
+
+// sendPasswordReset issues a reset token for a user and mails them the link.
+// Any earlier reset links of the user stop working.
+func (s *Service) sendPasswordReset(ctx context.Context, u *user.User) error {
+	raw, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.InvalidatePasswordResets(ctx, u.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	token := &PasswordResetToken{
+		ID:        uuid.New().String(),
+		UserID:    u.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(passwordResetTTL),
+		CreatedAt: now,
+	}
+	if err := s.repo.CreatePasswordReset(ctx, token); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.appURL, url.QueryEscape(raw))
+	return s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Reset your Sanctor password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Sanctor account. "+
+			"Open the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in %d minutes and can only be used once. "+
+			"If you did not ask for a reset, you can ignore this email; your password has not changed.\n",
+			u.FullName(), link, int(passwordResetTTL.Minutes())),
+	})
+}
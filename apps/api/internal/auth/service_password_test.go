@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"sanctor/internal/database"
+	"sanctor/internal/user"
+)
+
+const (
+	newPassword           = "difference-engine-1822"
+	passwordChangedNotice = "Your Sanctor password was changed"
+)
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name string
+		// present returns the reset token to use after registering
+		present func(t *testing.T, env *testEnv, userID string) string
+		wantErr error
+	}{
+		{
+			name: "fresh token",
+			present: func(t *testing.T, env *testEnv, userID string) string {
+				return env.forgotPassword(t, "ada@example.com")
+			},
+		},
+		{
+			name: "used twice",
+			present: func(t *testing.T, env *testEnv, userID string) string {
+				token := env.forgotPassword(t, "ada@example.com")
+				if err := env.auth.ResetPassword(context.Background(), ResetPasswordRequest{Token: token, NewPassword: "babbage-lovelace-1833"}); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name: "replaced by a newer token",
+			present: func(t *testing.T, env *testEnv, userID string) string {
+				token := env.forgotPassword(t, "ada@example.com")
+				// Requests are throttled, so issue the newer token directly
+				u, err := env.users.GetUser(context.Background(), userID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := env.auth.sendPasswordReset(context.Background(), u); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name: "expired",
+			present: func(t *testing.T, env *testEnv, userID string) string {
+				raw, err := generateToken()
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = env.repo.CreatePasswordReset(context.Background(), &PasswordResetToken{
+					ID:        uuid.New().String(),
+					UserID:    userID,
+					TokenHash: hashToken(raw),
+					ExpiresAt: time.Now().Add(-time.Minute),
+					CreatedAt: time.Now().Add(-passwordResetTTL),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name:    "unknown token",
+			present: func(t *testing.T, env *testEnv, userID string) string { return "not-a-reset-token" },
+			wantErr: ErrInvalidResetToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			userID, first := env.register(t, "ada@example.com", "ada")
+			apiKey := env.createAPIKey(t, userID)
+
+			token := tt.present(t, env, userID)
+			err := env.auth.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: newPassword})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: newPassword}); err == nil {
+					t.Error("the password was changed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: newPassword}); err != nil {
+				t.Errorf("cannot sign in with the new password: %v", err)
+			}
+			if _, err := env.auth.ValidateToken(ctx, first.Token); err == nil {
+				t.Error("the old session is still valid")
+			}
+			if _, err := env.auth.ParseAPIKey(ctx, apiKey); err == nil {
+				t.Error("the API key is still valid")
+			}
+		})
+	}
+}
+
+func TestResetPasswordRevokesSignInLinks(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+	link := env.requestMagicLink(t, "ada@example.com", "")
+
+	if err := env.auth.ResetPassword(ctx, ResetPasswordRequest{Token: env.forgotPassword(t, "ada@example.com"), NewPassword: newPassword}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.auth.LoginWithMagicLink(ctx, MagicLinkLoginRequest{Token: link}); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Fatalf("got error %v for a link mailed before the reset, want ErrInvalidMagicLink", err)
+	}
+}
+
+func TestResetPasswordRemovesPasskeys(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID, _ := env.register(t, "ada@example.com", "ada")
+	authenticator := env.registerPasskey(t, userID)
+
+	if err := env.auth.ResetPassword(ctx, ResetPasswordRequest{Token: env.forgotPassword(t, "ada@example.com"), NewPassword: newPassword}); err != nil {
+		t.Fatal(err)
+	}
+	if passkeys, err := env.auth.ListPasskeys(ctx, userID); err != nil || len(passkeys) != 0 {
+		t.Errorf("got %d passkeys (%v), want none", len(passkeys), err)
+	}
+	if _, err := env.loginWithPasskey(t, authenticator); !errors.Is(err, ErrInvalidPasskey) {
+		t.Errorf("got error %v for a passkey added before the reset, want ErrInvalidPasskey", err)
+	}
+}
+
+func TestResetPasswordKeepsTokenForWeakPassword(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+	token := env.forgotPassword(t, "ada@example.com")
+
+	if err := env.auth.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: "ada"}); err == nil {
+		t.Fatal("a weak password was accepted")
+	}
+	if err := env.auth.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: newPassword}); err != nil {
+		t.Fatalf("the token was spent on a rejected password: %v", err)
+	}
+}
+
+// failingMagicLinks fails to invalidate magic links, a step of revoking a
+// user's credentials
+type failingMagicLinks struct {
+	Repository
+}
+
+var errInjected = errors.New("injected failure")
+
+func (r failingMagicLinks) InvalidateMagicLinks(ctx context.Context, userID string) error {
+	return errInjected
+}
+
+func TestResetPasswordRollsBack(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID, first := env.register(t, "ada@example.com", "ada")
+	token := env.forgotPassword(t, "ada@example.com")
+
+	// Rebuild the service on a repository that fails halfway through
+	env.auth = NewService(failingMagicLinks{env.repo}, database.NewMemoryTransactor(), env.users, env.outbox, env.auth.universities, Config{Keys: env.auth.keys})
+	if err := env.auth.ResetPassword(ctx, ResetPasswordRequest{Token: token, NewPassword: newPassword}); !errors.Is(err, errInjected) {
+		t.Fatalf("got error %v, want the injected failure", err)
+	}
+
+	if ok, err := env.users.VerifyPassword(ctx, userID, testPassword); err != nil || !ok {
+		t.Errorf("the password was changed (%v)", err)
+	}
+	if _, err := env.auth.ValidateToken(ctx, first.Token); err != nil {
+		t.Errorf("the session was revoked: %v", err)
+	}
+	if reset, err := env.repo.FindPasswordReset(ctx, hashToken(token)); err != nil || reset.UsedAt != nil {
+		t.Errorf("the token was spent (%v)", err)
+	}
+}
+
+func TestForgotPasswordRevealsNothing(t *testing.T) {
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+
+	before := env.outbox.count("nobody@example.com")
+	env.auth.ForgotPassword(context.Background(), ForgotPasswordRequest{Email: "nobody@example.com"})
+	if err := env.auth.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if env.outbox.count("nobody@example.com") != before {
+		t.Error("a reset link was mailed to an address without an account")
+	}
+
+	// Addresses are matched without regard to case
+	env.forgotPassword(t, "ADA@example.com")
+}
+
+// forgotPassword asks for a password reset and returns the token mailed for
+// it, failing the test if none was sent
+func (env *testEnv) forgotPassword(t *testing.T, email string) string {
+	t.Helper()
+	to := user.NormalizeEmail(email)
+	before := env.outbox.count(to)
+	env.auth.ForgotPassword(context.Background(), ForgotPasswordRequest{Email: email})
+	if err := env.auth.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if env.outbox.count(to) == before {
+		t.Fatalf("no reset link was mailed to %s", to)
+	}
+	return env.outbox.lastToken(t, to)
+}
+
+// createAPIKey issues an API key for a user and returns the raw key
+func (env *testEnv) createAPIKey(t *testing.T, userID string) string {
+	t.Helper()
+	created, err := env.auth.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{Name: "laptop", Scopes: []string{ScopePostsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created.Key
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		next    string
+		wantErr bool
+	}{
+		{name: "new password", current: testPassword, next: newPassword},
+		{name: "wrong current password", current: "babbage-lovelace-1833", next: newPassword, wantErr: true},
+		{name: "rejected by the policy", current: testPassword, next: "ada", wantErr: true},
+		{name: "same password", current: testPassword, next: testPassword, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			userID, current := env.register(t, "ada@example.com", "ada")
+			other, err := env.auth.Login(ctx, LoginRequest{Email: "ada@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatal(err)
+			}
+			apiKey := env.createAPIKey(t, userID)
+			link := env.requestMagicLink(t, "ada@example.com", "")
+			authenticator := env.registerPasskey(t, userID)
+
+			sessionID := env.refreshToken(t, current.RefreshToken).SessionID
+			err = env.auth.ChangePassword(ctx, userID, sessionID, ChangePasswordRequest{CurrentPassword: tt.current, NewPassword: tt.next})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("the change was accepted")
+				}
+				if ok, _ := env.users.VerifyPassword(ctx, userID, testPassword); !ok {
+					t.Error("the password was changed")
+				}
+				if _, err := env.auth.ValidateToken(ctx, other.Token); err != nil {
+					t.Errorf("the other session was revoked: %v", err)
+				}
+				if _, err := env.auth.ParseAPIKey(ctx, apiKey); err != nil {
+					t.Errorf("the API key was revoked: %v", err)
+				}
+				if _, err := env.loginWithPasskey(t, authenticator); err != nil {
+					t.Errorf("the passkey was removed: %v", err)
+				}
+				if err := env.auth.Wait(ctx); err != nil {
+					t.Fatal(err)
+				}
+				if slices.Contains(env.outbox.subjects("ada@example.com"), passwordChangedNotice) {
+					t.Error("a refused change sent a password change notice")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The notice is sent in the background; shutdown waits for it
+			if err := env.auth.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Contains(env.outbox.subjects("ada@example.com"), passwordChangedNotice) {
+				t.Error("no password change notice was sent")
+			}
+
+			if ok, _ := env.users.VerifyPassword(ctx, userID, tt.next); !ok {
+				t.Error("the new password does not work")
+			}
+			if _, err := env.auth.ValidateToken(ctx, current.Token); err != nil {
+				t.Errorf("the current session was revoked: %v", err)
+			}
+			if _, err := env.auth.ValidateToken(ctx, other.Token); err == nil {
+				t.Error("the other session is still valid")
+			}
+			if _, err := env.auth.ParseAPIKey(ctx, apiKey); err == nil {
+				t.Error("the API key is still valid")
+			}
+			if _, err := env.auth.LoginWithMagicLink(ctx, MagicLinkLoginRequest{Token: link}); !errors.Is(err, ErrInvalidMagicLink) {
+				t.Errorf("got error %v for a link mailed before the change, want ErrInvalidMagicLink", err)
+			}
+			if _, err := env.loginWithPasskey(t, authenticator); !errors.Is(err, ErrInvalidPasskey) {
+				t.Errorf("got error %v for a passkey added before the change, want ErrInvalidPasskey", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token can be used exactly once; presenting a token that
+// was already exchanged is treated as theft and revokes the whole session.
+func (s *Service) Refresh(ctx context.Context, req RefreshRequest) (*AuthResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, errors.New("refresh token is required")
+	}
+
+	token, err := s.repo.FindByToken(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.repo.FindSession(ctx, token.SessionID)
+	if err != nil || !session.IsActive() {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.UsedAt != nil {
+		s.revokeReusedFamily(ctx, session)
+		return nil, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err := s.repo.MarkRefreshTokenUsed(ctx, token.ID, time.Now()); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			s.revokeReusedFamily(ctx, session)
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, err
+	}
+
+	if err := s.repo.TouchSession(ctx, session.ID, time.Now(), req.ClientInfo); err != nil {
+		return nil, err
+	}
+
+	return s.rotateTokens(ctx, session)
+}
+
+// issueTokens starts a new session for a user and returns its first token pair
+func (s *Service) issueTokens(ctx context.Context, userID string, client ClientInfo) (*AuthResponse, error) {
+	now := time.Now()
+	session := &Model{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionTTL),
+		CreatedAt:  now,
+	}
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return nil, errors.New("failed to create session")
+	}
+
+	return s.rotateTokens(ctx, session)
+}
+
+// rotateTokens issues a fresh access token and refresh token for an existing
+// session. The user is looked up each time so that the token carries their
+// current role and deactivated accounts cannot refresh.
+func (s *Service) rotateTokens(ctx context.Context, session *Model) (*AuthResponse, error) {
+	u, err := s.userService.GetUser(ctx, session.UserID)
+	if err != nil || !u.IsActive {
+		return nil, ErrAccountDisabled
+	}
+	u = s.promoteBootstrapAdmin(ctx, u)
+
+	accessToken, err := s.GenerateJWT(session.UserID, session.ID, u.Role)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	rawRefresh, err := generateToken()
+	if err != nil {
+		return nil, errors.New("failed to generate refresh token")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.refreshTokenTTL)
+	if expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+
+	refreshToken := &RefreshToken{
+		ID:        uuid.New().String(),
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		TokenHash: hashToken(rawRefresh),
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+	if err := s.repo.CreateRefreshToken(ctx, refreshToken); err != nil {
+		return nil, errors.New("failed to store refresh token")
+	}
+
+	return &AuthResponse{
+		Token:        accessToken,
+		RefreshToken: rawRefresh,
+		ExpiresAt:    now.Add(s.accessTokenTTL).Format(time.RFC3339),
+	}, nil
+}
+
+// revokeReusedFamily revokes a session after one of its refresh tokens was replayed
+func (s *Service) revokeReusedFamily(ctx context.Context, session *Model) {
+	log.Printf("⚠️  Refresh token reuse detected for user %s, revoking session %s", session.UserID, session.ID)
+	// The thief hanging up must not save the session
+	if err := s.repo.RevokeSession(context.WithoutCancel(ctx), session.ID); err != nil {
+		log.Printf("Failed to revoke session %s: %v", session.ID, err)
+	}
+}
+
+// generateToken returns a random, URL-safe opaque token
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 hash of an opaque token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
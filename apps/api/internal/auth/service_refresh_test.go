@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// present returns the refresh token to exchange after registering
+		present     func(t *testing.T, env *testEnv, first *AuthResponse) string
+		wantErr     error
+		wantRevoked bool
+	}{
+		{
+			name:    "fresh token",
+			present: func(t *testing.T, env *testEnv, first *AuthResponse) string { return first.RefreshToken },
+		},
+		{
+			name: "rotated token",
+			present: func(t *testing.T, env *testEnv, first *AuthResponse) string {
+				return env.refresh(t, first.RefreshToken).RefreshToken
+			},
+		},
+		{
+			name:    "unknown token",
+			present: func(t *testing.T, env *testEnv, first *AuthResponse) string { return "not-a-refresh-token" },
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "already exchanged",
+			present: func(t *testing.T, env *testEnv, first *AuthResponse) string {
+				env.refresh(t, first.RefreshToken)
+				return first.RefreshToken
+			},
+			wantErr:     ErrRefreshTokenReused,
+			wantRevoked: true,
+		},
+		{
+			name: "expired",
+			present: func(t *testing.T, env *testEnv, first *AuthResponse) string {
+				token := env.refreshToken(t, first.RefreshToken)
+				raw, err := generateToken()
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = env.repo.CreateRefreshToken(context.Background(), &RefreshToken{
+					ID:        uuid.New().String(),
+					SessionID: token.SessionID,
+					UserID:    token.UserID,
+					TokenHash: hashToken(raw),
+					ExpiresAt: time.Now().Add(-time.Minute),
+					CreatedAt: time.Now().Add(-time.Hour),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "session signed out",
+			present: func(t *testing.T, env *testEnv, first *AuthResponse) string {
+				token := env.refreshToken(t, first.RefreshToken)
+				if err := env.auth.Logout(context.Background(), token.SessionID); err != nil {
+					t.Fatal(err)
+				}
+				return first.RefreshToken
+			},
+			wantErr:     ErrInvalidRefreshToken,
+			wantRevoked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			_, first := env.register(t, "ada@example.com", "ada")
+			sessionID := env.refreshToken(t, first.RefreshToken).SessionID
+
+			resp, err := env.auth.Refresh(context.Background(), RefreshRequest{RefreshToken: tt.present(t, env, first)})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.Token == "" || resp.RefreshToken == "" {
+					t.Fatalf("got %+v, want a token pair", resp)
+				}
+			}
+
+			session, err := env.repo.FindSession(context.Background(), sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked := !session.IsActive(); revoked != tt.wantRevoked {
+				t.Errorf("got session revoked=%v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestRefreshReuseRevokesNewerTokens(t *testing.T) {
+	env := newTestEnv(t)
+	_, first := env.register(t, "ada@example.com", "ada")
+	second := env.refresh(t, first.RefreshToken)
+
+	// The stolen first token comes back after the owner already rotated it
+	ctx := context.Background()
+	if _, err := env.auth.Refresh(ctx, RefreshRequest{RefreshToken: first.RefreshToken}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("got error %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := env.auth.Refresh(ctx, RefreshRequest{RefreshToken: second.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("got error %v for the rotated token, want ErrInvalidRefreshToken", err)
+	}
+}
+
+// refresh exchanges a refresh token and fails the test if that does not work
+func (env *testEnv) refresh(t *testing.T, refreshToken string) *AuthResponse {
+	t.Helper()
+	resp, err := env.auth.Refresh(context.Background(), RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// refreshToken looks up the stored record of a raw refresh token
+func (env *testEnv) refreshToken(t *testing.T, raw string) *RefreshToken {
+	t.Helper()
+	token, err := env.repo.FindByToken(context.Background(), hashToken(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestFindByTokenReturnsCopy(t *testing.T) {
+	env := newTestEnv(t)
+	_, first := env.register(t, "ada@example.com", "ada")
+
+	// Changing a found token must not change what the repository holds
+	now := time.Now()
+	env.refreshToken(t, first.RefreshToken).UsedAt = &now
+	env.refresh(t, first.RefreshToken)
+}
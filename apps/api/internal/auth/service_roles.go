@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"log"
+
+	"sanctor/internal/user"
+)
+
+// SetBootstrapAdmins lists email addresses that are promoted to admin the
+// next time they sign in, once the address is verified. This is how the
+// first administrator is created.
+func (s *Service) SetBootstrapAdmins(emails []string) {
+	for _, email := range emails {
+		if email = user.NormalizeEmail(email); email != "" {
+			s.bootstrapAdmins[email] = true
+		}
+	}
+}
+
+// promoteBootstrapAdmin makes u an admin if its email is listed in the
+// bootstrap admins and that exact address was confirmed, and returns the
+// up-to-date user
+func (s *Service) promoteBootstrapAdmin(ctx context.Context, u *user.User) *user.User {
+	if u.Role == user.RoleAdmin || !u.IsVerified || u.VerifiedEmail != u.Email || !s.bootstrapAdmins[u.Email] {
+		return u
+	}
+
+	if err := s.userService.SetRole(ctx, u.ID, user.RoleAdmin); err != nil {
+		log.Printf("Failed to promote bootstrap admin %s: %v", u.ID, err)
+		return u
+	}
+	log.Printf("🛡️  Promoted %s to admin (ADMIN_EMAILS)", u.Email)
+	u.Role = user.RoleAdmin
+	return u
+}
+
+// RevokeAllCredentials signs a user out everywhere and revokes their API
+// keys and unused sign-in and reset links, e.g. after an account is
+// deactivated or its role changes
+func (s *Service) RevokeAllCredentials(ctx context.Context, userID string) error {
+	return s.revokeCredentials(ctx, userID, "")
+}
+
+// revokeCredentials revokes every credential of a user in one unit of work,
+// except the session keepSessionID when it is set
+func (s *Service) revokeCredentials(ctx context.Context, userID, keepSessionID string) error {
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.RevokeUserSessions(ctx, userID, keepSessionID); err != nil {
+			return err
+		}
+
+		keys, err := s.repo.FindAPIKeysByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key.RevokedAt == nil {
+				if err := s.repo.RevokeAPIKey(ctx, key.ID); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := s.repo.InvalidateMagicLinks(ctx, userID); err != nil {
+			return err
+		}
+		return s.repo.InvalidatePasswordResets(ctx, userID)
+	})
+}
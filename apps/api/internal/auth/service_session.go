@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// Logout revokes the session the caller is signed in with
+func (s *Service) Logout(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return ErrSessionNotFound
+	}
+	return s.repo.RevokeSession(ctx, sessionID)
+}
+
+// ListSessions returns the active sessions of a user, most recently used
+// first. The session matching currentSessionID is flagged as current.
+func (s *Service) ListSessions(ctx context.Context, userID, currentSessionID string) ([]*SessionInfo, error) {
+	sessions, err := s.repo.FindSessionsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]*SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		if !session.IsActive() {
+			continue
+		}
+		active = append(active, &SessionInfo{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			LastSeenAt: session.LastSeenAt,
+			CreatedAt:  session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].LastSeenAt.After(active[j].LastSeenAt)
+	})
+	return active, nil
+}
+
+// RevokeSession revokes one of a user's sessions
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if sessionID == "" {
+		return errors.New("session ID is required")
+	}
+
+	session, err := s.repo.FindSession(ctx, sessionID)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.repo.RevokeSession(ctx, sessionID)
+}
+
+// RevokeAllSessions signs a user out everywhere. A non-empty exceptSessionID
+// keeps that one session signed in.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID, exceptSessionID string) error {
+	return s.repo.RevokeUserSessions(ctx, userID, exceptSessionID)
+}
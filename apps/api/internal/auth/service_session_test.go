@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+// login signs a registered user in from another device and returns the
+// access token and its claims
+func (env *testEnv) login(t *testing.T, email string) (string, *Claims) {
+	t.Helper()
+	ctx := context.Background()
+
+	resp, err := env.auth.Login(ctx, LoginRequest{Email: email, Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := env.auth.ParseJWT(ctx, resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Token, claims
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	adaID, _ := env.register(t, "ada@example.com", "ada")
+	charlesID, _ := env.register(t, "charles@example.com", "charles")
+	token, claims := env.login(t, "ada@example.com")
+
+	tests := []struct {
+		name      string
+		userID    string
+		sessionID string
+		wantErr   bool
+	}{
+		{name: "another user's session", userID: charlesID, sessionID: claims.SessionID, wantErr: true},
+		{name: "unknown session", userID: adaID, sessionID: "missing", wantErr: true},
+		{name: "no session", userID: adaID, sessionID: "", wantErr: true},
+		{name: "own session", userID: adaID, sessionID: claims.SessionID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := env.auth.ParseJWT(ctx, token); err != nil {
+				t.Fatalf("session revoked before its owner asked: %v", err)
+			}
+
+			err := env.auth.RevokeSession(ctx, tt.userID, tt.sessionID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RevokeSession() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			_, err = env.auth.ParseJWT(ctx, token)
+			if revoked := err != nil; revoked == tt.wantErr {
+				t.Errorf("session revoked = %v after RevokeSession() error %v", revoked, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRevokeAllSessionsKeepsTheCurrentOne(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID, registered := env.register(t, "ada@example.com", "ada")
+	current, currentClaims := env.login(t, "ada@example.com")
+	other, _ := env.login(t, "ada@example.com")
+
+	if err := env.auth.RevokeAllSessions(ctx, userID, currentClaims.SessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.auth.ParseJWT(ctx, current); err != nil {
+		t.Errorf("the current session was revoked: %v", err)
+	}
+	for _, token := range []string{registered.Token, other} {
+		if _, err := env.auth.ParseJWT(ctx, token); err != ErrSessionRevoked {
+			t.Errorf("ParseJWT() on another session error = %v, want %v", err, ErrSessionRevoked)
+		}
+	}
+
+	sessions, err := env.auth.ListSessions(ctx, userID, currentClaims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != currentClaims.SessionID || !sessions[0].Current {
+		t.Errorf("sessions = %+v, want only the current one", sessions)
+	}
+}
+
+func TestParseJWTRejectsEndedSessions(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(env *testEnv, userID string, claims *Claims) error
+	}{
+		{
+			name: "logged out",
+			end: func(env *testEnv, userID string, claims *Claims) error {
+				return env.auth.Logout(context.Background(), claims.SessionID)
+			},
+		},
+		{
+			name: "revoked",
+			end: func(env *testEnv, userID string, claims *Claims) error {
+				return env.auth.RevokeSession(context.Background(), userID, claims.SessionID)
+			},
+		},
+		{
+			name: "signed out everywhere",
+			end: func(env *testEnv, userID string, claims *Claims) error {
+				return env.auth.RevokeAllSessions(context.Background(), userID, "")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+			token, claims := env.login(t, "ada@example.com")
+
+			if err := tt.end(env, userID, claims); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.auth.ParseJWT(ctx, token); err != ErrSessionRevoked {
+				t.Errorf("ParseJWT() error = %v, want %v", err, ErrSessionRevoked)
+			}
+			if _, err := env.auth.ValidateToken(ctx, token); err == nil {
+				t.Error("ValidateToken() accepted a token of an ended session")
+			}
+		})
+	}
+}
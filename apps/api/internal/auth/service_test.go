@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"sanctor/internal/database"
+	"sanctor/internal/mail"
+	"sanctor/internal/university"
+	"sanctor/internal/user"
+)
+
+// outbox records the messages a test service sends
+type outbox struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (o *outbox) Send(msg *mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([^\s&]+)`)
+
+// lastToken returns the token in the latest link mailed to an address
+func (o *outbox) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To != to {
+			continue
+		}
+		if m := linkToken.FindStringSubmatch(o.messages[i].Body); m != nil {
+			token, err := url.QueryUnescape(m[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}
+	}
+	t.Fatalf("no link was mailed to %s", to)
+	return ""
+}
+
+// count returns how many messages were sent to an address
+func (o *outbox) count(to string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, msg := range o.messages {
+		if msg.To == to {
+			n++
+		}
+	}
+	return n
+}
+
+// subjects returns the subjects of the messages sent to an address
+func (o *outbox) subjects(to string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var subjects []string
+	for _, msg := range o.messages {
+		if msg.To == to {
+			subjects = append(subjects, msg.Subject)
+		}
+	}
+	return subjects
+}
+
+type testEnv struct {
+	auth   *Service
+	users  *user.Service
+	repo   Repository
+	outbox *outbox
+}
+
+// newTestEnv builds an auth service on in-memory storage
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	universities, err := university.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := database.NewMemoryTransactor()
+	env := &testEnv{
+		users:  user.NewService(user.NewRepository(), tx),
+		repo:   NewRepository(),
+		outbox: &outbox{},
+	}
+	// Cheap hashing keeps the tests fast
+	env.users.SetPasswordHasher(user.NewArgon2idHasher(user.Argon2idParams{
+		Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}))
+	env.auth = NewService(env.repo, tx, env.users, env.outbox, universities, Config{})
+	env.users.SetEmailChangeHook(env.auth.EmailChanged)
+	return env
+}
+
+const testPassword = "analytical-engine-1843"
+
+// register signs up a user and returns their ID and first tokens
+func (env *testEnv) register(t *testing.T, email, username string) (string, *AuthResponse) {
+	t.Helper()
+	ctx := context.Background()
+
+	resp, err := env.auth.Register(ctx, RegisterRequest{
+		Email:     email,
+		Username:  username,
+		Password:  testPassword,
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The verification email is sent in the background
+	if err := env.auth.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	userID, err := env.auth.ValidateToken(ctx, resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID, resp
+}
+
+// changeEmail switches a user to another address and waits for the emails
+// that sends, which go out in the background
+func (env *testEnv) changeEmail(t *testing.T, userID, email string) *user.User {
+	t.Helper()
+	ctx := context.Background()
+
+	u, err := env.users.UpdateUser(ctx, userID, user.UpdateUserRequest{Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.auth.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestEmailChangeRequiresConfirmation(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID, _ := env.register(t, "ada@example.com", "ada")
+
+	oldToken := env.outbox.lastToken(t, "ada@example.com")
+	if err := env.auth.VerifyEmail(ctx, oldToken); err != nil {
+		t.Fatal(err)
+	}
+
+	u := env.changeEmail(t, userID, "lovelace@example.com")
+	if u.IsVerified {
+		t.Fatal("the new address is verified before it was confirmed")
+	}
+	if n := env.outbox.count("ada@example.com"); n != 2 {
+		t.Errorf("previous address got %d messages, want the verification and a change notice", n)
+	}
+
+	if err := env.auth.VerifyEmail(ctx, oldToken); err != ErrInvalidVerificationToken {
+		t.Errorf("a link for the previous address verified the new one: %v", err)
+	}
+	if err := env.auth.VerifyEmail(ctx, env.outbox.lastToken(t, "lovelace@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ = env.users.GetUser(ctx, userID); !u.IsVerified {
+		t.Error("confirming the new address did not verify it")
+	}
+}
+
+func TestEmailChangeRejectsTakenAddress(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "ada@example.com", "ada")
+	userID, _ := env.register(t, "charles@example.com", "charles")
+
+	if _, err := env.users.UpdateUser(ctx, userID, user.UpdateUserRequest{Email: "ada@example.com"}); err != user.ErrEmailTaken {
+		t.Fatalf("got error %v, want %v", err, user.ErrEmailTaken)
+	}
+	if u, _ := env.users.GetUser(ctx, userID); u.Email != "charles@example.com" {
+		t.Errorf("email changed to %s", u.Email)
+	}
+}
+
+func TestBootstrapAdminNeedsConfirmedAddress(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.auth.SetBootstrapAdmins([]string{"admin@example.com"})
+	userID, resp := env.register(t, "ada@example.com", "ada")
+
+	// refresh rotates the tokens and reports the user's role
+	refresh := func() string {
+		t.Helper()
+		next, err := env.auth.Refresh(ctx, RefreshRequest{RefreshToken: resp.RefreshToken})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp = next
+		u, err := env.users.GetUser(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Role
+	}
+
+	if err := env.auth.VerifyEmail(ctx, env.outbox.lastToken(t, "ada@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	env.changeEmail(t, userID, "admin@example.com")
+	if role := refresh(); role == user.RoleAdmin {
+		t.Fatal("promoted before the bootstrap address was confirmed")
+	}
+
+	if err := env.auth.VerifyEmail(ctx, env.outbox.lastToken(t, "admin@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if role := refresh(); role != user.RoleAdmin {
+		t.Errorf("got role %q after confirming the bootstrap address, want admin", role)
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// twoFactorChallengeTTL is how long a user has to enter their code after
+	// giving the right password
+	twoFactorChallengeTTL = 5 * time.Minute
+
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTwoFactor starts setting up TOTP for a user. The returned secret is
+// pending until ConfirmTwoFactor succeeds; enrolling again replaces it.
+func (s *Service) EnrollTwoFactor(ctx context.Context, userID string) (*TwoFactorEnrollment, error) {
+	u, err := s.userService.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := s.repo.FindTwoFactor(ctx, userID); err == nil && existing.IsEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, errors.New("failed to generate secret")
+	}
+
+	twoFactor := &TwoFactor{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.SaveTwoFactor(ctx, twoFactor); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totpURI(u.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables a pending second factor once the user proves
+// their authenticator produces valid codes, and returns the first set of
+// recovery codes
+func (s *Service) ConfirmTwoFactor(ctx context.Context, userID, code string) ([]string, error) {
+	twoFactor, err := s.repo.FindTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.IsEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if ok, wait := s.twoFactorAttempts.Allow(userID); !ok {
+		return nil, &ThrottleError{RetryAfter: wait}
+	}
+
+	step, ok := verifyTOTP(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	now := time.Now()
+	twoFactor.ConfirmedAt = &now
+	twoFactor.LastUsedStep = step
+	if err := s.repo.SaveTwoFactor(ctx, twoFactor); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔐 Two-factor authentication enabled for user %s", userID)
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// DisableTwoFactor turns 2FA off. It takes a current TOTP or recovery code
+// so that a stolen access token alone cannot remove the second factor.
+func (s *Service) DisableTwoFactor(ctx context.Context, userID, code string) error {
+	if err := s.checkTwoFactorCode(ctx, userID, code); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteTwoFactor(ctx, userID); err != nil {
+		return err
+	}
+	log.Printf("🔓 Two-factor authentication disabled for user %s", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	if err := s.checkTwoFactorCode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// VerifyTwoFactorLogin completes a login that was answered with a challenge
+// token, and starts the session once the code checks out
+func (s *Service) VerifyTwoFactorLogin(ctx context.Context, req TwoFactorLoginRequest) (*AuthResponse, error) {
+	claims, err := s.parseActionToken(req.ChallengeToken, purposeTwoFactorChallenge)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := s.checkTwoFactorCode(ctx, claims.Subject, req.Code); err != nil {
+		s.recordLoginFailed(ctx, claims.Subject, LoginMethodTwoFactor, req.ClientInfo, failureReason(err))
+		return nil, err
+	}
+
+	if claims.Reactivate {
+		return s.completeReactivation(ctx, claims.Subject, LoginMethodTwoFactor, req.ClientInfo)
+	}
+	return s.completeLogin(ctx, claims.Subject, LoginMethodTwoFactor, req.ClientInfo)
+}
+
+// requiresTwoFactor reports whether a user has confirmed a second factor
+func (s *Service) requiresTwoFactor(ctx context.Context, userID string) (bool, error) {
+	twoFactor, err := s.repo.FindTwoFactor(ctx, userID)
+	if errors.Is(err, ErrTwoFactorNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return twoFactor.IsEnabled(), nil
+}
+
+// twoFactorChallenge returns the response Login gives in place of tokens
+// when a second factor is needed. With reactivate set, answering it also
+// reactivates the account.
+func (s *Service) twoFactorChallenge(userID string, reactivate bool) (*AuthResponse, error) {
+	token, err := s.signActionToken(actionClaims{
+		Purpose:          purposeTwoFactorChallenge,
+		Reactivate:       reactivate,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: userID},
+	}, twoFactorChallengeTTL)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	return &AuthResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         time.Now().Add(twoFactorChallengeTTL).Format(time.RFC3339),
+	}, nil
+}
+
+// checkTwoFactorCode accepts either a TOTP code or an unused recovery code
+// for a user with 2FA enabled. Every code is single use, and attempts are
+// throttled per user because six digits are easy to guess otherwise.
+func (s *Service) checkTwoFactorCode(ctx context.Context, userID, code string) error {
+	twoFactor, err := s.repo.FindTwoFactor(ctx, userID)
+	if err != nil || !twoFactor.IsEnabled() {
+		return ErrTwoFactorNotFound
+	}
+
+	if ok, wait := s.twoFactorAttempts.Allow(userID); !ok {
+		return &ThrottleError{RetryAfter: wait}
+	}
+
+	if step, ok := verifyTOTP(twoFactor.Secret, code, time.Now()); ok {
+		return s.repo.MarkTwoFactorStepUsed(ctx, userID, step)
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	if err := s.repo.UseRecoveryCode(ctx, userID, hashToken(normalized), time.Now()); err != nil {
+		return ErrInvalidTwoFactorCode
+	}
+	log.Printf("⚠️  Recovery code used for user %s", userID)
+	return nil
+}
+
+// issueRecoveryCodes generates and stores a fresh set of recovery codes,
+// returning them in the form shown to the user
+func (s *Service) issueRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	now := time.Now()
+	plain := make([]string, 0, recoveryCodeCount)
+	stored := make([]*RecoveryCode, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.New("failed to generate recovery codes")
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		plain = append(plain, code[:4]+"-"+code[4:])
+		stored = append(stored, &RecoveryCode{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  hashToken(code),
+			CreatedAt: now,
+		})
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, stored); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// normalizeRecoveryCode strips the separators users may type along with a code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return code
+}
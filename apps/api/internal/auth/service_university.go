@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"sanctor/internal/mail"
+	"sanctor/internal/university"
+)
+
+// universityVerificationTTL is how long a university confirmation link stays valid
+const universityVerificationTTL = 24 * time.Hour
+
+// StartUniversityVerification mails a confirmation link to an address on one
+// of the university's domains. The user only becomes verified for the
+// university once the link is opened.
+func (s *Service) StartUniversityVerification(ctx context.Context, userID string, req UniversityVerificationRequest) error {
+	school, ok := s.universities.Get(req.UniversityID)
+	if !ok {
+		return university.ErrUnknownUniversity
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if !s.universities.Allows(school.ID, email) {
+		return ErrNotUniversityEmail
+	}
+
+	if ok, wait := s.verificationResend.Allow("university:" + userID); !ok {
+		return &ThrottleError{RetryAfter: wait}
+	}
+
+	u, err := s.userService.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	verification := &UniversityVerification{
+		ID:        uuid.New().String(),
+		UserID:    u.ID,
+		ExpiresAt: now.Add(universityVerificationTTL),
+		CreatedAt: now,
+	}
+	if err := s.repo.CreateUniversityVerification(ctx, verification); err != nil {
+		return err
+	}
+
+	token, err := s.signActionToken(actionClaims{
+		Purpose:          purposeUniversityVerification,
+		Email:            email,
+		UniversityID:     school.ID,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID, ID: verification.ID},
+	}, universityVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-university?token=%s", s.appURL, url.QueryEscape(token))
+	return s.mailer.Send(&mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Confirm that you study at %s", school.Name),
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to confirm this address and get the verified student "+
+			"badge for %s on Sanctor:\n\n%s\n\nThe link expires in %d hours.\n",
+			u.FullName(), school.Name, link, int(universityVerificationTTL.Hours())),
+	})
+}
+
+// ConfirmUniversityEmail marks a user as verified for the university named
+// in a confirmation token. The link is consumed once it succeeds; an address
+// that already verified another account fails with
+// user.ErrUniversityEmailTaken.
+func (s *Service) ConfirmUniversityEmail(ctx context.Context, token string) error {
+	claims, err := s.parseActionToken(token, purposeUniversityVerification)
+	if err != nil || claims.ID == "" {
+		return ErrInvalidVerificationToken
+	}
+
+	// The registry may have changed since the link was sent
+	school, ok := s.universities.Get(claims.UniversityID)
+	if !ok || !s.universities.Allows(school.ID, claims.Email) {
+		return ErrInvalidVerificationToken
+	}
+
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		verification, err := s.repo.TakeUniversityVerification(ctx, claims.ID)
+		if err != nil || verification.UserID != claims.Subject || time.Now().After(verification.ExpiresAt) {
+			return ErrInvalidVerificationToken
+		}
+		return s.userService.SetUniversityVerified(ctx, claims.Subject, school.Name, claims.Email)
+	})
+}
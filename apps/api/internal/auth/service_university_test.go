@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"sanctor/internal/user"
+)
+
+func TestConfirmUniversityEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		// present returns the confirmation token Ada opens
+		present      func(t *testing.T, env *testEnv, adaID, graceID string) string
+		wantErr      error
+		wantVerified bool
+	}{
+		{
+			name: "fresh link",
+			present: func(t *testing.T, env *testEnv, adaID, graceID string) string {
+				return env.startUniversityVerification(t, adaID, "ada@ucla.edu")
+			},
+			wantVerified: true,
+		},
+		{
+			name: "used twice",
+			present: func(t *testing.T, env *testEnv, adaID, graceID string) string {
+				token := env.startUniversityVerification(t, adaID, "ada@ucla.edu")
+				if err := env.auth.ConfirmUniversityEmail(context.Background(), token); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr:      ErrInvalidVerificationToken,
+			wantVerified: true,
+		},
+		{
+			name: "address verified by another account",
+			present: func(t *testing.T, env *testEnv, adaID, graceID string) string {
+				token := env.startUniversityVerification(t, adaID, "shared@ucla.edu")
+				graceToken := env.startUniversityVerification(t, graceID, "Shared@ucla.edu")
+				if err := env.auth.ConfirmUniversityEmail(context.Background(), graceToken); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: user.ErrUniversityEmailTaken,
+		},
+		{
+			name: "link that was never mailed",
+			present: func(t *testing.T, env *testEnv, adaID, graceID string) string {
+				token, err := env.auth.signActionToken(actionClaims{
+					Purpose:          purposeUniversityVerification,
+					Email:            "ada@ucla.edu",
+					UniversityID:     "ucla",
+					RegisteredClaims: jwt.RegisteredClaims{Subject: adaID, ID: uuid.New().String()},
+				}, universityVerificationTTL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidVerificationToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			adaID, _ := env.register(t, "ada@example.com", "ada")
+			graceID, _ := env.register(t, "grace@example.com", "grace")
+
+			token := tt.present(t, env, adaID, graceID)
+			err := env.auth.ConfirmUniversityEmail(ctx, token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			u, err := env.users.GetUser(ctx, adaID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.IsUniversityVerified() != tt.wantVerified {
+				t.Errorf("got verified=%v for %q, want %v", u.IsUniversityVerified(), u.UniversityEmail, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailSkipsTakenUniversityAddress(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	graceID, _ := env.register(t, "grace@example.com", "grace")
+	if err := env.auth.ConfirmUniversityEmail(ctx, env.startUniversityVerification(t, graceID, "ada@ucla.edu")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary address still gets verified, just without the badge
+	adaID, _ := env.register(t, "ada@ucla.edu", "ada")
+	if err := env.auth.VerifyEmail(ctx, env.outbox.lastToken(t, "ada@ucla.edu")); err != nil {
+		t.Fatal(err)
+	}
+	u, err := env.users.GetUser(ctx, adaID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.IsVerified || u.IsUniversityVerified() {
+		t.Errorf("got verified=%v universityVerified=%v, want only the email verified", u.IsVerified, u.IsUniversityVerified())
+	}
+}
+
+// startUniversityVerification mails a university confirmation link and
+// returns its token
+func (env *testEnv) startUniversityVerification(t *testing.T, userID, email string) string {
+	t.Helper()
+	err := env.auth.StartUniversityVerification(context.Background(), userID, UniversityVerificationRequest{UniversityID: "ucla", Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env.outbox.lastToken(t, email)
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"sanctor/internal/mail"
+	"sanctor/internal/user"
+)
+
+// verificationTokenTTL is how long an email verification link stays valid
+const verificationTokenTTL = 48 * time.Hour
+
+// VerifyEmail marks the user a verification token was issued for as verified
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	claims, err := s.parseActionToken(token, purposeEmailVerification)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	u, err := s.userService.GetUser(ctx, claims.Subject)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	// A token issued before an email change must not verify the new address
+	if u.Email != claims.Email {
+		return ErrInvalidVerificationToken
+	}
+
+	if err := s.userService.MarkEmailVerified(ctx, u.ID, claims.Email); err != nil {
+		return err
+	}
+
+	// Confirming an address on a university domain also proves enrollment,
+	// unless the address already verified another account
+	if school, ok := s.universities.LookupEmail(u.Email); ok && !u.IsUniversityVerified() {
+		err := s.userService.SetUniversityVerified(ctx, u.ID, school.Name, u.Email)
+		if err != nil && !errors.Is(err, user.ErrUniversityEmailTaken) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification email to a user, at most once a
+// minute and five times an hour
+func (s *Service) ResendVerification(ctx context.Context, userID string) error {
+	u, err := s.userService.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.IsVerified {
+		return ErrAlreadyVerified
+	}
+
+	if ok, wait := s.verificationResend.Allow(u.ID); !ok {
+		return &ThrottleError{RetryAfter: wait}
+	}
+
+	s.sendVerificationInBackground(ctx, u.ID)
+	return nil
+}
+
+// EmailChanged asks a user to confirm the address they switched to, and
+// tells the previous address about the change in case it was not them
+func (s *Service) EmailChanged(ctx context.Context, u *user.User, previous string) {
+	log.Printf("📧 User %s changed their email address", u.ID)
+	s.sendVerificationInBackground(ctx, u.ID)
+
+	s.goBackground(func() {
+		err := s.mailer.Send(&mail.Message{
+			To:      previous,
+			Subject: "Your Sanctor email address was changed",
+			Body: fmt.Sprintf("Hi %s,\n\nThe email address of your Sanctor account was changed to %s. "+
+				"If you did not do this, contact support right away.\n", u.FullName(), u.Email),
+		})
+		if err != nil {
+			log.Printf("Failed to notify user %s of their email change: %v", u.ID, err)
+		}
+	})
+}
+
+// sendVerificationInBackground mails a user a verification link for their
+// current address without holding up the request. A mail failure is only
+// logged; the user can ask for another link.
+func (s *Service) sendVerificationInBackground(ctx context.Context, userID string) {
+	// The email outlives the request, so it must not be cancelled with it
+	ctx = context.WithoutCancel(ctx)
+	s.goBackground(func() {
+		u, err := s.userService.GetUser(ctx, userID)
+		if err != nil || u.IsVerified {
+			return
+		}
+		if err := s.sendVerificationEmail(u); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", userID, err)
+		}
+	})
+}
+
+// sendVerificationEmail mails a user a signed link that confirms their address
+func (s *Service) sendVerificationEmail(u *user.User) error {
+	token, err := s.signActionToken(actionClaims{
+		Purpose:          purposeEmailVerification,
+		Email:            u.Email,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID},
+	}, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.appURL, url.QueryEscape(token))
+	return s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Confirm your Sanctor email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not create a Sanctor account, you can ignore this email.\n",
+			u.FullName(), link, int(verificationTokenTTL.Hours())),
+	})
+}
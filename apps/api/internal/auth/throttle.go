@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle limits how often an action may be performed per key, for example
+// how often a verification email may be resent to one user
+type throttle struct {
+	minInterval time.Duration
+	window      time.Duration
+	limit       int
+	events      map[string][]time.Time
+	lastSweep   time.Time
+	mu          sync.Mutex
+}
+
+// newThrottle allows at most limit events per window and per key, spaced at
+// least minInterval apart
+func newThrottle(minInterval, window time.Duration, limit int) *throttle {
+	return &throttle{
+		minInterval: minInterval,
+		window:      window,
+		limit:       limit,
+		events:      make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key if the limits permit it. When they do not,
+// it returns false and how long the caller has to wait.
+func (t *throttle) Allow(key string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.lastSweep) >= t.window {
+		t.sweep(now)
+	}
+
+	recent := t.events[key][:0]
+	for _, at := range t.events[key] {
+		if now.Sub(at) < t.window {
+			recent = append(recent, at)
+		}
+	}
+
+	if n := len(recent); n > 0 {
+		if wait := t.minInterval - now.Sub(recent[n-1]); wait > 0 {
+			t.events[key] = recent
+			return false, wait
+		}
+		if n >= t.limit {
+			t.events[key] = recent
+			return false, t.window - now.Sub(recent[0])
+		}
+	}
+
+	t.events[key] = append(recent, now)
+	return true, 0
+}
+
+// sweep forgets keys without events in the current window, so that keys
+// which are never seen again do not pile up
+func (t *throttle) sweep(now time.Time) {
+	for key, events := range t.events {
+		if len(events) == 0 || now.Sub(events[len(events)-1]) >= t.window {
+			delete(t.events, key)
+		}
+	}
+	t.lastSweep = now
+}
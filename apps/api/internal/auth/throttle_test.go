@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name     string
+		past     []time.Duration // how long ago earlier events happened, oldest first
+		wantOK   bool
+		wantWait time.Duration // lower bound of the wait when refused
+	}{
+		{name: "first event", wantOK: true},
+		{name: "too soon", past: []time.Duration{10 * time.Second}, wantWait: 40 * time.Second},
+		{name: "spaced out", past: []time.Duration{2 * time.Minute}, wantOK: true},
+		{
+			name:     "limit reached",
+			past:     []time.Duration{50 * time.Minute, 40 * time.Minute, 30 * time.Minute},
+			wantWait: 9 * time.Minute,
+		},
+		{
+			name:   "oldest event left the window",
+			past:   []time.Duration{70 * time.Minute, 40 * time.Minute, 30 * time.Minute},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThrottle(time.Minute, time.Hour, 3)
+			for _, ago := range tt.past {
+				th.events["ada"] = append(th.events["ada"], time.Now().Add(-ago))
+			}
+			th.lastSweep = time.Now()
+
+			ok, wait := th.Allow("ada")
+			if ok != tt.wantOK {
+				t.Fatalf("got allowed=%v, want %v", ok, tt.wantOK)
+			}
+			if !ok && wait < tt.wantWait {
+				t.Errorf("got wait %v, want at least %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestThrottleForgetsIdleKeys(t *testing.T) {
+	th := newThrottle(time.Minute, time.Hour, 3)
+	th.events["old"] = []time.Time{time.Now().Add(-2 * time.Hour)}
+	th.events["recent"] = []time.Time{time.Now().Add(-time.Minute)}
+	th.lastSweep = time.Now().Add(-time.Hour)
+
+	th.Allow("new")
+	if _, ok := th.events["old"]; ok {
+		t.Error("kept a key whose events all left the window")
+	}
+	if len(th.events) != 2 {
+		t.Errorf("got keys %v, want recent and new", th.events)
+	}
+}
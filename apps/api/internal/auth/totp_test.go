@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, cut down to six digits
+	tests := []struct {
+		unix   int64
+		secret string
+		want   string
+	}{
+		{unix: 59, secret: rfcSecret, want: "287082"},
+		{unix: 1111111109, secret: rfcSecret, want: "081804"},
+		{unix: 1111111111, secret: rfcSecret, want: "050471"},
+		{unix: 1234567890, secret: rfcSecret, want: "005924"},
+		{unix: 2000000000, secret: rfcSecret, want: "279037"},
+		{unix: 59, secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", want: "287082"},
+	}
+
+	for _, tt := range tests {
+		got, err := totpCode(tt.secret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode at %d = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("totpCode accepted a secret that is not base32")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := totpStep(now)
+	code := func(step int64) string {
+		c, err := totpCode(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(current), wantStep: current, wantOK: true},
+		{name: "previous step", code: code(current - 1), wantStep: current - 1, wantOK: true},
+		{name: "next step", code: code(current + 1), wantStep: current + 1, wantOK: true},
+		{name: "spaces", code: code(current)[:3] + " " + code(current)[3:], wantStep: current, wantOK: true},
+		{name: "two steps behind", code: code(current - 2)},
+		{name: "two steps ahead", code: code(current + 2)},
+		{name: "wrong code", code: "000000"},
+		{name: "too short", code: code(current)[:5]},
+		{name: "too long", code: code(current) + "0"},
+		{name: "empty", code: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A code from another step can collide by chance; skip rather than flake
+			if !tt.wantOK && tt.code == code(current) {
+				t.Skip("code collides with the current step")
+			}
+			step, ok := verifyTOTP(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("verifyTOTP(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTwoFactorCodeIsSingleUse(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []int64 // steps after the one used to confirm enrollment, in order
+		wantErr []error
+	}{
+		{name: "enrollment code replayed", offsets: []int64{0}, wantErr: []error{ErrInvalidTwoFactorCode}},
+		{name: "next code", offsets: []int64{1}, wantErr: []error{nil}},
+		{name: "next code replayed", offsets: []int64{1, 1}, wantErr: []error{nil, ErrInvalidTwoFactorCode}},
+		{name: "older code after a newer one", offsets: []int64{1, -1}, wantErr: []error{nil, ErrInvalidTwoFactorCode}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			userID, _ := env.register(t, "ada@example.com", "ada")
+			env.enableTwoFactor(t, userID)
+
+			ctx := context.Background()
+			twoFactor, err := env.repo.FindTwoFactor(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, offset := range tt.offsets {
+				code, err := totpCode(twoFactor.Secret, twoFactor.LastUsedStep+offset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := env.auth.checkTwoFactorCode(ctx, userID, code); !errors.Is(err, tt.wantErr[i]) {
+					t.Fatalf("code %d: got error %v, want %v", i, err, tt.wantErr[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package authctx
+
+import "context"
+
+// Identity describes the authenticated caller of a request. Callers
+// authenticated with an API key carry the key's ID and scopes instead of a
+// session.
+type Identity struct {
+	UserID    string
+	SessionID string
+	Role      string
+	APIKeyID  string
+	Scopes    []string
+}
+
+// HasScope reports whether the caller may act within scope. Session tokens
+// carry the user's full authority; API keys only what they were granted.
+func (i *Identity) HasScope(scope string) bool {
+	if i.APIKeyID == "" {
+		return true
+	}
+	for _, granted := range i.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// contextKey is unexported so no other package can collide with it
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the authenticated caller
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the authenticated caller stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+// UserID returns the ID of the authenticated user stored in ctx, if any
+func UserID(ctx context.Context) (string, bool) {
+	identity, ok := FromContext(ctx)
+	if !ok || identity.UserID == "" {
+		return "", false
+	}
+	return identity.UserID, true
+}
@@ -1,77 +1,192 @@
 package config
 
-import (
-	"os"
-	"strconv"
-)
+// defaultJWTSecret is the development fallback for JWT_SECRET
+const defaultJWTSecret = "your-secret-key"
 
-// Config holds application configuration
+// Config holds application configuration. It is assembled by Load from
+// defaults, a YAML or TOML file, environment variables and command-line
+// flags, and every subsystem takes its settings from it.
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Auth     AuthConfig
+	Server     ServerConfig     `yaml:"server" toml:"server"`
+	Database   DatabaseConfig   `yaml:"database" toml:"database"`
+	Auth       AuthConfig       `yaml:"auth" toml:"auth"`
+	Password   PasswordConfig   `yaml:"password" toml:"password"`
+	Mail       MailConfig       `yaml:"mail" toml:"mail"`
+	OIDC       OIDCConfig       `yaml:"oidc" toml:"oidc"`
+	WebAuthn   WebAuthnConfig   `yaml:"webauthn" toml:"webauthn"`
+	University UniversityConfig `yaml:"university" toml:"university"`
+	Flags      FlagsConfig      `yaml:"feature_flags" toml:"feature_flags"`
 }
 
 // ServerConfig holds server-specific configuration
 type ServerConfig struct {
-	Port string
-	Host string
-	Env  string
+	Port   string `yaml:"port" toml:"port"`
+	Host   string `yaml:"host" toml:"host"`
+	Env    string `yaml:"env" toml:"env"`
+	AppURL string `yaml:"app_url" toml:"app_url"` // base URL of the web app, used in email links
+	// RequestTimeout bounds how long a request may run, in seconds; 0 means no limit
+	RequestTimeout int `yaml:"request_timeout" toml:"request_timeout"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Forwarded-Proto headers are believed
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
 }
 
-// DatabaseConfig holds database configuration
+// DatabaseConfig holds database configuration. URL takes precedence over
+// the individual connection settings; with neither URL nor Host, data is
+// kept in memory.
 type DatabaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DBName   string
+	URL             string `yaml:"url" toml:"url"`
+	Host            string `yaml:"host" toml:"host"`
+	Port            int    `yaml:"port" toml:"port"`
+	User            string `yaml:"user" toml:"user"`
+	Password        string `yaml:"password" toml:"password"`
+	DBName          string `yaml:"name" toml:"name"`
+	SSLMode         string `yaml:"ssl_mode" toml:"ssl_mode"`
+	MaxOpenConns    int    `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int    `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime int    `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"` // in minutes
+	// MigrateOnStart applies pending migrations when the API starts
+	MigrateOnStart bool `yaml:"migrate_on_start" toml:"migrate_on_start"`
+	// Timeouts of a read query, a write and a whole transaction, in
+	// seconds; 0 means no limit
+	ReadTimeout        int `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout       int `yaml:"write_timeout" toml:"write_timeout"`
+	TransactionTimeout int `yaml:"transaction_timeout" toml:"transaction_timeout"`
 }
 
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
-	JWTSecret     string
-	TokenExpiry   int // in hours
-	RefreshExpiry int // in days
+	JWTSecret        string   `yaml:"jwt_secret" toml:"jwt_secret"`
+	TokenExpiry      int      `yaml:"token_expiry" toml:"token_expiry"`     // in hours
+	RefreshExpiry    int      `yaml:"refresh_expiry" toml:"refresh_expiry"` // in days
+	SigningKeyFile   string   `yaml:"signing_key_file" toml:"signing_key_file"`
+	SigningKeyID     string   `yaml:"signing_key_id" toml:"signing_key_id"`
+	VerificationKeys []string `yaml:"verification_keys" toml:"verification_keys"` // PEM files, each optionally prefixed with "kid="
+	// Issuer and Audience are the iss and aud claims of access tokens; empty
+	// leaves them out
+	Issuer   string `yaml:"jwt_issuer" toml:"jwt_issuer"`
+	Audience string `yaml:"jwt_audience" toml:"jwt_audience"`
+	// AdminEmails are promoted to the admin role when they sign in verified
+	AdminEmails []string `yaml:"admin_emails" toml:"admin_emails"`
+	// RequireVerifiedEmail stops unverified users from posting and messaging
+	RequireVerifiedEmail bool `yaml:"require_verified_email" toml:"require_verified_email"`
 }
 
-// Load loads configuration from environment variables
-func Load() *Config {
+// PasswordConfig holds password hashing and policy settings
+type PasswordConfig struct {
+	Hasher            string   `yaml:"hasher" toml:"hasher"`               // "argon2id" or "bcrypt"
+	Argon2Memory      int      `yaml:"argon2_memory" toml:"argon2_memory"` // in KiB
+	Argon2Iterations  int      `yaml:"argon2_iterations" toml:"argon2_iterations"`
+	Argon2Parallelism int      `yaml:"argon2_parallelism" toml:"argon2_parallelism"`
+	BcryptCost        int      `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	MinLength         int      `yaml:"min_length" toml:"min_length"`
+	MaxLength         int      `yaml:"max_length" toml:"max_length"`     // 0 means no limit
+	MinStrength       int      `yaml:"min_strength" toml:"min_strength"` // 0 to 4; 0 disables the strength check
+	Require           []string `yaml:"require" toml:"require"`
+	BreachedFile      string   `yaml:"breached_file" toml:"breached_file"` // replaces the bundled breach list
+}
+
+// MailConfig holds mail delivery settings
+type MailConfig struct {
+	Driver       string `yaml:"driver" toml:"driver"`
+	From         string `yaml:"from" toml:"from"`
+	OutboxDir    string `yaml:"outbox_dir" toml:"outbox_dir"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port"`
+	SMTPUser     string `yaml:"smtp_user" toml:"smtp_user"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+}
+
+// OIDCConfig holds external login providers
+type OIDCConfig struct {
+	RedirectURL string               `yaml:"redirect_url" toml:"redirect_url"`
+	Providers   []OIDCProviderConfig `yaml:"providers" toml:"providers"`
+}
+
+// OIDCProviderConfig describes one OpenID Connect login provider
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name" toml:"name"`
+	DisplayName  string   `yaml:"display_name" toml:"display_name"`
+	Issuer       string   `yaml:"issuer" toml:"issuer"`
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+// WebAuthnConfig holds the passkey relying party. When RPID and Origins are
+// empty, passkeys are scoped to the web app's URL.
+type WebAuthnConfig struct {
+	RPID    string   `yaml:"rp_id" toml:"rp_id"`
+	RPName  string   `yaml:"rp_name" toml:"rp_name"`
+	Origins []string `yaml:"origins" toml:"origins"`
+}
+
+// UniversityConfig holds university email verification settings
+type UniversityConfig struct {
+	RegistryFile string `yaml:"registry_file" toml:"registry_file"` // replaces the bundled university list
+}
+
+// FlagsConfig holds where feature flags are loaded from. With no source,
+// every flag keeps its built-in default.
+type FlagsConfig struct {
+	Source         string `yaml:"source" toml:"source"` // "", file or postgres
+	File           string `yaml:"file" toml:"file"`
+	ReloadInterval int    `yaml:"reload_interval" toml:"reload_interval"` // seconds
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
-			Host: getEnv("HOST", "0.0.0.0"),
-			Env:  getEnv("GO_ENV", "development"),
+			Port:   "8080",
+			Host:   "0.0.0.0",
+			Env:    "development",
+			AppURL: "http://localhost:3000",
+
+			RequestTimeout: 30,
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnvInt("DB_PORT", 5432),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", ""),
-			DBName:   getEnv("DB_NAME", "sanctor"),
+			Port:            5432,
+			User:            "postgres",
+			DBName:          "sanctor",
+			SSLMode:         "require",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 5,
+			MigrateOnStart:  true,
+
+			ReadTimeout:        5,
+			WriteTimeout:       10,
+			TransactionTimeout: 30,
 		},
 		Auth: AuthConfig{
-			JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
-			TokenExpiry:   getEnvInt("TOKEN_EXPIRY", 24),
-			RefreshExpiry: getEnvInt("REFRESH_EXPIRY", 7),
+			JWTSecret:     defaultJWTSecret,
+			TokenExpiry:   24,
+			RefreshExpiry: 7,
+		},
+		Password: PasswordConfig{
+			Hasher:            "argon2id",
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 2,
+			BcryptCost:        10,
+			MinLength:         8,
+			MaxLength:         128,
+			MinStrength:       2,
+		},
+		Mail: MailConfig{
+			Driver:    "outbox",
+			From:      "Sanctor <no-reply@sanctor.local>",
+			OutboxDir: "outbox",
+		},
+		OIDC: OIDCConfig{
+			RedirectURL: "http://localhost:8080/api/auth/oidc/callback",
+		},
+		WebAuthn: WebAuthnConfig{
+			RPName: "Sanctor",
+		},
+		Flags: FlagsConfig{
+			ReloadInterval: 15,
 		},
 	}
 }
-
-// getEnv gets an environment variable with a fallback default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-// getEnvInt gets an integer environment variable with a fallback default value
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
-}
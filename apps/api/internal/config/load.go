@@ -0,0 +1,302 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// field binds one setting to its environment variable and flag. The flag
+// name is the variable name in lower case with dashes, e.g. -db-host.
+type field struct {
+	env    string
+	target interface{} // *string, *int, *bool or *[]string
+	usage  string
+	// secret settings can be read from the file named by <env>_FILE, are
+	// not offered as flags (they would show up in the process list) and
+	// are redacted from dumps
+	secret bool
+}
+
+// fields lists the settings of c that the environment and flags can set
+func (c *Config) fields() []field {
+	return []field{
+		{env: "PORT", target: &c.Server.Port, usage: "port to listen on"},
+		{env: "HOST", target: &c.Server.Host, usage: "address to listen on"},
+		{env: "GO_ENV", target: &c.Server.Env, usage: "environment: development, test, staging or production"},
+		{env: "APP_URL", target: &c.Server.AppURL, usage: "base URL of the web app"},
+		{env: "REQUEST_TIMEOUT", target: &c.Server.RequestTimeout, usage: "seconds a request may run, 0 for no limit"},
+		{env: "TRUSTED_PROXIES", target: &c.Server.TrustedProxies, usage: "comma-separated addresses or CIDR ranges of trusted reverse proxies"},
+
+		{env: "DATABASE_URL", target: &c.Database.URL, usage: "Postgres connection URL", secret: true},
+		{env: "DB_HOST", target: &c.Database.Host, usage: "database host"},
+		{env: "DB_PORT", target: &c.Database.Port, usage: "database port"},
+		{env: "DB_USER", target: &c.Database.User, usage: "database user"},
+		{env: "DB_PASSWORD", target: &c.Database.Password, usage: "database password", secret: true},
+		{env: "DB_NAME", target: &c.Database.DBName, usage: "database name"},
+		{env: "DB_SSLMODE", target: &c.Database.SSLMode, usage: "database sslmode"},
+		{env: "DB_MAX_OPEN_CONNS", target: &c.Database.MaxOpenConns, usage: "maximum open database connections"},
+		{env: "DB_MAX_IDLE_CONNS", target: &c.Database.MaxIdleConns, usage: "maximum idle database connections"},
+		{env: "DB_CONN_MAX_LIFETIME", target: &c.Database.ConnMaxLifetime, usage: "minutes a database connection is reused"},
+		{env: "DB_MIGRATE_ON_START", target: &c.Database.MigrateOnStart, usage: "apply pending database migrations on startup"},
+		{env: "DB_READ_TIMEOUT", target: &c.Database.ReadTimeout, usage: "seconds a read query may run, 0 for no limit"},
+		{env: "DB_WRITE_TIMEOUT", target: &c.Database.WriteTimeout, usage: "seconds a write may run, 0 for no limit"},
+		{env: "DB_TRANSACTION_TIMEOUT", target: &c.Database.TransactionTimeout, usage: "seconds a transaction may run, 0 for no limit"},
+
+		{env: "JWT_SECRET", target: &c.Auth.JWTSecret, usage: "HS256 token secret", secret: true},
+		{env: "TOKEN_EXPIRY", target: &c.Auth.TokenExpiry, usage: "access token lifetime in hours"},
+		{env: "REFRESH_EXPIRY", target: &c.Auth.RefreshExpiry, usage: "refresh token lifetime in days"},
+		{env: "JWT_SIGNING_KEY_FILE", target: &c.Auth.SigningKeyFile, usage: "PEM private key to sign tokens with"},
+		{env: "JWT_SIGNING_KEY_ID", target: &c.Auth.SigningKeyID, usage: "key ID of the signing key"},
+		{env: "JWT_VERIFICATION_KEYS", target: &c.Auth.VerificationKeys, usage: "comma-separated PEM files of previous signing keys"},
+		{env: "JWT_ISSUER", target: &c.Auth.Issuer, usage: "issuer (iss) of access tokens"},
+		{env: "JWT_AUDIENCE", target: &c.Auth.Audience, usage: "audience (aud) of access tokens"},
+		{env: "ADMIN_EMAILS", target: &c.Auth.AdminEmails, usage: "comma-separated emails promoted to admin"},
+		{env: "REQUIRE_VERIFIED_EMAIL", target: &c.Auth.RequireVerifiedEmail, usage: "require a verified email to post and message"},
+
+		{env: "PASSWORD_HASHER", target: &c.Password.Hasher, usage: "password hashing algorithm: argon2id or bcrypt"},
+		{env: "ARGON2_MEMORY_KIB", target: &c.Password.Argon2Memory, usage: "Argon2id memory in KiB"},
+		{env: "ARGON2_ITERATIONS", target: &c.Password.Argon2Iterations, usage: "Argon2id iterations"},
+		{env: "ARGON2_PARALLELISM", target: &c.Password.Argon2Parallelism, usage: "Argon2id parallelism"},
+		{env: "BCRYPT_COST", target: &c.Password.BcryptCost, usage: "bcrypt cost"},
+		{env: "PASSWORD_MIN_LENGTH", target: &c.Password.MinLength, usage: "minimum password length"},
+		{env: "PASSWORD_MAX_LENGTH", target: &c.Password.MaxLength, usage: "maximum password length (0 means no limit)"},
+		{env: "PASSWORD_MIN_STRENGTH", target: &c.Password.MinStrength, usage: "minimum password strength from 0 to 4"},
+		{env: "PASSWORD_REQUIRE", target: &c.Password.Require, usage: "comma-separated character rules: uppercase, lowercase, digit, symbol"},
+		{env: "PASSWORD_BREACHED_FILE", target: &c.Password.BreachedFile, usage: "file of breached SHA-1 password hashes"},
+
+		{env: "MAIL_DRIVER", target: &c.Mail.Driver, usage: "mail driver: outbox, smtp or log"},
+		{env: "MAIL_FROM", target: &c.Mail.From, usage: "sender address"},
+		{env: "MAIL_OUTBOX_DIR", target: &c.Mail.OutboxDir, usage: "directory for the outbox driver"},
+		{env: "SMTP_HOST", target: &c.Mail.SMTPHost, usage: "SMTP host"},
+		{env: "SMTP_PORT", target: &c.Mail.SMTPPort, usage: "SMTP port"},
+		{env: "SMTP_USER", target: &c.Mail.SMTPUser, usage: "SMTP user"},
+		{env: "SMTP_PASSWORD", target: &c.Mail.SMTPPassword, usage: "SMTP password", secret: true},
+
+		{env: "OIDC_REDIRECT_URL", target: &c.OIDC.RedirectURL, usage: "callback URL registered with login providers"},
+
+		{env: "WEBAUTHN_RP_ID", target: &c.WebAuthn.RPID, usage: "passkey relying party ID"},
+		{env: "WEBAUTHN_RP_NAME", target: &c.WebAuthn.RPName, usage: "site name shown when creating a passkey"},
+		{env: "WEBAUTHN_ORIGINS", target: &c.WebAuthn.Origins, usage: "comma-separated origins allowed to use passkeys"},
+
+		{env: "UNIVERSITY_REGISTRY_FILE", target: &c.University.RegistryFile, usage: "JSON or CSV university list"},
+
+		{env: "FEATURE_FLAGS_SOURCE", target: &c.Flags.Source, usage: "where feature flags are loaded from: file or postgres"},
+		{env: "FEATURE_FLAGS_FILE", target: &c.Flags.File, usage: "YAML or JSON feature flag file"},
+		{env: "FEATURE_FLAGS_RELOAD", target: &c.Flags.ReloadInterval, usage: "seconds between feature flag reloads"},
+	}
+}
+
+// parse converts a raw value for the field and returns a function that
+// stores it
+func (f field) parse(value string) (func(), error) {
+	switch target := f.target.(type) {
+	case *string:
+		return func() { *target = value }, nil
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q is not a number", f.env, value)
+		}
+		return func() { *target = n }, nil
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q is not true or false", f.env, value)
+		}
+		return func() { *target = b }, nil
+	case *[]string:
+		list := splitList(value)
+		return func() { *target = list }, nil
+	default:
+		panic("config: unsupported field type for " + f.env)
+	}
+}
+
+// flagName is the command-line flag for the field
+func (f field) flagName() string {
+	return strings.ToLower(strings.ReplaceAll(f.env, "_", "-"))
+}
+
+// Load assembles the configuration. Each source overrides the one before:
+//
+//  1. built-in defaults
+//  2. the YAML or TOML file given by -config or CONFIG_FILE
+//  3. environment variables, with secrets optionally read from <NAME>_FILE
+//  4. command-line flags in args
+//
+// Load registers its flags on fs, so callers can add their own before
+// calling it. The result is validated.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file")
+	var flagValues []func()
+	for _, f := range cfg.fields() {
+		if f.secret {
+			continue
+		}
+		f := f
+		set := func(value string) error {
+			apply, err := f.parse(value)
+			if err != nil {
+				return err
+			}
+			flagValues = append(flagValues, apply)
+			return nil
+		}
+		if _, isBool := f.target.(*bool); isBool {
+			fs.BoolFunc(f.flagName(), f.usage, set)
+		} else {
+			fs.Func(f.flagName(), f.usage, set)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	for _, apply := range flagValues {
+		apply()
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile merges a YAML or TOML file into c. Unknown keys are rejected so
+// that typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		defer file.Close()
+
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.DecodeFile(path, c)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// loadEnv overrides c with the environment variables that are set
+func (c *Config) loadEnv() error {
+	for _, f := range c.fields() {
+		value, ok, err := lookupEnv(f.env, f.secret)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		apply, err := f.parse(value)
+		if err != nil {
+			return err
+		}
+		apply()
+	}
+
+	// OIDC_PROVIDERS adds providers by name; each provider, whether from the
+	// file or the environment, is configured through OIDC_<NAME>_ISSUER,
+	// _CLIENT_ID, _CLIENT_SECRET, _DISPLAY_NAME and _SCOPES
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		if c.oidcProvider(name) == nil {
+			c.OIDC.Providers = append(c.OIDC.Providers, OIDCProviderConfig{Name: name})
+		}
+	}
+	for i := range c.OIDC.Providers {
+		provider := &c.OIDC.Providers[i]
+		prefix := "OIDC_" + strings.ToUpper(provider.Name) + "_"
+		for env, target := range map[string]*string{
+			prefix + "DISPLAY_NAME":  &provider.DisplayName,
+			prefix + "ISSUER":        &provider.Issuer,
+			prefix + "CLIENT_ID":     &provider.ClientID,
+			prefix + "CLIENT_SECRET": &provider.ClientSecret,
+		} {
+			value, ok, err := lookupEnv(env, target == &provider.ClientSecret)
+			if err != nil {
+				return err
+			}
+			if ok {
+				*target = value
+			}
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			provider.Scopes = strings.Fields(scopes)
+		}
+	}
+	return nil
+}
+
+// oidcProvider finds a configured provider by name
+func (c *Config) oidcProvider(name string) *OIDCProviderConfig {
+	for i := range c.OIDC.Providers {
+		if strings.EqualFold(c.OIDC.Providers[i].Name, name) {
+			return &c.OIDC.Providers[i]
+		}
+	}
+	return nil
+}
+
+// lookupEnv reads an environment variable; empty counts as unset. A secret
+// can instead be read from the file named by <key>_FILE, as Docker and
+// Kubernetes mount them, with trailing newlines removed.
+func lookupEnv(key string, secret bool) (string, bool, error) {
+	value := os.Getenv(key)
+	if secret {
+		if path := os.Getenv(key + "_FILE"); path != "" {
+			if value != "" {
+				return "", false, fmt.Errorf("set either %s or %s_FILE, not both", key, key)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", false, fmt.Errorf("failed to read %s_FILE: %w", key, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), true, nil
+		}
+	}
+	return value, value != "", nil
+}
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolateEnv blanks every variable Load reads, so the test environment
+// cannot leak into the result
+func isolateEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("OIDC_PROVIDERS", "")
+	for _, f := range Default().fields() {
+		t.Setenv(f.env, "")
+		if f.secret {
+			t.Setenv(f.env+"_FILE", "")
+		}
+	}
+}
+
+// writeFile writes content to name in a temporary directory and returns
+// its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// load runs Load with a fresh flag set
+func load(args ...string) (*Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := "server:\n  port: \"9001\"\n  host: 127.0.0.1\ndatabase:\n  name: from_file\n"
+	tomlFile := "[server]\nport = \"9001\"\nhost = \"127.0.0.1\"\n\n[database]\nname = \"from_file\"\n"
+
+	tests := []struct {
+		name     string
+		file     string // file name; empty for none
+		content  string
+		env      map[string]string
+		args     []string
+		wantPort string
+		wantHost string
+		wantDB   string
+	}{
+		{
+			name:     "defaults",
+			wantPort: "8080",
+			wantHost: "0.0.0.0",
+			wantDB:   "sanctor",
+		},
+		{
+			name:     "yaml file over defaults",
+			file:     "config.yaml",
+			content:  yamlFile,
+			wantPort: "9001",
+			wantHost: "127.0.0.1",
+			wantDB:   "from_file",
+		},
+		{
+			name:     "toml file over defaults",
+			file:     "config.toml",
+			content:  tomlFile,
+			wantPort: "9001",
+			wantHost: "127.0.0.1",
+			wantDB:   "from_file",
+		},
+		{
+			name:     "environment over file",
+			file:     "config.yaml",
+			content:  yamlFile,
+			env:      map[string]string{"PORT": "9002", "DB_NAME": "from_env"},
+			wantPort: "9002",
+			wantHost: "127.0.0.1",
+			wantDB:   "from_env",
+		},
+		{
+			name:     "flags over environment",
+			file:     "config.yaml",
+			content:  yamlFile,
+			env:      map[string]string{"PORT": "9002", "DB_NAME": "from_env"},
+			args:     []string{"-port", "9003"},
+			wantPort: "9003",
+			wantHost: "127.0.0.1",
+			wantDB:   "from_env",
+		},
+		{
+			name:     "empty variables count as unset",
+			file:     "config.yaml",
+			content:  yamlFile,
+			env:      map[string]string{"PORT": ""},
+			wantPort: "9001",
+			wantHost: "127.0.0.1",
+			wantDB:   "from_file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file, tt.content)}, args...)
+			}
+
+			cfg, err := load(args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Port != tt.wantPort || cfg.Server.Host != tt.wantHost || cfg.Database.DBName != tt.wantDB {
+				t.Errorf("port, host, database = %q, %q, %q, want %q, %q, %q",
+					cfg.Server.Port, cfg.Server.Host, cfg.Database.DBName, tt.wantPort, tt.wantHost, tt.wantDB)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnvironment(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", "server:\n  port: \"9001\"\n"))
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "9001" {
+		t.Errorf("port = %q, want the one from CONFIG_FILE", cfg.Server.Port)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		env     map[string]string
+		args    []string
+		want    string
+	}{
+		{
+			name:    "unknown yaml key",
+			file:    "config.yaml",
+			content: "server:\n  prot: \"9001\"\n",
+			want:    "prot",
+		},
+		{
+			name:    "unknown toml key",
+			file:    "config.toml",
+			content: "[server]\nprot = \"9001\"\n",
+			want:    "unknown key server.prot",
+		},
+		{
+			name:    "unsupported file format",
+			file:    "config.json",
+			content: "{}",
+			want:    "unsupported format",
+		},
+		{
+			name: "number in the environment",
+			env:  map[string]string{"DB_PORT": "five"},
+			want: "invalid DB_PORT",
+		},
+		{
+			name: "number in a flag",
+			args: []string{"-db-port", "five"},
+			want: "invalid DB_PORT",
+		},
+		{
+			name: "invalid result",
+			env:  map[string]string{"PORT": "70000"},
+			want: "PORT must be a number between 1 and 65535",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file, tt.content)}, args...)
+			}
+
+			_, err := load(args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretFiles(t *testing.T) {
+	t.Run("read from the file", func(t *testing.T) {
+		isolateEnv(t)
+		t.Setenv("JWT_SECRET_FILE", writeFile(t, "jwt", "from-a-file\n"))
+		t.Setenv("OIDC_PROVIDERS", "google")
+		t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+		t.Setenv("OIDC_GOOGLE_CLIENT_ID", "client")
+		t.Setenv("OIDC_GOOGLE_CLIENT_SECRET_FILE", writeFile(t, "google", "oidc-secret\r\n"))
+
+		cfg, err := load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Auth.JWTSecret != "from-a-file" {
+			t.Errorf("JWT secret = %q, want the file content without its newline", cfg.Auth.JWTSecret)
+		}
+		if len(cfg.OIDC.Providers) != 1 || cfg.OIDC.Providers[0].ClientSecret != "oidc-secret" {
+			t.Errorf("OIDC providers = %+v, want google with the secret from its file", cfg.OIDC.Providers)
+		}
+	})
+
+	t.Run("file over the file setting", func(t *testing.T) {
+		isolateEnv(t)
+		t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db", "from-a-file"))
+
+		cfg, err := load("-config", writeFile(t, "config.yaml", "database:\n  password: from-config\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Database.Password != "from-a-file" {
+			t.Errorf("database password = %q, want the one from DB_PASSWORD_FILE", cfg.Database.Password)
+		}
+	})
+
+	failures := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "both set",
+			env:  map[string]string{"SMTP_PASSWORD": "inline", "SMTP_PASSWORD_FILE": "/run/secrets/smtp"},
+			want: "set either SMTP_PASSWORD or SMTP_PASSWORD_FILE, not both",
+		},
+		{
+			name: "missing file",
+			env:  map[string]string{"JWT_SECRET_FILE": filepath.Join(os.TempDir(), "does-not-exist")},
+			want: "failed to read JWT_SECRET_FILE",
+		},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := load()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("not settable by flag", func(t *testing.T) {
+		isolateEnv(t)
+		if _, err := load("-jwt-secret", "on-the-command-line"); err == nil {
+			t.Error("a secret was accepted as a command-line flag")
+		}
+	})
+
+	t.Run("only secrets read files", func(t *testing.T) {
+		isolateEnv(t)
+		t.Setenv("DB_NAME_FILE", writeFile(t, "name", "from-a-file"))
+		cfg, err := load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Database.DBName != "sanctor" {
+			t.Errorf("DB_NAME_FILE set the database name to %q", cfg.Database.DBName)
+		}
+	})
+}
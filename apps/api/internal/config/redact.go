@@ -0,0 +1,52 @@
+package config
+
+import (
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in dumps
+const redacted = "[redacted]"
+
+// Redacted returns a copy of c with secrets masked. The database URL keeps
+// everything but its password.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.OIDC.Providers = append([]OIDCProviderConfig(nil), c.OIDC.Providers...)
+
+	for _, f := range r.fields() {
+		if value, ok := f.target.(*string); ok && f.secret && *value != "" {
+			*value = redacted
+		}
+	}
+	r.Database.URL = redactURL(c.Database.URL)
+	for i := range r.OIDC.Providers {
+		if r.OIDC.Providers[i].ClientSecret != "" {
+			r.OIDC.Providers[i].ClientSecret = redacted
+		}
+	}
+	return &r
+}
+
+// Dump renders the configuration as YAML with secrets redacted, in the
+// same shape a config file takes
+func (c *Config) Dump() (string, error) {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// redactURL masks the password in a connection URL
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
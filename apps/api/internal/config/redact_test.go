@@ -0,0 +1,47 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://sanctor:db-url-password@db:5432/sanctor"
+	cfg.Database.Password = "db-password"
+	cfg.Auth.JWTSecret = "jwt-secret"
+	cfg.Mail.SMTPPassword = "smtp-password"
+	cfg.OIDC.Providers = []OIDCProviderConfig{
+		{Name: "google", Issuer: "https://accounts.google.com", ClientID: "client", ClientSecret: "oidc-secret"},
+		{Name: "public", Issuer: "https://id.example", ClientID: "public-client"},
+	}
+
+	dump, err := cfg.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"db-url-password", "db-password", "jwt-secret", "smtp-password", "oidc-secret"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("the dump contains %q:\n%s", secret, dump)
+		}
+	}
+	for _, want := range []string{
+		"url: postgres://sanctor:xxxxx@db:5432/sanctor",
+		"password: '[redacted]'",
+		"jwt_secret: '[redacted]'",
+		"smtp_password: '[redacted]'",
+		"client_secret: '[redacted]'",
+		"client_secret: \"\"", // an unset secret stays empty
+		"client_id: client",
+		"port: \"8080\"",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("the dump does not contain %q:\n%s", want, dump)
+		}
+	}
+
+	if cfg.Auth.JWTSecret != "jwt-secret" || cfg.OIDC.Providers[0].ClientSecret != "oidc-secret" {
+		t.Error("Dump changed the configuration it was called on")
+	}
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Validate checks the configuration and reports every problem it finds.
+// Settings are named by their environment variable.
+func (c *Config) Validate() error {
+	var problems []error
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	// Server
+	if !validPort(c.Server.Port) {
+		problem("PORT must be a number between 1 and 65535, got %q", c.Server.Port)
+	}
+	switch c.Server.Env {
+	case "development", "test", "staging", "production":
+	default:
+		problem("GO_ENV must be development, test, staging or production, got %q", c.Server.Env)
+	}
+	if !validURL(c.Server.AppURL) {
+		problem("APP_URL must be an absolute http or https URL, got %q", c.Server.AppURL)
+	}
+	if c.Server.RequestTimeout < 0 {
+		problem("REQUEST_TIMEOUT must not be negative, got %d", c.Server.RequestTimeout)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if !validProxy(proxy) {
+			problem("TRUSTED_PROXIES must list IP addresses or CIDR ranges, got %q", proxy)
+		}
+	}
+
+	// Database
+	if c.Database.URL == "" && c.Database.Host != "" {
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			problem("DB_PORT must be between 1 and 65535, got %d", c.Database.Port)
+		}
+		if c.Database.DBName == "" {
+			problem("DB_NAME is required with DB_HOST")
+		}
+		switch c.Database.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			problem("DB_SSLMODE must be a Postgres sslmode, got %q", c.Database.SSLMode)
+		}
+	}
+	if c.Database.MaxOpenConns < 1 || c.Database.MaxIdleConns < 1 || c.Database.ConnMaxLifetime < 1 {
+		problem("DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_LIFETIME must be positive")
+	}
+	if c.Database.ReadTimeout < 0 || c.Database.WriteTimeout < 0 || c.Database.TransactionTimeout < 0 {
+		problem("DB_READ_TIMEOUT, DB_WRITE_TIMEOUT and DB_TRANSACTION_TIMEOUT must not be negative")
+	}
+
+	// Auth
+	secretIsDefault := c.Auth.JWTSecret == "" || c.Auth.JWTSecret == defaultJWTSecret
+	if c.Server.Env == "production" && c.Auth.SigningKeyFile == "" && secretIsDefault {
+		problem("JWT_SECRET must be changed from the default in production, or JWT_SIGNING_KEY_FILE set")
+	}
+	if c.Auth.TokenExpiry < 1 {
+		problem("TOKEN_EXPIRY must be at least 1 hour, got %d", c.Auth.TokenExpiry)
+	}
+	if c.Auth.RefreshExpiry < 1 {
+		problem("REFRESH_EXPIRY must be at least 1 day, got %d", c.Auth.RefreshExpiry)
+	}
+
+	// Passwords
+	switch c.Password.Hasher {
+	case "argon2id":
+		if c.Password.Argon2Memory < 1 || c.Password.Argon2Iterations < 1 {
+			problem("ARGON2_MEMORY_KIB and ARGON2_ITERATIONS must be positive")
+		}
+		if c.Password.Argon2Parallelism < 1 || c.Password.Argon2Parallelism > 255 {
+			problem("ARGON2_PARALLELISM must be between 1 and 255, got %d", c.Password.Argon2Parallelism)
+		}
+	case "bcrypt":
+		if c.Password.BcryptCost < 4 || c.Password.BcryptCost > 31 {
+			problem("BCRYPT_COST must be between 4 and 31, got %d", c.Password.BcryptCost)
+		}
+	default:
+		problem("PASSWORD_HASHER must be argon2id or bcrypt, got %q", c.Password.Hasher)
+	}
+	if c.Password.MinLength < 0 || c.Password.MaxLength < 0 {
+		problem("PASSWORD_MIN_LENGTH and PASSWORD_MAX_LENGTH must not be negative")
+	}
+	if c.Password.MaxLength > 0 && c.Password.MaxLength < c.Password.MinLength {
+		problem("PASSWORD_MAX_LENGTH must not be below PASSWORD_MIN_LENGTH")
+	}
+	if c.Password.MinStrength < 0 || c.Password.MinStrength > 4 {
+		problem("PASSWORD_MIN_STRENGTH must be between 0 and 4, got %d", c.Password.MinStrength)
+	}
+	for _, rule := range c.Password.Require {
+		switch rule {
+		case "uppercase", "lowercase", "digit", "symbol":
+		default:
+			problem("unknown PASSWORD_REQUIRE rule %q", rule)
+		}
+	}
+
+	// Mail
+	switch c.Mail.Driver {
+	case "outbox":
+		if c.Server.Env == "production" {
+			problem("MAIL_DRIVER must not be outbox in production, where mail would never leave the server")
+		}
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			problem("SMTP_HOST is required with MAIL_DRIVER=smtp")
+		}
+		if c.Mail.SMTPPort < 1 || c.Mail.SMTPPort > 65535 {
+			problem("SMTP_PORT must be between 1 and 65535, got %d", c.Mail.SMTPPort)
+		}
+	default:
+		problem("MAIL_DRIVER must be outbox, smtp or log, got %q", c.Mail.Driver)
+	}
+
+	// Login providers and passkeys
+	if len(c.OIDC.Providers) > 0 && !validURL(c.OIDC.RedirectURL) {
+		problem("OIDC_REDIRECT_URL must be an absolute http or https URL, got %q", c.OIDC.RedirectURL)
+	}
+	seen := make(map[string]bool)
+	for _, provider := range c.OIDC.Providers {
+		name := strings.ToLower(provider.Name)
+		if name == "" {
+			problem("every OIDC provider needs a name")
+			continue
+		}
+		if seen[name] {
+			problem("OIDC provider %q is configured twice", provider.Name)
+		}
+		seen[name] = true
+		if provider.Issuer == "" || provider.ClientID == "" {
+			problem("OIDC provider %q needs an issuer and a client ID", provider.Name)
+		}
+	}
+	if (c.WebAuthn.RPID == "") != (len(c.WebAuthn.Origins) == 0) {
+		problem("WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS must be set together")
+	}
+
+	// Feature flags
+	switch c.Flags.Source {
+	case "":
+	case "file":
+		if c.Flags.File == "" {
+			problem("FEATURE_FLAGS_FILE is required with FEATURE_FLAGS_SOURCE=file")
+		}
+	case "postgres":
+		if c.Database.URL == "" && c.Database.Host == "" {
+			problem("FEATURE_FLAGS_SOURCE=postgres needs DATABASE_URL or DB_HOST")
+		}
+	default:
+		problem("FEATURE_FLAGS_SOURCE must be file or postgres, got %q", c.Flags.Source)
+	}
+	if c.Flags.ReloadInterval < 1 {
+		problem("FEATURE_FLAGS_RELOAD must be at least 1, got %d", c.Flags.ReloadInterval)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// validPort reports whether port is a TCP port number
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+// validProxy reports whether proxy is an IP address or CIDR range
+func validProxy(proxy string) bool {
+	if _, err := netip.ParsePrefix(proxy); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(proxy)
+	return err == nil
+}
+
+// validURL reports whether raw is an absolute http or https URL
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // part of the error; empty for a valid configuration
+	}{
+		{
+			name:   "defaults",
+			change: func(c *Config) {},
+		},
+		{
+			name:   "port out of range",
+			change: func(c *Config) { c.Server.Port = "0" },
+			want:   "PORT must be a number between 1 and 65535",
+		},
+		{
+			name:   "port not a number",
+			change: func(c *Config) { c.Server.Port = "http" },
+			want:   "PORT must be a number between 1 and 65535",
+		},
+		{
+			name:   "unknown environment",
+			change: func(c *Config) { c.Server.Env = "prod" },
+			want:   "GO_ENV must be development, test, staging or production",
+		},
+		{
+			name:   "relative app URL",
+			change: func(c *Config) { c.Server.AppURL = "/app" },
+			want:   "APP_URL must be an absolute http or https URL",
+		},
+		{
+			name:   "trusted proxy",
+			change: func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.internal"} },
+			want:   `TRUSTED_PROXIES must list IP addresses or CIDR ranges, got "proxy.internal"`,
+		},
+		{
+			name:   "database host without a name",
+			change: func(c *Config) { c.Database.Host = "db"; c.Database.DBName = "" },
+			want:   "DB_NAME is required with DB_HOST",
+		},
+		{
+			name:   "database port",
+			change: func(c *Config) { c.Database.Host = "db"; c.Database.Port = 70000 },
+			want:   "DB_PORT must be between 1 and 65535",
+		},
+		{
+			name:   "database URL skips the host checks",
+			change: func(c *Config) { c.Database.URL = "postgres://db/sanctor"; c.Database.Host = "db"; c.Database.Port = 0 },
+		},
+		{
+			name: "default JWT secret in production",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.Mail.Driver, c.Mail.SMTPHost, c.Mail.SMTPPort = "smtp", "smtp", 587
+			},
+			want: "JWT_SECRET must be changed from the default in production",
+		},
+		{
+			name: "default JWT secret in production with a signing key",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.Auth.SigningKeyFile = "/run/secrets/jwt.pem"
+				c.Mail.Driver, c.Mail.SMTPHost, c.Mail.SMTPPort = "smtp", "smtp", 587
+			},
+		},
+		{
+			name:   "default JWT secret in staging",
+			change: func(c *Config) { c.Server.Env = "staging" },
+		},
+		{
+			name: "outbox mail in production",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.Auth.JWTSecret = "a-real-secret"
+			},
+			want: "MAIL_DRIVER must not be outbox in production",
+		},
+		{
+			name: "smtp mail in production",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.Auth.JWTSecret = "a-real-secret"
+				c.Mail.Driver, c.Mail.SMTPHost, c.Mail.SMTPPort = "smtp", "smtp", 587
+			},
+		},
+		{
+			name:   "smtp without a host",
+			change: func(c *Config) { c.Mail.Driver = "smtp"; c.Mail.SMTPPort = 587 },
+			want:   "SMTP_HOST is required with MAIL_DRIVER=smtp",
+		},
+		{
+			name:   "unknown mail driver",
+			change: func(c *Config) { c.Mail.Driver = "sendmail" },
+			want:   "MAIL_DRIVER must be outbox, smtp or log",
+		},
+		{
+			name:   "unknown password hasher",
+			change: func(c *Config) { c.Password.Hasher = "md5" },
+			want:   "PASSWORD_HASHER must be argon2id or bcrypt",
+		},
+		{
+			name:   "bcrypt cost",
+			change: func(c *Config) { c.Password.Hasher = "bcrypt"; c.Password.BcryptCost = 3 },
+			want:   "BCRYPT_COST must be between 4 and 31",
+		},
+		{
+			name:   "password lengths",
+			change: func(c *Config) { c.Password.MinLength = 20; c.Password.MaxLength = 10 },
+			want:   "PASSWORD_MAX_LENGTH must not be below PASSWORD_MIN_LENGTH",
+		},
+		{
+			name:   "password rule",
+			change: func(c *Config) { c.Password.Require = []string{"digit", "emoji"} },
+			want:   `unknown PASSWORD_REQUIRE rule "emoji"`,
+		},
+		{
+			name: "OIDC provider twice",
+			change: func(c *Config) {
+				c.OIDC.Providers = []OIDCProviderConfig{oidcProvider("google"), oidcProvider("Google")}
+			},
+			want: `OIDC provider "Google" is configured twice`,
+		},
+		{
+			name: "OIDC provider without a client ID",
+			change: func(c *Config) {
+				c.OIDC.Providers = []OIDCProviderConfig{{Name: "google", Issuer: "https://accounts.google.com"}}
+			},
+			want: `OIDC provider "google" needs an issuer and a client ID`,
+		},
+		{
+			name:   "passkey RP ID without origins",
+			change: func(c *Config) { c.WebAuthn.RPID = "sanctor.example" },
+			want:   "WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS must be set together",
+		},
+		{
+			name:   "flag file source without a file",
+			change: func(c *Config) { c.Flags.Source = "file" },
+			want:   "FEATURE_FLAGS_FILE is required with FEATURE_FLAGS_SOURCE=file",
+		},
+		{
+			name:   "flag postgres source without a database",
+			change: func(c *Config) { c.Flags.Source = "postgres" },
+			want:   "FEATURE_FLAGS_SOURCE=postgres needs DATABASE_URL or DB_HOST",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Validate() = %v, want no error", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Validate() = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = "0"
+	cfg.Password.Hasher = "md5"
+	cfg.Flags.ReloadInterval = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() accepted an invalid configuration")
+	}
+	for _, want := range []string{"PORT", "PASSWORD_HASHER", "FEATURE_FLAGS_RELOAD"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func oidcProvider(name string) OIDCProviderConfig {
+	return OIDCProviderConfig{Name: name, Issuer: "https://accounts.google.com", ClientID: "client"}
+}
@@ -16,6 +16,8 @@ import (
 type DB struct {
 	*sql.DB
 	Gorm *gorm.DB // GORM instance for ORM operations
+
+	timeouts Timeouts
 }
 
 // Config holds database configuration
@@ -26,6 +28,14 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	Pool     PoolConfig
+}
+
+// PoolConfig holds connection pool settings. Zero values use the defaults.
+type PoolConfig struct {
+	MaxOpenConns    int           // default 25
+	MaxIdleConns    int           // default 5
+	ConnMaxLifetime time.Duration // default 5 minutes
 }
 
 // New creates a new database connection
@@ -41,14 +51,14 @@ func New(config Config) (*DB, error) {
 		config.SSLMode,
 	)
 
-	return connect(connStr)
+	return connect(connStr, config.Pool)
 }
 
 // NewFromURL creates a new database connection from a DATABASE_URL string
-func NewFromURL(databaseURL string) (*DB, error) {
+func NewFromURL(databaseURL string, pool PoolConfig) (*DB, error) {
 	// Ensure sslmode is set (Supabase requires SSL)
 	connStr := ensureSSLMode(databaseURL)
-	return connect(connStr)
+	return connect(connStr, pool)
 }
 
 // ensureSSLMode adds sslmode=require to the connection URL if not already set
@@ -72,7 +82,7 @@ func ensureSSLMode(databaseURL string) string {
 }
 
 // connect establishes a database connection with the given connection string
-func connect(connStr string) (*DB, error) {
+func connect(connStr string, pool PoolConfig) (*DB, error) {
 	// Let GORM open the connection using its own pgx driver
 	var gormDB *gorm.DB
 	var err error
@@ -102,9 +112,18 @@ func connect(connStr string) (*DB, error) {
 	}
 
 	// Configure connection pool
-	sqlDB.SetMaxOpenConns(25)
-	sqlDB.SetMaxIdleConns(5)
-	sqlDB.SetConnMaxLifetime(5 * time.Minute)
+	if pool.MaxOpenConns == 0 {
+		pool.MaxOpenConns = 25
+	}
+	if pool.MaxIdleConns == 0 {
+		pool.MaxIdleConns = 5
+	}
+	if pool.ConnMaxLifetime == 0 {
+		pool.ConnMaxLifetime = 5 * time.Minute
+	}
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
 
 	// Verify connectivity
 	if err := sqlDB.Ping(); err != nil {
@@ -127,13 +146,3 @@ func (db *DB) Close() error {
 func (db *DB) Ping() error {
 	return db.DB.Ping()
 }
-
-// AutoMigrate runs GORM auto-migration for the given models
-func (db *DB) AutoMigrate(models ...interface{}) error {
-	log.Println("Running database migrations...")
-	if err := db.Gorm.AutoMigrate(models...); err != nil {
-		return fmt.Errorf("failed to auto-migrate: %w", err)
-	}
-	log.Println("✅ Database migrations completed")
-	return nil
-}
\ No newline at end of file
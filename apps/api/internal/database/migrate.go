@@ -0,0 +1,397 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationLockID is the Postgres advisory lock key held while migrating, so
+// replicas starting at the same time apply each migration once
+const migrationLockID int64 = 0x73616e63746f72 // "sanctor"
+
+// migrationFile matches NNN_name.up.sql and NNN_name.down.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// adoptFile is the optional script that prepares a database created before
+// migrations were used
+const adoptFile = "adopt.sql"
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // empty when the migration cannot be rolled back
+	Checksum string // SHA-256 of Up
+}
+
+// Migration states reported by Status
+const (
+	MigrationApplied  = "applied"
+	MigrationPending  = "pending"
+	MigrationModified = "modified" // applied, but its file changed since
+	MigrationMissing  = "missing"  // applied, but its file is gone
+)
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	State     string
+	AppliedAt *time.Time
+}
+
+// Common errors
+var (
+	ErrChecksumMismatch = errors.New("applied migration has been modified")
+	ErrNoDownMigration  = errors.New("migration has no down file")
+)
+
+// LoadMigrations reads the migrations in the root of fsys, sorted by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies versioned SQL migrations and records them, with their
+// checksums, in the schema_migrations table. Each migration runs in its own
+// transaction while an advisory lock keeps other replicas out.
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+	adopt      string // run before the first migration of a database, if set
+}
+
+// NewMigrator creates a migrator for the migrations in fsys. If fsys also
+// holds adopt.sql, it runs before the first migration on a database that
+// has none applied yet.
+func NewMigrator(db *DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	adopt, err := fs.ReadFile(fsys, adoptFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", adoptFile, err)
+	}
+	return &Migrator{db: db, migrations: migrations, adopt: string(adopt)}, nil
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Up applies every pending migration in version order and returns them.
+// It refuses to run when an applied migration's file has been changed.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		if len(applied) == 0 && len(m.migrations) > 0 && m.adopt != "" {
+			if err := m.adoptSchema(ctx, conn); err != nil {
+				return err
+			}
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the most recently applied steps migrations and returns
+// them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		for _, version := range latest(applied, steps) {
+			migration, ok := m.find(version)
+			if !ok {
+				return fmt.Errorf("migration %03d_%s: file not found", version, applied[version].name)
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Redo rolls back the most recently applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		versions := latest(applied, 1)
+		if len(versions) == 0 {
+			return nil
+		}
+		migration, ok := m.find(versions[0])
+		if !ok {
+			return fmt.Errorf("migration %03d_%s: file not found", versions[0], applied[versions[0]].name)
+		}
+		if err := m.revert(ctx, conn, migration); err != nil {
+			return err
+		}
+		if err := m.apply(ctx, conn, migration); err != nil {
+			return err
+		}
+		redone = &migration
+		return nil
+	})
+	return redone, err
+}
+
+// Status lists every known migration, and applied ones whose file is gone,
+// by version. It only reads: it takes no lock and does not create
+// schema_migrations, so a database that was never migrated shows every
+// migration as pending.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var exists bool
+	err := m.db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	applied := make(map[int]appliedMigration)
+	if exists {
+		if applied, err = readApplied(ctx, m.db); err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name, State: MigrationPending}
+		if row, ok := applied[migration.Version]; ok {
+			status.State = MigrationApplied
+			if row.checksum != migration.Checksum {
+				status.State = MigrationModified
+			}
+			appliedAt := row.appliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		if _, ok := m.find(version); !ok {
+			appliedAt := row.appliedAt
+			statuses = append(statuses, MigrationStatus{Version: version, Name: row.name, State: MigrationMissing, AppliedAt: &appliedAt})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// locked runs fn on a dedicated connection holding the migration lock, with
+// the schema table created and its rows loaded
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int]appliedMigration) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock is released with the connection if this fails
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			log.Printf("⚠️  Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied, err := readApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+// readApplied loads the rows of schema_migrations by version
+func readApplied(ctx context.Context, q querier) (map[int]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var row appliedMigration
+		if err := rows.Scan(&row.version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[row.version] = row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// apply runs a migration's up file and records it
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	log.Printf("Applying migration %03d_%s...", migration.Version, migration.Name)
+	return inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, migration.Checksum,
+		)
+		return err
+	})
+}
+
+// adoptSchema runs the adoption script, which brings a database created
+// before migrations were used to the shape the first migrations expect
+func (m *Migrator) adoptSchema(ctx context.Context, conn *sql.Conn) error {
+	log.Printf("Adopting the existing schema...")
+	return inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.adopt); err != nil {
+			return fmt.Errorf("%s failed: %w", adoptFile, err)
+		}
+		return nil
+	})
+}
+
+// revert runs a migration's down file and forgets it
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %03d_%s: %w", migration.Version, migration.Name, ErrNoDownMigration)
+	}
+	log.Printf("Rolling back migration %03d_%s...", migration.Version, migration.Name)
+	return inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("rollback of %03d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		return err
+	})
+}
+
+// verify checks that no applied migration has changed since
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	for _, migration := range m.migrations {
+		if row, ok := applied[migration.Version]; ok && row.checksum != migration.Checksum {
+			return fmt.Errorf("migration %03d_%s: %w", migration.Version, migration.Name, ErrChecksumMismatch)
+		}
+	}
+	return nil
+}
+
+// find returns the migration with the given version
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// latest returns up to n applied versions, newest first
+func latest(applied map[int]appliedMigration, n int) []int {
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if len(versions) > n {
+		versions = versions[:n]
+	}
+	return versions
+}
+
+// inTx runs fn in a transaction on conn, committing if it succeeds
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
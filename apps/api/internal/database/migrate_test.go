@@ -0,0 +1,505 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeDatabase is a database/sql driver that understands the statements the
+// migrator issues about schema_migrations. Migration SQL is only recorded.
+type fakeDatabase struct {
+	mu       sync.Mutex
+	executed []string // every statement, in order
+	table    bool     // schema_migrations exists
+	rows     map[int64]fakeMigrationRow
+	failOn   string // statements containing it fail
+}
+
+type fakeMigrationRow struct {
+	name, checksum string
+	appliedAt      time.Time
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{rows: make(map[int64]fakeMigrationRow)}
+}
+
+// open returns a DB backed by the fake
+func (d *fakeDatabase) open(t *testing.T) *DB {
+	t.Helper()
+	db := sql.OpenDB(d)
+	t.Cleanup(func() { db.Close() })
+	return &DB{DB: db}
+}
+
+// ran reports whether a statement containing fragment was executed
+func (d *fakeDatabase) ran(fragment string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, statement := range d.executed {
+		if strings.Contains(statement, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// index returns the position of the first statement containing fragment, or -1
+func (d *fakeDatabase) index(fragment string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, statement := range d.executed {
+		if strings.Contains(statement, fragment) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *fakeDatabase) Connect(context.Context) (driver.Conn, error) { return &fakeConn{d}, nil }
+func (d *fakeDatabase) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("use the connector") }
+
+type fakeConn struct{ d *fakeDatabase }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	snapshot := make(map[int64]fakeMigrationRow, len(c.d.rows))
+	for version, row := range c.d.rows {
+		snapshot[version] = row
+	}
+	return &fakeTx{d: c.d, rows: snapshot, table: c.d.table}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	d := c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.executed = append(d.executed, query)
+	if d.failOn != "" && strings.Contains(query, d.failOn) {
+		return nil, errors.New("statement failed")
+	}
+
+	switch {
+	case strings.Contains(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		d.table = true
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		d.rows[args[0].Value.(int64)] = fakeMigrationRow{
+			name:      args[1].Value.(string),
+			checksum:  args[2].Value.(string),
+			appliedAt: time.Now(),
+		}
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		delete(d.rows, args[0].Value.(int64))
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	d := c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.executed = append(d.executed, query)
+
+	switch {
+	case strings.Contains(query, "to_regclass('schema_migrations')"):
+		return &fakeRows{columns: []string{"exists"}, values: [][]driver.Value{{d.table}}}, nil
+	case strings.Contains(query, "FROM schema_migrations"):
+		if !d.table {
+			return nil, errors.New(`relation "schema_migrations" does not exist`)
+		}
+		rows := &fakeRows{columns: []string{"version", "name", "checksum", "applied_at"}}
+		for version, row := range d.rows {
+			rows.values = append(rows.values, []driver.Value{version, row.name, row.checksum, row.appliedAt})
+		}
+		return rows, nil
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+}
+
+// fakeTx restores schema_migrations as it was if rolled back
+type fakeTx struct {
+	d     *fakeDatabase
+	rows  map[int64]fakeMigrationRow
+	table bool
+}
+
+func (tx *fakeTx) Commit() error { return nil }
+
+func (tx *fakeTx) Rollback() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	tx.d.rows, tx.d.table = tx.rows, tx.table
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// testMigrations are three migrations; the last cannot be rolled back
+var testMigrations = fstest.MapFS{
+	"001_create_things.up.sql":   {Data: []byte("CREATE TABLE things (id INT);")},
+	"001_create_things.down.sql": {Data: []byte("DROP TABLE things;")},
+	"002_add_colour.up.sql":      {Data: []byte("ALTER TABLE things ADD COLUMN colour TEXT;")},
+	"002_add_colour.down.sql":    {Data: []byte("ALTER TABLE things DROP COLUMN colour;")},
+	"003_fill_colour.up.sql":     {Data: []byte("UPDATE things SET colour = 'blue';")},
+}
+
+func newTestMigrator(t *testing.T, d *fakeDatabase) *Migrator {
+	t.Helper()
+	migrator, err := NewMigrator(d.open(t), testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrator
+}
+
+// versions lists the versions of migrations
+func versions(migrations []Migration) []int {
+	list := make([]int, 0, len(migrations))
+	for _, migration := range migrations {
+		list = append(list, migration.Version)
+	}
+	return list
+}
+
+// recorded lists the versions in schema_migrations
+func (d *fakeDatabase) recorded() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]int, 0, len(d.rows))
+	for version := range d.rows {
+		list = append(list, int(version))
+	}
+	sort.Ints(list)
+	return list
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		wantVersions []int
+		wantErr      bool
+	}{
+		{name: "sorted by version", files: testMigrations, wantVersions: []int{1, 2, 3}},
+		{
+			name: "other files are ignored",
+			files: fstest.MapFS{
+				"README.md":            {Data: []byte("# Migrations")},
+				"migrations.go":        {Data: []byte("package migrations")},
+				"010_later.up.sql":     {Data: []byte("SELECT 1;")},
+				"2_Not-Snake.up.sql":   {Data: []byte("SELECT 1;")},
+				"003_no_direction.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantVersions: []int{10},
+		},
+		{
+			name:    "down without up",
+			files:   fstest.MapFS{"001_orphan.down.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: true,
+		},
+		{
+			name: "two names for one version",
+			files: fstest.MapFS{
+				"001_first.up.sql":  {Data: []byte("SELECT 1;")},
+				"001_second.up.sql": {Data: []byte("SELECT 2;")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "version zero",
+			files:   fstest.MapFS{"000_zero.up.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := LoadMigrations(tt.files)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("loaded %v", versions(migrations))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions(migrations); !equalInts(got, tt.wantVersions) {
+				t.Errorf("got versions %v, want %v", got, tt.wantVersions)
+			}
+			for _, migration := range migrations {
+				if len(migration.Checksum) != 64 {
+					t.Errorf("migration %d has checksum %q", migration.Version, migration.Checksum)
+				}
+			}
+		})
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	ctx := context.Background()
+	d := newFakeDatabase()
+	migrator := newTestMigrator(t, d)
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(applied); !equalInts(got, []int{1, 2, 3}) {
+		t.Errorf("applied %v, want [1 2 3]", got)
+	}
+	if got := d.recorded(); !equalInts(got, []int{1, 2, 3}) {
+		t.Errorf("recorded %v, want [1 2 3]", got)
+	}
+	if !d.ran("pg_advisory_lock") || !d.ran("pg_advisory_unlock") {
+		t.Error("migrated without holding the lock")
+	}
+
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second run applied %v (%v), want nothing", versions(applied), err)
+	}
+}
+
+func TestMigratorUpStopsAtFailure(t *testing.T) {
+	d := newFakeDatabase()
+	d.failOn = "ADD COLUMN colour"
+	migrator := newTestMigrator(t, d)
+
+	applied, err := migrator.Up(context.Background())
+	if err == nil {
+		t.Fatal("the failed migration was not reported")
+	}
+	if got := versions(applied); !equalInts(got, []int{1}) {
+		t.Errorf("applied %v, want [1]", got)
+	}
+	if got := d.recorded(); !equalInts(got, []int{1}) {
+		t.Errorf("recorded %v, want [1]", got)
+	}
+	if d.ran("UPDATE things") {
+		t.Error("kept going after a failed migration")
+	}
+}
+
+func TestMigratorUpRefusesModifiedMigration(t *testing.T) {
+	ctx := context.Background()
+	d := newFakeDatabase()
+	if _, err := newTestMigrator(t, d).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.rows[2] = fakeMigrationRow{name: "add_colour", checksum: "edited", appliedAt: time.Now()}
+	delete(d.rows, 3)
+
+	applied, err := newTestMigrator(t, d).Up(ctx)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got error %v, want ErrChecksumMismatch", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied %v after finding a modified migration", versions(applied))
+	}
+}
+
+func TestMigratorAdopt(t *testing.T) {
+	tests := []struct {
+		name      string
+		applied   int // how many of the test migrations are applied
+		wantAdopt bool
+	}{
+		{name: "new database", applied: 0, wantAdopt: true},
+		{name: "partly migrated", applied: 1},
+		{name: "up to date", applied: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fstest.MapFS{"adopt.sql": {Data: []byte("ALTER TABLE legacy ADD COLUMN IF NOT EXISTS colour TEXT;")}}
+			for name, file := range testMigrations {
+				files[name] = file
+			}
+			ctx := context.Background()
+			d := newFakeDatabase()
+			for _, migration := range newTestMigrator(t, d).migrations[:tt.applied] {
+				d.rows[int64(migration.Version)] = fakeMigrationRow{name: migration.Name, checksum: migration.Checksum, appliedAt: time.Now()}
+			}
+			d.table = tt.applied > 0
+
+			migrator, err := NewMigrator(d.open(t), files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := migrator.Up(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if got := d.ran("ALTER TABLE legacy"); got != tt.wantAdopt {
+				t.Fatalf("adopted=%v, want %v", got, tt.wantAdopt)
+			}
+			if tt.wantAdopt && d.index("ALTER TABLE legacy") > d.index("CREATE TABLE things") {
+				t.Error("adopted the schema after the first migration")
+			}
+		})
+	}
+}
+
+func TestMigratorDown(t *testing.T) {
+	tests := []struct {
+		name         string
+		applied      int // how many of the test migrations are applied
+		steps        int
+		wantReverted []int
+		wantRecorded []int
+		wantErr      error
+	}{
+		{name: "last one", applied: 2, steps: 1, wantReverted: []int{2}, wantRecorded: []int{1}},
+		{name: "all", applied: 2, steps: 5, wantReverted: []int{2, 1}, wantRecorded: []int{}},
+		{name: "nothing applied", applied: 0, steps: 1, wantReverted: []int{}, wantRecorded: []int{}},
+		{name: "no down file", applied: 3, steps: 1, wantReverted: []int{}, wantRecorded: []int{1, 2, 3}, wantErr: ErrNoDownMigration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newFakeDatabase()
+			migrator := newTestMigrator(t, d)
+			for _, migration := range migrator.migrations[:tt.applied] {
+				d.table = true
+				d.rows[int64(migration.Version)] = fakeMigrationRow{name: migration.Name, checksum: migration.Checksum}
+			}
+
+			reverted, err := migrator.Down(ctx, tt.steps)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got := versions(reverted); !equalInts(got, tt.wantReverted) {
+				t.Errorf("reverted %v, want %v", got, tt.wantReverted)
+			}
+			if got := d.recorded(); !equalInts(got, tt.wantRecorded) {
+				t.Errorf("recorded %v, want %v", got, tt.wantRecorded)
+			}
+		})
+	}
+}
+
+func TestMigratorRedo(t *testing.T) {
+	ctx := context.Background()
+	d := newFakeDatabase()
+	migrator, err := NewMigrator(d.open(t), fstest.MapFS{
+		"001_create_things.up.sql":   testMigrations["001_create_things.up.sql"],
+		"001_create_things.down.sql": testMigrations["001_create_things.down.sql"],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	redone, err := migrator.Redo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redone == nil || redone.Version != 1 || !d.ran("DROP TABLE things") {
+		t.Errorf("redid %v", redone)
+	}
+	if got := d.recorded(); !equalInts(got, []int{1}) {
+		t.Errorf("recorded %v, want [1]", got)
+	}
+}
+
+func TestMigratorStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied map[int64]string // version -> checksum; "" for the file's own
+		want    []string         // state of versions 1, 2, 3 and any missing ones
+	}{
+		{name: "never migrated", want: []string{MigrationPending, MigrationPending, MigrationPending}},
+		{
+			name:    "partly applied",
+			applied: map[int64]string{1: ""},
+			want:    []string{MigrationApplied, MigrationPending, MigrationPending},
+		},
+		{
+			name:    "modified and missing",
+			applied: map[int64]string{1: "", 2: "edited", 9: "gone"},
+			want:    []string{MigrationApplied, MigrationModified, MigrationPending, MigrationMissing},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newFakeDatabase()
+			migrator := newTestMigrator(t, d)
+			for version, checksum := range tt.applied {
+				if migration, ok := migrator.find(int(version)); ok && checksum == "" {
+					checksum = migration.Checksum
+				}
+				d.table = true
+				d.rows[version] = fakeMigrationRow{name: "m", checksum: checksum, appliedAt: time.Now()}
+			}
+
+			statuses, err := migrator.Status(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(statuses))
+			for _, status := range statuses {
+				got = append(got, status.State)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got states %v, want %v", got, tt.want)
+			}
+
+			// A status check must not wait for a running migration or change the schema
+			if d.ran("pg_advisory") || d.ran("CREATE") {
+				t.Errorf("status took the lock or changed the schema: %q", d.executed)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
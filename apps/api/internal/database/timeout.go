@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Timeouts bound how long database work may take. A zero value means no
+// limit beyond the caller's context.
+type Timeouts struct {
+	Read        time.Duration // a single query that only reads
+	Write       time.Duration // a single insert, update or delete
+	Transaction time.Duration // a whole unit of work
+}
+
+// SetTimeouts sets the limits applied by ReadContext, WriteContext and
+// Transaction
+func (db *DB) SetTimeouts(timeouts Timeouts) {
+	db.timeouts = timeouts
+}
+
+// ReadContext returns ctx bounded by the read timeout. Repositories call it
+// at the start of a query and defer the cancel func until they are done
+// with the rows.
+func (db *DB) ReadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, db.timeouts.Read)
+}
+
+// WriteContext returns ctx bounded by the write timeout
+func (db *DB) WriteContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, db.timeouts.Write)
+}
+
+// timeoutKey is the context key of a request's timeout report
+type timeoutKey struct{}
+
+// WithTimeoutReport returns a context in which database operations that run
+// out of time are recorded, and a func reporting whether any did. The HTTP
+// layer uses it to tell a timed out query from other failures.
+func WithTimeoutReport(ctx context.Context) (context.Context, func() bool) {
+	timedOut := new(atomic.Bool)
+	return context.WithValue(ctx, timeoutKey{}, timedOut), timedOut.Load
+}
+
+// withTimeout bounds ctx by d, recording in ctx's timeout report if the
+// operation ran out of time
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, d)
+	return opCtx, func() {
+		if opCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			if timedOut, ok := ctx.Value(timeoutKey{}).(*atomic.Bool); ok {
+				timedOut.Store(true)
+			}
+		}
+		cancel()
+	}
+}
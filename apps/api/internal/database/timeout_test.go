@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openWithGorm returns a DB backed by the fake with GORM on top, as
+// Transaction needs
+func (d *fakeDatabase) openWithGorm(t *testing.T) *DB {
+	t.Helper()
+	sqlDB := sql.OpenDB(d)
+	t.Cleanup(func() { sqlDB.Close() })
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DB{DB: sqlDB, Gorm: gormDB}
+}
+
+func TestTimeouts(t *testing.T) {
+	const limit = 20 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		timeouts     Timeouts
+		op           string // read, write or transaction
+		cancelCaller bool
+		wantDeadline bool
+		wantReported bool
+	}{
+		{name: "read", timeouts: Timeouts{Read: limit}, op: "read", wantDeadline: true, wantReported: true},
+		{name: "write", timeouts: Timeouts{Write: limit}, op: "write", wantDeadline: true, wantReported: true},
+		{name: "transaction", timeouts: Timeouts{Transaction: limit}, op: "transaction", wantDeadline: true, wantReported: true},
+		{name: "read without a limit", timeouts: Timeouts{Write: limit, Transaction: limit}, op: "read"},
+		{name: "write without a limit", timeouts: Timeouts{Read: limit, Transaction: limit}, op: "write"},
+		{name: "transaction without a limit", timeouts: Timeouts{Read: limit, Write: limit}, op: "transaction"},
+		{name: "caller cancelled", timeouts: Timeouts{Read: limit}, op: "read", cancelCaller: true, wantDeadline: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDatabase().openWithGorm(t)
+			db.SetTimeouts(tt.timeouts)
+
+			ctx, timedOut := WithTimeoutReport(context.Background())
+			ctx, cancelCaller := context.WithCancel(ctx)
+			defer cancelCaller()
+
+			// run waits for the operation's context to end unless it has no
+			// deadline, as a query that outlives its limit would
+			run := func(opCtx context.Context) error {
+				_, hasDeadline := opCtx.Deadline()
+				if hasDeadline != tt.wantDeadline {
+					t.Errorf("operation has a deadline = %v, want %v", hasDeadline, tt.wantDeadline)
+				}
+				if !hasDeadline {
+					return nil
+				}
+				if tt.cancelCaller {
+					cancelCaller()
+				}
+				<-opCtx.Done()
+				return opCtx.Err()
+			}
+
+			var err error
+			switch tt.op {
+			case "read", "write":
+				bound := db.ReadContext
+				if tt.op == "write" {
+					bound = db.WriteContext
+				}
+				opCtx, cancel := bound(ctx)
+				err = run(opCtx)
+				cancel()
+			case "transaction":
+				err = db.Transaction(ctx, run)
+			}
+
+			wantErr := error(nil)
+			switch {
+			case tt.cancelCaller:
+				wantErr = context.Canceled
+			case tt.wantDeadline:
+				wantErr = context.DeadlineExceeded
+			}
+			if !errors.Is(err, wantErr) {
+				t.Errorf("operation error = %v, want %v", err, wantErr)
+			}
+			if got := timedOut(); got != tt.wantReported {
+				t.Errorf("timeout reported = %v, want %v", got, tt.wantReported)
+			}
+		})
+	}
+}
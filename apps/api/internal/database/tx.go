@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Transactor runs a unit of work atomically. Repositories called with the
+// context passed to fn take part in the transaction; calling Transaction
+// again with that context joins it rather than starting a new one.
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// txKey is the context key of the database transaction in progress
+type txKey struct{}
+
+// tx is a database transaction as seen by the raw SQL and GORM repositories
+type tx struct {
+	sql  *sql.Tx
+	gorm *gorm.DB
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Transaction runs fn in a database transaction, committing if it returns
+// nil and rolling back if it fails, panics or runs past the transaction
+// timeout
+func (db *DB) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*tx); ok {
+		return fn(ctx)
+	}
+
+	ctx, cancel := withTimeout(ctx, db.timeouts.Transaction)
+	defer cancel()
+	return db.Gorm.WithContext(ctx).Transaction(func(gormTx *gorm.DB) error {
+		sqlTx, ok := gormTx.Statement.ConnPool.(*sql.Tx)
+		if !ok {
+			return errors.New("transaction is not backed by *sql.Tx")
+		}
+		return fn(context.WithValue(ctx, txKey{}, &tx{sql: sqlTx, gorm: gormTx}))
+	})
+}
+
+// querier returns the transaction in ctx, or the connection pool outside one
+func (db *DB) querier(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*tx); ok {
+		return tx.sql
+	}
+	return db.DB
+}
+
+// ExecContext executes a query, within the transaction in ctx if there is one
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.querier(ctx).ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs a query, within the transaction in ctx if there is one
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.querier(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs a query returning at most one row, within the
+// transaction in ctx if there is one
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.querier(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// WithContext returns a GORM session bound to ctx, within the transaction in
+// ctx if there is one
+func (db *DB) WithContext(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*tx); ok {
+		return tx.gorm.WithContext(ctx)
+	}
+	return db.Gorm.WithContext(ctx)
+}
+
+// MemoryTransactor gives the in-memory repositories all-or-nothing units of
+// work. Repositories record how to undo each change with OnRollback; if the
+// unit of work fails, the changes are undone in reverse order. Units of work
+// run one at a time, but plain repository calls are not held back, so other
+// requests may briefly see changes that are later undone.
+type MemoryTransactor struct {
+	mu sync.Mutex
+}
+
+// NewMemoryTransactor creates a transactor for in-memory repositories
+func NewMemoryTransactor() *MemoryTransactor {
+	return &MemoryTransactor{}
+}
+
+// undoKey is the context key of the in-memory transaction in progress
+type undoKey struct{}
+
+// undoLog holds the undo functions of an in-memory transaction
+type undoLog struct {
+	undo []func()
+	mu   sync.Mutex
+}
+
+// Transaction runs fn, undoing its changes if it returns an error or panics
+func (t *MemoryTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(undoKey{}).(*undoLog); ok {
+		return fn(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	log := &undoLog{}
+	defer func() {
+		if p := recover(); p != nil {
+			log.rollback()
+			panic(p)
+		}
+		if err != nil {
+			log.rollback()
+		}
+	}()
+	return fn(context.WithValue(ctx, undoKey{}, log))
+}
+
+// OnRollback registers undo to run if the in-memory transaction in ctx is
+// rolled back. Outside a transaction it does nothing.
+func OnRollback(ctx context.Context, undo func()) {
+	if log, ok := ctx.Value(undoKey{}).(*undoLog); ok {
+		log.mu.Lock()
+		log.undo = append(log.undo, undo)
+		log.mu.Unlock()
+	}
+}
+
+// rollback runs the undo functions, most recent first
+func (l *undoLog) rollback() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.undo) - 1; i >= 0; i-- {
+		l.undo[i]()
+	}
+	l.undo = nil
+}
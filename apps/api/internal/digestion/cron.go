@@ -1,6 +1,7 @@
 package digestion
 
 import (
+	"context"
 	"log"
 	"time"
 )
@@ -8,11 +9,28 @@ import (
 // Cron handles scheduled tasks for data digestion
 type Cron struct {
 	ticker *time.Ticker
+	jobs   []job
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// job is a task run on every tick
+type job struct {
+	name string
+	run  func(ctx context.Context) error
 }
 
 // NewCron creates a new cron job manager
 func NewCron() *Cron {
-	return &Cron{}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Cron{ctx: ctx, cancel: cancel}
+}
+
+// Register adds a task to run on every tick. Tasks run one after another;
+// a failing task is logged and does not stop the others. The context
+// passed to a task is cancelled when the cron is stopped.
+func (c *Cron) Register(name string, run func(ctx context.Context) error) {
+	c.jobs = append(c.jobs, job{name: name, run: run})
 }
 
 // Start begins the cron job scheduler
@@ -31,6 +49,7 @@ func (c *Cron) Start() {
 
 // Stop halts the cron job scheduler
 func (c *Cron) Stop() {
+	c.cancel()
 	if c.ticker != nil {
 		c.ticker.Stop()
 		log.Println("Digestion cron jobs stopped")
@@ -40,6 +59,11 @@ func (c *Cron) Stop() {
 // ProcessDigestion handles the data digestion process
 func (c *Cron) ProcessDigestion() {
 	log.Println("Running digestion process...")
+	for _, j := range c.jobs {
+		if err := j.run(c.ctx); err != nil {
+			log.Printf("⚠️  Cron job %s failed: %v", j.name, err)
+		}
+	}
 	// TODO: Implement digestion logic
 	// This could handle:
 	// - Data aggregation
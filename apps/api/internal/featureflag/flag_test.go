@@ -0,0 +1,179 @@
+package featureflag
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func percentage(p int) *int {
+	return &p
+}
+
+func TestEvaluate(t *testing.T) {
+	student := Subject{UserID: "user-1", University: "tum"}
+	tests := []struct {
+		name    string
+		flag    Flag
+		env     string
+		subject Subject
+		on      bool
+		reason  string
+	}{
+		{
+			name:    "disabled",
+			flag:    Flag{Name: "f", Environments: []string{"test"}},
+			env:     "test",
+			subject: student,
+			reason:  ReasonDisabled,
+		},
+		{
+			name:    "enabled for everyone",
+			flag:    Flag{Name: "f", Enabled: true},
+			env:     "production",
+			subject: Subject{},
+			on:      true,
+			reason:  ReasonEveryone,
+		},
+		{
+			name:    "listed environment",
+			flag:    Flag{Name: "f", Enabled: true, Environments: []string{"staging", "production"}},
+			env:     "staging",
+			subject: Subject{},
+			on:      true,
+			reason:  ReasonEveryone,
+		},
+		{
+			name:    "other environment",
+			flag:    Flag{Name: "f", Enabled: true, Environments: []string{"staging"}},
+			env:     "production",
+			subject: student,
+			reason:  ReasonEnvironment,
+		},
+		{
+			name:    "listed university",
+			flag:    Flag{Name: "f", Enabled: true, Universities: []string{"lmu", "tum"}},
+			env:     "production",
+			subject: student,
+			on:      true,
+			reason:  ReasonUniversity,
+		},
+		{
+			name:    "other university",
+			flag:    Flag{Name: "f", Enabled: true, Universities: []string{"lmu"}},
+			env:     "production",
+			subject: student,
+			reason:  ReasonNotTargeted,
+		},
+		{
+			name:    "university targeting needs a verified university",
+			flag:    Flag{Name: "f", Enabled: true, Universities: []string{"tum"}},
+			env:     "production",
+			subject: Subject{UserID: "user-1"},
+			reason:  ReasonNotTargeted,
+		},
+		{
+			name:    "university outside the environments",
+			flag:    Flag{Name: "f", Enabled: true, Environments: []string{"staging"}, Universities: []string{"tum"}},
+			env:     "production",
+			subject: student,
+			reason:  ReasonEnvironment,
+		},
+		{
+			name:    "full percentage",
+			flag:    Flag{Name: "f", Enabled: true, Percentage: percentage(100)},
+			env:     "production",
+			subject: Subject{UserID: "user-1"},
+			on:      true,
+			reason:  ReasonPercentage,
+		},
+		{
+			name:    "zero percentage",
+			flag:    Flag{Name: "f", Enabled: true, Percentage: percentage(0)},
+			env:     "production",
+			subject: Subject{UserID: "user-1"},
+			reason:  ReasonNotTargeted,
+		},
+		{
+			name:    "percentage skips anonymous requests",
+			flag:    Flag{Name: "f", Enabled: true, Percentage: percentage(100)},
+			env:     "production",
+			subject: Subject{},
+			reason:  ReasonNotTargeted,
+		},
+		{
+			name:    "university before percentage",
+			flag:    Flag{Name: "f", Enabled: true, Universities: []string{"tum"}, Percentage: percentage(0)},
+			env:     "production",
+			subject: student,
+			on:      true,
+			reason:  ReasonUniversity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			on, reason := tt.flag.Evaluate(tt.env, tt.subject)
+			if on != tt.on || reason != tt.reason {
+				t.Errorf("Evaluate() = %v, %q, want %v, %q", on, reason, tt.on, tt.reason)
+			}
+		})
+	}
+}
+
+func TestPercentageBuckets(t *testing.T) {
+	const users = 2000
+	subject := func(i int) Subject {
+		return Subject{UserID: fmt.Sprintf("user-%d", i)}
+	}
+	onFor := func(flag Flag) map[int]bool {
+		on := make(map[int]bool)
+		for i := 0; i < users; i++ {
+			if ok, _ := flag.Evaluate("production", subject(i)); ok {
+				on[i] = true
+			}
+		}
+		return on
+	}
+
+	t.Run("share", func(t *testing.T) {
+		on := onFor(Flag{Name: "f", Enabled: true, Percentage: percentage(25)})
+		if share := len(on) * 100 / users; share < 20 || share > 30 {
+			t.Errorf("flag at 25%% is on for %d%% of users", share)
+		}
+	})
+
+	t.Run("stable", func(t *testing.T) {
+		flag := Flag{Name: "f", Enabled: true, Percentage: percentage(40)}
+		if first, again := onFor(flag), onFor(flag); !reflect.DeepEqual(first, again) {
+			t.Errorf("a second evaluation chose different users: %d, then %d", len(first), len(again))
+		}
+	})
+
+	t.Run("raising only adds users", func(t *testing.T) {
+		low := onFor(Flag{Name: "f", Enabled: true, Percentage: percentage(10)})
+		high := onFor(Flag{Name: "f", Enabled: true, Percentage: percentage(50)})
+		for i := range low {
+			if !high[i] {
+				t.Fatalf("user-%d lost the flag when the percentage was raised", i)
+			}
+		}
+		if len(high) <= len(low) {
+			t.Errorf("raising the percentage added no users: %d at 10%%, %d at 50%%", len(low), len(high))
+		}
+	})
+
+	t.Run("differs per flag", func(t *testing.T) {
+		a := onFor(Flag{Name: "a", Enabled: true, Percentage: percentage(50)})
+		b := onFor(Flag{Name: "b", Enabled: true, Percentage: percentage(50)})
+		same := 0
+		for i := 0; i < users; i++ {
+			if a[i] == b[i] {
+				same++
+			}
+		}
+		if same == users {
+			t.Error("two flags at the same percentage chose the same users")
+		}
+	})
+}
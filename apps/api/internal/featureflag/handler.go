@@ -0,0 +1,89 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"sanctor/internal/authctx"
+)
+
+// Resolver finds the subject flags are evaluated for from a signed-in
+// user's ID
+type Resolver func(ctx context.Context, userID string) Subject
+
+// SetResolver sets how signed-in users are turned into subjects. Without
+// one, only the user ID is known and university targeting never matches.
+func (s *Store) SetResolver(resolve Resolver) {
+	s.resolve = resolve
+}
+
+// SubjectFor returns the subject for the authenticated user in ctx. Anonymous
+// requests get an empty subject.
+func (s *Store) SubjectFor(ctx context.Context) Subject {
+	userID, ok := authctx.UserID(ctx)
+	if !ok {
+		return Subject{}
+	}
+	if s.resolve == nil {
+		return Subject{UserID: userID}
+	}
+	return s.resolve(ctx, userID)
+}
+
+// EnabledFor reports whether a flag is on for the authenticated user in ctx
+func (s *Store) EnabledFor(ctx context.Context, name string) bool {
+	return s.Enabled(name, s.SubjectFor(ctx))
+}
+
+// Require returns a middleware that answers 404 while the flag is off for
+// the caller, as if the route did not exist. It must run after
+// Authenticate for user and university targeting to apply.
+func (s *Store) Require(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" || s.EnabledFor(r.Context(), name) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		})
+	}
+}
+
+// Handler serves the admin view of the flags
+type Handler struct {
+	store *Store
+}
+
+// NewHandler creates a new feature flag handler
+func NewHandler(store *Store) *Handler {
+	return &Handler{store: store}
+}
+
+// GetFlags lists every flag and where it was loaded from. With ?userId=,
+// each flag also shows whether it is on for that user and why.
+func (h *Handler) GetFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var subject *Subject
+	if userID := r.URL.Query().Get("userId"); userID != "" {
+		resolved := Subject{UserID: userID}
+		if h.store.resolve != nil {
+			resolved = h.store.resolve(r.Context(), userID)
+		}
+		subject = &resolved
+	}
+
+	writeJSON(w, http.StatusOK, h.store.Status(subject))
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
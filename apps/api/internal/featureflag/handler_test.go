@@ -0,0 +1,54 @@
+package featureflag
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sanctor/internal/authctx"
+)
+
+func TestRequire(t *testing.T) {
+	store := NewStore(nil, "production", []Flag{
+		{Name: "off", Enabled: false},
+		{Name: "on", Enabled: true},
+		{Name: "tum", Enabled: true, Universities: []string{"tum"}},
+	})
+	store.SetResolver(func(ctx context.Context, userID string) Subject {
+		return Subject{UserID: userID, University: map[string]string{"student": "tum"}[userID]}
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		flag   string
+		method string
+		userID string
+		want   int
+	}{
+		{name: "on", flag: "on", method: "POST", want: http.StatusNoContent},
+		{name: "off", flag: "off", method: "POST", userID: "student", want: http.StatusNotFound},
+		{name: "unknown flag", flag: "missing", method: "POST", want: http.StatusNotFound},
+		{name: "preflight while off", flag: "off", method: "OPTIONS", want: http.StatusNoContent},
+		{name: "targeted user", flag: "tum", method: "POST", userID: "student", want: http.StatusNoContent},
+		{name: "other user", flag: "tum", method: "POST", userID: "someone", want: http.StatusNotFound},
+		{name: "anonymous", flag: "tum", method: "POST", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/feature", nil)
+			if tt.userID != "" {
+				req = req.WithContext(authctx.WithIdentity(req.Context(), &authctx.Identity{UserID: tt.userID}))
+			}
+			rec := httptest.NewRecorder()
+			store.Require(tt.flag)(next).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package featureflag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"sanctor/internal/database"
+)
+
+// Source loads flag definitions
+type Source interface {
+	Load(ctx context.Context) ([]Flag, error)
+	// String describes the source for logs and the admin endpoint
+	String() string
+}
+
+// FileSource reads flags from a YAML or JSON file of the form
+//
+//	flags:
+//	  - name: group_messaging
+//	    enabled: true
+//	    environments: [staging, production]
+//	    universities: [tum]
+//	    percentage: 10
+type FileSource struct {
+	path string
+}
+
+// NewFileSource creates a source reading the file at path
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Load reads the file
+func (s *FileSource) Load(ctx context.Context) ([]Flag, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Flags []Flag `yaml:"flags"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return file.Flags, nil
+}
+
+func (s *FileSource) String() string {
+	return "file " + s.path
+}
+
+// PostgresSource reads flags from the feature_flags table. Lists are
+// comma-separated; a NULL percentage means none.
+type PostgresSource struct {
+	db *database.DB
+}
+
+// NewPostgresSource creates a source reading the feature_flags table
+func NewPostgresSource(db *database.DB) *PostgresSource {
+	return &PostgresSource{db: db}
+}
+
+// Load reads every row of the table
+func (s *PostgresSource) Load(ctx context.Context) ([]Flag, error) {
+	ctx, cancel := s.db.ReadContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, description, enabled, environments, universities, percentage
+		FROM feature_flags
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []Flag
+	for rows.Next() {
+		var (
+			flag                       Flag
+			environments, universities string
+		)
+		if err := rows.Scan(&flag.Name, &flag.Description, &flag.Enabled, &environments, &universities, &flag.Percentage); err != nil {
+			return nil, err
+		}
+		flag.Environments = splitList(environments)
+		flag.Universities = splitList(universities)
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
+
+func (s *PostgresSource) String() string {
+	return "postgres table feature_flags"
+}
+
+// splitList splits a comma-separated column, dropping empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
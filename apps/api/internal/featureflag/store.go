@@ -0,0 +1,209 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store holds the current flags and reloads them from a source while the
+// API runs. Flags the source does not define keep their default.
+type Store struct {
+	source   Source // nil serves the defaults only
+	env      string
+	defaults map[string]Flag
+	resolve  Resolver
+
+	flags    map[string]Flag
+	fromSrc  map[string]bool // flags the source defines
+	loadedAt time.Time
+	loadErr  error
+	mu       sync.RWMutex
+
+	stopWatch context.CancelFunc // set while Watch runs; guarded by mu
+}
+
+// NewStore creates a store for the given environment. It serves the
+// defaults until Reload succeeds.
+func NewStore(source Source, env string, defaults []Flag) *Store {
+	s := &Store{
+		source:   source,
+		env:      env,
+		defaults: make(map[string]Flag, len(defaults)),
+	}
+	for _, flag := range defaults {
+		s.defaults[flag.Name] = flag
+	}
+	s.flags = s.merge(nil)
+	return s
+}
+
+// Reload reads the source. On failure the previous flags stay in effect.
+func (s *Store) Reload(ctx context.Context) error {
+	if s.source == nil {
+		return nil
+	}
+
+	loaded, err := s.source.Load(ctx)
+	if err == nil {
+		err = validate(loaded)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.loadErr = err
+		return err
+	}
+
+	flags := s.merge(loaded)
+	changed := !reflect.DeepEqual(flags, s.flags)
+	s.flags = flags
+	s.fromSrc = make(map[string]bool, len(loaded))
+	for _, flag := range loaded {
+		s.fromSrc[flag.Name] = true
+	}
+	s.loadedAt = time.Now()
+	s.loadErr = nil
+	if changed {
+		log.Printf("🚩 Loaded %d feature flags from %s", len(loaded), s.source)
+	}
+	return nil
+}
+
+// Watch reloads the flags every interval until Close. Failures are logged
+// once and keep the last good flags.
+func (s *Store) Watch(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.source == nil || s.stopWatch != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWatch = cancel
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		var lastErr string
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.Reload(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil && err.Error() != lastErr {
+					log.Printf("⚠️  Failed to reload feature flags from %s: %v", s.source, err)
+				}
+				lastErr = ""
+				if err != nil {
+					lastErr = err.Error()
+				}
+			}
+		}
+	}()
+}
+
+// Close stops watching the source, cancelling a reload in progress
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopWatch != nil {
+		s.stopWatch()
+		s.stopWatch = nil
+	}
+}
+
+// Enabled reports whether a flag is on for subject. Unknown flags are off.
+func (s *Store) Enabled(name string, subject Subject) bool {
+	s.mu.RLock()
+	flag, ok := s.flags[name]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	on, _ := flag.Evaluate(s.env, subject)
+	return on
+}
+
+// FlagState is a flag as the admin endpoint shows it
+type FlagState struct {
+	Flag
+	Default bool `json:"default"` // not defined by the source
+	// On and Reason are the result for the subject asked about, if any
+	On     *bool  `json:"on,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Status describes the store and its flags
+type Status struct {
+	Source      string      `json:"source"`
+	Environment string      `json:"environment"`
+	LoadedAt    *time.Time  `json:"loadedAt,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Flags       []FlagState `json:"flags"`
+}
+
+// Status returns every flag, sorted by name, evaluated for subject when it
+// is not nil
+func (s *Store) Status(subject *Subject) *Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := &Status{Source: "defaults", Environment: s.env, Flags: make([]FlagState, 0, len(s.flags))}
+	if s.source != nil {
+		status.Source = s.source.String()
+	}
+	if !s.loadedAt.IsZero() {
+		loadedAt := s.loadedAt
+		status.LoadedAt = &loadedAt
+	}
+	if s.loadErr != nil {
+		status.Error = s.loadErr.Error()
+	}
+
+	for _, flag := range s.flags {
+		state := FlagState{Flag: flag, Default: !s.fromSrc[flag.Name]}
+		if subject != nil {
+			on, reason := flag.Evaluate(s.env, *subject)
+			state.On, state.Reason = &on, reason
+		}
+		status.Flags = append(status.Flags, state)
+	}
+	sort.Slice(status.Flags, func(i, j int) bool { return status.Flags[i].Name < status.Flags[j].Name })
+	return status
+}
+
+// merge overlays loaded flags on the defaults
+func (s *Store) merge(loaded []Flag) map[string]Flag {
+	flags := make(map[string]Flag, len(s.defaults)+len(loaded))
+	for name, flag := range s.defaults {
+		flags[name] = flag
+	}
+	for _, flag := range loaded {
+		flags[flag.Name] = flag
+	}
+	return flags
+}
+
+// validate checks flags read from a source
+func validate(flags []Flag) error {
+	seen := make(map[string]bool, len(flags))
+	for i := range flags {
+		if err := flags[i].validate(); err != nil {
+			return err
+		}
+		if seen[flags[i].Name] {
+			return fmt.Errorf("flag %s is defined twice", flags[i].Name)
+		}
+		seen[flags[i].Name] = true
+	}
+	return nil
+}
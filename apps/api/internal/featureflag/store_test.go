@@ -0,0 +1,50 @@
+package featureflag
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSource serves a fixed flag and counts how often it is read
+type countingSource struct {
+	loads atomic.Int64
+}
+
+func (s *countingSource) Load(ctx context.Context) ([]Flag, error) {
+	s.loads.Add(1)
+	return []Flag{{Name: GroupMessaging}}, nil
+}
+
+func (s *countingSource) String() string {
+	return "counting source"
+}
+
+func TestWatchStopsOnClose(t *testing.T) {
+	source := &countingSource{}
+	store := NewStore(source, "test", Defaults)
+
+	store.Watch(time.Millisecond)
+	store.Watch(time.Millisecond) // a second call must not start another watcher
+	deadline := time.Now().Add(5 * time.Second)
+	for source.loads.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("the source was never reloaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if store.Enabled(GroupMessaging, Subject{}) {
+		t.Error("the flag from the source was not applied")
+	}
+
+	store.Close()
+	store.Close()
+	// A reload that had already started may still finish
+	time.Sleep(10 * time.Millisecond)
+	stopped := source.loads.Load()
+	time.Sleep(20 * time.Millisecond)
+	if loads := source.loads.Load(); loads != stopped {
+		t.Errorf("the source was read %d more times after Close", loads-stopped)
+	}
+}
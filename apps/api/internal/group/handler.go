@@ -5,27 +5,22 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
-	"sanctor/internal/database"
-	"sanctor/internal/pubsub"
+	"sanctor/internal/authctx"
 )
 
-// Initialize repository, service, and messaging (defaults to in-memory)
-var (
-	repo      Repository = NewRepository()
-	service              = NewService(repo)
-	ps                   = pubsub.NewPubSub()
-	messaging            = NewMessaging(ps, service)
-)
+// Handler handles HTTP requests for groups and group messaging
+type Handler struct {
+	service   *Service
+	messaging *Messaging
+}
 
-// InitWithDatabase initializes the group module with a database connection
-func InitWithDatabase(db *database.DB) {
-	repo = NewPostgresRepository(db)
-	service = NewService(repo)
-	messaging = NewMessaging(ps, service)
+// NewHandler creates a new group handler
+func NewHandler(service *Service, messaging *Messaging) *Handler {
+	return &Handler{service: service, messaging: messaging}
 }
 
 // GetGroups returns all groups
-func GetGroups(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetGroups(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -34,7 +29,7 @@ func GetGroups(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	groups, err := service.GetAllGroups()
+	groups, err := h.service.GetAllGroups(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -44,7 +39,7 @@ func GetGroups(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetGroup returns a single group by ID
-func GetGroup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -59,7 +54,7 @@ func GetGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	group, err := service.GetGroupWithMembers(id)
+	group, err := h.service.GetGroupWithMembers(r.Context(), id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -69,7 +64,7 @@ func GetGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 // CreateGroup creates a new group
-func CreateGroup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -83,13 +78,19 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	var req CreateGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	group, err := service.CreateGroup(req)
+	group, err := h.service.CreateGroup(r.Context(), actorID, req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -100,7 +101,7 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateGroup updates an existing group
-func UpdateGroup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -114,6 +115,12 @@ func UpdateGroup(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Group ID is required", http.StatusBadRequest)
@@ -126,20 +133,20 @@ func UpdateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	group, err := service.UpdateGroup(id, req)
+	group, err := h.service.UpdateGroup(r.Context(), actorID, id, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), errorStatus(err, http.StatusNotFound))
 		return
 	}
 
 	// Notify group members of the update
-	messaging.NotifyGroupUpdated(group)
+	h.messaging.NotifyGroupUpdated(group)
 
 	json.NewEncoder(w).Encode(group)
 }
 
 // DeleteGroup deletes a group
-func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -151,25 +158,31 @@ func DeleteGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Group ID is required", http.StatusBadRequest)
 		return
 	}
 
-	if err := service.DeleteGroup(id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err := h.service.DeleteGroup(r.Context(), actorID, id); err != nil {
+		http.Error(w, err.Error(), errorStatus(err, http.StatusNotFound))
 		return
 	}
 
 	// Notify that group was deleted
-	messaging.NotifyGroupDeleted(id)
+	h.messaging.NotifyGroupDeleted(id)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // AddUserToGroup adds a user to a group
-func AddUserToGroup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AddUserToGroup(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -183,26 +196,32 @@ func AddUserToGroup(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	var req AddUserToGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := service.AddUserToGroup(req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.service.AddUserToGroup(r.Context(), actorID, req); err != nil {
+		http.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
 		return
 	}
 
 	// Notify group members
-	messaging.NotifyUserJoined(req.GroupID, req.UserID)
+	h.messaging.NotifyUserJoined(req.GroupID, req.UserID)
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "User added to group successfully"})
 }
 
 // RemoveUserFromGroup removes a user from a group
-func RemoveUserFromGroup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RemoveUserFromGroup(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -214,27 +233,37 @@ func RemoveUserFromGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	// userId defaults to the caller, i.e. leaving the group
 	userID := r.URL.Query().Get("userId")
+	if userID == "" {
+		userID = actorID
+	}
 	groupID := r.URL.Query().Get("groupId")
 
-	if userID == "" || groupID == "" {
-		http.Error(w, "User ID and Group ID are required", http.StatusBadRequest)
+	if groupID == "" {
+		http.Error(w, "Group ID is required", http.StatusBadRequest)
 		return
 	}
 
-	if err := service.RemoveUserFromGroup(userID, groupID); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.service.RemoveUserFromGroup(r.Context(), actorID, userID, groupID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
 		return
 	}
 
 	// Notify group members
-	messaging.NotifyUserLeft(groupID, userID)
+	h.messaging.NotifyUserLeft(groupID, userID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetGroupMembers returns all members of a group
-func GetGroupMembers(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetGroupMembers(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -249,7 +278,7 @@ func GetGroupMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	members, err := service.GetGroupMembers(groupID)
+	members, err := h.service.GetGroupMembers(r.Context(), groupID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -259,7 +288,7 @@ func GetGroupMembers(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUserGroups returns all groups a user belongs to
-func GetUserGroups(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -274,7 +303,7 @@ func GetUserGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	groups, err := service.GetUserGroups(userID)
+	groups, err := h.service.GetUserGroups(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -284,7 +313,7 @@ func GetUserGroups(w http.ResponseWriter, r *http.Request) {
 }
 
 // SendGroupMessage sends a message to a group
-func SendGroupMessage(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) SendGroupMessage(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -298,9 +327,14 @@ func SendGroupMessage(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
+	actorID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
 		GroupID string `json:"groupId"`
-		UserID  string `json:"userId"`
 		Content string `json:"content"`
 		Type    string `json:"type,omitempty"` // defaults to "text"
 	}
@@ -310,8 +344,8 @@ func SendGroupMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.GroupID == "" || req.UserID == "" || req.Content == "" {
-		http.Error(w, "groupId, userId, and content are required", http.StatusBadRequest)
+	if req.GroupID == "" || req.Content == "" {
+		http.Error(w, "groupId and content are required", http.StatusBadRequest)
 		return
 	}
 
@@ -324,12 +358,12 @@ func SendGroupMessage(w http.ResponseWriter, r *http.Request) {
 	msg := &Message{
 		ID:      uuid.New().String(),
 		GroupID: req.GroupID,
-		UserID:  req.UserID,
+		UserID:  actorID,
 		Content: req.Content,
 		Type:    msgType,
 	}
 
-	if err := messaging.SendMessage(msg); err != nil {
+	if err := h.messaging.SendMessage(r.Context(), msg); err != nil {
 		if err == ErrNotMember {
 			http.Error(w, err.Error(), http.StatusForbidden)
 		} else {
@@ -342,6 +376,18 @@ func SendGroupMessage(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(msg)
 }
 
+// errorStatus maps service errors to HTTP status codes, falling back to the given default
+func errorStatus(err error, fallback int) int {
+	switch err {
+	case ErrUnauthorized, ErrNotMember:
+		return http.StatusForbidden
+	case ErrGroupNotFound:
+		return http.StatusNotFound
+	default:
+		return fallback
+	}
+}
+
 func enableCORS(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
 	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -1,6 +1,7 @@
 package group
 
 import (
+	"context"
 	"sanctor/internal/pubsub"
 	"time"
 )
@@ -39,9 +40,9 @@ func NewMessaging(ps *pubsub.PubSub, svc *Service) *Messaging {
 }
 
 // SendMessage sends a message to a group
-func (m *Messaging) SendMessage(msg *Message) error {
+func (m *Messaging) SendMessage(ctx context.Context, msg *Message) error {
 	// Verify user is in group
-	if !m.service.IsUserInGroup(msg.UserID, msg.GroupID) {
+	if !m.service.IsUserInGroup(ctx, msg.UserID, msg.GroupID) {
 		return ErrNotMember
 	}
 
@@ -23,12 +23,12 @@ type UserGroup struct {
 	JoinedAt  time.Time `json:"joinedAt" gorm:"autoCreateTime"`
 }
 
-// CreateGroupRequest represents the data needed to create a new group
+// CreateGroupRequest represents the data needed to create a new group.
+// The creator is always the authenticated user.
 type CreateGroupRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description,omitempty"`
 	IsPrivate   bool   `json:"isPrivate"`
-	CreatedBy   string `json:"createdBy"` // User ID
 }
 
 // UpdateGroupRequest represents the data that can be updated
@@ -1,11 +1,16 @@
 package group
 
 import (
+	"context"
 	"errors"
 	"sync"
+
+	"sanctor/internal/database"
 )
 
-// InMemoryRepository handles data access for groups in memory
+// InMemoryRepository handles data access for groups in memory. Like the
+// database, it stores and hands out copies, so a change only takes effect
+// once it is saved and can be undone if a unit of work fails.
 type InMemoryRepository struct {
 	groups      map[string]*Group      // groupID -> Group
 	userGroups  map[string][]*UserGroup // userID -> []UserGroup
@@ -23,16 +28,21 @@ func NewRepository() Repository {
 }
 
 // Create creates a new group
-func (r *InMemoryRepository) Create(group *Group) error {
+func (r *InMemoryRepository) Create(ctx context.Context, group *Group) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.groups[group.ID] = group
+	r.groups[group.ID] = cloneGroup(group)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.groups, group.ID)
+	})
 	return nil
 }
 
 // FindByID finds a group by ID
-func (r *InMemoryRepository) FindByID(id string) (*Group, error) {
+func (r *InMemoryRepository) FindByID(ctx context.Context, id string) (*Group, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -40,64 +50,68 @@ func (r *InMemoryRepository) FindByID(id string) (*Group, error) {
 	if !exists {
 		return nil, errors.New("group not found")
 	}
-	return group, nil
+	return cloneGroup(group), nil
 }
 
 // FindAll returns all groups
-func (r *InMemoryRepository) FindAll() []*Group {
+func (r *InMemoryRepository) FindAll(ctx context.Context) ([]*Group, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	groups := make([]*Group, 0, len(r.groups))
 	for _, group := range r.groups {
-		groups = append(groups, group)
+		groups = append(groups, cloneGroup(group))
 	}
-	return groups
+	return groups, nil
 }
 
 // Update updates an existing group
-func (r *InMemoryRepository) Update(group *Group) error {
+func (r *InMemoryRepository) Update(ctx context.Context, group *Group) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if _, exists := r.groups[group.ID]; !exists {
 		return errors.New("group not found")
 	}
-	r.groups[group.ID] = group
+	r.groups[group.ID] = cloneGroup(group)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.groups, group.ID)
+	})
 	return nil
 }
 
 // Delete deletes a group and its memberships
-func (r *InMemoryRepository) Delete(id string) error {
+func (r *InMemoryRepository) Delete(ctx context.Context, id string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.groups[id]; !exists {
+	group, exists := r.groups[id]
+	if !exists {
 		return errors.New("group not found")
 	}
 
-	// Remove group
-	delete(r.groups, id)
-
-	// Remove all memberships for this group
+	members := r.groupUsers[id]
+	for _, ug := range members {
+		r.removeMembership(ug.UserID, id)
+	}
 	delete(r.groupUsers, id)
+	delete(r.groups, id)
 
-	// Remove from user's group lists
-	for userID, userGroupsList := range r.userGroups {
-		newList := make([]*UserGroup, 0)
-		for _, ug := range userGroupsList {
-			if ug.GroupID != id {
-				newList = append(newList, ug)
-			}
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.groups[id] = group
+		for _, ug := range members {
+			r.addMembership(ug)
 		}
-		r.userGroups[userID] = newList
-	}
-
+	})
 	return nil
 }
 
 // AddUserToGroup adds a user to a group
-func (r *InMemoryRepository) AddUserToGroup(userGroup *UserGroup) error {
+func (r *InMemoryRepository) AddUserToGroup(ctx context.Context, userGroup *UserGroup) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -111,17 +125,18 @@ func (r *InMemoryRepository) AddUserToGroup(userGroup *UserGroup) error {
 		return errors.New("user already in group")
 	}
 
-	// Add to groupUsers
-	r.groupUsers[userGroup.GroupID] = append(r.groupUsers[userGroup.GroupID], userGroup)
-
-	// Add to userGroups
-	r.userGroups[userGroup.UserID] = append(r.userGroups[userGroup.UserID], userGroup)
-
+	stored := *userGroup
+	r.addMembership(&stored)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.removeMembership(stored.UserID, stored.GroupID)
+	})
 	return nil
 }
 
 // RemoveUserFromGroup removes a user from a group
-func (r *InMemoryRepository) RemoveUserFromGroup(userID, groupID string) error {
+func (r *InMemoryRepository) RemoveUserFromGroup(ctx context.Context, userID, groupID string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -129,16 +144,36 @@ func (r *InMemoryRepository) RemoveUserFromGroup(userID, groupID string) error {
 		return errors.New("user not in group")
 	}
 
-	// Remove from groupUsers
+	removed := r.removeMembership(userID, groupID)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.addMembership(removed)
+	})
+	return nil
+}
+
+// addMembership indexes a membership by group and by user (internal, no lock)
+func (r *InMemoryRepository) addMembership(userGroup *UserGroup) {
+	r.groupUsers[userGroup.GroupID] = append(r.groupUsers[userGroup.GroupID], userGroup)
+	r.userGroups[userGroup.UserID] = append(r.userGroups[userGroup.UserID], userGroup)
+}
+
+// removeMembership drops a membership from both indexes and returns it
+// (internal, no lock)
+func (r *InMemoryRepository) removeMembership(userID, groupID string) *UserGroup {
+	var removed *UserGroup
+
 	newGroupUsers := make([]*UserGroup, 0)
 	for _, ug := range r.groupUsers[groupID] {
 		if ug.UserID != userID {
 			newGroupUsers = append(newGroupUsers, ug)
+		} else {
+			removed = ug
 		}
 	}
 	r.groupUsers[groupID] = newGroupUsers
 
-	// Remove from userGroups
 	newUserGroups := make([]*UserGroup, 0)
 	for _, ug := range r.userGroups[userID] {
 		if ug.GroupID != groupID {
@@ -147,11 +182,11 @@ func (r *InMemoryRepository) RemoveUserFromGroup(userID, groupID string) error {
 	}
 	r.userGroups[userID] = newUserGroups
 
-	return nil
+	return removed
 }
 
 // GetGroupMembers returns all users in a group
-func (r *InMemoryRepository) GetGroupMembers(groupID string) ([]*UserGroup, error) {
+func (r *InMemoryRepository) GetGroupMembers(ctx context.Context, groupID string) ([]*UserGroup, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -159,19 +194,19 @@ func (r *InMemoryRepository) GetGroupMembers(groupID string) ([]*UserGroup, erro
 		return nil, errors.New("group not found")
 	}
 
-	return r.groupUsers[groupID], nil
+	return cloneMemberships(r.groupUsers[groupID]), nil
 }
 
 // GetUserGroups returns all groups a user belongs to
-func (r *InMemoryRepository) GetUserGroups(userID string) []*UserGroup {
+func (r *InMemoryRepository) GetUserGroups(ctx context.Context, userID string) ([]*UserGroup, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	return r.userGroups[userID]
+	return cloneMemberships(r.userGroups[userID]), nil
 }
 
 // IsUserInGroup checks if a user is in a group (exported version)
-func (r *InMemoryRepository) IsUserInGroup(userID, groupID string) bool {
+func (r *InMemoryRepository) IsUserInGroup(ctx context.Context, userID, groupID string) bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return r.isUserInGroup(userID, groupID)
@@ -188,14 +223,14 @@ func (r *InMemoryRepository) isUserInGroup(userID, groupID string) bool {
 }
 
 // GetMemberCount returns the number of members in a group
-func (r *InMemoryRepository) GetMemberCount(groupID string) int {
+func (r *InMemoryRepository) GetMemberCount(ctx context.Context, groupID string) int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return len(r.groupUsers[groupID])
 }
 
 // GetUserRole returns the role of a user in a group
-func (r *InMemoryRepository) GetUserRole(userID, groupID string) (string, error) {
+func (r *InMemoryRepository) GetUserRole(ctx context.Context, userID, groupID string) (string, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -206,3 +241,19 @@ func (r *InMemoryRepository) GetUserRole(userID, groupID string) (string, error)
 	}
 	return "", errors.New("user not in group")
 }
+
+// cloneGroup copies a group so callers cannot change the stored record
+func cloneGroup(group *Group) *Group {
+	c := *group
+	return &c
+}
+
+// cloneMemberships copies a list of memberships
+func cloneMemberships(userGroups []*UserGroup) []*UserGroup {
+	clones := make([]*UserGroup, len(userGroups))
+	for i, ug := range userGroups {
+		c := *ug
+		clones[i] = &c
+	}
+	return clones
+}
@@ -1,17 +1,20 @@
 package group
 
-// Repository defines the interface for group data access
+import "context"
+
+// Repository defines the interface for group data access. Calls made with
+// the context of a unit of work take part in it.
 type Repository interface {
-	Create(group *Group) error
-	FindByID(id string) (*Group, error)
-	FindAll() []*Group
-	Update(group *Group) error
-	Delete(id string) error
-	AddUserToGroup(userGroup *UserGroup) error
-	RemoveUserFromGroup(userID, groupID string) error
-	GetGroupMembers(groupID string) ([]*UserGroup, error)
-	GetUserGroups(userID string) []*UserGroup
-	IsUserInGroup(userID, groupID string) bool
-	GetMemberCount(groupID string) int
-	GetUserRole(userID, groupID string) (string, error)
+	Create(ctx context.Context, group *Group) error
+	FindByID(ctx context.Context, id string) (*Group, error)
+	FindAll(ctx context.Context) ([]*Group, error)
+	Update(ctx context.Context, group *Group) error
+	Delete(ctx context.Context, id string) error
+	AddUserToGroup(ctx context.Context, userGroup *UserGroup) error
+	RemoveUserFromGroup(ctx context.Context, userID, groupID string) error
+	GetGroupMembers(ctx context.Context, groupID string) ([]*UserGroup, error)
+	GetUserGroups(ctx context.Context, userID string) ([]*UserGroup, error)
+	IsUserInGroup(ctx context.Context, userID, groupID string) bool
+	GetMemberCount(ctx context.Context, groupID string) int
+	GetUserRole(ctx context.Context, userID, groupID string) (string, error)
 }
@@ -1,6 +1,7 @@
 package group
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 
@@ -18,23 +19,29 @@ func NewPostgresRepository(db *database.DB) Repository {
 }
 
 // Create creates a new group
-func (r *PostgresRepository) Create(group *Group) error {
+func (r *PostgresRepository) Create(ctx context.Context, group *Group) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO groups (id, name, description, is_private, created_by, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	_, err := r.db.Exec(query, group.ID, group.Name, group.Description, group.IsPrivate,
+	_, err := r.db.ExecContext(ctx, query, group.ID, group.Name, group.Description, group.IsPrivate,
 		group.CreatedBy, group.CreatedAt, group.UpdatedAt)
 	return err
 }
 
 // FindByID finds a group by ID
-func (r *PostgresRepository) FindByID(id string) (*Group, error) {
+func (r *PostgresRepository) FindByID(ctx context.Context, id string) (*Group, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	group := &Group{}
 	query := `SELECT id, name, description, is_private, created_by, created_at, updated_at 
 	          FROM groups WHERE id = $1`
 	
-	err := r.db.QueryRow(query, id).Scan(&group.ID, &group.Name, &group.Description,
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&group.ID, &group.Name, &group.Description,
 		&group.IsPrivate, &group.CreatedBy, &group.CreatedAt, &group.UpdatedAt)
 	
 	if err == sql.ErrNoRows {
@@ -44,13 +51,16 @@ func (r *PostgresRepository) FindByID(id string) (*Group, error) {
 }
 
 // FindAll returns all groups
-func (r *PostgresRepository) FindAll() []*Group {
+func (r *PostgresRepository) FindAll(ctx context.Context) ([]*Group, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	query := `SELECT id, name, description, is_private, created_by, created_at, updated_at 
 	          FROM groups ORDER BY created_at DESC`
 	
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
-		return []*Group{}
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -58,19 +68,23 @@ func (r *PostgresRepository) FindAll() []*Group {
 	for rows.Next() {
 		group := &Group{}
 		if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.IsPrivate,
-			&group.CreatedBy, &group.CreatedAt, &group.UpdatedAt); err == nil {
-			groups = append(groups, group)
+			&group.CreatedBy, &group.CreatedAt, &group.UpdatedAt); err != nil {
+			return nil, err
 		}
+		groups = append(groups, group)
 	}
-	return groups
+	return groups, rows.Err()
 }
 
 // Update updates an existing group
-func (r *PostgresRepository) Update(group *Group) error {
+func (r *PostgresRepository) Update(ctx context.Context, group *Group) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
 	query := `UPDATE groups SET name = $2, description = $3, is_private = $4, updated_at = $5 
 	          WHERE id = $1`
 	
-	result, err := r.db.Exec(query, group.ID, group.Name, group.Description, 
+	result, err := r.db.ExecContext(ctx, query, group.ID, group.Name, group.Description, 
 		group.IsPrivate, group.UpdatedAt)
 	if err != nil {
 		return err
@@ -83,35 +97,46 @@ func (r *PostgresRepository) Update(group *Group) error {
 	return nil
 }
 
-// Delete deletes a group (CASCADE will delete user_groups automatically)
-func (r *PostgresRepository) Delete(id string) error {
-	query := `DELETE FROM groups WHERE id = $1`
-	result, err := r.db.Exec(query, id)
-	if err != nil {
-		return err
-	}
+// Delete deletes a group and its memberships
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	return r.db.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := r.db.ExecContext(ctx, `DELETE FROM user_groups WHERE group_id = $1`, id); err != nil {
+			return err
+		}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return errors.New("group not found")
-	}
-	return nil
+		result, err := r.db.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+
+		rows, _ := result.RowsAffected()
+		if rows == 0 {
+			return errors.New("group not found")
+		}
+		return nil
+	})
 }
 
 // AddUserToGroup adds a user to a group
-func (r *PostgresRepository) AddUserToGroup(userGroup *UserGroup) error {
+func (r *PostgresRepository) AddUserToGroup(ctx context.Context, userGroup *UserGroup) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
 	query := `INSERT INTO user_groups (user_id, group_id, role, joined_at) 
 	          VALUES ($1, $2, $3, $4)`
 	
-	_, err := r.db.Exec(query, userGroup.UserID, userGroup.GroupID, 
+	_, err := r.db.ExecContext(ctx, query, userGroup.UserID, userGroup.GroupID, 
 		userGroup.Role, userGroup.JoinedAt)
 	return err
 }
 
 // RemoveUserFromGroup removes a user from a group
-func (r *PostgresRepository) RemoveUserFromGroup(userID, groupID string) error {
+func (r *PostgresRepository) RemoveUserFromGroup(ctx context.Context, userID, groupID string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
 	query := `DELETE FROM user_groups WHERE user_id = $1 AND group_id = $2`
-	result, err := r.db.Exec(query, userID, groupID)
+	result, err := r.db.ExecContext(ctx, query, userID, groupID)
 	if err != nil {
 		return err
 	}
@@ -124,11 +149,14 @@ func (r *PostgresRepository) RemoveUserFromGroup(userID, groupID string) error {
 }
 
 // GetGroupMembers returns all members of a group
-func (r *PostgresRepository) GetGroupMembers(groupID string) ([]*UserGroup, error) {
+func (r *PostgresRepository) GetGroupMembers(ctx context.Context, groupID string) ([]*UserGroup, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	query := `SELECT user_id, group_id, role, joined_at 
 	          FROM user_groups WHERE group_id = $1 ORDER BY joined_at`
 	
-	rows, err := r.db.Query(query, groupID)
+	rows, err := r.db.QueryContext(ctx, query, groupID)
 	if err != nil {
 		return nil, err
 	}
@@ -145,48 +173,61 @@ func (r *PostgresRepository) GetGroupMembers(groupID string) ([]*UserGroup, erro
 }
 
 // GetUserGroups returns all groups a user belongs to
-func (r *PostgresRepository) GetUserGroups(userID string) []*UserGroup {
+func (r *PostgresRepository) GetUserGroups(ctx context.Context, userID string) ([]*UserGroup, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	query := `SELECT user_id, group_id, role, joined_at 
 	          FROM user_groups WHERE user_id = $1 ORDER BY joined_at DESC`
 	
-	rows, err := r.db.Query(query, userID)
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
-		return []*UserGroup{}
+		return nil, err
 	}
 	defer rows.Close()
 
 	userGroups := []*UserGroup{}
 	for rows.Next() {
 		ug := &UserGroup{}
-		if err := rows.Scan(&ug.UserID, &ug.GroupID, &ug.Role, &ug.JoinedAt); err == nil {
-			userGroups = append(userGroups, ug)
+		if err := rows.Scan(&ug.UserID, &ug.GroupID, &ug.Role, &ug.JoinedAt); err != nil {
+			return nil, err
 		}
+		userGroups = append(userGroups, ug)
 	}
-	return userGroups
+	return userGroups, rows.Err()
 }
 
 // IsUserInGroup checks if a user is in a group
-func (r *PostgresRepository) IsUserInGroup(userID, groupID string) bool {
+func (r *PostgresRepository) IsUserInGroup(ctx context.Context, userID, groupID string) bool {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM user_groups WHERE user_id = $1 AND group_id = $2)`
-	_ = r.db.QueryRow(query, userID, groupID).Scan(&exists)
+	_ = r.db.QueryRowContext(ctx, query, userID, groupID).Scan(&exists)
 	return exists
 }
 
 // GetMemberCount returns the number of members in a group
-func (r *PostgresRepository) GetMemberCount(groupID string) int {
+func (r *PostgresRepository) GetMemberCount(ctx context.Context, groupID string) int {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var count int
 	query := `SELECT COUNT(*) FROM user_groups WHERE group_id = $1`
-	_ = r.db.QueryRow(query, groupID).Scan(&count)
+	_ = r.db.QueryRowContext(ctx, query, groupID).Scan(&count)
 	return count
 }
 
 // GetUserRole returns the role of a user in a group
-func (r *PostgresRepository) GetUserRole(userID, groupID string) (string, error) {
+func (r *PostgresRepository) GetUserRole(ctx context.Context, userID, groupID string) (string, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var role string
 	query := `SELECT role FROM user_groups WHERE user_id = $1 AND group_id = $2`
 	
-	err := r.db.QueryRow(query, userID, groupID).Scan(&role)
+	err := r.db.QueryRowContext(ctx, query, userID, groupID).Scan(&role)
 	if err == sql.ErrNoRows {
 		return "", errors.New("user not in group")
 	}
@@ -1,30 +1,34 @@
 package group
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"sanctor/internal/database"
 )
 
 // Service handles business logic for group operations
 type Service struct {
 	repo Repository
+	tx   database.Transactor
 }
 
-// NewService creates a new group service
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+// NewService creates a new group service. Multi-step changes run as units
+// of work on tx, which must match the repository's storage.
+func NewService(repo Repository, tx database.Transactor) *Service {
+	return &Service{repo: repo, tx: tx}
 }
 
-// CreateGroup creates a new group with validation
-func (s *Service) CreateGroup(req CreateGroupRequest) (*Group, error) {
+// CreateGroup creates a new group with validation. The creator becomes its owner.
+func (s *Service) CreateGroup(ctx context.Context, creatorID string, req CreateGroupRequest) (*Group, error) {
 	// Validate input
 	if req.Name == "" {
 		return nil, errors.New("group name is required")
 	}
 
-	if req.CreatedBy == "" {
+	if creatorID == "" {
 		return nil, errors.New("creator user ID is required")
 	}
 
@@ -34,49 +38,53 @@ func (s *Service) CreateGroup(req CreateGroupRequest) (*Group, error) {
 		Name:        req.Name,
 		Description: req.Description,
 		IsPrivate:   req.IsPrivate,
-		CreatedBy:   req.CreatedBy,
+		CreatedBy:   creatorID,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := s.repo.Create(group); err != nil {
-		return nil, err
-	}
-
-	// Automatically add creator as owner
-	userGroup := &UserGroup{
-		UserID:   req.CreatedBy,
-		GroupID:  group.ID,
-		Role:     "owner",
-		JoinedAt: time.Now(),
-	}
+	// The creator becomes the owner in the same unit of work, so a group is
+	// never left without one
+	err := s.tx.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, group); err != nil {
+			return err
+		}
 
-	if err := s.repo.AddUserToGroup(userGroup); err != nil {
-		// Rollback: delete the group if adding creator fails
-		s.repo.Delete(group.ID)
-		return nil, errors.New("failed to add creator to group")
+		userGroup := &UserGroup{
+			UserID:   creatorID,
+			GroupID:  group.ID,
+			Role:     "owner",
+			JoinedAt: time.Now(),
+		}
+		if err := s.repo.AddUserToGroup(ctx, userGroup); err != nil {
+			return errors.New("failed to add creator to group")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return group, nil
 }
 
 // GetGroup retrieves a group by ID
-func (s *Service) GetGroup(id string) (*Group, error) {
+func (s *Service) GetGroup(ctx context.Context, id string) (*Group, error) {
 	if id == "" {
 		return nil, errors.New("group ID is required")
 	}
 
-	return s.repo.FindByID(id)
+	return s.repo.FindByID(ctx, id)
 }
 
 // GetGroupWithMembers retrieves a group with member count
-func (s *Service) GetGroupWithMembers(id string) (*GroupWithMembers, error) {
-	group, err := s.repo.FindByID(id)
+func (s *Service) GetGroupWithMembers(ctx context.Context, id string) (*GroupWithMembers, error) {
+	group, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	memberCount := s.repo.GetMemberCount(id)
+	memberCount := s.repo.GetMemberCount(ctx, id)
 
 	return &GroupWithMembers{
 		Group:       group,
@@ -85,15 +93,19 @@ func (s *Service) GetGroupWithMembers(id string) (*GroupWithMembers, error) {
 }
 
 // GetAllGroups retrieves all groups
-func (s *Service) GetAllGroups() ([]*Group, error) {
-	return s.repo.FindAll(), nil
+func (s *Service) GetAllGroups(ctx context.Context) ([]*Group, error) {
+	return s.repo.FindAll(ctx)
 }
 
-// UpdateGroup updates an existing group
-func (s *Service) UpdateGroup(id string, req UpdateGroupRequest) (*Group, error) {
-	group, err := s.repo.FindByID(id)
+// UpdateGroup updates an existing group. Only owners and admins may update it.
+func (s *Service) UpdateGroup(ctx context.Context, actorID, id string, req UpdateGroupRequest) (*Group, error) {
+	group, err := s.repo.FindByID(ctx, id)
 	if err != nil {
-		return nil, errors.New("group not found")
+		return nil, ErrGroupNotFound
+	}
+
+	if err := s.requireRole(ctx, actorID, id, "owner", "admin"); err != nil {
+		return nil, err
 	}
 
 	// Update fields if provided
@@ -108,31 +120,55 @@ func (s *Service) UpdateGroup(id string, req UpdateGroupRequest) (*Group, error)
 	}
 	group.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(group); err != nil {
+	if err := s.repo.Update(ctx, group); err != nil {
 		return nil, err
 	}
 
 	return group, nil
 }
 
-// DeleteGroup deletes a group by ID
-func (s *Service) DeleteGroup(id string) error {
+// DeleteGroup deletes a group by ID. Only the owner may delete it.
+func (s *Service) DeleteGroup(ctx context.Context, actorID, id string) error {
 	if id == "" {
 		return errors.New("group ID is required")
 	}
 
-	return s.repo.Delete(id)
+	if _, err := s.repo.FindByID(ctx, id); err != nil {
+		return ErrGroupNotFound
+	}
+
+	if err := s.requireRole(ctx, actorID, id, "owner"); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, id)
 }
 
-// AddUserToGroup adds a user to a group
-func (s *Service) AddUserToGroup(req AddUserToGroupRequest) error {
+// RemoveGroup deletes any group regardless of its members' roles, for moderation
+func (s *Service) RemoveGroup(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("group ID is required")
+	}
+
+	if _, err := s.repo.FindByID(ctx, id); err != nil {
+		return ErrGroupNotFound
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+// AddUserToGroup adds a user to a group. Anyone may join a public group as a
+// member; every other addition needs an owner or admin, and only owners may
+// hand out the owner role.
+func (s *Service) AddUserToGroup(ctx context.Context, actorID string, req AddUserToGroupRequest) error {
 	if req.UserID == "" || req.GroupID == "" {
 		return errors.New("user ID and group ID are required")
 	}
 
 	// Validate group exists
-	if _, err := s.repo.FindByID(req.GroupID); err != nil {
-		return errors.New("group not found")
+	group, err := s.repo.FindByID(ctx, req.GroupID)
+	if err != nil {
+		return ErrGroupNotFound
 	}
 
 	// Default role to "member"
@@ -143,7 +179,18 @@ func (s *Service) AddUserToGroup(req AddUserToGroupRequest) error {
 
 	// Validate role
 	if role != "member" && role != "admin" && role != "owner" {
-		return errors.New("invalid role: must be member, admin, or owner")
+		return ErrInvalidRole
+	}
+
+	selfJoin := actorID == req.UserID && !group.IsPrivate && role == "member"
+	if !selfJoin {
+		allowed := []string{"owner", "admin"}
+		if role == "owner" {
+			allowed = []string{"owner"}
+		}
+		if err := s.requireRole(ctx, actorID, req.GroupID, allowed...); err != nil {
+			return err
+		}
 	}
 
 	userGroup := &UserGroup{
@@ -153,39 +200,50 @@ func (s *Service) AddUserToGroup(req AddUserToGroupRequest) error {
 		JoinedAt: time.Now(),
 	}
 
-	return s.repo.AddUserToGroup(userGroup)
+	return s.repo.AddUserToGroup(ctx, userGroup)
 }
 
-// RemoveUserFromGroup removes a user from a group
-func (s *Service) RemoveUserFromGroup(userID, groupID string) error {
+// RemoveUserFromGroup removes a user from a group. Members may leave on
+// their own; removing someone else needs an owner or admin, and nobody can
+// remove the owner.
+func (s *Service) RemoveUserFromGroup(ctx context.Context, actorID, userID, groupID string) error {
 	if userID == "" || groupID == "" {
 		return errors.New("user ID and group ID are required")
 	}
 
 	// Check if user is the owner
-	role, err := s.repo.GetUserRole(userID, groupID)
+	role, err := s.repo.GetUserRole(ctx, userID, groupID)
 	if err != nil {
 		return err
 	}
 
+	if actorID != userID {
+		if role == "owner" {
+			return ErrUnauthorized
+		}
+		if err := s.requireRole(ctx, actorID, groupID, "owner", "admin"); err != nil {
+			return err
+		}
+	}
+
 	if role == "owner" {
 		// Check if there are other members
-		members, _ := s.repo.GetGroupMembers(groupID)
+		members, _ := s.repo.GetGroupMembers(ctx, groupID)
 		if len(members) > 1 {
 			return errors.New("owner cannot leave group with other members. Transfer ownership first or delete the group")
 		}
 	}
 
-	return s.repo.RemoveUserFromGroup(userID, groupID)
+	return s.repo.RemoveUserFromGroup(ctx, userID, groupID)
 }
 
 // GetGroupMembers returns all members of a group
-func (s *Service) GetGroupMembers(groupID string) ([]*UserGroupInfo, error) {
+func (s *Service) GetGroupMembers(ctx context.Context, groupID string) ([]*UserGroupInfo, error) {
 	if groupID == "" {
 		return nil, errors.New("group ID is required")
 	}
 
-	userGroups, err := s.repo.GetGroupMembers(groupID)
+	userGroups, err := s.repo.GetGroupMembers(ctx, groupID)
 	if err != nil {
 		return nil, err
 	}
@@ -203,20 +261,109 @@ func (s *Service) GetGroupMembers(groupID string) ([]*UserGroupInfo, error) {
 }
 
 // GetUserGroups returns all groups a user belongs to
-func (s *Service) GetUserGroups(userID string) ([]*UserGroup, error) {
+func (s *Service) GetUserGroups(ctx context.Context, userID string) ([]*UserGroup, error) {
 	if userID == "" {
 		return nil, errors.New("user ID is required")
 	}
 
-	return s.repo.GetUserGroups(userID), nil
+	return s.repo.GetUserGroups(ctx, userID)
 }
 
 // IsUserInGroup checks if a user is a member of a group
-func (s *Service) IsUserInGroup(userID, groupID string) bool {
-	return s.repo.IsUserInGroup(userID, groupID)
+func (s *Service) IsUserInGroup(ctx context.Context, userID, groupID string) bool {
+	return s.repo.IsUserInGroup(ctx, userID, groupID)
 }
 
 // GetUserRole returns a user's role in a group
-func (s *Service) GetUserRole(userID, groupID string) (string, error) {
-	return s.repo.GetUserRole(userID, groupID)
+func (s *Service) GetUserRole(ctx context.Context, userID, groupID string) (string, error) {
+	return s.repo.GetUserRole(ctx, userID, groupID)
+}
+
+// RemoveUserFromAllGroups takes a user out of every group, for account
+// deletion. Groups the user owns are handed to the longest-standing admin,
+// or failing that the longest-standing member; groups left without members
+// are deleted.
+func (s *Service) RemoveUserFromAllGroups(ctx context.Context, userID string) error {
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	return s.tx.Transaction(ctx, func(ctx context.Context) error {
+		memberships, err := s.repo.GetUserGroups(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, membership := range memberships {
+			if membership.Role == "owner" {
+				transferred, err := s.transferOwnership(ctx, userID, membership.GroupID)
+				if err != nil {
+					return err
+				}
+				if !transferred {
+					if err := s.repo.Delete(ctx, membership.GroupID); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			if err := s.repo.RemoveUserFromGroup(ctx, userID, membership.GroupID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// transferOwnership makes another member of a group its owner, preferring
+// admins, and reports whether anyone was left to take it over. It must run
+// in a unit of work.
+func (s *Service) transferOwnership(ctx context.Context, ownerID, groupID string) (bool, error) {
+	members, err := s.repo.GetGroupMembers(ctx, groupID)
+	if err != nil {
+		return false, err
+	}
+
+	var successor *UserGroup
+	for _, member := range members {
+		if member.UserID == ownerID || member.Role == "owner" {
+			// Another owner already keeps the group alive
+			if member.UserID != ownerID {
+				return true, nil
+			}
+			continue
+		}
+		if successor == nil ||
+			(member.Role == "admin" && successor.Role != "admin") ||
+			(member.Role == successor.Role && member.JoinedAt.Before(successor.JoinedAt)) {
+			successor = member
+		}
+	}
+	if successor == nil {
+		return false, nil
+	}
+
+	promoted := *successor
+	promoted.Role = "owner"
+	if err := s.repo.RemoveUserFromGroup(ctx, successor.UserID, groupID); err != nil {
+		return false, err
+	}
+	if err := s.repo.AddUserToGroup(ctx, &promoted); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// requireRole checks that a user holds one of the given roles in a group
+func (s *Service) requireRole(ctx context.Context, userID, groupID string, roles ...string) error {
+	role, err := s.repo.GetUserRole(ctx, userID, groupID)
+	if err != nil {
+		return ErrUnauthorized
+	}
+	for _, allowed := range roles {
+		if role == allowed {
+			return nil
+		}
+	}
+	return ErrUnauthorized
 }
@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+)
+
+// Message represents an outgoing email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email messages
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// Config holds mail delivery configuration
+type Config struct {
+	Driver       string // "outbox", "smtp" or "log"
+	From         string
+	OutboxDir    string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUser     string
+	SMTPPassword string
+}
+
+// New creates the sender selected by cfg.Driver
+func New(cfg Config) (Sender, error) {
+	switch cfg.Driver {
+	case "", "outbox":
+		return NewOutboxSender(cfg.OutboxDir, cfg.From)
+	case "smtp":
+		return NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.From)
+	case "log":
+		return NewLogSender(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// LogSender writes messages to the application log instead of delivering them
+type LogSender struct{}
+
+// NewLogSender creates a new log sender
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+// Send logs the message
+func (s *LogSender) Send(msg *Message) error {
+	log.Printf("📧 Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
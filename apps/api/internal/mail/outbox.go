@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxSender writes every message as an .eml file into a directory
+// instead of delivering it. It lets the mail flows run fully offline.
+type OutboxSender struct {
+	dir  string
+	from string
+}
+
+// NewOutboxSender creates a new outbox sender, creating dir if needed
+func NewOutboxSender(dir, from string) (*OutboxSender, error) {
+	if dir == "" {
+		dir = "outbox"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail outbox: %w", err)
+	}
+	return &OutboxSender{dir: dir, from: from}, nil
+}
+
+// Send writes the message to the outbox directory
+func (s *OutboxSender) Send(msg *Message) error {
+	if msg == nil || msg.To == "" {
+		return errors.New("message recipient is required")
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), uuid.New().String())
+	return os.WriteFile(filepath.Join(s.dir, name), formatMessage(s.from, msg, now), 0o644)
+}
+
+// Dir returns the directory messages are written to
+func (s *OutboxSender) Dir() string {
+	return s.dir
+}
+
+// formatMessage renders a message in RFC 5322 format
+func formatMessage(from string, msg *Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so values cannot inject extra headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"time"
+)
+
+// SMTPSender delivers messages through an SMTP server
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPSender creates a new SMTP sender
+func NewSMTPSender(host string, port int, username, password, from string) (*SMTPSender, error) {
+	if host == "" {
+		return nil, errors.New("SMTP host is required")
+	}
+	if from == "" {
+		return nil, errors.New("mail sender address is required")
+	}
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPSender{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}, nil
+}
+
+// Send delivers the message
+func (s *SMTPSender) Send(msg *Message) error {
+	if msg == nil || msg.To == "" {
+		return errors.New("message recipient is required")
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, formatMessage(s.from, msg, time.Now()))
+}
@@ -1,9 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
+
+	"sanctor/internal/auth"
+	"sanctor/internal/authctx"
+	"sanctor/internal/database"
+	"sanctor/internal/user"
 )
 
 // Logger is a middleware that logs HTTP requests
@@ -41,17 +51,321 @@ func CORS(next http.Handler) http.Handler {
 	})
 }
 
-// Authenticate is a middleware that validates JWT tokens
-func Authenticate(next http.Handler) http.Handler {
+// TokenParser resolves bearer tokens to the session or API key they belong to
+type TokenParser interface {
+	ParseJWT(ctx context.Context, token string) (*auth.Claims, error)
+	ParseAPIKey(ctx context.Context, raw string) (*auth.APIKey, error)
+}
+
+// Authenticator provides the middleware that identifies callers by their
+// bearer token
+type Authenticator struct {
+	tokens TokenParser
+}
+
+// NewAuthenticator creates an Authenticator that checks tokens with tokens
+func NewAuthenticator(tokens TokenParser) *Authenticator {
+	return &Authenticator{tokens: tokens}
+}
+
+// Authenticate is a middleware that validates JWT tokens. It requires an
+// "Authorization: Bearer <token>" header and stores the caller's identity in
+// the request context, where handlers read it through the authctx package.
+// CORS preflight requests are passed through untouched. API keys are
+// rejected; routes that accept them use AuthenticateScoped.
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
+	return a.authenticate(next, "")
+}
+
+// AuthenticateScoped returns a middleware like Authenticate that also
+// accepts API keys, provided they were granted scope
+func (a *Authenticator) AuthenticateScoped(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return a.authenticate(next, scope)
+	}
+}
+
+// AuthenticateOptional returns a middleware for routes that are open to
+// anonymous callers. Requests without an Authorization header pass through
+// as they are; a bearer token, when given, is checked like
+// AuthenticateScoped, so an API key must have been granted scope.
+func (a *Authenticator) AuthenticateOptional(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authenticated := a.authenticate(next, scope)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			authenticated.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticate resolves the bearer token to an identity. An empty scope
+// means the route is only open to session tokens.
+func (a *Authenticator) authenticate(next http.Handler, scope string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Implement JWT validation
-		// token := r.Header.Get("Authorization")
-		// Validate token and extract user info
-		
-		next.ServeHTTP(w, r)
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if header == "" || token == header {
+			unauthorized(w, "missing bearer token")
+			return
+		}
+
+		var identity *authctx.Identity
+		if auth.IsAPIKey(token) {
+			if scope == "" {
+				forbidden(w, "API keys cannot be used for this endpoint")
+				return
+			}
+			key, err := a.tokens.ParseAPIKey(r.Context(), token)
+			if err != nil {
+				unauthorized(w, err.Error())
+				return
+			}
+			identity = &authctx.Identity{
+				UserID:   key.UserID,
+				APIKeyID: key.ID,
+				Scopes:   key.ScopeList(),
+			}
+			if !identity.HasScope(scope) {
+				forbidden(w, "API key is missing the "+scope+" scope")
+				return
+			}
+		} else {
+			claims, err := a.tokens.ParseJWT(r.Context(), token)
+			if err != nil {
+				unauthorized(w, err.Error())
+				return
+			}
+			identity = &authctx.Identity{
+				UserID:    claims.UserID,
+				SessionID: claims.SessionID,
+				Role:      claims.Role,
+			}
+		}
+
+		ctx := authctx.WithIdentity(r.Context(), identity)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// AuthenticateFunc wraps a handler function with Authenticate
+func (a *Authenticator) AuthenticateFunc(next http.HandlerFunc) http.Handler {
+	return a.Authenticate(next)
+}
+
+// UserLookup resolves the authenticated user for middleware that needs more
+// than the token carries
+type UserLookup interface {
+	GetUser(ctx context.Context, id string) (*user.User, error)
+}
+
+// RequireVerified returns a middleware that only lets users with a verified
+// email address through. It must run after Authenticate.
+func RequireVerified(users UserLookup) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, ok := authctx.UserID(r.Context())
+			if !ok {
+				unauthorized(w, "authentication required")
+				return
+			}
+
+			u, err := users.GetUser(r.Context(), userID)
+			if err != nil || !u.IsVerified {
+				forbidden(w, "please verify your email address first")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole returns a middleware that only lets users whose site-wide
+// role is at least min through. The role comes from the access token, so
+// it must run after Authenticate.
+func RequireRole(min string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			identity, ok := authctx.FromContext(r.Context())
+			if !ok {
+				unauthorized(w, "authentication required")
+				return
+			}
+			if !user.RoleAtLeast(identity.Role, min) {
+				forbidden(w, min+" access required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// StatusClientClosedRequest is the non-standard status, borrowed from nginx,
+// of a request the client gave up on before it was answered
+const StatusClientClosedRequest = 499
+
+// Timeout returns a middleware that bounds each request by d, or only by
+// the client when d is 0. The deadline reaches the database through the
+// request context. When the client disconnects or the request, or one of
+// its database operations, runs out of time, an error response from the
+// handler is replaced by 499 or 503 so the cause is not reported as a
+// failure of the operation itself.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if d > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+			ctx, dbTimedOut := database.WithTimeoutReport(ctx)
+
+			cw := &cutShortWriter{ResponseWriter: w, ctx: ctx, dbTimedOut: dbTimedOut}
+			next.ServeHTTP(cw, r.WithContext(ctx))
+			if cw.replacedWith == http.StatusServiceUnavailable {
+				log.Printf("⚠️  %s %s timed out", r.Method, r.URL.Path)
+			}
+		})
+	}
+}
+
+// cutShortWriter replaces an error response with 499 or 503 when the
+// request it answers was cut short
+type cutShortWriter struct {
+	http.ResponseWriter
+	ctx          context.Context
+	dbTimedOut   func() bool
+	wroteHeader  bool
+	replacedWith int
+}
+
+// WriteHeader sends the status, or the cut short status instead of an error
+func (w *cutShortWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status >= 400 {
+		if replacement, message := w.cutShort(); replacement != 0 {
+			w.replacedWith = replacement
+			w.Header().Del("Content-Length")
+			w.Header().Set("Content-Type", "application/json")
+			w.ResponseWriter.WriteHeader(replacement)
+			json.NewEncoder(w.ResponseWriter).Encode(map[string]string{"error": message})
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the body, dropping it when the response was replaced
+func (w *cutShortWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replacedWith != 0 {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (w *cutShortWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cutShort returns the status and message replacing an error response, or
+// 0 when the request ran its course
+func (w *cutShortWriter) cutShort() (int, string) {
+	switch err := w.ctx.Err(); {
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, "request cancelled"
+	case errors.Is(err, context.DeadlineExceeded), w.dbTimedOut():
+		return http.StatusServiceUnavailable, "request timed out"
+	}
+	return 0, ""
+}
+
+// TrustProxies returns a middleware that believes the X-Forwarded-For and
+// X-Forwarded-Proto headers only from the given proxies, which are IP
+// addresses or CIDR ranges. A request from a trusted proxy gets the address
+// of the client it forwarded as its RemoteAddr: the rightmost address in
+// X-Forwarded-For that is not itself a trusted proxy. Any other request has
+// the headers removed, so a client cannot choose the address that login
+// lockouts, login history and sessions record.
+func TrustProxies(proxies []string) func(http.Handler) http.Handler {
+	trusted := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			trusted = append(trusted, prefix)
+		} else if addr, err := netip.ParseAddr(proxy); err == nil {
+			trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded := r.Header.Values("X-Forwarded-For")
+			if len(forwarded) == 0 && r.Header.Get("X-Forwarded-Proto") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r = r.Clone(r.Context())
+			peer, err := netip.ParseAddrPort(r.RemoteAddr)
+			if err != nil || !isTrusted(peer.Addr()) {
+				r.Header.Del("X-Forwarded-For")
+				r.Header.Del("X-Forwarded-Proto")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			hops := strings.Split(strings.Join(forwarded, ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+				if err != nil {
+					break
+				}
+				r.RemoteAddr = netip.AddrPortFrom(addr.Unmap(), 0).String()
+				if !isTrusted(addr) {
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // RateLimit is a middleware that limits request rate
 func RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -59,3 +373,20 @@ func RateLimit(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// unauthorized writes a 401 JSON error response
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// forbidden writes a 403 JSON error response
+func forbidden(w http.ResponseWriter, message string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
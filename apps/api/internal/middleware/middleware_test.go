@@ -0,0 +1,313 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sanctor/internal/auth"
+	"sanctor/internal/authctx"
+	"sanctor/internal/database"
+)
+
+func TestTrustProxies(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		proto      string
+		wantAddr   string
+		wantProto  string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:4711",
+			wantAddr:   "203.0.113.7:4711",
+		},
+		{
+			name:       "spoofed header from a client",
+			remoteAddr: "203.0.113.7:4711",
+			forwarded:  []string{"198.51.100.1"},
+			proto:      "https",
+			wantAddr:   "203.0.113.7:4711",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"198.51.100.1"},
+			proto:      "https",
+			wantAddr:   "198.51.100.1:0",
+			wantProto:  "https",
+		},
+		{
+			name:       "client prepends a fake hop",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"192.0.2.66, 198.51.100.1"},
+			wantAddr:   "198.51.100.1:0",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"198.51.100.1, 10.0.0.3", "192.168.1.1"},
+			wantAddr:   "198.51.100.1:0",
+		},
+		{
+			name:       "ipv6 proxy",
+			remoteAddr: "[2001:db8::2]:4711",
+			forwarded:  []string{"2001:db8:1::9"},
+			wantAddr:   "[2001:db8:1::9]:0",
+		},
+		{
+			name:       "unparsable hop",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"198.51.100.1, unknown"},
+			wantAddr:   "10.0.0.2:4711",
+		},
+	}
+
+	handler := TrustProxies([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/64"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAddr, gotProto string
+			h := handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAddr = r.RemoteAddr
+				gotProto = r.Header.Get("X-Forwarded-Proto")
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if gotAddr != tt.wantAddr {
+				t.Errorf("got address %q, want %q", gotAddr, tt.wantAddr)
+			}
+			if gotProto != tt.wantProto {
+				t.Errorf("got X-Forwarded-Proto %q, want %q", gotProto, tt.wantProto)
+			}
+		})
+	}
+}
+
+// fakeTokens accepts the session token "session" and the API keys in keys,
+// which map a raw key to its scopes
+type fakeTokens struct {
+	keys map[string]string
+}
+
+func (f fakeTokens) ParseJWT(ctx context.Context, token string) (*auth.Claims, error) {
+	if token != "session" {
+		return nil, errors.New("invalid token")
+	}
+	return &auth.Claims{UserID: "user-1", SessionID: "session-1"}, nil
+}
+
+func (f fakeTokens) ParseAPIKey(ctx context.Context, raw string) (*auth.APIKey, error) {
+	scopes, ok := f.keys[raw]
+	if !ok {
+		return nil, errors.New("invalid API key")
+	}
+	return &auth.APIKey{ID: "key-1", UserID: "user-1", Scopes: scopes}, nil
+}
+
+func TestAuthenticateOptional(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantUser      string
+	}{
+		{name: "anonymous", wantStatus: http.StatusOK},
+		{name: "session", authorization: "Bearer session", wantStatus: http.StatusOK, wantUser: "user-1"},
+		{name: "invalid session", authorization: "Bearer forged", wantStatus: http.StatusUnauthorized},
+		{name: "not a bearer token", authorization: "Basic dXNlcjpwYXNz", wantStatus: http.StatusUnauthorized},
+		{name: "key with scope", authorization: "Bearer sanctor_pat_reader", wantStatus: http.StatusOK, wantUser: "user-1"},
+		{name: "key without scope", authorization: "Bearer sanctor_pat_writer", wantStatus: http.StatusForbidden},
+		{name: "unknown key", authorization: "Bearer sanctor_pat_revoked", wantStatus: http.StatusUnauthorized},
+	}
+
+	authn := NewAuthenticator(fakeTokens{keys: map[string]string{
+		"sanctor_pat_reader": auth.ScopePostsRead,
+		"sanctor_pat_writer": auth.ScopePostsWrite,
+	}})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			h := authn.AuthenticateOptional(auth.ScopePostsRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUser, _ = authctx.UserID(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("got user %q, want %q", gotUser, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		scope         string // "" routes through Authenticate
+		authorization string
+		wantStatus    int
+	}{
+		{name: "key with the route's scope", scope: auth.ScopePostsWrite, authorization: "Bearer sanctor_pat_writer", wantStatus: http.StatusOK},
+		{name: "key without the route's scope", scope: auth.ScopePostsWrite, authorization: "Bearer sanctor_pat_reader", wantStatus: http.StatusForbidden},
+		{name: "unknown key on a scoped route", scope: auth.ScopePostsWrite, authorization: "Bearer sanctor_pat_revoked", wantStatus: http.StatusUnauthorized},
+		{name: "session on a scoped route", scope: auth.ScopePostsWrite, authorization: "Bearer session", wantStatus: http.StatusOK},
+		{name: "key on a session route", authorization: "Bearer sanctor_pat_writer", wantStatus: http.StatusForbidden},
+		{name: "session on a session route", authorization: "Bearer session", wantStatus: http.StatusOK},
+		{name: "no token on a session route", wantStatus: http.StatusUnauthorized},
+	}
+
+	authn := NewAuthenticator(fakeTokens{keys: map[string]string{
+		"sanctor_pat_reader": auth.ScopePostsRead,
+		"sanctor_pat_writer": auth.ScopePostsRead + "," + auth.ScopePostsWrite,
+	}})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+			})
+			if tt.scope == "" {
+				h = authn.Authenticate(h)
+			} else {
+				h = authn.AuthenticateScoped(tt.scope)(h)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/posts/create", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if want := tt.wantStatus == http.StatusOK; reached != want {
+				t.Errorf("handler reached = %v, want %v", reached, want)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	slowQueries := &database.DB{}
+	slowQueries.SetTimeouts(database.Timeouts{Read: time.Millisecond})
+
+	// fail answers with an error once the request, or a query it runs, is
+	// cut short
+	fail := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		http.Error(w, "query failed", http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		clientCancel bool
+		handler      http.HandlerFunc
+		wantStatus   int
+		wantBody     string
+	}{
+		{
+			name:         "client cancelled",
+			clientCancel: true,
+			handler:      fail,
+			wantStatus:   StatusClientClosedRequest,
+			wantBody:     "request cancelled",
+		},
+		{
+			name:       "deadline",
+			timeout:    10 * time.Millisecond,
+			handler:    fail,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "request timed out",
+		},
+		{
+			name: "query timed out",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				ctx, cancel := slowQueries.ReadContext(r.Context())
+				<-ctx.Done()
+				cancel()
+				http.Error(w, "query failed", http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "request timed out",
+		},
+		{
+			name:    "header already written",
+			timeout: 10 * time.Millisecond,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				<-r.Context().Done()
+				http.Error(w, "query failed", http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusCreated,
+			wantBody:   "query failed",
+		},
+		{
+			name:         "success after the client left",
+			clientCancel: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("done"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "done",
+		},
+		{
+			name:    "error that is not cut short",
+			timeout: time.Minute,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "query failed", http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "query failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.clientCancel {
+				cancel()
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/posts", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			Timeout(tt.timeout)(tt.handler).ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("got body %q, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by providers
+var (
+	ErrInvalidConfig  = errors.New("invalid OIDC provider configuration")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+// Config describes an OpenID Connect provider registered with Sanctor
+type Config struct {
+	Name         string // short identifier used in URLs, e.g. "ucla"
+	DisplayName  string // label shown on the login button
+	Issuer       string // issuer URL; discovery is read from {Issuer}/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // defaults to openid, email and profile
+}
+
+// Provider talks to one OpenID Connect provider. Discovery and signing keys
+// are fetched lazily, so an unreachable provider does not stop the API from
+// starting.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      *keySet
+}
+
+// discovery is the subset of the provider metadata Sanctor uses
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Token is the result of exchanging an authorization code
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// NewProvider validates a provider configuration. Pass a nil client to use
+// a default one with a timeout.
+func NewProvider(config Config, client *http.Client) (*Provider, error) {
+	if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("%w: %q needs a name, an issuer, a client ID and a redirect URL", ErrInvalidConfig, config.Name)
+	}
+	if config.DisplayName == "" {
+		config.DisplayName = config.Name
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{config: config, client: client}, nil
+}
+
+// Name returns the provider's short identifier
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// DisplayName returns the provider's human-readable name
+func (p *Provider) DisplayName() string {
+	return p.config.DisplayName
+}
+
+// AuthCodeURL returns the URL to send the browser to. The code challenge is
+// derived from a PKCE verifier with S256.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades an authorization code and its PKCE verifier for tokens
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	token := &Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return token, nil
+}
+
+// metadata returns the provider's discovery document, fetching it on first use
+func (p *Provider) metadata(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	meta := &discovery{}
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %w", p.config.Name, err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery for %s returned issuer %q", p.config.Name, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery for %s is missing endpoints", p.config.Name)
+	}
+
+	p.discovery = meta
+	return meta, nil
+}
+
+// getJSON fetches and decodes a JSON document
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
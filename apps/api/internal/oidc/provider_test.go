@@ -0,0 +1,622 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "sanctor"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "http://localhost:8080/api/auth/oidc/callback"
+)
+
+// testProvider is an in-process OpenID Connect provider
+type testProvider struct {
+	server *httptest.Server
+	// issuer is what discovery and ID tokens announce, server.URL+"/" by
+	// default as Auth0 does
+	issuer string
+
+	mu          sync.Mutex
+	key         *ecdsa.PrivateKey
+	kid         string
+	discovery   map[string]string // overrides of the discovery document
+	discoveries int
+	jwksFetches int
+	tokenForm   url.Values // the last token request
+	tokenAuth   [2]string  // its basic auth user and password
+	tokenStatus int
+	tokenBody   map[string]interface{}
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	p := &testProvider{key: newKey(t), kid: "key-1", discovery: map[string]string{}, tokenStatus: http.StatusOK}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.discoveries++
+		doc := map[string]string{
+			"issuer":                 p.issuer,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		}
+		for key, value := range p.discovery {
+			doc[key] = value
+		}
+		if doc["issuer"] == "error" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(doc)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.jwksFetches++
+		encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "AQAB", "e": "AQAB"},
+			{
+				"kty": "EC",
+				"kid": p.kid,
+				"use": "sig",
+				"crv": "P-256",
+				"x":   encode(p.key.PublicKey.X.FillBytes(make([]byte, 32))),
+				"y":   encode(p.key.PublicKey.Y.FillBytes(make([]byte, 32))),
+			},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		r.ParseForm()
+		p.tokenForm = r.PostForm
+		user, password, _ := r.BasicAuth()
+		p.tokenAuth = [2]string{user, password}
+		w.WriteHeader(p.tokenStatus)
+		json.NewEncoder(w).Encode(p.tokenBody)
+	})
+	p.server = httptest.NewServer(mux)
+	p.issuer = p.server.URL + "/"
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// provider returns a Provider for the test provider, configured with
+// issuer
+func (p *testProvider) provider(t *testing.T, issuer string) *Provider {
+	t.Helper()
+	provider, err := NewProvider(Config{
+		Name:         "campus",
+		Issuer:       issuer,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, p.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// count reads one of the provider's counters
+func (p *testProvider) count(n *int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return *n
+}
+
+// claims returns valid ID token claims for nonce
+func (p *testProvider) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   p.issuer,
+		"aud":   testClientID,
+		"sub":   "user-1",
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+		"email": "ada@example.com",
+	}
+}
+
+// sign signs claims with the provider's current key
+func (p *testProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	p.mu.Lock()
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+	return signWith(t, claims, key, kid)
+}
+
+func signWith(t *testing.T, claims jwt.MapClaims, key *ecdsa.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "complete", config: Config{Name: "campus", Issuer: "https://id.example/", ClientID: "c", RedirectURL: testRedirectURL}},
+		{name: "no name", config: Config{Issuer: "https://id.example", ClientID: "c", RedirectURL: testRedirectURL}, wantErr: true},
+		{name: "no issuer", config: Config{Name: "campus", ClientID: "c", RedirectURL: testRedirectURL}, wantErr: true},
+		{name: "no client ID", config: Config{Name: "campus", Issuer: "https://id.example", RedirectURL: testRedirectURL}, wantErr: true},
+		{name: "no redirect URL", config: Config{Name: "campus", Issuer: "https://id.example", ClientID: "c"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewProvider(tt.config, nil)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("NewProvider() error = %v, want ErrInvalidConfig", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if provider.DisplayName() != "campus" {
+				t.Errorf("display name = %q, want the name", provider.DisplayName())
+			}
+		})
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(p *testProvider) string // returns the configured issuer
+		wantErr   string
+	}{
+		{
+			name:      "issuer with a trailing slash",
+			configure: func(p *testProvider) string { return p.issuer },
+		},
+		{
+			name:      "configured without the trailing slash",
+			configure: func(p *testProvider) string { return p.server.URL },
+		},
+		{
+			name: "provider without a trailing slash",
+			configure: func(p *testProvider) string {
+				p.issuer = p.server.URL
+				return p.server.URL + "/"
+			},
+		},
+		{
+			name: "other issuer",
+			configure: func(p *testProvider) string {
+				p.issuer = "https://attacker.example/"
+				return p.server.URL
+			},
+			wantErr: "returned issuer",
+		},
+		{
+			name: "missing endpoint",
+			configure: func(p *testProvider) string {
+				p.discovery["token_endpoint"] = ""
+				return p.server.URL
+			},
+			wantErr: "missing endpoints",
+		},
+		{
+			name: "unavailable",
+			configure: func(p *testProvider) string {
+				p.discovery["issuer"] = "error"
+				return p.server.URL
+			},
+			wantErr: "503",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			provider := p.provider(t, tt.configure(p))
+
+			_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("AuthCodeURL() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIsCached(t *testing.T) {
+	p := newTestProvider(t)
+	provider := p.provider(t, p.issuer)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := provider.AuthCodeURL(ctx, "state", "nonce", "challenge"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if discoveries := p.count(&p.discoveries); discoveries != 1 {
+		t.Errorf("discovery was fetched %d times, want once", discoveries)
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636 allows verifiers of 43 to 128 unreserved characters
+	if len(verifier) < 43 || len(verifier) > 128 || strings.ContainsAny(verifier, "+/=") {
+		t.Errorf("verifier %q is not a valid PKCE verifier", verifier)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); challenge != want {
+		t.Errorf("challenge = %q, want the S256 of the verifier %q", challenge, want)
+	}
+
+	again, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == verifier {
+		t.Error("two verifiers are the same")
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p := newTestProvider(t)
+	p.discovery["authorization_endpoint"] = p.server.URL + "/authorize?tenant=campus"
+	provider := p.provider(t, p.issuer)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != p.server.URL+"/authorize" {
+		t.Errorf("endpoint = %q, want the one from discovery", got)
+	}
+
+	want := map[string]string{
+		"tenant":                "campus",
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        "the-challenge",
+		"code_challenge_method": "S256",
+	}
+	query := u.Query()
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sends the code and verifier", func(t *testing.T) {
+		p := newTestProvider(t)
+		p.tokenBody = map[string]interface{}{"access_token": "access", "token_type": "Bearer", "id_token": "id-token"}
+		provider := p.provider(t, p.issuer)
+
+		token, err := provider.Exchange(ctx, "the-code", "the-verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if token.IDToken != "id-token" {
+			t.Errorf("ID token = %q, want the one from the token response", token.IDToken)
+		}
+		want := map[string]string{
+			"grant_type":    "authorization_code",
+			"code":          "the-code",
+			"code_verifier": "the-verifier",
+			"redirect_uri":  testRedirectURL,
+		}
+		for key, value := range want {
+			if got := p.tokenForm.Get(key); got != value {
+				t.Errorf("%s = %q, want %q", key, got, value)
+			}
+		}
+		if p.tokenAuth != [2]string{testClientID, testClientSecret} {
+			t.Errorf("client authentication = %v, want the client ID and secret", p.tokenAuth)
+		}
+	})
+
+	failures := []struct {
+		name   string
+		status int
+		body   map[string]interface{}
+		want   string
+	}{
+		{name: "refused", status: http.StatusBadRequest, body: map[string]interface{}{"error": "invalid_grant"}, want: "invalid_grant"},
+		{name: "no ID token", status: http.StatusOK, body: map[string]interface{}{"access_token": "access"}, want: "no id_token"},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			p.tokenStatus, p.tokenBody = tt.status, tt.body
+			provider := p.provider(t, p.issuer)
+
+			_, err := provider.Exchange(ctx, "the-code", "the-verifier")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Exchange() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	const nonce = "the-nonce"
+	otherKey := newKey(t)
+
+	tests := []struct {
+		name    string
+		issuer  func(p *testProvider) string // the configured issuer; the provider's by default
+		token   func(t *testing.T, p *testProvider, claims jwt.MapClaims) string
+		wantErr string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:   "issuer with a trailing slash configured without it",
+			issuer: func(p *testProvider) string { return p.server.URL },
+		},
+		{
+			name: "issuer without a trailing slash",
+			issuer: func(p *testProvider) string {
+				p.issuer = p.server.URL
+				return p.server.URL
+			},
+		},
+		{
+			name: "other issuer",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				claims["iss"] = "https://attacker.example/"
+				return p.sign(t, claims)
+			},
+			wantErr: "issued by",
+		},
+		{
+			name: "issuer missing",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				delete(claims, "iss")
+				return p.sign(t, claims)
+			},
+			wantErr: "issued by",
+		},
+		{
+			name: "other audience",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				claims["aud"] = "another-client"
+				return p.sign(t, claims)
+			},
+			wantErr: "aud",
+		},
+		{
+			name: "several audiences with us as the authorized party",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				claims["aud"] = []string{testClientID, "another-client"}
+				claims["azp"] = testClientID
+				return p.sign(t, claims)
+			},
+		},
+		{
+			name: "several audiences for another party",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				claims["aud"] = []string{testClientID, "another-client"}
+				claims["azp"] = "another-client"
+				return p.sign(t, claims)
+			},
+			wantErr: "issued to",
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				claims["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+				return p.sign(t, claims)
+			},
+			wantErr: "expired",
+		},
+		{
+			name: "no expiry",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				delete(claims, "exp")
+				return p.sign(t, claims)
+			},
+			wantErr: "exp",
+		},
+		{
+			name: "issued in the future",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				claims["iat"] = time.Now().Add(5 * time.Minute).Unix()
+				return p.sign(t, claims)
+			},
+			wantErr: "used before issued",
+		},
+		{
+			name: "no subject",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				delete(claims, "sub")
+				return p.sign(t, claims)
+			},
+			wantErr: "missing subject",
+		},
+		{
+			name: "other nonce",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				claims["nonce"] = "replayed-nonce"
+				return p.sign(t, claims)
+			},
+			wantErr: "nonce mismatch",
+		},
+		{
+			name: "no nonce",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				delete(claims, "nonce")
+				return p.sign(t, claims)
+			},
+			wantErr: "nonce mismatch",
+		},
+		{
+			name: "signed with another key",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				return signWith(t, claims, otherKey, p.kid)
+			},
+			wantErr: "signature",
+		},
+		{
+			name: "unknown key ID",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				return signWith(t, claims, p.key, "key-2")
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "encryption key",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				return signWith(t, claims, p.key, "encryption")
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "HMAC with the client secret",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testClientSecret))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: "signing method",
+		},
+		{
+			name: "unsigned",
+			token: func(t *testing.T, p *testProvider, claims jwt.MapClaims) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: "signing method",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			issuer := p.issuer
+			if tt.issuer != nil {
+				issuer = tt.issuer(p)
+			}
+			provider := p.provider(t, issuer)
+			claims := p.claims(nonce)
+			var rawIDToken string
+			if tt.token != nil {
+				rawIDToken = tt.token(t, p, claims)
+			} else {
+				rawIDToken = p.sign(t, claims)
+			}
+
+			got, err := provider.VerifyIDToken(context.Background(), rawIDToken, nonce)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidIDToken) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("VerifyIDToken() error = %v, want ErrInvalidIDToken mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Subject != "user-1" || got.Email != "ada@example.com" {
+				t.Errorf("claims = %+v, want the ones signed", got)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	const nonce = "the-nonce"
+	ctx := context.Background()
+	p := newTestProvider(t)
+	provider := p.provider(t, p.issuer)
+
+	if _, err := provider.VerifyIDToken(ctx, p.sign(t, p.claims(nonce)), nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	p.key, p.kid = newKey(t), "key-2"
+	p.mu.Unlock()
+	rotated := p.sign(t, p.claims(nonce))
+
+	// Unknown key IDs refetch the keys at most once a minute
+	if _, err := provider.VerifyIDToken(ctx, rotated, nonce); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("VerifyIDToken() error = %v, want the new key unknown until the next refetch", err)
+	}
+	if fetches := p.count(&p.jwksFetches); fetches != 1 {
+		t.Fatalf("the keys were fetched %d times, want once", fetches)
+	}
+
+	provider.mu.Lock()
+	provider.keys.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	provider.mu.Unlock()
+	if _, err := provider.VerifyIDToken(ctx, rotated, nonce); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v after the keys could be refetched", err)
+	}
+	if fetches := p.count(&p.jwksFetches); fetches != 2 {
+		t.Errorf("the keys were fetched %d times, want twice", fetches)
+	}
+}
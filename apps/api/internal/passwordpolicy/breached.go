@@ -0,0 +1,125 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// prefixLength is how many hex characters of a SHA-1 hash are revealed to a
+// RangeSource, as in the Pwned Passwords range API
+const prefixLength = 5
+
+// bundledBreaches holds the SHA-1 hashes of common and breached passwords
+// shipped with the binary
+//
+//go:embed breached.txt
+var bundledBreaches []byte
+
+// RangeSource answers k-anonymity range queries: given the first five hex
+// characters of a SHA-1 hash, it returns the remaining 35 characters of every
+// breached password hash with that prefix. The password itself, and its full
+// hash, never leave the server.
+type RangeSource interface {
+	Range(prefix string) ([]string, error)
+}
+
+// IsBreached reports whether a password appears in a breach source
+func IsBreached(source RangeSource, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := source.Range(hash[:prefixLength])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[prefixLength:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BreachList is a RangeSource held in memory
+type BreachList struct {
+	ranges map[string][]string
+}
+
+// Range returns the hash suffixes stored under a prefix
+func (l *BreachList) Range(prefix string) ([]string, error) {
+	return l.ranges[strings.ToUpper(prefix)], nil
+}
+
+// Len returns the number of hashes in the list
+func (l *BreachList) Len() int {
+	n := 0
+	for _, suffixes := range l.ranges {
+		n += len(suffixes)
+	}
+	return n
+}
+
+var (
+	bundledOnce sync.Once
+	bundledList *BreachList
+)
+
+// Bundled returns the breach list shipped with the binary
+func Bundled() *BreachList {
+	bundledOnce.Do(func() {
+		list, err := LoadBreachList(bytes.NewReader(bundledBreaches))
+		if err != nil {
+			panic(fmt.Sprintf("bundled breach list is invalid: %v", err))
+		}
+		bundledList = list
+	})
+	return bundledList
+}
+
+// LoadBreachFile loads a breach list from a file
+func LoadBreachFile(path string) (*BreachList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadBreachList(f)
+}
+
+// LoadBreachList reads one SHA-1 hash per line. Anything after a colon is
+// ignored, so the "HASH:COUNT" lines of a Pwned Passwords download work as is.
+func LoadBreachList(r io.Reader) (*BreachList, error) {
+	list := &BreachList{ranges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		hash := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(hash, ':'); i >= 0 {
+			hash = hash[:i]
+		}
+		if hash == "" || strings.HasPrefix(hash, "#") {
+			continue
+		}
+
+		hash = strings.ToUpper(hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha1.Size {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash: %q", line, hash)
+		}
+		prefix := hash[:prefixLength]
+		list.ranges[prefix] = append(list.ranges[prefix], hash[prefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breach list: %w", err)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,93 @@
+package passwordpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// SHA-1 hashes of "password1" and "zebra-quilt-mango-7"
+const (
+	password1Hash = "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D"
+	zebraHash     = "37255A216F1F58FE9B18A4DF35F6E58335310135"
+)
+
+func TestLoadBreachList(t *testing.T) {
+	input := strings.Join([]string{
+		"# Pwned Passwords sample",
+		"",
+		password1Hash + ":2418984",
+		"  " + strings.ToLower(zebraHash) + ":1  ",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", // "password"
+	}, "\n")
+
+	list, err := LoadBreachList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", list.Len())
+	}
+	for _, password := range []string{"password1", "zebra-quilt-mango-7", "password"} {
+		if breached, err := IsBreached(list, password); err != nil || !breached {
+			t.Errorf("IsBreached(%q) = %v, %v, want true", password, breached, err)
+		}
+	}
+	if breached, err := IsBreached(list, "analytical-engine-1843"); err != nil || breached {
+		t.Errorf("IsBreached() = %v, %v for a password not on the list", breached, err)
+	}
+	if suffixes, _ := list.Range(strings.ToLower(password1Hash[:prefixLength])); len(suffixes) != 1 {
+		t.Errorf("Range() with a lowercase prefix = %v, want the hash", suffixes)
+	}
+}
+
+func TestLoadBreachListRejectsBadLines(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "not hex", line: "password1"},
+		{name: "too short", line: password1Hash[:39]},
+		{name: "too long", line: password1Hash + "0"},
+		{name: "SHA-256", line: strings.Repeat("A", 64) + ":3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := password1Hash + "\n" + tt.line + "\n"
+			_, err := LoadBreachList(strings.NewReader(input))
+			if err == nil || !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("LoadBreachList() error = %v, want one naming line 2", err)
+			}
+		})
+	}
+}
+
+func TestLoadBreachFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(password1Hash+":1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadBreachFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", list.Len())
+	}
+
+	if _, err := LoadBreachFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("a missing file was loaded")
+	}
+}
+
+func TestBundledList(t *testing.T) {
+	list := Bundled()
+	if list.Len() == 0 {
+		t.Fatal("the bundled breach list is empty")
+	}
+	if Bundled() != list {
+		t.Error("the bundled list was loaded twice")
+	}
+}
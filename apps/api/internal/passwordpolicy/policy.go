@@ -0,0 +1,149 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation codes, stable for clients to translate
+const (
+	CodeTooShort         = "too_short"
+	CodeTooLong          = "too_long"
+	CodeMissingUppercase = "missing_uppercase"
+	CodeMissingLowercase = "missing_lowercase"
+	CodeMissingDigit     = "missing_digit"
+	CodeMissingSymbol    = "missing_symbol"
+	CodeTooWeak          = "too_weak"
+	CodeBreached         = "breached"
+)
+
+// Violation is one rule a password breaks
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule a password breaks. Field names the
+// request field the password came from, so clients can show the messages
+// next to the right input.
+type ValidationError struct {
+	Field      string      `json:"field"`
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Fields returns the violations keyed by request field, the shape clients
+// expect in the "fields" member of an error response
+func (e *ValidationError) Fields() map[string][]Violation {
+	return map[string][]Violation{e.Field: e.Violations}
+}
+
+// Policy describes what a password must look like. Lengths count characters,
+// not bytes.
+type Policy struct {
+	MinLength     int  `json:"minLength"`
+	MaxLength     int  `json:"maxLength"`
+	RequireUpper  bool `json:"requireUppercase"`
+	RequireLower  bool `json:"requireLowercase"`
+	RequireDigit  bool `json:"requireDigit"`
+	RequireSymbol bool `json:"requireSymbol"`
+
+	// MinScore is the lowest acceptable strength score, from 0 (guessable in
+	// a few attempts) to 4 (very hard to guess); 0 disables the check
+	MinScore int `json:"minScore"`
+
+	// Breached screens passwords against known breaches; nil disables it
+	Breached RangeSource `json:"-"`
+}
+
+// Default returns the default policy: at least 8 characters, a strength
+// score of at least 2 and no password from the bundled breach list
+func Default() *Policy {
+	return &Policy{
+		MinLength: 8,
+		MaxLength: 128,
+		MinScore:  2,
+		Breached:  Bundled(),
+	}
+}
+
+// Validate checks a password against the policy. userInputs are the user's
+// own details, such as their email address, username and name; passwords
+// built from them score lower. The result is nil or a *ValidationError.
+func (p *Policy) Validate(field, password string, userInputs ...string) error {
+	var violations []Violation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add(CodeTooShort, "password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(CodeTooLong, "password must be at most %d characters", p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		add(CodeMissingUppercase, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		add(CodeMissingLowercase, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		add(CodeMissingDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add(CodeMissingSymbol, "password must contain a symbol")
+	}
+
+	// For a password that is too short, these would only repeat the length error
+	if length >= p.MinLength {
+		if p.MinScore > 0 {
+			if strength := Estimate(password, userInputs...); strength.Score < p.MinScore {
+				message := "password is too easy to guess"
+				if strength.Warning != "" {
+					message += ": " + strength.Warning
+				}
+				add(CodeTooWeak, "%s", message)
+			}
+		}
+		if p.Breached != nil {
+			breached, err := IsBreached(p.Breached, password)
+			if err != nil {
+				// A broken breach source must not lock everyone out
+				log.Printf("⚠️  Failed to check password against breach list: %v", err)
+			} else if breached {
+				add(CodeBreached, "password has appeared in a data breach, choose a different one")
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Field: field, Violations: violations}
+}
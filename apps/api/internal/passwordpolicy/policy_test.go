@@ -0,0 +1,181 @@
+package passwordpolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// codes returns the violation codes of a Validate result
+func codes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("Validate() returned %T, want *ValidationError", err)
+	}
+	var codes []string
+	for _, v := range validation.Violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		password string
+		want     []string
+	}{
+		{name: "long enough", policy: Policy{MinLength: 8}, password: "abcdwxyz"},
+		{name: "too short", policy: Policy{MinLength: 8}, password: "abcdwxy", want: []string{CodeTooShort}},
+		{name: "length counts characters", policy: Policy{MinLength: 8}, password: "äöüßäöüß"},
+		{name: "too long", policy: Policy{MaxLength: 8}, password: "abcdefghi", want: []string{CodeTooLong}},
+		{name: "no maximum", policy: Policy{}, password: "abcdefghijklmnopqrstuvwxyz"},
+		{name: "uppercase", policy: Policy{RequireUpper: true}, password: "Ünicode"},
+		{name: "missing uppercase", policy: Policy{RequireUpper: true}, password: "lower-1", want: []string{CodeMissingUppercase}},
+		{name: "lowercase", policy: Policy{RequireLower: true}, password: "UPPEr"},
+		{name: "missing lowercase", policy: Policy{RequireLower: true}, password: "UPPER-1", want: []string{CodeMissingLowercase}},
+		{name: "digit", policy: Policy{RequireDigit: true}, password: "four4"},
+		{name: "missing digit", policy: Policy{RequireDigit: true}, password: "four-Four", want: []string{CodeMissingDigit}},
+		{name: "symbol", policy: Policy{RequireSymbol: true}, password: "a-b"},
+		{name: "space is not a symbol", policy: Policy{RequireSymbol: true}, password: "a b 1 C", want: []string{CodeMissingSymbol}},
+		{
+			name:     "every rule at once",
+			policy:   Policy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true},
+			password: "abc",
+			want:     []string{CodeTooShort, CodeMissingUppercase, CodeMissingDigit, CodeMissingSymbol},
+		},
+		{
+			name:     "every rule met",
+			policy:   Policy{MinLength: 8, MaxLength: 16, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true},
+			password: "Zebra-Quilt-7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codes(t, tt.policy.Validate("password", tt.password))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrengthThreshold(t *testing.T) {
+	userInputs := []string{"ada@example.com", "ada", "Ada", "Lovelace"}
+	tests := []struct {
+		name       string
+		minScore   int
+		password   string
+		userInputs []string
+		want       []string
+	}{
+		{name: "disabled", minScore: 0, password: "abcdefgh"},
+		{name: "sequence", minScore: 1, password: "abcdefgh", want: []string{CodeTooWeak}},
+		{name: "repeat", minScore: 1, password: "aaaaaaaaaaaa", want: []string{CodeTooWeak}},
+		{name: "common password", minScore: 2, password: "iloveyou2", want: []string{CodeTooWeak}},
+		{name: "at the threshold", minScore: 2, password: "adalovelace1815", userInputs: userInputs},
+		{name: "below the threshold", minScore: 3, password: "adalovelace1815", userInputs: userInputs, want: []string{CodeTooWeak}},
+		{name: "passphrase", minScore: 4, password: "zebra-quilt-mango-7"},
+		{name: "short passwords only fail the length", minScore: 4, password: "abc", want: []string{CodeTooShort}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Policy{MinLength: 8, MinScore: tt.minScore}
+			got := codes(t, policy.Validate("password", tt.password, tt.userInputs...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate(%q) = %v, want %v (score %d)",
+					tt.password, got, tt.want, Estimate(tt.password, tt.userInputs...).Score)
+			}
+		})
+	}
+}
+
+func TestUserInputsLowerTheScore(t *testing.T) {
+	const password = "adalovelace1815"
+	without := Estimate(password)
+	with := Estimate(password, "ada@example.com", "ada", "Ada", "Lovelace")
+	if with.Score >= without.Score {
+		t.Errorf("score with the user's details = %d, without = %d, want it lower", with.Score, without.Score)
+	}
+	if with.Warning != "avoid your name, username or email address" {
+		t.Errorf("warning = %q, want the one about the user's details", with.Warning)
+	}
+}
+
+// failingSource is a breach source that is down
+type failingSource struct{}
+
+func (failingSource) Range(prefix string) ([]string, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	tests := []struct {
+		name     string
+		breached RangeSource
+		password string
+		want     []string
+	}{
+		{name: "bundled hit", breached: Bundled(), password: "password1", want: []string{CodeBreached}},
+		{name: "bundled miss", breached: Bundled(), password: "zebra-quilt-mango-7"},
+		{name: "disabled", breached: nil, password: "password1"},
+		{name: "source down", breached: failingSource{}, password: "password1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Policy{MinLength: 8, Breached: tt.breached}
+			got := codes(t, policy.Validate("password", tt.password))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	got := codes(t, Default().Validate("password", "password1"))
+	if want := []string{CodeTooWeak, CodeBreached}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate(%q) = %v, want %v", "password1", got, want)
+	}
+	if err := Default().Validate("password", "analytical-engine-1843"); err != nil {
+		t.Errorf("Validate() = %v for a strong password", err)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := (&Policy{MinLength: 8, RequireDigit: true}).Validate("newPassword", "short")
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("Validate() = %v, want a *ValidationError", err)
+	}
+
+	want := "password must be at least 8 characters; password must contain a digit"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	fields := validation.Fields()
+	if len(fields) != 1 || len(fields["newPassword"]) != 2 {
+		t.Errorf("Fields() = %v, want both violations under newPassword", fields)
+	}
+
+	body, marshalErr := json.Marshal(validation)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	wantJSON := `{"field":"newPassword","violations":[` +
+		`{"code":"too_short","message":"password must be at least 8 characters"},` +
+		`{"code":"missing_digit","message":"password must contain a digit"}]}`
+	if string(body) != wantJSON {
+		t.Errorf("JSON = %s, want %s", body, wantJSON)
+	}
+}
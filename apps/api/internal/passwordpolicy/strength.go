@@ -0,0 +1,375 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Strength estimates how hard a password is to guess, in the manner of
+// zxcvbn: the password is split into the cheapest sequence of guessable
+// patterns (common passwords, the user's own details, sequences, repeats,
+// keyboard rows and years), with brute force filling the gaps.
+type Strength struct {
+	// Score runs from 0 (guessable in a few attempts) to 4 (very hard to guess)
+	Score int `json:"score"`
+	// GuessesLog10 is the estimated number of guesses as a power of ten
+	GuessesLog10 float64 `json:"guessesLog10"`
+	// Warning names the weakest pattern found, if any
+	Warning string `json:"warning,omitempty"`
+}
+
+// commonWords lists common passwords and their building blocks, most common first
+//
+//go:embed common.txt
+var commonWords []byte
+
+var commonRanks = loadRanks(commonWords)
+
+func loadRanks(data []byte) map[string]int {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if _, exists := ranks[word]; word != "" && !exists {
+			ranks[word] = len(ranks) + 1
+		}
+	}
+	return ranks
+}
+
+// Pattern kinds a match can belong to
+const (
+	patternCommon    = "common"
+	patternUserInput = "user_input"
+	patternSequence  = "sequence"
+	patternRepeat    = "repeat"
+	patternKeyboard  = "keyboard"
+	patternYear      = "year"
+)
+
+var patternWarnings = map[string]string{
+	patternCommon:    "it is built from a very common password or word",
+	patternUserInput: "avoid your name, username or email address",
+	patternSequence:  "sequences like abc or 6543 are easy to guess",
+	patternRepeat:    "repeats like aaa or abcabc are easy to guess",
+	patternKeyboard:  "straight rows of keys are easy to guess",
+	patternYear:      "years are easy to guess",
+}
+
+// keyboardRows are the key rows of a QWERTY keyboard
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// leetSubstitutions maps common character swaps back to letters
+var leetSubstitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+const (
+	// maxEstimateLength bounds the work spent on very long passwords; any
+	// characters past it only add strength
+	maxEstimateLength = 128
+	// bruteforceCardinality is the guesses charged per character no pattern covers
+	bruteforceCardinality = 10
+	// minMatchGuesses keeps a matched pattern from looking free
+	minMatchGuesses = 50
+)
+
+type match struct {
+	start, end int // runes [start, end)
+	guesses    float64
+	pattern    string
+}
+
+// Estimate estimates the strength of a password. userInputs are the user's
+// own details, such as their email address, username and name.
+func Estimate(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+	extra := 0
+	if len(runes) > maxEstimateLength {
+		extra = len(runes) - maxEstimateLength
+		runes = runes[:maxEstimateLength]
+	}
+
+	matches := findMatches(runes, userDictionary(userInputs))
+
+	// best[k] is the cheapest way, in log10 guesses, to produce the first k
+	// runes; via[k] is the match ending there, or nil for a brute-forced rune
+	n := len(runes)
+	best := make([]float64, n+1)
+	via := make([]*match, n+1)
+	for k := 1; k <= n; k++ {
+		best[k] = best[k-1] + math.Log10(bruteforceCardinality)
+		for i := range matches {
+			m := &matches[i]
+			if m.end != k {
+				continue
+			}
+			if cost := best[m.start] + math.Log10(math.Max(m.guesses, minMatchGuesses)); cost < best[k] {
+				best[k] = cost
+				via[k] = m
+			}
+		}
+	}
+
+	// The pattern covering the most characters explains the weakness best
+	var weakest *match
+	for k := n; k > 0; {
+		m := via[k]
+		if m == nil {
+			k--
+			continue
+		}
+		if weakest == nil || m.end-m.start > weakest.end-weakest.start {
+			weakest = m
+		}
+		k = m.start
+	}
+
+	strength := Strength{GuessesLog10: best[n] + float64(extra)*math.Log10(bruteforceCardinality)}
+	switch g := strength.GuessesLog10; {
+	case g < 3:
+		strength.Score = 0
+	case g < 6:
+		strength.Score = 1
+	case g < 8:
+		strength.Score = 2
+	case g < 10:
+		strength.Score = 3
+	default:
+		strength.Score = 4
+	}
+	if weakest != nil {
+		strength.Warning = patternWarnings[weakest.pattern]
+	}
+	return strength
+}
+
+// userDictionary splits the user's details into lowercase words, ranked in
+// the order given
+func userDictionary(userInputs []string) map[string]int {
+	ranks := make(map[string]int)
+	add := func(word string) {
+		if _, exists := ranks[word]; len([]rune(word)) >= 3 && !exists {
+			ranks[word] = len(ranks) + 1
+		}
+	}
+
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if at := strings.LastIndex(input, "@"); at >= 0 {
+			input = input[:at]
+		}
+		add(input)
+		for _, word := range strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			add(word)
+		}
+	}
+	return ranks
+}
+
+func findMatches(runes []rune, userWords map[string]int) []match {
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, userWords)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+	return matches
+}
+
+// dictionaryMatches finds common passwords and the user's own details, also
+// written backwards or with leetspeak substitutions
+func dictionaryMatches(runes []rune, userWords map[string]int) []match {
+	var matches []match
+	for i := 0; i < len(runes); i++ {
+		for j := i + 3; j <= len(runes); j++ {
+			original := runes[i:j]
+			lower := []rune(strings.ToLower(string(original)))
+
+			// Reversed and leetspeak spellings double the guesses
+			candidates := map[string]float64{string(lower): 1}
+			if reversed := string(reverse(lower)); reversed != string(lower) {
+				candidates[reversed] = 2
+			}
+			if plain := string(unleet(lower)); plain != string(lower) {
+				candidates[plain] = 2
+			}
+
+			for word, multiplier := range candidates {
+				guesses := multiplier * uppercaseVariations(original)
+				if rank, ok := userWords[word]; ok {
+					matches = append(matches, match{i, j, float64(rank) * guesses, patternUserInput})
+				}
+				if rank, ok := commonRanks[word]; ok {
+					matches = append(matches, match{i, j, float64(rank) * guesses, patternCommon})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs like "abcd", "9876" or "wxyz"
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes)-2; {
+		delta := runes[i+1] - runes[i]
+		if delta != 1 && delta != -1 {
+			i++
+			continue
+		}
+		j := i + 2
+		for j < len(runes) && runes[j]-runes[j-1] == delta {
+			j++
+		}
+		if j-i >= 3 {
+			base := 26.0
+			switch first := unicode.ToLower(runes[i]); {
+			case strings.ContainsRune("az019", first):
+				base = 4
+			case unicode.IsDigit(first):
+				base = 10
+			}
+			guesses := base * float64(j-i)
+			if delta < 0 {
+				guesses *= 2
+			}
+			matches = append(matches, match{i, j, guesses, patternSequence})
+		}
+		i = j - 1
+	}
+	return matches
+}
+
+// repeatMatches finds a character or a block of characters repeated, like
+// "aaaa" or "abcabc"
+func repeatMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes); i++ {
+		for size := 1; i+2*size <= len(runes); size++ {
+			block := string(runes[i : i+size])
+			count := 1
+			for i+(count+1)*size <= len(runes) && string(runes[i+count*size:i+(count+1)*size]) == block {
+				count++
+			}
+			if count < 2 || (size == 1 && count < 3) {
+				continue
+			}
+			guesses := math.Pow(bruteforceCardinality, float64(size))
+			if size == 1 {
+				guesses = cardinality(runes[i])
+			}
+			matches = append(matches, match{i, i + count*size, guesses * float64(count), patternRepeat})
+		}
+	}
+	return matches
+}
+
+// keyboardMatches finds straight runs of at least four keys along a
+// keyboard row, in either direction
+func keyboardMatches(runes []rune) []match {
+	var matches []match
+	lower := []rune(strings.ToLower(string(runes)))
+	for i := 0; i < len(lower); i++ {
+		for j := i + 4; j <= len(lower); j++ {
+			run := string(lower[i:j])
+			for _, row := range keyboardRows {
+				if strings.Contains(row, run) || strings.Contains(string(reverse([]rune(row))), run) {
+					// Any of ~94 starting keys, four directions, one per length
+					matches = append(matches, match{i, j, 94 * 4 * float64(j-i-1), patternKeyboard})
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// yearMatches finds four-digit years from 1900 to 2099
+func yearMatches(runes []rune) []match {
+	var matches []match
+	thisYear := time.Now().Year()
+	for i := 0; i+4 <= len(runes); i++ {
+		year, err := strconv.Atoi(string(runes[i : i+4]))
+		if err != nil || year < 1900 || year > 2099 {
+			continue
+		}
+		span := math.Max(math.Abs(float64(year-thisYear)), 20)
+		matches = append(matches, match{i, i + 4, span, patternYear})
+	}
+	return matches
+}
+
+// uppercaseVariations counts the ways the capitals of a word could have been
+// placed; "password", "Password" and "PASSWORD" are all cheap
+func uppercaseVariations(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 || (upper == 1 && unicode.IsUpper(word[0])) || lower == 0 {
+		if upper == 0 {
+			return 1
+		}
+		return 2
+	}
+
+	variations := 0.0
+	for k := 1; k <= upper && k <= lower; k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return variations
+}
+
+// cardinality returns the size of the character class a rune belongs to
+func cardinality(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return 10
+	case unicode.IsLetter(r):
+		return 26
+	default:
+		return 33
+	}
+}
+
+func unleet(word []rune) []rune {
+	out := make([]rune, len(word))
+	for i, r := range word {
+		if sub, ok := leetSubstitutions[r]; ok {
+			r = sub
+		}
+		out[i] = r
+	}
+	return out
+}
+
+func reverse(word []rune) []rune {
+	out := make([]rune, len(word))
+	for i, r := range word {
+		out[len(word)-1-i] = r
+	}
+	return out
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
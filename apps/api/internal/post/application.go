@@ -0,0 +1,34 @@
+package post
+
+import "time"
+
+// Application statuses
+const (
+	ApplicationPending  = "pending"
+	ApplicationAccepted = "accepted"
+	ApplicationRejected = "rejected"
+)
+
+// Application is a user's request for a room in a post's listing. Accepting
+// it takes one of the listing's rooms.
+type Application struct {
+	ID        string    `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	PostID    string    `json:"postId" gorm:"type:uuid;not null;index"`
+	UserID    string    `json:"userId" gorm:"type:uuid;not null;index"`
+	Message   string    `json:"message" gorm:"type:text"`
+	Status    string    `json:"status" gorm:"type:varchar(20);not null"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName keeps GORM on the table created by the migrations
+func (Application) TableName() string {
+	return "post_applications"
+}
+
+// ApplyRequest represents an application for a room. The applicant is
+// always the authenticated user.
+type ApplyRequest struct {
+	PostID  string `json:"postId"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,17 @@
+package post
+
+import "errors"
+
+var (
+	ErrPostNotFound = errors.New("post not found")
+	ErrNotOwner     = errors.New("only the author of a post can modify it")
+)
+
+// Errors returned for applications
+var (
+	ErrApplicationNotFound = errors.New("application not found")
+	ErrOwnPost             = errors.New("you cannot apply to your own post")
+	ErrAlreadyApplied      = errors.New("you already have an open application for this post")
+	ErrApplicationClosed   = errors.New("application was already accepted or rejected")
+	ErrNoRoomsLeft         = errors.New("every room of this post is taken")
+)
@@ -3,6 +3,8 @@ package post
 import (
 	"encoding/json"
 	"net/http"
+
+	"sanctor/internal/authctx"
 )
 
 // Handler handles HTTP requests for posts
@@ -20,7 +22,7 @@ func (h *Handler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	
-	posts, err := h.service.GetAllPosts()
+	posts, err := h.service.GetAllPosts(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -39,20 +41,40 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	var post Post
-	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreatePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	createdPost, err := h.service.CreatePost(&post)
+	post := &Post{
+		UserID:        userID,
+		Address:       req.Address,
+		IsSublet:      req.IsSublet,
+		Price:         req.Price,
+		Rooms:         req.Rooms,
+		RoomsOccupied: req.RoomsOccupied,
+		Bathrooms:     req.Bathrooms,
+		Description:   req.Description,
+		Gender:        req.Gender,
+		PropertyType:  req.PropertyType,
+		Term:          req.Term,
+	}
+
+	createdPost, err := h.service.CreatePost(r.Context(), post)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -73,7 +95,7 @@ func (h *Handler) GetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	post, err := h.service.GetPost(id)
+	post, err := h.service.GetPost(r.Context(), id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -97,13 +119,19 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "PUT, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "id parameter is required", http.StatusBadRequest)
@@ -116,9 +144,9 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updatedPost, err := h.service.UpdatePost(id, req)
+	updatedPost, err := h.service.UpdatePost(r.Context(), id, userID, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
@@ -135,23 +163,43 @@ func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "id parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.service.DeletePost(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.DeletePost(r.Context(), id, userID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// errorStatus maps service errors to HTTP status codes
+func errorStatus(err error) int {
+	switch err {
+	case ErrPostNotFound, ErrApplicationNotFound:
+		return http.StatusNotFound
+	case ErrNotOwner, ErrOwnPost:
+		return http.StatusForbidden
+	case ErrAlreadyApplied, ErrApplicationClosed, ErrNoRoomsLeft:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
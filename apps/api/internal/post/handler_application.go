@@ -0,0 +1,110 @@
+package post
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"sanctor/internal/authctx"
+)
+
+// Apply applies for a room in a post
+func (h *Handler) Apply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req ApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PostID == "" {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+
+	application, err := h.service.Apply(r.Context(), userID, req)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(application)
+}
+
+// ListApplications returns the applications for a post to its author
+func (h *Handler) ListApplications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	postID := r.URL.Query().Get("post_id")
+	if postID == "" {
+		http.Error(w, "post_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	applications, err := h.service.ListApplications(r.Context(), postID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(applications)
+}
+
+// AcceptApplication accepts an application and counts its room as occupied
+func (h *Handler) AcceptApplication(w http.ResponseWriter, r *http.Request) {
+	h.decideApplication(w, r, h.service.AcceptApplication)
+}
+
+// RejectApplication rejects an application
+func (h *Handler) RejectApplication(w http.ResponseWriter, r *http.Request) {
+	h.decideApplication(w, r, h.service.RejectApplication)
+}
+
+// decideApplication runs an author's decision on the application named by
+// the id parameter
+func (h *Handler) decideApplication(w http.ResponseWriter, r *http.Request, decide func(ctx context.Context, id, ownerID string) (*Application, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	application, err := decide(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(application)
+}
@@ -28,13 +28,14 @@ type Post struct {
 	Gender        string    `json:"gender" gorm:"type:varchar(20)"`
 	PropertyType  string    `json:"propertyType" gorm:"type:varchar(50)"`
 	Term          Term      `json:"terms" gorm:"type:varchar(20)"`
+	Hidden        bool      `json:"-" gorm:"default:false;index"` // author's account is deactivated
 	CreatedAt     time.Time `json:"createdAt" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
 }
 
-// CreatePostRequest represents post creation data
+// CreatePostRequest represents post creation data. The author is always
+// the authenticated user, never a field of the request.
 type CreatePostRequest struct {
-	UserID        string `json:"userId"`
 	Address       string `json:"address"`
 	IsSublet      bool   `json:"isSublet"`
 	Price         string `json:"price"`
@@ -1,48 +1,260 @@
 package post
 
-// Repository handles data persistence for posts
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"sanctor/internal/database"
+)
+
+// Repository handles data persistence for posts. Like the database, it
+// stores and hands out copies, so a change only takes effect once it is
+// saved and can be undone if a unit of work fails.
 type Repository struct {
-	posts map[string]*Post
+	posts        map[string]*Post
+	applications map[string]*Application
+	mu           sync.RWMutex
 }
 
 // NewRepository creates a new post repository
 func NewRepository() *Repository {
 	return &Repository{
-		posts: make(map[string]*Post),
+		posts:        make(map[string]*Post),
+		applications: make(map[string]*Application),
 	}
 }
 
 // Create adds a new post
-func (r *Repository) Create(post *Post) (*Post, error) {
-	r.posts[post.ID] = post
+func (r *Repository) Create(ctx context.Context, post *Post) (*Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.posts[post.ID] = clone(post)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.posts, post.ID)
+	})
 	return post, nil
 }
 
 // FindByID retrieves a post by ID
-func (r *Repository) FindByID(id string) (*Post, error) {
+func (r *Repository) FindByID(ctx context.Context, id string) (*Post, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if post, ok := r.posts[id]; ok {
-		return post, nil
+		return clone(post), nil
 	}
 	return nil, nil
 }
 
 // FindAll retrieves all posts
-func (r *Repository) FindAll() ([]*Post, error) {
+func (r *Repository) FindAll(ctx context.Context) ([]*Post, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	posts := make([]*Post, 0, len(r.posts))
 	for _, post := range r.posts {
-		posts = append(posts, post)
+		if !post.Hidden {
+			posts = append(posts, clone(post))
+		}
 	}
 	return posts, nil
 }
 
 // Update updates a post
-func (r *Repository) Update(post *Post) error {
-	r.posts[post.ID] = post
+func (r *Repository) Update(ctx context.Context, post *Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, existed := r.posts[post.ID]
+	r.posts[post.ID] = clone(post)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existed {
+			r.posts[post.ID] = previous
+		} else {
+			delete(r.posts, post.ID)
+		}
+	})
 	return nil
 }
 
 // Delete removes a post
-func (r *Repository) Delete(id string) error {
-	delete(r.posts, id)
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if previous, ok := r.posts[id]; ok {
+		delete(r.posts, id)
+		database.OnRollback(ctx, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.posts[id] = previous
+		})
+	}
+	r.deleteApplications(ctx, func(a *Application) bool { return a.PostID == id })
+	return nil
+}
+
+// SetHiddenByUser hides or shows all posts of a user
+func (r *Repository) SetHiddenByUser(ctx context.Context, userID string, hidden bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, post := range r.posts {
+		if post.UserID == userID {
+			updated := clone(post)
+			updated.Hidden = hidden
+			r.posts[id] = updated
+			previous := post
+			database.OnRollback(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.posts[previous.ID] = previous
+			})
+		}
+	}
+	return nil
+}
+
+// DeleteByUser removes all posts of a user with their applications, and
+// the user's own applications
+func (r *Repository) DeleteByUser(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := make(map[string]bool)
+	for id, post := range r.posts {
+		if post.UserID == userID {
+			delete(r.posts, id)
+			deleted[id] = true
+			previous := post
+			database.OnRollback(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.posts[previous.ID] = previous
+			})
+		}
+	}
+	r.deleteApplications(ctx, func(a *Application) bool { return deleted[a.PostID] || a.UserID == userID })
+	return nil
+}
+
+// FindByIDForUpdate retrieves a post by ID. Units of work on the in-memory
+// repositories already run one at a time, so there is nothing to lock.
+func (r *Repository) FindByIDForUpdate(ctx context.Context, id string) (*Post, error) {
+	return r.FindByID(ctx, id)
+}
+
+// AddRoomsOccupied changes a post's occupied rooms by n
+func (r *Repository) AddRoomsOccupied(ctx context.Context, id string, n int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, ok := r.posts[id]
+	if !ok {
+		return ErrPostNotFound
+	}
+	updated := clone(previous)
+	updated.RoomsOccupied += n
+	r.posts[id] = updated
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.posts[id] = previous
+	})
+	return nil
+}
+
+// CreateApplication adds a new application
+func (r *Repository) CreateApplication(ctx context.Context, application *Application) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := *application
+	r.applications[application.ID] = &c
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.applications, application.ID)
+	})
+	return nil
+}
+
+// FindApplicationByIDForUpdate retrieves an application by ID
+func (r *Repository) FindApplicationByIDForUpdate(ctx context.Context, id string) (*Application, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if application, ok := r.applications[id]; ok {
+		c := *application
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// FindApplicationsByPost retrieves the applications for a post, oldest first
+func (r *Repository) FindApplicationsByPost(ctx context.Context, postID string) ([]*Application, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	applications := []*Application{}
+	for _, application := range r.applications {
+		if application.PostID == postID {
+			c := *application
+			applications = append(applications, &c)
+		}
+	}
+	sort.Slice(applications, func(i, j int) bool {
+		return applications[i].CreatedAt.Before(applications[j].CreatedAt)
+	})
+	return applications, nil
+}
+
+// UpdateApplicationStatus sets the status of an application
+func (r *Repository) UpdateApplicationStatus(ctx context.Context, id, status string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, ok := r.applications[id]
+	if !ok {
+		return ErrApplicationNotFound
+	}
+	updated := *previous
+	updated.Status = status
+	updated.UpdatedAt = at
+	r.applications[id] = &updated
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.applications[id] = previous
+	})
 	return nil
 }
+
+// deleteApplications removes the applications matching match. The caller
+// holds r.mu.
+func (r *Repository) deleteApplications(ctx context.Context, match func(a *Application) bool) {
+	for id, application := range r.applications {
+		if match(application) {
+			delete(r.applications, id)
+			previous := application
+			database.OnRollback(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.applications[previous.ID] = previous
+			})
+		}
+	}
+}
+
+// clone copies a post so callers cannot change the stored record
+func clone(post *Post) *Post {
+	c := *post
+	return &c
+}
@@ -1,69 +1,204 @@
 package post
 
 import (
-	"sanctor/internal/database"
+	"context"
+	"errors"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sanctor/internal/database"
+	"sanctor/internal/picture"
 )
 
 // GormRepository handles data persistence for posts using GORM
 type GormRepository struct {
-	db *gorm.DB
+	db *database.DB
 }
 
 // NewGormRepository creates a new GORM post repository
 func NewGormRepository(db *database.DB) *GormRepository {
 	return &GormRepository{
-		db: db.Gorm,
+		db: db,
 	}
 }
 
 // Create adds a new post
-func (r *GormRepository) Create(post *Post) (*Post, error) {
-	if err := r.db.Create(post).Error; err != nil {
+func (r *GormRepository) Create(ctx context.Context, post *Post) (*Post, error) {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Create(post).Error; err != nil {
 		return nil, err
 	}
 	return post, nil
 }
 
 // FindByID retrieves a post by ID
-func (r *GormRepository) FindByID(id string) (*Post, error) {
+func (r *GormRepository) FindByID(ctx context.Context, id string) (*Post, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var post Post
-	err := r.db.Where("id = ?", id).First(&post).Error
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&post).Error
 	if err != nil {
 		return nil, err
 	}
 	return &post, nil
 }
 
-// FindAll retrieves all posts
-func (r *GormRepository) FindAll() ([]*Post, error) {
+// FindAll retrieves all visible posts
+func (r *GormRepository) FindAll(ctx context.Context) ([]*Post, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var posts []*Post
-	err := r.db.Find(&posts).Error
+	err := r.db.WithContext(ctx).Where("hidden = ?", false).Find(&posts).Error
 	return posts, err
 }
 
 // FindByUserID retrieves all posts for a specific user
-func (r *GormRepository) FindByUserID(userID string) ([]*Post, error) {
+func (r *GormRepository) FindByUserID(ctx context.Context, userID string) ([]*Post, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var posts []*Post
-	err := r.db.Where("user_id = ?", userID).Find(&posts).Error
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&posts).Error
 	return posts, err
 }
 
 // Update updates a post
-func (r *GormRepository) Update(post *Post) error {
-	return r.db.Save(post).Error
+func (r *GormRepository) Update(ctx context.Context, post *Post) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Save(post).Error
 }
 
 // Delete removes a post
-func (r *GormRepository) Delete(id string) error {
-	return r.db.Delete(&Post{}, "id = ?", id).Error
+func (r *GormRepository) Delete(ctx context.Context, id string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Delete(&Post{}, "id = ?", id).Error
+}
+
+// SetHiddenByUser hides or shows all posts of a user
+func (r *GormRepository) SetHiddenByUser(ctx context.Context, userID string, hidden bool) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Model(&Post{}).Where("user_id = ?", userID).Update("hidden", hidden).Error
+}
+
+// DeleteByUser removes all posts of a user together with their pictures,
+// and the user's own applications. Applications for the posts go with them.
+func (r *GormRepository) DeleteByUser(ctx context.Context, userID string) error {
+	return r.db.Transaction(ctx, func(ctx context.Context) error {
+		tx := r.db.WithContext(ctx)
+		posts := tx.Model(&Post{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("post_id IN (?)", posts).Delete(&picture.Picture{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&Application{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&Post{}).Error
+	})
+}
+
+// FindByIDForUpdate retrieves a post by ID and locks the row until the unit
+// of work in ctx ends. It must be called within a unit of work.
+func (r *GormRepository) FindByIDForUpdate(ctx context.Context, id string) (*Post, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	var post Post
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&post).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// AddRoomsOccupied changes a post's occupied rooms by n
+func (r *GormRepository) AddRoomsOccupied(ctx context.Context, id string, n int) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Model(&Post{}).Where("id = ?", id).
+		Update("rooms_occupied", gorm.Expr("rooms_occupied + ?", n))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// CreateApplication adds a new application
+func (r *GormRepository) CreateApplication(ctx context.Context, application *Application) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Create(application).Error
+}
+
+// FindApplicationByIDForUpdate retrieves an application by ID and locks the
+// row until the unit of work in ctx ends. It must be called within a unit
+// of work.
+func (r *GormRepository) FindApplicationByIDForUpdate(ctx context.Context, id string) (*Application, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	var application Application
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&application).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &application, nil
+}
+
+// FindApplicationsByPost retrieves the applications for a post, oldest first
+func (r *GormRepository) FindApplicationsByPost(ctx context.Context, postID string) ([]*Application, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	applications := []*Application{}
+	err := r.db.WithContext(ctx).Where("post_id = ?", postID).Order("created_at").Find(&applications).Error
+	return applications, err
+}
+
+// UpdateApplicationStatus sets the status of an application
+func (r *GormRepository) UpdateApplicationStatus(ctx context.Context, id, status string, at time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Model(&Application{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "updated_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrApplicationNotFound
+	}
+	return nil
 }
 
 // Search posts by filters
-func (r *GormRepository) Search(filters map[string]interface{}) ([]*Post, error) {
+func (r *GormRepository) Search(ctx context.Context, filters map[string]interface{}) ([]*Post, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var posts []*Post
-	query := r.db
+	query := r.db.WithContext(ctx).Where("hidden = ?", false)
 
 	// Apply filters
 	if term, ok := filters["term"].(Term); ok {
@@ -1,10 +1,32 @@
 package post
 
-// RepositoryInterface defines the contract for post data persistence
+import (
+	"context"
+	"time"
+)
+
+// RepositoryInterface defines the contract for post data persistence. Calls
+// made with the context of a unit of work take part in it.
 type RepositoryInterface interface {
-	Create(post *Post) (*Post, error)
-	FindByID(id string) (*Post, error)
-	FindAll() ([]*Post, error)
-	Update(post *Post) error
-	Delete(id string) error
+	Create(ctx context.Context, post *Post) (*Post, error)
+	FindByID(ctx context.Context, id string) (*Post, error)
+	FindAll(ctx context.Context) ([]*Post, error)
+	Update(ctx context.Context, post *Post) error
+	Delete(ctx context.Context, id string) error
+	SetHiddenByUser(ctx context.Context, userID string, hidden bool) error
+	DeleteByUser(ctx context.Context, userID string) error
+
+	// FindByIDForUpdate retrieves a post and locks it until the unit of
+	// work in ctx ends
+	FindByIDForUpdate(ctx context.Context, id string) (*Post, error)
+	// AddRoomsOccupied changes a post's occupied rooms by n without
+	// touching its other columns
+	AddRoomsOccupied(ctx context.Context, id string, n int) error
+
+	CreateApplication(ctx context.Context, application *Application) error
+	// FindApplicationByIDForUpdate retrieves an application, nil if there
+	// is none, and locks it until the unit of work in ctx ends
+	FindApplicationByIDForUpdate(ctx context.Context, id string) (*Application, error)
+	FindApplicationsByPost(ctx context.Context, postID string) ([]*Application, error)
+	UpdateApplicationStatus(ctx context.Context, id, status string, at time.Time) error
 }
@@ -1,29 +1,32 @@
 package post
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"sanctor/internal/database"
 )
 
 // Service handles business logic for post operations
 type Service struct {
 	repo RepositoryInterface
+	tx   database.Transactor
 }
 
 // NewService creates a new post service with in-memory repository
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo *Repository, tx database.Transactor) *Service {
+	return &Service{repo: repo, tx: tx}
 }
 
 // NewServiceWithGorm creates a new post service with GORM repository
-func NewServiceWithGorm(repo *GormRepository) *Service {
-	return &Service{repo: repo}
+func NewServiceWithGorm(repo *GormRepository, tx database.Transactor) *Service {
+	return &Service{repo: repo, tx: tx}
 }
 
 // CreatePost creates a new post
-func (s *Service) CreatePost(post *Post) (*Post, error) {
+func (s *Service) CreatePost(ctx context.Context, post *Post) (*Post, error) {
 	// Generate ID if not provided
 	if post.ID == "" {
 		post.ID = uuid.New().String()
@@ -44,42 +47,52 @@ func (s *Service) CreatePost(post *Post) (*Post, error) {
 	
 	// If repository exists, save to database
 	if s.repo != nil {
-		return s.repo.Create(post)
+		return s.repo.Create(ctx, post)
 	}
 	
 	// Return the post with generated values (in-memory mode)
 	return post, nil
 }
 
-// GetPost retrieves a post by ID
-func (s *Service) GetPost(id string) (*Post, error) {
+// GetPost retrieves a post by ID. Posts of deactivated accounts are not found.
+func (s *Service) GetPost(ctx context.Context, id string) (*Post, error) {
 	if s.repo != nil {
-		return s.repo.FindByID(id)
+		post, err := s.repo.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if post == nil || post.Hidden {
+			return nil, ErrPostNotFound
+		}
+		return post, nil
 	}
 	return nil, fmt.Errorf("post not found")
 }
 
 // GetAllPosts retrieves all posts
-func (s *Service) GetAllPosts() ([]*Post, error) {
+func (s *Service) GetAllPosts(ctx context.Context) ([]*Post, error) {
 	if s.repo != nil {
-		return s.repo.FindAll()
+		return s.repo.FindAll(ctx)
 	}
 	return []*Post{}, nil
 }
 
-// UpdatePost updates an existing post
-func (s *Service) UpdatePost(id string, req UpdatePostRequest) (*Post, error) {
+// UpdatePost updates an existing post on behalf of its author
+func (s *Service) UpdatePost(ctx context.Context, id, userID string, req UpdatePostRequest) (*Post, error) {
 	if s.repo == nil {
 		return nil, fmt.Errorf("repository not initialized")
 	}
 
 	// Get existing post
-	post, err := s.repo.FindByID(id)
+	post, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if post == nil {
-		return nil, fmt.Errorf("post not found")
+		return nil, ErrPostNotFound
+	}
+	if post.UserID != userID {
+		return nil, ErrNotOwner
 	}
 
 	// Update fields if provided (pointer fields are nil when omitted)
@@ -118,17 +131,57 @@ func (s *Service) UpdatePost(id string, req UpdatePostRequest) (*Post, error) {
 	post.UpdatedAt = time.Now()
 
 	// Save to repository
-	if err := s.repo.Update(post); err != nil {
+	if err := s.repo.Update(ctx, post); err != nil {
 		return nil, err
 	}
 
 	return post, nil
 }
 
-// DeletePost deletes a post
-func (s *Service) DeletePost(id string) error {
-	if s.repo != nil {
-		return s.repo.Delete(id)
+// DeletePost deletes a post on behalf of its author
+func (s *Service) DeletePost(ctx context.Context, id, userID string) error {
+	if s.repo == nil {
+		return fmt.Errorf("not implemented")
+	}
+
+	post, err := s.repo.FindByID(ctx, id)
+	if err != nil || post == nil {
+		return ErrPostNotFound
+	}
+	if post.UserID != userID {
+		return ErrNotOwner
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+// RemovePost deletes any post regardless of its author, for moderation
+func (s *Service) RemovePost(ctx context.Context, id string) error {
+	if s.repo == nil {
+		return fmt.Errorf("not implemented")
+	}
+
+	post, err := s.repo.FindByID(ctx, id)
+	if err != nil || post == nil {
+		return ErrPostNotFound
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+// SetUserPostsHidden hides a user's posts while their account is
+// deactivated, or shows them again
+func (s *Service) SetUserPostsHidden(ctx context.Context, userID string, hidden bool) error {
+	if s.repo == nil {
+		return fmt.Errorf("not implemented")
+	}
+	return s.repo.SetHiddenByUser(ctx, userID, hidden)
+}
+
+// DeleteUserPosts deletes every post of a user and their pictures, for account deletion
+func (s *Service) DeleteUserPosts(ctx context.Context, userID string) error {
+	if s.repo == nil {
+		return fmt.Errorf("not implemented")
 	}
-	return fmt.Errorf("not implemented")
+	return s.repo.DeleteByUser(ctx, userID)
 }
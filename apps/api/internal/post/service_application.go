@@ -0,0 +1,156 @@
+package post
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Apply asks the author of a post for one of its rooms
+func (s *Service) Apply(ctx context.Context, userID string, req ApplyRequest) (*Application, error) {
+	post, err := s.GetPost(ctx, req.PostID)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID == userID {
+		return nil, ErrOwnPost
+	}
+	if !hasRoomLeft(post) {
+		return nil, ErrNoRoomsLeft
+	}
+
+	existing, err := s.repo.FindApplicationsByPost(ctx, post.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, application := range existing {
+		if application.UserID == userID && application.Status == ApplicationPending {
+			return nil, ErrAlreadyApplied
+		}
+	}
+
+	now := time.Now()
+	application := &Application{
+		ID:        uuid.New().String(),
+		PostID:    post.ID,
+		UserID:    userID,
+		Message:   strings.TrimSpace(req.Message),
+		Status:    ApplicationPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateApplication(ctx, application); err != nil {
+		return nil, err
+	}
+	return application, nil
+}
+
+// ListApplications returns the applications for a post to its author
+func (s *Service) ListApplications(ctx context.Context, postID, ownerID string) ([]*Application, error) {
+	post, err := s.GetPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID != ownerID {
+		return nil, ErrNotOwner
+	}
+	return s.repo.FindApplicationsByPost(ctx, postID)
+}
+
+// AcceptApplication accepts a pending application on behalf of the post's
+// author. In one unit of work the application is accepted and the post's
+// occupied rooms go up by one, so a room is never handed out twice and an
+// accepted application never goes uncounted.
+func (s *Service) AcceptApplication(ctx context.Context, id, ownerID string) (*Application, error) {
+	var accepted *Application
+	err := s.tx.Transaction(ctx, func(ctx context.Context) error {
+		application, post, err := s.openApplication(ctx, id, ownerID)
+		if err != nil {
+			return err
+		}
+		if !hasRoomLeft(post) {
+			return ErrNoRoomsLeft
+		}
+
+		now := time.Now()
+		if err := s.repo.UpdateApplicationStatus(ctx, id, ApplicationAccepted, now); err != nil {
+			return err
+		}
+		if err := s.repo.AddRoomsOccupied(ctx, post.ID, 1); err != nil {
+			return err
+		}
+		application.Status, application.UpdatedAt = ApplicationAccepted, now
+		accepted = application
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🏠 Application %s accepted for post %s", id, accepted.PostID)
+	return accepted, nil
+}
+
+// RejectApplication rejects a pending application on behalf of the post's
+// author
+func (s *Service) RejectApplication(ctx context.Context, id, ownerID string) (*Application, error) {
+	var rejected *Application
+	err := s.tx.Transaction(ctx, func(ctx context.Context) error {
+		application, _, err := s.openApplication(ctx, id, ownerID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := s.repo.UpdateApplicationStatus(ctx, id, ApplicationRejected, now); err != nil {
+			return err
+		}
+		application.Status, application.UpdatedAt = ApplicationRejected, now
+		rejected = application
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rejected, nil
+}
+
+// openApplication locks a pending application and its post for a decision
+// by the post's author
+func (s *Service) openApplication(ctx context.Context, id, ownerID string) (*Application, *Post, error) {
+	application, err := s.repo.FindApplicationByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if application == nil {
+		return nil, nil, ErrApplicationNotFound
+	}
+	post, err := s.repo.FindByIDForUpdate(ctx, application.PostID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if post == nil || post.Hidden {
+		return nil, nil, ErrApplicationNotFound
+	}
+	if post.UserID != ownerID {
+		return nil, nil, ErrNotOwner
+	}
+	if application.Status != ApplicationPending {
+		return nil, nil, ErrApplicationClosed
+	}
+	return application, post, nil
+}
+
+// hasRoomLeft reports whether a post has a room that is not occupied. A post
+// whose room count is not a number has no limit.
+func hasRoomLeft(post *Post) bool {
+	rooms, err := strconv.Atoi(strings.TrimSpace(post.Rooms))
+	if err != nil {
+		return true
+	}
+	return post.RoomsOccupied < rooms
+}
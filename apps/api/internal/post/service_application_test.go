@@ -0,0 +1,195 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"sanctor/internal/database"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingOccupancyRepository fails to count a room as occupied, the step
+// of accepting an application that follows marking it accepted
+type failingOccupancyRepository struct {
+	RepositoryInterface
+}
+
+func (r failingOccupancyRepository) AddRoomsOccupied(ctx context.Context, id string, n int) error {
+	return errInjected
+}
+
+const (
+	ownerID     = "owner"
+	applicantID = "applicant"
+)
+
+// newApplicationService builds an in-memory service with a two-room post by
+// ownerID, some of whose rooms are already occupied
+func newApplicationService(t *testing.T, repo RepositoryInterface, occupied int) (*Service, *Post) {
+	t.Helper()
+
+	s := &Service{repo: repo, tx: database.NewMemoryTransactor()}
+	post, err := s.CreatePost(context.Background(), &Post{
+		UserID:        ownerID,
+		Address:       "12 Analytical Row",
+		Rooms:         "2",
+		RoomsOccupied: occupied,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, post
+}
+
+func TestAcceptApplication(t *testing.T) {
+	tests := []struct {
+		name     string
+		occupied int
+		decider  string
+		want     error
+	}{
+		{name: "accepted", occupied: 0, decider: ownerID},
+		{name: "last room", occupied: 1, decider: ownerID},
+		{name: "not the author", occupied: 0, decider: applicantID, want: ErrNotOwner},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, post := newApplicationService(t, NewRepository(), tt.occupied)
+
+			application, err := s.Apply(ctx, applicantID, ApplyRequest{PostID: post.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			accepted, err := s.AcceptApplication(ctx, application.ID, tt.decider)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AcceptApplication() error = %v, want %v", err, tt.want)
+			}
+
+			wantStatus, wantOccupied := ApplicationPending, tt.occupied
+			if tt.want == nil {
+				wantStatus, wantOccupied = ApplicationAccepted, tt.occupied+1
+				if accepted.Status != ApplicationAccepted {
+					t.Errorf("returned status = %q, want %q", accepted.Status, ApplicationAccepted)
+				}
+			}
+			assertApplication(t, s, post.ID, wantStatus, wantOccupied)
+		})
+	}
+}
+
+func TestAcceptApplicationRefusesAFullPost(t *testing.T) {
+	ctx := context.Background()
+	s, post := newApplicationService(t, NewRepository(), 0)
+
+	first, err := s.Apply(ctx, applicantID, ApplyRequest{PostID: post.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Apply(ctx, "second", ApplyRequest{PostID: post.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := s.Apply(ctx, "third", ApplyRequest{PostID: post.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, application := range []*Application{first, second} {
+		if _, err := s.AcceptApplication(ctx, application.ID, ownerID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.AcceptApplication(ctx, third.ID, ownerID); !errors.Is(err, ErrNoRoomsLeft) {
+		t.Fatalf("AcceptApplication() on a full post error = %v, want %v", err, ErrNoRoomsLeft)
+	}
+	if _, err := s.AcceptApplication(ctx, first.ID, ownerID); !errors.Is(err, ErrApplicationClosed) {
+		t.Errorf("accepting twice error = %v, want %v", err, ErrApplicationClosed)
+	}
+	if _, err := s.Apply(ctx, "fourth", ApplyRequest{PostID: post.ID}); !errors.Is(err, ErrNoRoomsLeft) {
+		t.Errorf("Apply() to a full post error = %v, want %v", err, ErrNoRoomsLeft)
+	}
+
+	got, err := s.GetPost(ctx, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RoomsOccupied != 2 {
+		t.Errorf("RoomsOccupied = %d, want 2", got.RoomsOccupied)
+	}
+}
+
+func TestAcceptApplicationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s, post := newApplicationService(t, failingOccupancyRepository{NewRepository()}, 0)
+
+	application, err := s.Apply(ctx, applicantID, ApplyRequest{PostID: post.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AcceptApplication(ctx, application.ID, ownerID); !errors.Is(err, errInjected) {
+		t.Fatalf("AcceptApplication() error = %v, want %v", err, errInjected)
+	}
+
+	// Marking the application accepted is undone with the failed occupancy
+	// update, so it can be decided again
+	assertApplication(t, s, post.ID, ApplicationPending, 0)
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	s, post := newApplicationService(t, NewRepository(), 0)
+
+	if _, err := s.Apply(ctx, ownerID, ApplyRequest{PostID: post.ID}); !errors.Is(err, ErrOwnPost) {
+		t.Errorf("applying to your own post error = %v, want %v", err, ErrOwnPost)
+	}
+	if _, err := s.Apply(ctx, applicantID, ApplyRequest{PostID: "missing"}); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("applying to a missing post error = %v, want %v", err, ErrPostNotFound)
+	}
+
+	application, err := s.Apply(ctx, applicantID, ApplyRequest{PostID: post.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Apply(ctx, applicantID, ApplyRequest{PostID: post.ID}); !errors.Is(err, ErrAlreadyApplied) {
+		t.Errorf("applying twice error = %v, want %v", err, ErrAlreadyApplied)
+	}
+
+	if _, err := s.RejectApplication(ctx, application.ID, ownerID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Apply(ctx, applicantID, ApplyRequest{PostID: post.ID}); err != nil {
+		t.Errorf("applying again after a rejection: %v", err)
+	}
+	if _, err := s.ListApplications(ctx, post.ID, applicantID); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("ListApplications() by the applicant error = %v, want %v", err, ErrNotOwner)
+	}
+}
+
+// assertApplication checks the only application on a post and the post's
+// occupied rooms
+func assertApplication(t *testing.T, s *Service, postID, status string, occupied int) {
+	t.Helper()
+	ctx := context.Background()
+
+	applications, err := s.ListApplications(ctx, postID, ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applications) != 1 || applications[0].Status != status {
+		t.Errorf("applications = %+v, want one %s", applications, status)
+	}
+
+	post, err := s.GetPost(ctx, postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.RoomsOccupied != occupied {
+		t.Errorf("RoomsOccupied = %d, want %d", post.RoomsOccupied, occupied)
+	}
+}
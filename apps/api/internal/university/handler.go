@@ -0,0 +1,27 @@
+package university
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the university registry
+type Handler struct {
+	registry *Registry
+}
+
+// NewHandler creates a new university handler
+func NewHandler(registry *Registry) *Handler {
+	return &Handler{registry: registry}
+}
+
+// ListUniversities returns every university that supports email verification
+func (h *Handler) ListUniversities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.registry.All())
+}
@@ -0,0 +1,170 @@
+package university
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownUniversity is returned for university IDs missing from the registry
+var ErrUnknownUniversity = errors.New("unknown university")
+
+// bundled is the registry shipped with the binary
+//
+//go:embed universities.json
+var bundled []byte
+
+// University represents a school and the email domains it issues to students
+type University struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Domains []string `json:"domains"`
+}
+
+// Registry maps universities to their allowed email domains
+type Registry struct {
+	byID     map[string]*University
+	byDomain map[string]*University
+}
+
+// NewRegistry builds a registry from a list of universities. Domains must be
+// unique across universities.
+func NewRegistry(universities []*University) (*Registry, error) {
+	r := &Registry{
+		byID:     make(map[string]*University),
+		byDomain: make(map[string]*University),
+	}
+
+	for _, u := range universities {
+		if u.ID == "" || u.Name == "" || len(u.Domains) == 0 {
+			return nil, fmt.Errorf("university %q needs an id, a name and at least one domain", u.ID)
+		}
+		if _, exists := r.byID[u.ID]; exists {
+			return nil, fmt.Errorf("duplicate university id: %s", u.ID)
+		}
+		r.byID[u.ID] = u
+
+		for i, domain := range u.Domains {
+			domain = strings.ToLower(strings.TrimSpace(domain))
+			u.Domains[i] = domain
+			if other, exists := r.byDomain[domain]; exists {
+				return nil, fmt.Errorf("domain %s is claimed by both %s and %s", domain, other.ID, u.ID)
+			}
+			r.byDomain[domain] = u
+		}
+	}
+
+	return r, nil
+}
+
+// Default returns the registry bundled with the binary
+func Default() (*Registry, error) {
+	return LoadJSON(bytes.NewReader(bundled))
+}
+
+// LoadFile loads a registry from a .json or .csv file
+func LoadFile(path string) (*Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return LoadJSON(f)
+	case ".csv":
+		return LoadCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported university registry format: %s", path)
+	}
+}
+
+// LoadJSON loads a registry from a JSON array of universities
+func LoadJSON(r io.Reader) (*Registry, error) {
+	var universities []*University
+	if err := json.NewDecoder(r).Decode(&universities); err != nil {
+		return nil, fmt.Errorf("failed to parse university registry: %w", err)
+	}
+	return NewRegistry(universities)
+}
+
+// LoadCSV loads a registry from CSV rows of "id,name,domains", where domains
+// are separated by semicolons. A header row starting with "id" is skipped.
+func LoadCSV(r io.Reader) (*Registry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse university registry: %w", err)
+	}
+
+	universities := make([]*University, 0, len(records))
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "id") {
+			continue
+		}
+		universities = append(universities, &University{
+			ID:      strings.TrimSpace(record[0]),
+			Name:    strings.TrimSpace(record[1]),
+			Domains: strings.Split(record[2], ";"),
+		})
+	}
+	return NewRegistry(universities)
+}
+
+// Get retrieves a university by ID
+func (r *Registry) Get(id string) (*University, bool) {
+	u, ok := r.byID[id]
+	return u, ok
+}
+
+// All returns every university, sorted by name
+func (r *Registry) All() []*University {
+	universities := make([]*University, 0, len(r.byID))
+	for _, u := range r.byID {
+		universities = append(universities, u)
+	}
+	sort.Slice(universities, func(i, j int) bool {
+		return universities[i].Name < universities[j].Name
+	})
+	return universities
+}
+
+// LookupEmail returns the university that issued an email address. Addresses
+// on subdomains of a registered domain (e.g. cs.example.edu) also match.
+func (r *Registry) LookupEmail(email string) (*University, bool) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil, false
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+	for domain != "" {
+		if u, ok := r.byDomain[domain]; ok {
+			return u, true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+	return nil, false
+}
+
+// Allows reports whether an email address belongs to the given university
+func (r *Registry) Allows(universityID, email string) bool {
+	u, ok := r.LookupEmail(email)
+	return ok && u.ID == universityID
+}
@@ -2,25 +2,24 @@ package user
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"sanctor/internal/database"
+	"sanctor/internal/authctx"
 )
 
-// Initialize repository and service (defaults to in-memory)
-var (
-	repo    Repository = NewRepository()
-	service            = NewService(repo)
-)
+// Handler handles HTTP requests for users
+type Handler struct {
+	service *Service
+}
 
-// InitWithDatabase initializes the user module with a database connection
-func InitWithDatabase(db *database.DB) {
-	repo = NewPostgresRepository(db)
-	service = NewService(repo)
+// NewHandler creates a new user handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
 }
 
-// GetUsers returns all users
-func GetUsers(w http.ResponseWriter, r *http.Request) {
+// GetUsers returns the public profiles of all users
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -29,17 +28,21 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	
-	users, err := service.GetAllUsers()
+	users, err := h.service.GetAllUsers(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	
-	json.NewEncoder(w).Encode(users)
+	profiles := make([]*PublicUser, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, user.ToPublicUser())
+	}
+	json.NewEncoder(w).Encode(profiles)
 }
 
-// GetUser returns a single user by ID
-func GetUser(w http.ResponseWriter, r *http.Request) {
+// GetUser returns a single user's public profile by ID
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -54,48 +57,17 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := service.GetUser(id)
+	user, err := h.service.GetUser(r.Context(), id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	json.NewEncoder(w).Encode(user)
-}
-
-// CreateUser creates a new user
-func CreateUser(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-
-	var req CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	user, err := service.CreateUser(req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(user.ToPublicUser())
 }
 
 // UpdateUser updates an existing user
-func UpdateUser(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w)
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -109,9 +81,8 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	id, ok := actingUserID(w, r)
+	if !ok {
 		return
 	}
 
@@ -121,40 +92,41 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := service.UpdateUser(id, req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	// Whoever controls the address controls the account, so only a signed-in user may change it
+	if identity, ok := authctx.FromContext(r.Context()); ok && identity.APIKeyID != "" && req.Email != "" {
+		http.Error(w, "API keys cannot change the email address", http.StatusForbidden)
 		return
 	}
 
-	json.NewEncoder(w).Encode(user)
-}
-
-// DeleteUser deletes a user
-func DeleteUser(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	user, err := h.service.UpdateUser(r.Context(), id, req)
+	if errors.Is(err, ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
-
-	if r.Method != "DELETE" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
+	json.NewEncoder(w).Encode(user)
+}
+
+// actingUserID resolves the user a self-service request targets. The "id"
+// query parameter is optional, but when given it must match the
+// authenticated user; users can only modify their own account.
+func actingUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, ok := authctx.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return "", false
 	}
 
-	if err := service.DeleteUser(id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+	if id := r.URL.Query().Get("id"); id != "" && id != userID {
+		http.Error(w, "You can only modify your own account", http.StatusForbidden)
+		return "", false
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	return userID, true
 }
 
 func enableCORS(w *http.ResponseWriter) {
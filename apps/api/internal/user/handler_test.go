@@ -0,0 +1,86 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sanctor/internal/database"
+)
+
+func TestProfilesArePublic(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(NewRepository(), database.NewMemoryTransactor())
+	service.SetPasswordHasher(NewArgon2idHasher(Argon2idParams{
+		Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}))
+	u, err := service.CreateUser(ctx, CreateUserRequest{
+		Email:      "ada@example.com",
+		Username:   "ada",
+		Password:   "analytical-engine-1843",
+		University: "University of London",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetUniversityVerified(ctx, u.ID, "University of London", "ada@london.ac.uk"); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(service)
+
+	tests := []struct {
+		name   string
+		target string
+		serve  http.HandlerFunc
+		decode func(body []byte) ([]map[string]interface{}, error)
+	}{
+		{
+			name:   "list",
+			target: "/api/users",
+			serve:  handler.GetUsers,
+			decode: func(body []byte) ([]map[string]interface{}, error) {
+				var profiles []map[string]interface{}
+				err := json.Unmarshal(body, &profiles)
+				return profiles, err
+			},
+		},
+		{
+			name:   "get",
+			target: "/api/users/get?id=" + u.ID,
+			serve:  handler.GetUser,
+			decode: func(body []byte) ([]map[string]interface{}, error) {
+				var profile map[string]interface{}
+				err := json.Unmarshal(body, &profile)
+				return []map[string]interface{}{profile}, err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.serve(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+			}
+
+			profiles, err := tt.decode(rec.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(profiles) != 1 {
+				t.Fatalf("got %d profiles, want 1", len(profiles))
+			}
+			if profiles[0]["universityVerified"] != true {
+				t.Error("the verified student badge is missing")
+			}
+			for _, field := range []string{"email", "universityEmail", "role", "isActive"} {
+				if _, ok := profiles[0][field]; ok {
+					t.Errorf("profile exposes %s", field)
+				}
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ type User struct {
 	Bio          string     `json:"bio,omitempty" gorm:"type:text"`
 	IsActive     bool       `json:"isActive" gorm:"default:true"`
 	IsVerified   bool       `json:"isVerified" gorm:"default:false"`
+	Role         string     `json:"role" gorm:"type:varchar(20);not null;default:'user'"`
 	LastLoginAt  *time.Time `json:"lastLoginAt,omitempty"`
 	CreatedAt    time.Time  `json:"createdAt" gorm:"autoCreateTime"`
 	UpdatedAt    time.Time  `json:"updatedAt" gorm:"autoUpdateTime"`
@@ -23,6 +24,50 @@ type User struct {
 	Age          *int       `json:"age,omitempty"`
 	University   string     `json:"university,omitempty" gorm:"type:varchar(200)"`
 	Major        *string    `json:"major,omitempty" gorm:"type:varchar(100)"`
+
+	// Email verification: VerifiedEmail is the address the user last
+	// confirmed. Privileges tied to an address require it to match Email.
+	VerifiedEmail string `json:"-" gorm:"type:varchar(255);not null;default:''"`
+
+	// University verification: set only after the user confirmed an address
+	// on one of the university's registered email domains
+	UniversityEmail      string     `json:"universityEmail,omitempty" gorm:"type:varchar(255);not null;default:''"`
+	UniversityVerifiedAt *time.Time `json:"universityVerifiedAt,omitempty"`
+
+	// Deactivation: DeactivatedBy is DeactivatedBySelf or DeactivatedByAdmin.
+	// A user can only undo their own deactivation. A scheduled deletion is
+	// carried out once DeletionScheduledAt has passed.
+	DeactivatedAt       *time.Time `json:"deactivatedAt,omitempty"`
+	DeactivatedBy       string     `json:"-" gorm:"type:varchar(20);not null;default:''"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty" gorm:"index"`
+}
+
+// Who deactivated an account
+const (
+	DeactivatedBySelf  = "self"
+	DeactivatedByAdmin = "admin"
+)
+
+// Site-wide roles, from least to most privileged. Moderators can remove
+// content; admins can also manage accounts and roles.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+// ValidRole reports whether role is one of the site-wide roles
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of min
+func RoleAtLeast(role, min string) bool {
+	rank, ok := roleRank[role]
+	return ok && rank >= roleRank[min]
 }
 
 // FullName returns the user's full name
@@ -33,6 +78,11 @@ func (u *User) FullName() string {
 	return u.Username
 }
 
+// IsUniversityVerified reports whether the user proved they study at their university
+func (u *User) IsUniversityVerified() bool {
+	return u.UniversityVerifiedAt != nil
+}
+
 // ToPublicUser returns a user object safe for public display
 func (u *User) ToPublicUser() *PublicUser {
 	return &PublicUser{
@@ -47,6 +97,8 @@ func (u *User) ToPublicUser() *PublicUser {
 		University: u.University,
 		Major:      u.Major,
 		CreatedAt:  u.CreatedAt,
+
+		UniversityVerified: u.IsUniversityVerified(),
 	}
 }
 
@@ -63,6 +115,47 @@ type PublicUser struct {
 	University string    `json:"university,omitempty"`
 	Major      *string   `json:"major,omitempty"`
 	CreatedAt  time.Time `json:"createdAt"`
+
+	// UniversityVerified backs the "verified student" badge on listings
+	UniversityVerified bool `json:"universityVerified"`
+}
+
+// ToAdminUser returns the account details an administrator manages
+func (u *User) ToAdminUser() *AdminUser {
+	return &AdminUser{
+		ID:                  u.ID,
+		Email:               u.Email,
+		Username:            u.Username,
+		FirstName:           u.FirstName,
+		LastName:            u.LastName,
+		Role:                u.Role,
+		IsActive:            u.IsActive,
+		IsVerified:          u.IsVerified,
+		UniversityVerified:  u.IsUniversityVerified(),
+		DeactivatedBy:       u.DeactivatedBy,
+		DeactivatedAt:       u.DeactivatedAt,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+		LastLoginAt:         u.LastLoginAt,
+		CreatedAt:           u.CreatedAt,
+	}
+}
+
+// AdminUser represents user data shown in the admin user list
+type AdminUser struct {
+	ID                  string     `json:"id"`
+	Email               string     `json:"email"`
+	Username            string     `json:"username"`
+	FirstName           string     `json:"firstName,omitempty"`
+	LastName            string     `json:"lastName,omitempty"`
+	Role                string     `json:"role"`
+	IsActive            bool       `json:"isActive"`
+	IsVerified          bool       `json:"isVerified"`
+	UniversityVerified  bool       `json:"universityVerified"`
+	DeactivatedBy       string     `json:"deactivatedBy,omitempty"`
+	DeactivatedAt       *time.Time `json:"deactivatedAt,omitempty"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty"`
+	LastLoginAt         *time.Time `json:"lastLoginAt,omitempty"`
+	CreatedAt           time.Time  `json:"createdAt"`
 }
 
 // CreateUserRequest represents the data needed to create a new user
@@ -0,0 +1,202 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes and verifies passwords. Encoded hashes are
+// self-describing: they name the algorithm and carry its parameters, so a
+// hash made with older settings can still be verified and then upgraded.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password
+	Hash(password string) (string, error)
+	// Supports reports whether an encoded hash was made by this algorithm
+	Supports(encoded string) bool
+	// Verify reports whether a password matches an encoded hash
+	Verify(password, encoded string) bool
+	// NeedsRehash reports whether an encoded hash of this algorithm was made
+	// with parameters other than the hasher's current ones
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idParams configures Argon2id hashing
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the second recommended option of RFC 9106
+// with a lower degree of parallelism
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes passwords with Argon2id. Hashes use the PHC string
+// format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher creates an Argon2id hasher
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+// Hash returns the encoded Argon2id hash of a password
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Supports reports whether an encoded hash is an Argon2id hash
+func (h *Argon2idHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// Verify reports whether a password matches an encoded Argon2id hash
+func (h *Argon2idHasher) Verify(password, encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+// NeedsRehash reports whether an Argon2id hash was made with other parameters
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.params.Memory || params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		uint32(len(salt)) != h.params.SaltLength || uint32(len(key)) != h.params.KeyLength
+}
+
+// decodeArgon2id parses an encoded Argon2id hash
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. It was the only algorithm
+// before Argon2id and remains available to verify older hashes.
+type BcryptHasher struct {
+	cost int
+}
+
+// DefaultBcryptCost is the cost bcrypt hashes were made with before Argon2id
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+// NewBcryptHasher creates a bcrypt hasher
+func NewBcryptHasher(cost int) (*BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &BcryptHasher{cost: cost}, nil
+}
+
+// Hash returns the bcrypt hash of a password
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// Supports reports whether an encoded hash is a bcrypt hash
+func (h *BcryptHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Verify reports whether a password matches a bcrypt hash
+func (h *BcryptHasher) Verify(password, encoded string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether a bcrypt hash was made with another cost
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// knownHashers can verify hashes made by algorithms other than the current one
+var knownHashers = []PasswordHasher{
+	NewArgon2idHasher(DefaultArgon2idParams),
+	&BcryptHasher{cost: DefaultBcryptCost},
+}
+
+// SetPasswordHasher replaces the hasher used for new passwords. Hashes made
+// by any supported algorithm keep verifying, and are upgraded on the next
+// successful sign-in.
+func (s *Service) SetPasswordHasher(hasher PasswordHasher) {
+	s.hasher = hasher
+}
+
+// hasherFor returns the hasher that can verify an encoded hash
+func (s *Service) hasherFor(encoded string) PasswordHasher {
+	if s.hasher.Supports(encoded) {
+		return s.hasher
+	}
+	for _, hasher := range knownHashers {
+		if hasher.Supports(encoded) {
+			return hasher
+		}
+	}
+	return nil
+}
+
+// needsRehash reports whether an encoded hash should be replaced by one
+// made with the current hasher and parameters
+func (s *Service) needsRehash(encoded string) bool {
+	return !s.hasher.Supports(encoded) || s.hasher.NeedsRehash(encoded)
+}
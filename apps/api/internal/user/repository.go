@@ -1,10 +1,22 @@
 package user
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-// InMemoryRepository handles data persistence for users in memory
+	"sanctor/internal/database"
+)
+
+// InMemoryRepository handles data persistence for users in memory. Like
+// the database, it stores and hands out copies, so a change only takes
+// effect once it is saved and can be undone if a unit of work fails.
 type InMemoryRepository struct {
 	users map[string]*User
+	mu    sync.RWMutex
 }
 
 // NewRepository creates a new in-memory user repository
@@ -15,89 +27,264 @@ func NewRepository() Repository {
 }
 
 // Create adds a new user to the repository
-func (r *InMemoryRepository) Create(user *User) error {
+func (r *InMemoryRepository) Create(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if user == nil {
 		return errors.New("user cannot be nil")
 	}
-	r.users[user.ID] = user
+	r.users[user.ID] = clone(user)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.users, user.ID)
+	})
 	return nil
 }
 
 // FindByID retrieves a user by ID
-func (r *InMemoryRepository) FindByID(id string) (*User, error) {
+func (r *InMemoryRepository) FindByID(ctx context.Context, id string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	user, exists := r.users[id]
 	if !exists {
 		return nil, errors.New("user not found")
 	}
-	return user, nil
+	return clone(user), nil
+}
+
+// FindByIDForUpdate retrieves a user by ID to change it. Units of work on
+// the in-memory transactor run one at a time, so no lock is needed.
+func (r *InMemoryRepository) FindByIDForUpdate(ctx context.Context, id string) (*User, error) {
+	return r.FindByID(ctx, id)
 }
 
 // FindAll retrieves all users
-func (r *InMemoryRepository) FindAll() []*User {
+func (r *InMemoryRepository) FindAll(ctx context.Context) ([]*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	userList := make([]*User, 0, len(r.users))
 	for _, user := range r.users {
-		userList = append(userList, user)
+		userList = append(userList, clone(user))
 	}
-	return userList
+	return userList, nil
 }
 
 // Update updates an existing user
-func (r *InMemoryRepository) Update(user *User) error {
+func (r *InMemoryRepository) Update(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if user == nil {
 		return errors.New("user cannot be nil")
 	}
-	if _, exists := r.users[user.ID]; !exists {
+	previous, exists := r.users[user.ID]
+	if !exists {
 		return errors.New("user not found")
 	}
-	r.users[user.ID] = user
+	r.users[user.ID] = clone(user)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.users[user.ID] = previous
+	})
+	return nil
+}
+
+// UpdatePasswordHash replaces a user's password hash if it is still
+// oldHash, and reports whether it was replaced
+func (r *InMemoryRepository) UpdatePasswordHash(ctx context.Context, id, oldHash, newHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.users[id]
+	if !exists {
+		return false, errors.New("user not found")
+	}
+	if stored.PasswordHash != oldHash {
+		return false, nil
+	}
+	updated := clone(stored)
+	updated.PasswordHash = newHash
+	updated.UpdatedAt = time.Now()
+	r.users[id] = updated
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if current, exists := r.users[id]; exists && current.PasswordHash == newHash {
+			restored := clone(current)
+			restored.PasswordHash = oldHash
+			r.users[id] = restored
+		}
+	})
+	return true, nil
+}
+
+// UpdateLastLogin sets the time of a user's latest sign-in, leaving the
+// rest of the record as it is
+func (r *InMemoryRepository) UpdateLastLogin(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.users[id]
+	if !exists {
+		return errors.New("user not found")
+	}
+	previous := stored.LastLoginAt
+	updated := clone(stored)
+	updated.LastLoginAt = &at
+	r.users[id] = updated
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if current, exists := r.users[id]; exists {
+			restored := clone(current)
+			restored.LastLoginAt = previous
+			r.users[id] = restored
+		}
+	})
 	return nil
 }
 
 // Delete removes a user from the repository
-func (r *InMemoryRepository) Delete(id string) error {
-	if _, exists := r.users[id]; !exists {
+func (r *InMemoryRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, exists := r.users[id]
+	if !exists {
 		return errors.New("user not found")
 	}
 	delete(r.users, id)
+	database.OnRollback(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.users[id] = previous
+	})
 	return nil
 }
 
 // ExistsByEmail checks if a user with the given email exists
-func (r *InMemoryRepository) ExistsByEmail(email string) bool {
+func (r *InMemoryRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	email = NormalizeEmail(email)
 	for _, user := range r.users {
 		if user.Email == email {
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
+}
+
+// ExistsByUniversityEmail checks if a user other than exceptID verified the
+// given university email
+func (r *InMemoryRepository) ExistsByUniversityEmail(ctx context.Context, email, exceptID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	email = NormalizeEmail(email)
+	for _, user := range r.users {
+		if user.ID != exceptID && user.UniversityEmail == email && user.IsUniversityVerified() {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // ExistsByUsername checks if a user with the given username exists
-func (r *InMemoryRepository) ExistsByUsername(username string) bool {
+func (r *InMemoryRepository) ExistsByUsername(ctx context.Context, username string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	for _, user := range r.users {
 		if user.Username == username {
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 // FindByEmail retrieves a user by email
-func (r *InMemoryRepository) FindByEmail(email string) (*User, error) {
+func (r *InMemoryRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	email = NormalizeEmail(email)
 	for _, user := range r.users {
 		if user.Email == email {
-			return user, nil
+			return clone(user), nil
 		}
 	}
 	return nil, errors.New("user not found")
 }
 
 // FindByUsername retrieves a user by username
-func (r *InMemoryRepository) FindByUsername(username string) (*User, error) {
+func (r *InMemoryRepository) FindByUsername(ctx context.Context, username string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	for _, user := range r.users {
 		if user.Username == username {
-			return user, nil
+			return clone(user), nil
 		}
 	}
 	return nil, errors.New("user not found")
 }
+
+// Search finds users whose email, username or name contains query, newest
+// first, and returns one page of them with the total number of matches
+func (r *InMemoryRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	matches := make([]*User, 0)
+	for _, user := range r.users {
+		if query == "" ||
+			strings.Contains(strings.ToLower(user.Email), query) ||
+			strings.Contains(strings.ToLower(user.Username), query) ||
+			strings.Contains(strings.ToLower(user.FirstName), query) ||
+			strings.Contains(strings.ToLower(user.LastName), query) {
+			matches = append(matches, clone(user))
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	total := len(matches)
+	if offset >= total {
+		return []*User{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return matches[offset:end], total, nil
+}
+
+// FindDueForDeletion retrieves users whose scheduled deletion is due before the given time
+func (r *InMemoryRepository) FindDueForDeletion(ctx context.Context, before time.Time) ([]*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*User, 0)
+	for _, user := range r.users {
+		if user.DeletionScheduledAt != nil && user.DeletionScheduledAt.Before(before) {
+			users = append(users, clone(user))
+		}
+	}
+	return users, nil
+}
+
+// clone copies a user so callers cannot change the stored record
+func clone(user *User) *User {
+	c := *user
+	return &c
+}
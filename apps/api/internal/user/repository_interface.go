@@ -1,14 +1,26 @@
 package user
 
-// Repository defines the interface for user data access
+import (
+	"context"
+	"time"
+)
+
+// Repository defines the interface for user data access. Calls made with
+// the context of a unit of work take part in it.
 type Repository interface {
-	Create(user *User) error
-	FindByID(id string) (*User, error)
-	FindAll() []*User
-	Update(user *User) error
-	Delete(id string) error
-	ExistsByEmail(email string) bool
-	ExistsByUsername(username string) bool
-	FindByEmail(email string) (*User, error)
-	FindByUsername(username string) (*User, error)
+	Create(ctx context.Context, user *User) error
+	FindByID(ctx context.Context, id string) (*User, error)
+	FindByIDForUpdate(ctx context.Context, id string) (*User, error)
+	FindAll(ctx context.Context) ([]*User, error)
+	Update(ctx context.Context, user *User) error
+	UpdatePasswordHash(ctx context.Context, id, oldHash, newHash string) (bool, error)
+	UpdateLastLogin(ctx context.Context, id string, at time.Time) error
+	Delete(ctx context.Context, id string) error
+	ExistsByEmail(ctx context.Context, email string) (bool, error)
+	ExistsByUsername(ctx context.Context, username string) (bool, error)
+	ExistsByUniversityEmail(ctx context.Context, email, exceptID string) (bool, error)
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByUsername(ctx context.Context, username string) (*User, error)
+	Search(ctx context.Context, query string, limit, offset int) ([]*User, int, error)
+	FindDueForDeletion(ctx context.Context, before time.Time) ([]*User, error)
 }
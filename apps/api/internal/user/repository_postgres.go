@@ -1,12 +1,19 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"sanctor/internal/database"
 )
 
+// verifiedUniversityEmailIndex keeps a university email from verifying
+// more than one account
+const verifiedUniversityEmailIndex = "idx_users_verified_university_email"
+
 // PostgresRepository implements Repository interface for PostgreSQL
 type PostgresRepository struct {
 	db *database.DB
@@ -18,7 +25,10 @@ func NewPostgresRepository(db *database.DB) Repository {
 }
 
 // Create adds a new user to the database
-func (r *PostgresRepository) Create(user *User) error {
+func (r *PostgresRepository) Create(ctx context.Context, user *User) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
 	if user == nil {
 		return errors.New("user cannot be nil")
 	}
@@ -27,35 +37,83 @@ func (r *PostgresRepository) Create(user *User) error {
 		INSERT INTO users (
 			id, email, username, first_name, last_name, password_hash,
 			avatar, bio, is_active, is_verified,last_login_at,
-			created_at, updated_at, gender, age, university, major
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			created_at, updated_at, gender, age, university, major,
+			university_email, university_verified_at, role,
+			deactivated_at, deactivated_by, deletion_scheduled_at, verified_email
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
 	`
 
-	_, err := r.db.Exec(query,
+	_, err := r.db.ExecContext(ctx, query,
 		user.ID, user.Email, user.Username, user.FirstName, user.LastName,
 		user.PasswordHash, user.Avatar, user.Bio, user.IsActive, user.IsVerified,
 		user.LastLoginAt, user.CreatedAt, user.UpdatedAt,
 		user.Gender, user.Age, user.University, user.Major,
+		user.UniversityEmail, user.UniversityVerifiedAt, user.Role,
+		user.DeactivatedAt, user.DeactivatedBy, user.DeletionScheduledAt, user.VerifiedEmail,
 	)
 
 	return err
 }
 
 // FindByID retrieves a user by ID
-func (r *PostgresRepository) FindByID(id string) (*User, error) {
+func (r *PostgresRepository) FindByID(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	user := &User{}
+	query := `
+		SELECT id, email, username, first_name, last_name, password_hash,
+		       avatar, bio, is_active, is_verified, last_login_at,
+		       created_at, updated_at, gender, age, university, major,
+		       university_email, university_verified_at, role,
+		       deactivated_at, deactivated_by, deletion_scheduled_at, verified_email
+		FROM users WHERE id = $1
+	`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName,
+		&user.PasswordHash, &user.Avatar, &user.Bio, &user.IsActive, &user.IsVerified,
+		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
+		&user.Gender, &user.Age, &user.University, &user.Major,
+		&user.UniversityEmail, &user.UniversityVerifiedAt, &user.Role,
+		&user.DeactivatedAt, &user.DeactivatedBy, &user.DeletionScheduledAt, &user.VerifiedEmail,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FindByIDForUpdate retrieves a user by ID and locks the row until the unit
+// of work in ctx ends, so the user cannot change between the read and the
+// write. It must be called within a unit of work.
+func (r *PostgresRepository) FindByIDForUpdate(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	user := &User{}
 	query := `
 		SELECT id, email, username, first_name, last_name, password_hash,
 		       avatar, bio, is_active, is_verified, last_login_at,
-		       created_at, updated_at, gender, age, university, major
+		       created_at, updated_at, gender, age, university, major,
+		       university_email, university_verified_at, role,
+		       deactivated_at, deactivated_by, deletion_scheduled_at, verified_email
 		FROM users WHERE id = $1
+		FOR UPDATE
 	`
 
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName,
 		&user.PasswordHash, &user.Avatar, &user.Bio, &user.IsActive, &user.IsVerified,
 		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
 		&user.Gender, &user.Age, &user.University, &user.Major,
+		&user.UniversityEmail, &user.UniversityVerifiedAt, &user.Role,
+		&user.DeactivatedAt, &user.DeactivatedBy, &user.DeletionScheduledAt, &user.VerifiedEmail,
 	)
 
 	if err == sql.ErrNoRows {
@@ -69,18 +127,23 @@ func (r *PostgresRepository) FindByID(id string) (*User, error) {
 }
 
 // FindAll retrieves all users
-func (r *PostgresRepository) FindAll() []*User {
+func (r *PostgresRepository) FindAll(ctx context.Context) ([]*User, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, email, username, first_name, last_name, password_hash,
 		       avatar, bio, is_active, is_verified, last_login_at,
-		       created_at, updated_at, gender, age, university, major
+		       created_at, updated_at, gender, age, university, major,
+		       university_email, university_verified_at, role,
+		       deactivated_at, deactivated_by, deletion_scheduled_at, verified_email
 		FROM users
 		ORDER BY created_at DESC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
-		return []*User{}
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -92,17 +155,23 @@ func (r *PostgresRepository) FindAll() []*User {
 			&user.PasswordHash, &user.Avatar, &user.Bio, &user.IsActive, &user.IsVerified,
 			&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
 			&user.Gender, &user.Age, &user.University, &user.Major,
+			&user.UniversityEmail, &user.UniversityVerifiedAt, &user.Role,
+			&user.DeactivatedAt, &user.DeactivatedBy, &user.DeletionScheduledAt, &user.VerifiedEmail,
 		)
-		if err == nil {
-			users = append(users, user)
+		if err != nil {
+			return nil, err
 		}
+		users = append(users, user)
 	}
 
-	return users
+	return users, rows.Err()
 }
 
 // Update modifies an existing user
-func (r *PostgresRepository) Update(user *User) error {
+func (r *PostgresRepository) Update(ctx context.Context, user *User) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
 	if user == nil {
 		return errors.New("user cannot be nil")
 	}
@@ -112,16 +181,71 @@ func (r *PostgresRepository) Update(user *User) error {
 			email = $2, username = $3, first_name = $4, last_name = $5,
 			password_hash = $6, avatar = $7, bio = $8, is_active = $9,
 			is_verified = $10, last_login_at = $11, updated_at = $12,
-			gender = $13, age = $14, university = $15, major = $16
+			gender = $13, age = $14, university = $15, major = $16,
+			university_email = $17, university_verified_at = $18, role = $19,
+			deactivated_at = $20, deactivated_by = $21, deletion_scheduled_at = $22,
+			verified_email = $23
 		WHERE id = $1
 	`
 
-	result, err := r.db.Exec(query,
+	result, err := r.db.ExecContext(ctx, query,
 		user.ID, user.Email, user.Username, user.FirstName, user.LastName,
 		user.PasswordHash, user.Avatar, user.Bio, user.IsActive, user.IsVerified,
 		user.LastLoginAt, user.UpdatedAt,
 		user.Gender, user.Age, user.University, user.Major,
+		user.UniversityEmail, user.UniversityVerifiedAt, user.Role,
+		user.DeactivatedAt, user.DeactivatedBy, user.DeletionScheduledAt, user.VerifiedEmail,
 	)
+	// Another account may have verified the address in the meantime
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == verifiedUniversityEmailIndex {
+		return ErrUniversityEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// UpdatePasswordHash replaces a user's password hash if it is still
+// oldHash, and reports whether it was replaced. The comparison and the write
+// are one statement, so a password changed meanwhile is never overwritten.
+func (r *PostgresRepository) UpdatePasswordHash(ctx context.Context, id, oldHash, newHash string) (bool, error) {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET password_hash = $3, updated_at = $4 WHERE id = $1 AND password_hash = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, oldHash, newHash, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// UpdateLastLogin sets the time of a user's latest sign-in. Only that
+// column is written, so a login never undoes a change made meanwhile.
+func (r *PostgresRepository) UpdateLastLogin(ctx context.Context, id string, at time.Time) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET last_login_at = $2 WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, at)
 	if err != nil {
 		return err
 	}
@@ -138,10 +262,13 @@ func (r *PostgresRepository) Update(user *User) error {
 }
 
 // Delete removes a user from the database
-func (r *PostgresRepository) Delete(id string) error {
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	ctx, cancel := r.db.WriteContext(ctx)
+	defer cancel()
+
 	query := `DELETE FROM users WHERE id = $1`
 
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -158,36 +285,62 @@ func (r *PostgresRepository) Delete(id string) error {
 }
 
 // ExistsByEmail checks if a user with the given email exists
-func (r *PostgresRepository) ExistsByEmail(email string) bool {
+func (r *PostgresRepository) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
-	err := r.db.QueryRow(query, email).Scan(&exists)
-	return err == nil && exists
+	err := r.db.QueryRowContext(ctx, query, NormalizeEmail(email)).Scan(&exists)
+	return exists, err
+}
+
+// ExistsByUniversityEmail checks if a user other than exceptID verified the
+// given university email
+func (r *PostgresRepository) ExistsByUniversityEmail(ctx context.Context, email, exceptID string) (bool, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users
+	          WHERE university_email = $1 AND university_verified_at IS NOT NULL AND id <> $2)`
+	err := r.db.QueryRowContext(ctx, query, NormalizeEmail(email), exceptID).Scan(&exists)
+	return exists, err
 }
 
 // ExistsByUsername checks if a user with the given username exists
-func (r *PostgresRepository) ExistsByUsername(username string) bool {
+func (r *PostgresRepository) ExistsByUsername(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`
-	err := r.db.QueryRow(query, username).Scan(&exists)
-	return err == nil && exists
+	err := r.db.QueryRowContext(ctx, query, username).Scan(&exists)
+	return exists, err
 }
 
 // FindByEmail retrieves a user by email
-func (r *PostgresRepository) FindByEmail(email string) (*User, error) {
+func (r *PostgresRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	user := &User{}
 	query := `
 		SELECT id, email, username, first_name, last_name, password_hash,
 		       avatar, bio, is_active, is_verified, last_login_at,
-		       created_at, updated_at, gender, age, university, major
+		       created_at, updated_at, gender, age, university, major,
+		       university_email, university_verified_at, role,
+		       deactivated_at, deactivated_by, deletion_scheduled_at, verified_email
 		FROM users WHERE email = $1
 	`
 
-	err := r.db.QueryRow(query, email).Scan(
+	err := r.db.QueryRowContext(ctx, query, NormalizeEmail(email)).Scan(
 		&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName,
 		&user.PasswordHash, &user.Avatar, &user.Bio, &user.IsActive, &user.IsVerified,
 		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
 		&user.Gender, &user.Age, &user.University, &user.Major,
+		&user.UniversityEmail, &user.UniversityVerifiedAt, &user.Role,
+		&user.DeactivatedAt, &user.DeactivatedBy, &user.DeletionScheduledAt, &user.VerifiedEmail,
 	)
 
 	if err == sql.ErrNoRows {
@@ -201,20 +354,27 @@ func (r *PostgresRepository) FindByEmail(email string) (*User, error) {
 }
 
 // FindByUsername retrieves a user by username
-func (r *PostgresRepository) FindByUsername(username string) (*User, error) {
+func (r *PostgresRepository) FindByUsername(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
 	user := &User{}
 	query := `
 		SELECT id, email, username, first_name, last_name, password_hash,
 		       avatar, bio, is_active, is_verified, last_login_at,
-		       created_at, updated_at, gender, age, university, major
+		       created_at, updated_at, gender, age, university, major,
+		       university_email, university_verified_at, role,
+		       deactivated_at, deactivated_by, deletion_scheduled_at, verified_email
 		FROM users WHERE username = $1
 	`
 
-	err := r.db.QueryRow(query, username).Scan(
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName,
 		&user.PasswordHash, &user.Avatar, &user.Bio, &user.IsActive, &user.IsVerified,
 		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
 		&user.Gender, &user.Age, &user.University, &user.Major,
+		&user.UniversityEmail, &user.UniversityVerifiedAt, &user.Role,
+		&user.DeactivatedAt, &user.DeactivatedBy, &user.DeletionScheduledAt, &user.VerifiedEmail,
 	)
 
 	if err == sql.ErrNoRows {
@@ -226,3 +386,92 @@ func (r *PostgresRepository) FindByUsername(username string) (*User, error) {
 
 	return user, nil
 }
+
+// Search finds users whose email, username or name contains query, newest
+// first, and returns one page of them with the total number of matches
+func (r *PostgresRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, int, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	sqlQuery := `
+		SELECT id, email, username, first_name, last_name, password_hash,
+		       avatar, bio, is_active, is_verified, last_login_at,
+		       created_at, updated_at, gender, age, university, major,
+		       university_email, university_verified_at, role,
+		       deactivated_at, deactivated_by, deletion_scheduled_at, verified_email,
+		       COUNT(*) OVER()
+		FROM users
+		WHERE $1 = '' OR email ILIKE '%' || $1 || '%' OR username ILIKE '%' || $1 || '%'
+		   OR first_name ILIKE '%' || $1 || '%' OR last_name ILIKE '%' || $1 || '%'
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, sqlQuery, query, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	total := 0
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(
+			&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName,
+			&user.PasswordHash, &user.Avatar, &user.Bio, &user.IsActive, &user.IsVerified,
+			&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
+			&user.Gender, &user.Age, &user.University, &user.Major,
+			&user.UniversityEmail, &user.UniversityVerifiedAt, &user.Role,
+			&user.DeactivatedAt, &user.DeactivatedBy, &user.DeletionScheduledAt, &user.VerifiedEmail,
+			&total,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// FindDueForDeletion retrieves users whose scheduled deletion is due before the given time
+func (r *PostgresRepository) FindDueForDeletion(ctx context.Context, before time.Time) ([]*User, error) {
+	ctx, cancel := r.db.ReadContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, email, username, first_name, last_name, password_hash,
+		       avatar, bio, is_active, is_verified, last_login_at,
+		       created_at, updated_at, gender, age, university, major,
+		       university_email, university_verified_at, role,
+		       deactivated_at, deactivated_by, deletion_scheduled_at, verified_email
+		FROM users
+		WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at < $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(
+			&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName,
+			&user.PasswordHash, &user.Avatar, &user.Bio, &user.IsActive, &user.IsVerified,
+			&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
+			&user.Gender, &user.Age, &user.University, &user.Major,
+			&user.UniversityEmail, &user.UniversityVerifiedAt, &user.Role,
+			&user.DeactivatedAt, &user.DeactivatedBy, &user.DeletionScheduledAt, &user.VerifiedEmail,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
@@ -1,25 +1,49 @@
 package user
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"sanctor/internal/database"
+	"sanctor/internal/passwordpolicy"
 )
 
+// ErrEmailTaken is returned when an email address belongs to another account
+var ErrEmailTaken = errors.New("user with this email already exists")
+
 // Service handles business logic for user operations
 type Service struct {
-	repo Repository
+	repo   Repository
+	tx     database.Transactor
+	hasher PasswordHasher
+	policy *passwordpolicy.Policy
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+
+	onEmailChange func(ctx context.Context, user *User, previous string)
 }
 
-// NewService creates a new user service
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+// NewService creates a new user service. Passwords are hashed with Argon2id
+// and checked against the default policy until replaced. Changes that read
+// a user before writing it run as units of work on tx, which must match the
+// repository's storage.
+func NewService(repo Repository, tx database.Transactor) *Service {
+	return &Service{
+		repo:   repo,
+		tx:     tx,
+		hasher: NewArgon2idHasher(DefaultArgon2idParams),
+		policy: passwordpolicy.Default(),
+	}
 }
 
 // CreateUser creates a new user with validation
-func (s *Service) CreateUser(req CreateUserRequest) (*User, error) {
+func (s *Service) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
 	// Validate input
+	req.Email = NormalizeEmail(req.Email)
 	if req.Email == "" || req.Username == "" {
 		return nil, errors.New("email and username are required")
 	}
@@ -32,21 +56,29 @@ func (s *Service) CreateUser(req CreateUserRequest) (*User, error) {
 		return nil, err
 	}
 
-	if req.Password == "" || len(req.Password) < 8 {
-		return nil, errors.New("password must be at least 8 characters")
+	if err := s.ValidatePassword("password", req.Password, req.Email, req.Username, req.FirstName, req.LastName); err != nil {
+		return nil, err
 	}
 
 	// Check if user already exists
-	if s.repo.ExistsByEmail(req.Email) {
-		return nil, errors.New("user with this email already exists")
+	exists, err := s.repo.ExistsByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrEmailTaken
 	}
 
-	if s.repo.ExistsByUsername(req.Username) {
+	exists, err = s.repo.ExistsByUsername(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
 		return nil, errors.New("username already taken")
 	}
 
 	// Hash password
-	hashedPassword, err := HashPassword(req.Password)
+	hashedPassword, err := s.hashPassword(req.Password)
 	if err != nil {
 		return nil, errors.New("failed to hash password")
 	}
@@ -65,11 +97,12 @@ func (s *Service) CreateUser(req CreateUserRequest) (*User, error) {
 		Major:        req.Major,
 		IsActive:     true,
 		IsVerified:   false,
+		Role:         RoleUser,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
-	if err := s.repo.Create(user); err != nil {
+	if err := s.repo.Create(ctx, user); err != nil {
 		return nil, err
 	}
 
@@ -77,12 +110,12 @@ func (s *Service) CreateUser(req CreateUserRequest) (*User, error) {
 }
 
 // GetUser retrieves a user by ID
-func (s *Service) GetUser(id string) (*User, error) {
+func (s *Service) GetUser(ctx context.Context, id string) (*User, error) {
 	if id == "" {
 		return nil, errors.New("user ID is required")
 	}
 
-	user, err := s.repo.FindByID(id)
+	user, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
@@ -91,61 +124,114 @@ func (s *Service) GetUser(id string) (*User, error) {
 }
 
 // GetAllUsers retrieves all users
-func (s *Service) GetAllUsers() ([]*User, error) {
-	return s.repo.FindAll(), nil
+func (s *Service) GetAllUsers(ctx context.Context) ([]*User, error) {
+	return s.repo.FindAll(ctx)
 }
 
 // UpdateUser updates an existing user
-func (s *Service) UpdateUser(id string, req UpdateUserRequest) (*User, error) {
-	user, err := s.repo.FindByID(id)
+func (s *Service) UpdateUser(ctx context.Context, id string, req UpdateUserRequest) (*User, error) {
+	var previousEmail string
+	user, err := s.modify(ctx, id, func(user *User) error {
+		// A new address is unverified until the user confirms it
+		previousEmail = user.Email
+		if email := NormalizeEmail(req.Email); email != "" && email != user.Email {
+			if !ValidateEmail(email) {
+				return errors.New("invalid email format")
+			}
+			taken, err := s.repo.ExistsByEmail(ctx, email)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrEmailTaken
+			}
+			user.IsVerified = false
+			user.Email = email
+		}
+
+		// Update fields if provided
+		if req.FirstName != "" {
+			user.FirstName = req.FirstName
+		}
+		if req.LastName != "" {
+			user.LastName = req.LastName
+		}
+		if req.Avatar != "" {
+			user.Avatar = req.Avatar
+		}
+		if req.Bio != "" {
+			user.Bio = req.Bio
+		}
+		if req.Gender != "" {
+			user.Gender = req.Gender
+		}
+		if req.Age != nil {
+			user.Age = req.Age
+		}
+		if req.University != "" && req.University != user.University {
+			// A verified badge belongs to one school; changing it needs a new proof
+			user.University = req.University
+			user.UniversityEmail = ""
+			user.UniversityVerifiedAt = nil
+		}
+		if req.Major != nil {
+			user.Major = req.Major
+		}
+		user.UpdatedAt = time.Now()
+		return nil
+	})
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, err
 	}
 
-	// Update fields if provided
-	if req.Email != "" {
-		user.Email = req.Email
-	}
-	if req.FirstName != "" {
-		user.FirstName = req.FirstName
+	if user.Email != previousEmail && s.onEmailChange != nil {
+		s.onEmailChange(ctx, user, previousEmail)
 	}
-	if req.LastName != "" {
-		user.LastName = req.LastName
-	}
-	if req.Avatar != "" {
-		user.Avatar = req.Avatar
-	}
-	if req.Bio != "" {
-		user.Bio = req.Bio
-	}
-	if req.Gender != "" {
-		user.Gender = req.Gender
-	}
-	if req.Age != nil {
-		user.Age = req.Age
-	}
-	if req.University != "" {
-		user.University = req.University
-	}
-	if req.Major != nil {
-		user.Major = req.Major
-	}
-	user.UpdatedAt = time.Now()
+	return user, nil
+}
 
-	if err := s.repo.Update(user); err != nil {
+// errUnchanged is returned by a change passed to modify when the user is
+// already as requested, so there is nothing to save
+var errUnchanged = errors.New("user unchanged")
+
+// modify reads a user, applies change and saves the result in one unit of
+// work. The user is locked from the read to the write, so changes made at
+// the same time cannot overwrite each other.
+func (s *Service) modify(ctx context.Context, userID string, change func(user *User) error) (*User, error) {
+	var user *User
+	err := s.tx.Transaction(ctx, func(ctx context.Context) error {
+		u, err := s.repo.FindByIDForUpdate(ctx, userID)
+		if err != nil {
+			return errors.New("user not found")
+		}
+		if err := change(u); err != nil {
+			return err
+		}
+		user = u
+		return s.repo.Update(ctx, u)
+	})
+	if errors.Is(err, errUnchanged) {
+		return s.repo.FindByID(ctx, userID)
+	}
+	if err != nil {
 		return nil, err
 	}
-
 	return user, nil
 }
 
+// SetEmailChangeHook registers fn to be called after a user changes their
+// email address, e.g. to ask them to confirm the new one
+func (s *Service) SetEmailChangeHook(fn func(ctx context.Context, user *User, previous string)) {
+	s.onEmailChange = fn
+}
+
 // DeleteUser deletes a user by ID
-func (s *Service) DeleteUser(id string) error {
+func (s *Service) DeleteUser(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("user ID is required")
 	}
 
-	if err := s.repo.Delete(id); err != nil {
+	if err := s.repo.Delete(ctx, id); err != nil {
 		return errors.New("user not found")
 	}
 
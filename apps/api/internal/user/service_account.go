@@ -0,0 +1,72 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDeactivatedByAdmin is returned when a user tries to undo a deactivation
+// that an administrator made
+var ErrDeactivatedByAdmin = errors.New("this account was deactivated by an administrator")
+
+// Deactivate blocks sign-in to an account. by records who deactivated it:
+// DeactivatedBySelf or DeactivatedByAdmin.
+func (s *Service) Deactivate(ctx context.Context, userID, by string) error {
+	_, err := s.modify(ctx, userID, func(user *User) error {
+		deactivate(user, by, time.Now())
+		return nil
+	})
+	return err
+}
+
+// Reactivate undoes a user's own deactivation and cancels any scheduled deletion
+func (s *Service) Reactivate(ctx context.Context, userID string) error {
+	_, err := s.modify(ctx, userID, func(user *User) error {
+		if user.DeactivatedBy == DeactivatedByAdmin {
+			return ErrDeactivatedByAdmin
+		}
+
+		user.IsActive = true
+		user.DeactivatedAt = nil
+		user.DeactivatedBy = ""
+		user.DeletionScheduledAt = nil
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+	return err
+}
+
+// ScheduleDeletion deactivates an account and marks it for deletion at the
+// given time. Reactivating the account before then cancels the deletion.
+func (s *Service) ScheduleDeletion(ctx context.Context, userID string, at time.Time) error {
+	_, err := s.modify(ctx, userID, func(user *User) error {
+		deactivate(user, DeactivatedBySelf, time.Now())
+		user.DeletionScheduledAt = &at
+		return nil
+	})
+	return err
+}
+
+// deactivate marks user as deactivated by by at now
+func deactivate(user *User, by string, now time.Time) {
+	user.IsActive = false
+	user.DeactivatedAt = &now
+	// An administrator's deactivation is never downgraded to the user's own
+	if user.DeactivatedBy != DeactivatedByAdmin {
+		user.DeactivatedBy = by
+	}
+	user.UpdatedAt = now
+}
+
+// GetUserForUpdate retrieves a user and locks them until the unit of work in
+// ctx ends, so a decision based on the user still holds when it is carried
+// out. It must be called within a unit of work.
+func (s *Service) GetUserForUpdate(ctx context.Context, userID string) (*User, error) {
+	return s.repo.FindByIDForUpdate(ctx, userID)
+}
+
+// DueForDeletion returns the users whose scheduled deletion has come
+func (s *Service) DueForDeletion(ctx context.Context, now time.Time) ([]*User, error) {
+	return s.repo.FindDueForDeletion(ctx, now)
+}
@@ -0,0 +1,56 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SearchUsers returns one page of users matching query, and the total number of matches
+func (s *Service) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*User, int, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.Search(ctx, query, limit, offset)
+}
+
+// SetActive activates or deactivates an account on behalf of an
+// administrator. Deactivated users cannot sign in, and only an administrator
+// can reactivate an account an administrator deactivated. Activating an
+// account the user scheduled for deletion only lifts the administrator's
+// block: it stays deactivated by the user, and the deletion stays due.
+func (s *Service) SetActive(ctx context.Context, userID string, active bool) error {
+	if !active {
+		return s.Deactivate(ctx, userID, DeactivatedByAdmin)
+	}
+
+	_, err := s.modify(ctx, userID, func(user *User) error {
+		if user.DeletionScheduledAt != nil {
+			user.DeactivatedBy = DeactivatedBySelf
+		} else {
+			user.IsActive = true
+			user.DeactivatedAt = nil
+			user.DeactivatedBy = ""
+		}
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+	return err
+}
+
+// SetRole changes a user's site-wide role
+func (s *Service) SetRole(ctx context.Context, userID, role string) error {
+	if !ValidRole(role) {
+		return errors.New("invalid role")
+	}
+
+	_, err := s.modify(ctx, userID, func(user *User) error {
+		user.Role = role
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+	return err
+}
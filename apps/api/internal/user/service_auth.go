@@ -1,50 +1,187 @@
 package user
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
 
 // VerifyPassword checks if the provided password matches the user's password
-func (s *Service) VerifyPassword(userID, password string) (bool, error) {
-	user, err := s.repo.FindByID(userID)
+func (s *Service) VerifyPassword(ctx context.Context, userID, password string) (bool, error) {
+	user, err := s.repo.FindByID(ctx, userID)
 	if err != nil {
 		return false, err
 	}
 	
-	return CheckPassword(password, user.PasswordHash), nil
+	return s.CheckPasswordAndUpgrade(ctx, user, password), nil
 }
 
+// CheckPasswordAndUpgrade compares a password with a user's hash. When the
+// password matches a hash made with an outdated algorithm or parameters, the
+// user's hash is replaced by one from the current hasher, unless the
+// password was changed since user was read.
+func (s *Service) CheckPasswordAndUpgrade(ctx context.Context, user *User, password string) bool {
+	if !s.checkPassword(password, user.PasswordHash) {
+		return false
+	}
+
+	if s.needsRehash(user.PasswordHash) {
+		if hashed, err := s.hasher.Hash(password); err == nil {
+			if _, err := s.repo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, hashed); err != nil {
+				log.Printf("Failed to upgrade password hash of user %s: %v", user.ID, err)
+			}
+		}
+	}
+	return true
+}
+
+// ErrPasswordChanged is returned when a user's password changed while
+// another change of it was in progress
+var ErrPasswordChanged = errors.New("the password was changed in the meantime")
+
 // ChangePassword updates a user's password
-func (s *Service) ChangePassword(userID, oldPassword, newPassword string) error {
-	user, err := s.repo.FindByID(userID)
+func (s *Service) ChangePassword(ctx context.Context, userID, oldPassword, newPassword string) error {
+	user, err := s.repo.FindByID(ctx, userID)
 	if err != nil {
 		return errors.New("user not found")
 	}
 
 	// Verify old password
-	if !CheckPassword(oldPassword, user.PasswordHash) {
+	if !s.checkPassword(oldPassword, user.PasswordHash) {
 		return errors.New("invalid current password")
 	}
 
 	// Validate new password
-	if len(newPassword) < 8 {
-		return errors.New("new password must be at least 8 characters")
+	if err := s.ValidatePassword("newPassword", newPassword, user.personalInputs()...); err != nil {
+		return err
 	}
 
 	// Hash new password
-	hashedPassword, err := HashPassword(newPassword)
+	hashedPassword, err := s.hashPassword(newPassword)
 	if err != nil {
 		return errors.New("failed to hash password")
 	}
 
-	user.PasswordHash = hashedPassword
-	return s.repo.Update(user)
+	return s.replacePasswordHash(ctx, user, hashedPassword)
+}
+
+// ErrUniversityEmailTaken is returned when a university email was already
+// verified for another account
+var ErrUniversityEmailTaken = errors.New("this university email is already verified for another account")
+
+// SetUniversityVerified records that a user confirmed an address issued by
+// their university, and sets University to the school's canonical name. An
+// address can verify one account only.
+func (s *Service) SetUniversityVerified(ctx context.Context, userID, university, email string) error {
+	email = NormalizeEmail(email)
+	_, err := s.modify(ctx, userID, func(user *User) error {
+		taken, err := s.repo.ExistsByUniversityEmail(ctx, email, user.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrUniversityEmailTaken
+		}
+
+		now := time.Now()
+		user.University = university
+		user.UniversityEmail = email
+		user.UniversityVerifiedAt = &now
+		user.UpdatedAt = now
+		return nil
+	})
+	return err
+}
+
+// ValidateNewPassword checks a password a user wants to switch to against
+// the password policy, without changing anything
+func (s *Service) ValidateNewPassword(ctx context.Context, userID, password string) error {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	return s.ValidatePassword("newPassword", password, user.personalInputs()...)
+}
+
+// ResetPassword replaces a user's password without checking the old one.
+// Callers must have verified the user's identity some other way.
+func (s *Service) ResetPassword(ctx context.Context, userID, newPassword string) error {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	// Validate new password
+	if err := s.ValidatePassword("newPassword", newPassword, user.personalInputs()...); err != nil {
+		return err
+	}
+
+	// Hash new password
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	return s.replacePasswordHash(ctx, user, hashedPassword)
+}
+
+// replacePasswordHash stores a new hash for user, failing with
+// ErrPasswordChanged if the hash was changed since user was read. Only the
+// hash is written, so other changes to the account are kept.
+func (s *Service) replacePasswordHash(ctx context.Context, user *User, hashed string) error {
+	replaced, err := s.repo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, hashed)
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		return ErrPasswordChanged
+	}
+	return nil
 }
 
 // FindByEmail retrieves a user by email
-func (s *Service) FindByEmail(email string) (*User, error) {
-	return s.repo.FindByEmail(email)
+func (s *Service) FindByEmail(ctx context.Context, email string) (*User, error) {
+	return s.repo.FindByEmail(ctx, email)
+}
+
+// UsernameTaken reports whether a username is already in use
+func (s *Service) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	return s.repo.ExistsByUsername(ctx, username)
 }
 
 // FindByUsername retrieves a user by username
-func (s *Service) FindByUsername(username string) (*User, error) {
-	return s.repo.FindByUsername(username)
+func (s *Service) FindByUsername(ctx context.Context, username string) (*User, error) {
+	return s.repo.FindByUsername(ctx, username)
+}
+
+// ErrEmailChanged is returned when an address is confirmed after the user
+// switched to another one
+var ErrEmailChanged = errors.New("the email address has changed since it was confirmed")
+
+// MarkEmailVerified flags a user's email address as verified. email is the
+// address that was confirmed; it must still be the user's.
+func (s *Service) MarkEmailVerified(ctx context.Context, userID, email string) error {
+	_, err := s.modify(ctx, userID, func(user *User) error {
+		if user.Email != NormalizeEmail(email) {
+			return ErrEmailChanged
+		}
+		if user.IsVerified && user.VerifiedEmail == user.Email {
+			return errUnchanged
+		}
+
+		user.IsVerified = true
+		user.VerifiedEmail = user.Email
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+	return err
+}
+
+// RecordLogin stores the time of a user's latest successful sign-in. It
+// writes that field alone, so it cannot undo a change to the account made
+// while the user was signing in.
+func (s *Service) RecordLogin(ctx context.Context, userID string, at time.Time) error {
+	return s.repo.UpdateLastLogin(ctx, userID, at)
 }
@@ -0,0 +1,253 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"sanctor/internal/database"
+)
+
+// newTestService builds a user service on in-memory storage with cheap hashing
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	service := NewService(NewRepository(), database.NewMemoryTransactor())
+	service.SetPasswordHasher(NewArgon2idHasher(Argon2idParams{
+		Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}))
+	return service
+}
+
+func TestEmailsIgnoreCase(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	ada, err := service.CreateUser(ctx, CreateUserRequest{Email: " Ada@Example.com", Username: "ada", Password: "analytical-engine-1843"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ada.Email != "ada@example.com" {
+		t.Errorf("stored email %q, want it in lower case", ada.Email)
+	}
+	grace, err := service.CreateUser(ctx, CreateUserRequest{Email: "grace@example.com", Username: "grace", Password: "compiler-a0-1952"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("register", func(t *testing.T) {
+		_, err := service.CreateUser(ctx, CreateUserRequest{Email: "ADA@example.com", Username: "ada2", Password: "analytical-engine-1843"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("got error %v, want ErrEmailTaken", err)
+		}
+	})
+
+	t.Run("change email", func(t *testing.T) {
+		_, err := service.UpdateUser(ctx, grace.ID, UpdateUserRequest{Email: "ADA@EXAMPLE.COM"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("got error %v, want ErrEmailTaken", err)
+		}
+	})
+
+	t.Run("find", func(t *testing.T) {
+		found, err := service.FindByEmail(ctx, "ADA@example.COM")
+		if err != nil || found.ID != ada.ID {
+			t.Fatalf("got %v, %v, want %s", found, err, ada.ID)
+		}
+	})
+
+	t.Run("same address in another case", func(t *testing.T) {
+		if err := service.MarkEmailVerified(ctx, ada.ID, "ada@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := service.UpdateUser(ctx, ada.ID, UpdateUserRequest{Email: "Ada@Example.COM"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Email != "ada@example.com" || !updated.IsVerified {
+			t.Errorf("got %q verified=%v, want the verified address unchanged", updated.Email, updated.IsVerified)
+		}
+	})
+
+	t.Run("confirm in another case", func(t *testing.T) {
+		if err := service.MarkEmailVerified(ctx, grace.ID, "Grace@Example.com"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestMarkEmailVerified(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is the address the user switches to before confirming
+		change       string
+		confirm      string
+		wantErr      error
+		wantVerified string
+	}{
+		{name: "current address", confirm: "ada@example.com", wantVerified: "ada@example.com"},
+		{name: "other case", confirm: "ADA@example.com", wantVerified: "ada@example.com"},
+		{name: "previous address", change: "lovelace@example.com", confirm: "ada@example.com", wantErr: ErrEmailChanged},
+		{name: "new address", change: "lovelace@example.com", confirm: "lovelace@example.com", wantVerified: "lovelace@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			service := newTestService(t)
+			ada, err := service.CreateUser(ctx, CreateUserRequest{Email: "ada@example.com", Username: "ada", Password: "analytical-engine-1843"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != "" {
+				if _, err := service.UpdateUser(ctx, ada.ID, UpdateUserRequest{Email: tt.change}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := service.MarkEmailVerified(ctx, ada.ID, tt.confirm); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			u, err := service.GetUser(ctx, ada.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verified := tt.wantVerified != ""; u.IsVerified != verified || u.VerifiedEmail != tt.wantVerified {
+				t.Errorf("got verified=%v for %q, want %v for %q", u.IsVerified, u.VerifiedEmail, verified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestRecordLoginKeepsConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	ada, err := service.CreateUser(ctx, CreateUserRequest{Email: "ada@example.com", Username: "ada", Password: "analytical-engine-1843"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An administrator deactivates the account while the user signs in
+	if err := service.Deactivate(ctx, ada.ID, DeactivatedByAdmin); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	if err := service.RecordLogin(ctx, ada.ID, at); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := service.GetUser(ctx, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.IsActive || u.DeactivatedBy != DeactivatedByAdmin {
+		t.Errorf("got active=%v deactivated by %q, want the deactivation kept", u.IsActive, u.DeactivatedBy)
+	}
+	if u.LastLoginAt == nil || !u.LastLoginAt.Equal(at) {
+		t.Errorf("got last login %v, want %v", u.LastLoginAt, at)
+	}
+}
+
+func TestPasswordUpgradeKeepsConcurrentChange(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	ada, err := service.CreateUser(ctx, CreateUserRequest{Email: "ada@example.com", Username: "ada", Password: "analytical-engine-1843"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hashes made so far now need an upgrade
+	service.SetPasswordHasher(NewArgon2idHasher(Argon2idParams{
+		Memory: 128, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}))
+
+	t.Run("upgrade", func(t *testing.T) {
+		if !service.CheckPasswordAndUpgrade(ctx, ada, "analytical-engine-1843") {
+			t.Fatal("password rejected")
+		}
+		u, err := service.GetUser(ctx, ada.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.PasswordHash == ada.PasswordHash || service.needsRehash(u.PasswordHash) {
+			t.Errorf("hash %q was not upgraded", u.PasswordHash)
+		}
+		ada = u
+	})
+
+	t.Run("password changed meanwhile", func(t *testing.T) {
+		stale := *ada
+		service.SetPasswordHasher(NewArgon2idHasher(Argon2idParams{
+			Memory: 256, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+		}))
+		if err := service.ChangePassword(ctx, ada.ID, "analytical-engine-1843", "difference-engine-1822"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The check began before the change, so it still sees the old hash
+		if !service.CheckPasswordAndUpgrade(ctx, &stale, "analytical-engine-1843") {
+			t.Fatal("password rejected")
+		}
+		if ok, err := service.VerifyPassword(ctx, ada.ID, "difference-engine-1822"); err != nil || !ok {
+			t.Errorf("got %v, %v for the new password, want it kept", ok, err)
+		}
+		if ok, _ := service.VerifyPassword(ctx, ada.ID, "analytical-engine-1843"); ok {
+			t.Error("the upgrade restored the old password")
+		}
+	})
+
+	t.Run("reset from a stale read", func(t *testing.T) {
+		if err := service.replacePasswordHash(ctx, ada, "stale"); !errors.Is(err, ErrPasswordChanged) {
+			t.Errorf("got error %v, want ErrPasswordChanged", err)
+		}
+	})
+}
+
+func TestConcurrentChangesAreKept(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	users := make([]*User, 20)
+	for i := range users {
+		u, err := service.CreateUser(ctx, CreateUserRequest{
+			Email:    fmt.Sprintf("user%d@example.com", i),
+			Username: fmt.Sprintf("user%d", i),
+			Password: "analytical-engine-1843",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[i] = u
+	}
+
+	// Each user is promoted, deactivated and verified at the same time
+	var wg sync.WaitGroup
+	for _, u := range users {
+		u := u
+		changes := []func() error{
+			func() error { return service.SetRole(ctx, u.ID, RoleModerator) },
+			func() error { return service.SetActive(ctx, u.ID, false) },
+			func() error { return service.MarkEmailVerified(ctx, u.ID, u.Email) },
+		}
+		for _, change := range changes {
+			wg.Add(1)
+			go func(change func() error) {
+				defer wg.Done()
+				if err := change(); err != nil {
+					t.Error(err)
+				}
+			}(change)
+		}
+	}
+	wg.Wait()
+
+	for _, u := range users {
+		got, err := service.GetUser(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Role != RoleModerator || got.IsActive || !got.IsVerified {
+			t.Errorf("user %s: got role %q, active=%v, verified=%v, want every change kept",
+				u.Username, got.Role, got.IsActive, got.IsVerified)
+		}
+	}
+}
@@ -2,27 +2,47 @@ package user
 
 import (
 	"errors"
+	"strings"
 
-	"golang.org/x/crypto/bcrypt"
+	"sanctor/internal/passwordpolicy"
 )
 
-// HashPassword generates a bcrypt hash of the password
-func HashPassword(password string) (string, error) {
-	if len(password) < 8 {
-		return "", errors.New("password must be at least 8 characters")
-	}
-	
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
+// SetPasswordPolicy replaces the password policy
+func (s *Service) SetPasswordPolicy(policy *passwordpolicy.Policy) {
+	s.policy = policy
+}
+
+// ValidatePassword checks a new password against the password policy. field
+// is the request field the password came from; userInputs are the user's
+// own details, which make a poor password. Errors are *passwordpolicy.ValidationError.
+func (s *Service) ValidatePassword(field, password string, userInputs ...string) error {
+	return s.policy.Validate(field, password, userInputs...)
+}
+
+// personalInputs returns the details of a user a password should not be built from
+func (u *User) personalInputs() []string {
+	return []string{u.Email, u.Username, u.FirstName, u.LastName}
 }
 
-// CheckPassword compares a password with a hash
-func CheckPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// hashPassword hashes the password with the current password hasher. Callers
+// validate new passwords with ValidatePassword first.
+func (s *Service) hashPassword(password string) (string, error) {
+	return s.hasher.Hash(password)
+}
+
+// checkPassword compares a password with a hash made by any supported algorithm
+func (s *Service) checkPassword(password, hash string) bool {
+	hasher := s.hasherFor(hash)
+	return hasher != nil && hasher.Verify(password, hash)
+}
+
+// CheckDummyPassword spends the same time as a real password check, so
+// callers can hide whether an account exists
+func (s *Service) CheckDummyPassword(password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = s.hashPassword("sanctor-dummy-password")
+	})
+	s.checkPassword(password, s.dummyHash)
 }
 
 // ValidateEmail performs basic email validation
@@ -31,6 +51,12 @@ func ValidateEmail(email string) bool {
 	return len(email) > 3 && contains(email, "@") && contains(email, ".")
 }
 
+// NormalizeEmail returns the form email addresses are stored and compared
+// in, so that addresses differing only in case belong to one account
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // ValidateUsername checks if username is valid
 func ValidateUsername(username string) error {
 	if len(username) < 3 {
@@ -0,0 +1,77 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string // hex
+		want     interface{}
+		wantRest string // hex
+		wantErr  bool
+	}{
+		{name: "small integer", input: "17", want: int64(23)},
+		{name: "one-byte integer", input: "1818", want: int64(24)},
+		{name: "two-byte integer", input: "190100", want: int64(256)},
+		{name: "eight-byte integer", input: "1b7fffffffffffffff", want: int64(1<<63 - 1)},
+		{name: "negative integer", input: "3863", want: int64(-100)},
+		{name: "byte string", input: "4401020304", want: []byte{1, 2, 3, 4}},
+		{name: "text string", input: "6449455446", want: "IETF"},
+		{name: "array", input: "83010203", want: []interface{}{int64(1), int64(2), int64(3)}},
+		{
+			name:  "map with int and text keys",
+			input: "a2032661616162",
+			want:  map[interface{}]interface{}{int64(3): int64(-7), "a": "b"},
+		},
+		{name: "false", input: "f4", want: false},
+		{name: "true", input: "f5", want: true},
+		{name: "null", input: "f6", want: nil},
+		{name: "tag is skipped", input: "c24101", want: []byte{1}},
+		{name: "bytes after the item", input: "0102", want: int64(1), wantRest: "02"},
+
+		{name: "empty", input: "", wantErr: true},
+		{name: "truncated argument", input: "19ff", wantErr: true},
+		{name: "string past the end", input: "430102", wantErr: true},
+		{name: "array past the end", input: "9bffffffffffffffff", wantErr: true},
+		{name: "indefinite length", input: "5f41ff", wantErr: true},
+		{name: "float", input: "fa3fc00000", wantErr: true},
+		{name: "integer overflow", input: "1bffffffffffffffff", wantErr: true},
+		{name: "negative overflow", input: "3bffffffffffffffff", wantErr: true},
+		{name: "duplicate map key", input: "a201010102", wantErr: true},
+		{name: "byte string map key", input: "a1410101", wantErr: true},
+		{name: "truncated map value", input: "a101", wantErr: true},
+		{name: "nested too deeply", input: strings.Repeat("81", maxCBORDepth+2) + "00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := hex.DecodeString(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, rest, err := decodeCBOR(input)
+			if tt.wantErr {
+				if !errors.Is(err, errCBOR) {
+					t.Fatalf("got %v, %v; want a CBOR error", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if hex.EncodeToString(rest) != tt.wantRest {
+				t.Errorf("rest is %x, want %s", rest, tt.wantRest)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers Sanctor accepts, in order of preference
+// (IANA COSE Algorithms registry)
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms lists the accepted algorithms, most preferred first
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKeyType  = 1
+	coseKeyAlg   = 3
+	coseCurve    = -1
+	coseX        = -2
+	coseY        = -3
+	coseRSAN     = -1
+	coseRSAE     = -2
+	keyTypeOKP   = 1
+	keyTypeEC2   = 2
+	keyTypeRSA   = 3
+	curveP256    = 1
+	curveEd25519 = 6
+)
+
+// errUnsupportedKey reports a credential key Sanctor cannot verify
+var errUnsupportedKey = errors.New("unsupported credential public key")
+
+// publicKey is a credential public key with the algorithm it signs with
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key and returns it with the bytes after it
+func parsePublicKey(data []byte) (*publicKey, []byte, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: not a COSE key", errUnsupportedKey)
+	}
+
+	intParam := func(label int64) int64 {
+		v, _ := params[label].(int64)
+		return v
+	}
+	bytesParam := func(label int64) []byte {
+		v, _ := params[label].([]byte)
+		return v
+	}
+
+	alg := intParam(coseKeyAlg)
+	switch kty := intParam(coseKeyType); {
+	case kty == keyTypeEC2 && alg == AlgES256:
+		x, y := bytesParam(coseX), bytesParam(coseY)
+		if intParam(coseCurve) != curveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, nil, fmt.Errorf("%w: bad P-256 key", errUnsupportedKey)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, nil, fmt.Errorf("%w: point is not on the curve", errUnsupportedKey)
+		}
+		return &publicKey{alg: alg, key: key}, rest, nil
+	case kty == keyTypeOKP && alg == AlgEdDSA:
+		x := bytesParam(coseX)
+		if intParam(coseCurve) != curveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, nil, fmt.Errorf("%w: bad Ed25519 key", errUnsupportedKey)
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, rest, nil
+	case kty == keyTypeRSA && alg == AlgRS256:
+		n, e := bytesParam(coseRSAN), bytesParam(coseRSAE)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, nil, fmt.Errorf("%w: bad RSA key", errUnsupportedKey)
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return &publicKey{alg: alg, key: key}, rest, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: key type %d with algorithm %d", errUnsupportedKey, kty, alg)
+	}
+}
+
+// verify checks a signature over data
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,117 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+
+	"sanctor/internal/webauthn"
+	"sanctor/internal/webauthn/webauthntest"
+)
+
+func TestParsePublicKey(t *testing.T) {
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey := func(edit func(key map[interface{}]interface{})) []byte {
+		key := map[interface{}]interface{}{
+			int64(1):  int64(2),
+			int64(3):  webauthn.AlgES256,
+			int64(-1): int64(1),
+			int64(-2): ecPrivate.X.FillBytes(make([]byte, 32)),
+			int64(-3): ecPrivate.Y.FillBytes(make([]byte, 32)),
+		}
+		edit(key)
+		return webauthntest.EncodeCBOR(key)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaE := big.NewInt(int64(rsaKey.E)).Bytes()
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantAlg int64
+		wantErr bool
+	}{
+		{name: "ES256", input: ecKey(func(map[interface{}]interface{}) {}), wantAlg: webauthn.AlgES256},
+		{
+			name: "EdDSA",
+			input: webauthntest.EncodeCBOR(map[interface{}]interface{}{
+				int64(1): int64(1), int64(3): webauthn.AlgEdDSA, int64(-1): int64(6), int64(-2): []byte(edPublic),
+			}),
+			wantAlg: webauthn.AlgEdDSA,
+		},
+		{
+			name: "RS256",
+			input: webauthntest.EncodeCBOR(map[interface{}]interface{}{
+				int64(1): int64(3), int64(3): webauthn.AlgRS256, int64(-1): rsaKey.N.Bytes(), int64(-2): rsaE,
+			}),
+			wantAlg: webauthn.AlgRS256,
+		},
+		{
+			name:    "point not on the curve",
+			input:   ecKey(func(key map[interface{}]interface{}) { key[int64(-3)] = bytes.Repeat([]byte{1}, 32) }),
+			wantErr: true,
+		},
+		{
+			name:    "other curve",
+			input:   ecKey(func(key map[interface{}]interface{}) { key[int64(-1)] = int64(2) }),
+			wantErr: true,
+		},
+		{
+			name:    "short coordinate",
+			input:   ecKey(func(key map[interface{}]interface{}) { key[int64(-2)] = []byte{1, 2, 3} }),
+			wantErr: true,
+		},
+		{
+			name:    "algorithm of another key type",
+			input:   ecKey(func(key map[interface{}]interface{}) { key[int64(3)] = webauthn.AlgRS256 }),
+			wantErr: true,
+		},
+		{
+			name:    "missing algorithm",
+			input:   ecKey(func(key map[interface{}]interface{}) { delete(key, int64(3)) }),
+			wantErr: true,
+		},
+		{
+			name: "RSA key too short",
+			input: webauthntest.EncodeCBOR(map[interface{}]interface{}{
+				int64(1): int64(3), int64(3): webauthn.AlgRS256, int64(-1): rsaKey.N.Bytes()[:128], int64(-2): rsaE,
+			}),
+			wantErr: true,
+		},
+		{name: "not a map", input: webauthntest.EncodeCBOR(int64(2)), wantErr: true},
+		{name: "malformed CBOR", input: []byte{0xa5, 0x01}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alg, err := webauthn.ParsePublicKey(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("key was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alg != tt.wantAlg {
+				t.Errorf("got algorithm %d, want %d", alg, tt.wantAlg)
+			}
+		})
+	}
+}
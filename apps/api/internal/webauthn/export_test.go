@@ -0,0 +1,11 @@
+package webauthn
+
+// ParsePublicKey exposes parsePublicKey to the external tests. It returns
+// the algorithm of the decoded key.
+func ParsePublicKey(data []byte) (int64, error) {
+	key, _, err := parsePublicKey(data)
+	if err != nil {
+		return 0, err
+	}
+	return key.alg, nil
+}
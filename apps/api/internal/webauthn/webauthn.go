@@ -0,0 +1,481 @@
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Errors returned by the ceremonies
+var (
+	ErrInvalidConfig     = errors.New("invalid WebAuthn relying party configuration")
+	ErrInvalidCredential = errors.New("invalid passkey response")
+)
+
+// CeremonyTimeout is how long the browser gives the user to finish a ceremony
+const CeremonyTimeout = 5 * time.Minute
+
+// Authenticator data flags (WebAuthn §6.1)
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagBackedUp         = 0x10
+	flagAttestedData     = 0x40
+	flagExtensionData    = 0x80
+	authDataMinLength    = 37
+	maxCredentialIDBytes = 1023
+)
+
+// Base64URL is binary data that travels in JSON as unpadded base64url, the
+// encoding of the WebAuthn JSON serialization
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty is the site passkeys are scoped to
+type RelyingParty struct {
+	ID      string   // registrable domain, e.g. "sanctor.app"
+	Name    string   // shown by the authenticator
+	Origins []string // web origins allowed to run ceremonies, e.g. "https://sanctor.app"
+}
+
+// NewRelyingParty checks that every origin is the RP ID or one of its
+// subdomains
+func NewRelyingParty(id, name string, origins []string) (*RelyingParty, error) {
+	if id == "" || name == "" || len(origins) == 0 {
+		return nil, fmt.Errorf("%w: an ID, a name and at least one origin are required", ErrInvalidConfig)
+	}
+	for _, origin := range origins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" || u.Path != "" {
+			return nil, fmt.Errorf("%w: bad origin %q", ErrInvalidConfig, origin)
+		}
+		if u.Scheme != "https" && u.Hostname() != "localhost" {
+			return nil, fmt.Errorf("%w: origin %q must use https", ErrInvalidConfig, origin)
+		}
+		if host := u.Hostname(); host != id && !strings.HasSuffix(host, "."+id) {
+			return nil, fmt.Errorf("%w: origin %q is not within %q", ErrInvalidConfig, origin, id)
+		}
+	}
+	return &RelyingParty{ID: id, Name: name, Origins: origins}, nil
+}
+
+// NewChallenge returns a random challenge for one ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// UserEntity identifies the account a passkey is created for. ID must not
+// contain personal information; it comes back as the user handle.
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialDescriptor names an existing credential
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// NewCredentialDescriptor describes a stored credential
+func NewCredentialDescriptor(id []byte, transports []string) CredentialDescriptor {
+	return CredentialDescriptor{Type: "public-key", ID: id, Transports: transports}
+}
+
+type relyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the PublicKeyCredentialCreationOptions for
+// navigator.credentials.create(), in the WebAuthn JSON serialization
+type CreationOptions struct {
+	RP                     relyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the PublicKeyCredentialRequestOptions for
+// navigator.credentials.get(), in the WebAuthn JSON serialization
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions asks for a discoverable, user-verifying credential, so
+// the passkey alone can sign the user in. Credentials in exclude are
+// already registered and must not be created again on the same authenticator.
+func (rp *RelyingParty) CreationOptions(user UserEntity, challenge []byte, exclude []CredentialDescriptor) *CreationOptions {
+	params := make([]credentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = credentialParameter{Type: "public-key", Alg: alg}
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return &CreationOptions{
+		RP:                 relyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            CeremonyTimeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions asks for an assertion from any of the user's passkeys. With
+// no allowed credentials the browser offers every passkey it holds for the
+// site, so the user does not need to type an email address first.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor) *RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          CeremonyTimeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: "required",
+	}
+}
+
+// AttestationResponse is the response of navigator.credentials.create()
+type AttestationResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports,omitempty"`
+}
+
+// RegistrationCredential is a new PublicKeyCredential, as serialized by its toJSON()
+type RegistrationCredential struct {
+	ID       string              `json:"id"`
+	RawID    Base64URL           `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// AssertionResponse is the response of navigator.credentials.get()
+type AssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// AuthenticationCredential is an asserting PublicKeyCredential, as
+// serialized by its toJSON()
+type AuthenticationCredential struct {
+	ID       string            `json:"id"`
+	RawID    Base64URL         `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// Credential is a newly registered credential, ready to be stored
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// Assertion is the outcome of a verified authentication
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	BackedUp     bool
+}
+
+// VerifyRegistration checks the response to CreationOptions issued with
+// challenge (WebAuthn §7.1) and returns the new credential. The attestation
+// statement is checked for consistency, but its certificate chain is not
+// evaluated: Sanctor asks for no attestation and trusts any authenticator.
+func (rp *RelyingParty) VerifyRegistration(cred *RegistrationCredential, challenge []byte) (*Credential, error) {
+	if cred == nil || cred.Type != "public-key" {
+		return nil, fmt.Errorf("%w: not a public key credential", ErrInvalidCredential)
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(cred.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+	object, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: bad attestation object", ErrInvalidCredential)
+	}
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := object["authData"].([]byte)
+
+	data, err := rp.parseAuthenticatorData(rawAuthData, true)
+	if err != nil {
+		return nil, err
+	}
+	if data.flags&flagAttestedData == 0 || data.credentialKey == nil {
+		return nil, fmt.Errorf("%w: no credential in authenticator data", ErrInvalidCredential)
+	}
+	if len(cred.RawID) > 0 && subtle.ConstantTimeCompare(cred.RawID, data.credentialID) != 1 {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidCredential)
+	}
+
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	if err := verifyAttestation(format, statement, rawAuthData, clientDataHash[:], data.credentialKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             data.credentialID,
+		PublicKey:      data.rawCredentialKey,
+		Algorithm:      data.credentialKey.alg,
+		SignCount:      data.signCount,
+		AAGUID:         data.aaguid,
+		Transports:     cred.Response.Transports,
+		BackupEligible: data.flags&flagBackupEligible != 0,
+		BackedUp:       data.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAuthentication checks the response to RequestOptions issued with
+// challenge against a stored credential public key (WebAuthn §7.2). Callers
+// compare the returned sign count with the stored one.
+func (rp *RelyingParty) VerifyAuthentication(cred *AuthenticationCredential, challenge, storedKey []byte) (*Assertion, error) {
+	if cred == nil || cred.Type != "public-key" {
+		return nil, fmt.Errorf("%w: not a public key credential", ErrInvalidCredential)
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	data, err := rp.parseAuthenticatorData(cred.Response.AuthenticatorData, false)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := parsePublicKey(storedKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), cred.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, cred.Response.Signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidCredential)
+	}
+
+	return &Assertion{
+		SignCount:    data.signCount,
+		UserVerified: data.flags&flagUserVerified != 0,
+		BackedUp:     data.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// clientData is the subset of CollectedClientData Sanctor checks
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData checks the ceremony type, challenge and origin the
+// browser signed over
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%w: bad client data", ErrInvalidCredential)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: expected a %s ceremony", ErrInvalidCredential, ceremony)
+	}
+	expected := base64.RawURLEncoding.EncodeToString(challenge)
+	if len(challenge) == 0 || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(expected)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidCredential)
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremonies are not allowed", ErrInvalidCredential)
+	}
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidCredential, data.Origin)
+}
+
+// authenticatorData is parsed authenticator data (WebAuthn §6.1)
+type authenticatorData struct {
+	flags            byte
+	signCount        uint32
+	aaguid           []byte
+	credentialID     []byte
+	credentialKey    *publicKey
+	rawCredentialKey []byte
+}
+
+// parseAuthenticatorData parses authenticator data and checks the RP ID
+// hash and that the user was both present and verified
+func (rp *RelyingParty) parseAuthenticatorData(raw []byte, attested bool) (*authenticatorData, error) {
+	if len(raw) < authDataMinLength {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidCredential)
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(raw[:32], rpIDHash[:]) != 1 {
+		return nil, fmt.Errorf("%w: credential belongs to another site", ErrInvalidCredential)
+	}
+
+	data := &authenticatorData{
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user was not present", ErrInvalidCredential)
+	}
+	if data.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user was not verified", ErrInvalidCredential)
+	}
+	if data.flags&flagBackedUp != 0 && data.flags&flagBackupEligible == 0 {
+		return nil, fmt.Errorf("%w: inconsistent backup flags", ErrInvalidCredential)
+	}
+
+	rest := raw[authDataMinLength:]
+	if data.flags&flagAttestedData != 0 {
+		if !attested {
+			return nil, fmt.Errorf("%w: unexpected attested credential data", ErrInvalidCredential)
+		}
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidCredential)
+		}
+		data.aaguid = append([]byte(nil), rest[:16]...)
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > maxCredentialIDBytes || idLength > len(rest) {
+			return nil, fmt.Errorf("%w: bad credential ID length", ErrInvalidCredential)
+		}
+		data.credentialID = append([]byte(nil), rest[:idLength]...)
+		rest = rest[idLength:]
+
+		key, after, err := parsePublicKey(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+		}
+		data.credentialKey = key
+		data.rawCredentialKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+		rest = after
+	}
+	if data.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad extension data", ErrInvalidCredential)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes in authenticator data", ErrInvalidCredential)
+	}
+	return data, nil
+}
+
+// verifyAttestation checks an attestation statement of the "none" or
+// "packed" format (WebAuthn §8.2, §8.7)
+func verifyAttestation(format string, statement map[interface{}]interface{}, authData, clientDataHash []byte, credentialKey *publicKey) error {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return fmt.Errorf("%w: unexpected attestation statement", ErrInvalidCredential)
+		}
+		return nil
+	case "packed":
+		alg, _ := statement["alg"].(int64)
+		sig, _ := statement["sig"].([]byte)
+		signed := append(append([]byte(nil), authData...), clientDataHash...)
+
+		chain, hasChain := statement["x5c"].([]interface{})
+		if !hasChain {
+			// Self attestation: signed with the credential key itself
+			if alg != credentialKey.alg || !credentialKey.verify(signed, sig) {
+				return fmt.Errorf("%w: bad self attestation", ErrInvalidCredential)
+			}
+			return nil
+		}
+
+		if len(chain) == 0 {
+			return fmt.Errorf("%w: empty attestation certificate chain", ErrInvalidCredential)
+		}
+		der, _ := chain[0].([]byte)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("%w: bad attestation certificate", ErrInvalidCredential)
+		}
+		attestationKey := &publicKey{alg: alg, key: cert.PublicKey}
+		if !attestationKey.verify(signed, sig) {
+			return fmt.Errorf("%w: bad attestation signature", ErrInvalidCredential)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported attestation format %q", ErrInvalidCredential, format)
+	}
+}
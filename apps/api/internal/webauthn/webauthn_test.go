@@ -0,0 +1,217 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"sanctor/internal/webauthn"
+	"sanctor/internal/webauthn/webauthntest"
+)
+
+const (
+	testRPID   = "sanctor.app"
+	testOrigin = "https://sanctor.app"
+)
+
+func newTestRelyingParty(t *testing.T) *webauthn.RelyingParty {
+	t.Helper()
+	rp, err := webauthn.NewRelyingParty(testRPID, "Sanctor", []string{testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(a *webauthntest.Authenticator)
+		edit    func(cred *webauthn.RegistrationCredential)
+		wantErr bool
+	}{
+		{name: "packed self attestation"},
+		{name: "no attestation", tamper: func(a *webauthntest.Authenticator) { a.Attestation = "none" }},
+		{name: "other site", tamper: func(a *webauthntest.Authenticator) { a.RPID = "evil.example.com" }, wantErr: true},
+		{name: "other origin", tamper: func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example.com" }, wantErr: true},
+		{name: "subdomain origin", tamper: func(a *webauthntest.Authenticator) { a.Origin = "https://app.sanctor.app" }, wantErr: true},
+		{name: "unknown attestation format", tamper: func(a *webauthntest.Authenticator) { a.Attestation = "tpm" }, wantErr: true},
+		{
+			name:    "credential ID mismatch",
+			edit:    func(cred *webauthn.RegistrationCredential) { cred.RawID = []byte("another credential") },
+			wantErr: true,
+		},
+		{
+			name: "truncated attestation object",
+			edit: func(cred *webauthn.RegistrationCredential) {
+				object := cred.Response.AttestationObject
+				cred.Response.AttestationObject = object[:len(object)/2]
+			},
+			wantErr: true,
+		},
+		{
+			name:    "attestation object is not a map",
+			edit:    func(cred *webauthn.RegistrationCredential) { cred.Response.AttestationObject = []byte{0x01} },
+			wantErr: true,
+		},
+		{
+			name: "bad client data",
+			edit: func(cred *webauthn.RegistrationCredential) {
+				cred.Response.ClientDataJSON = []byte("{")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			challenge := newTestChallenge(t)
+			authenticator := webauthntest.NewAuthenticator(testRPID, testOrigin)
+			if tt.tamper != nil {
+				tt.tamper(authenticator)
+			}
+
+			options := rp.CreationOptions(webauthn.UserEntity{ID: []byte("user-1"), Name: "ada@example.com"}, challenge, nil)
+			cred := authenticator.Create(options)
+			if tt.edit != nil {
+				tt.edit(cred)
+			}
+
+			credential, err := rp.VerifyRegistration(cred, challenge)
+			if tt.wantErr {
+				if !errors.Is(err, webauthn.ErrInvalidCredential) {
+					t.Fatalf("got error %v, want ErrInvalidCredential", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(credential.ID, authenticator.CredentialID()) {
+				t.Errorf("got credential ID %x, want %x", credential.ID, authenticator.CredentialID())
+			}
+			if !bytes.Equal(credential.PublicKey, authenticator.PublicKey()) || credential.Algorithm != webauthn.AlgES256 {
+				t.Errorf("got public key %x (algorithm %d)", credential.PublicKey, credential.Algorithm)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejectsOtherChallenge(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	options := rp.CreationOptions(webauthn.UserEntity{ID: []byte("user-1")}, newTestChallenge(t), nil)
+
+	if _, err := rp.VerifyRegistration(authenticator.Create(options), newTestChallenge(t)); !errors.Is(err, webauthn.ErrInvalidCredential) {
+		t.Fatalf("got error %v, want ErrInvalidCredential", err)
+	}
+}
+
+func TestVerifyAuthentication(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(a *webauthntest.Authenticator)
+		edit    func(cred *webauthn.AuthenticationCredential)
+		wantErr bool
+	}{
+		{name: "valid"},
+		{name: "other site", tamper: func(a *webauthntest.Authenticator) { a.RPID = "evil.example.com" }, wantErr: true},
+		{name: "other origin", tamper: func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example.com" }, wantErr: true},
+		{
+			name: "registration response replayed",
+			edit: func(cred *webauthn.AuthenticationCredential) {
+				cred.Response.ClientDataJSON = bytes.Replace(cred.Response.ClientDataJSON,
+					[]byte("webauthn.get"), []byte("webauthn.create"), 1)
+			},
+			wantErr: true,
+		},
+		{
+			name: "tampered signature",
+			edit: func(cred *webauthn.AuthenticationCredential) {
+				cred.Response.Signature[len(cred.Response.Signature)-1] ^= 0xff
+			},
+			wantErr: true,
+		},
+		{
+			name: "user not verified",
+			edit: func(cred *webauthn.AuthenticationCredential) {
+				cred.Response.AuthenticatorData[32] &^= 0x04
+			},
+			wantErr: true,
+		},
+		{
+			name: "trailing bytes",
+			edit: func(cred *webauthn.AuthenticationCredential) {
+				cred.Response.AuthenticatorData = append(cred.Response.AuthenticatorData, 0)
+			},
+			wantErr: true,
+		},
+		{
+			name: "truncated authenticator data",
+			edit: func(cred *webauthn.AuthenticationCredential) {
+				cred.Response.AuthenticatorData = cred.Response.AuthenticatorData[:36]
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed extension data",
+			edit: func(cred *webauthn.AuthenticationCredential) {
+				cred.Response.AuthenticatorData[32] |= 0x80
+				cred.Response.AuthenticatorData = append(cred.Response.AuthenticatorData, 0xa5)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			authenticator := webauthntest.NewAuthenticator(testRPID, testOrigin)
+			if tt.tamper != nil {
+				tt.tamper(authenticator)
+			}
+
+			challenge := newTestChallenge(t)
+			cred := authenticator.Get(rp.RequestOptions(challenge, nil))
+			if tt.edit != nil {
+				tt.edit(cred)
+			}
+
+			assertion, err := rp.VerifyAuthentication(cred, challenge, authenticator.PublicKey())
+			if tt.wantErr {
+				if !errors.Is(err, webauthn.ErrInvalidCredential) {
+					t.Fatalf("got error %v, want ErrInvalidCredential", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assertion.SignCount != authenticator.SignCount || !assertion.UserVerified {
+				t.Errorf("got sign count %d verified=%v, want %d verified", assertion.SignCount, assertion.UserVerified, authenticator.SignCount)
+			}
+		})
+	}
+}
+
+func TestVerifyAuthenticationRejectsOtherKey(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator(testRPID, testOrigin)
+	other := webauthntest.NewAuthenticator(testRPID, testOrigin)
+
+	challenge := newTestChallenge(t)
+	cred := authenticator.Get(rp.RequestOptions(challenge, nil))
+	if _, err := rp.VerifyAuthentication(cred, challenge, other.PublicKey()); !errors.Is(err, webauthn.ErrInvalidCredential) {
+		t.Fatalf("got error %v, want ErrInvalidCredential", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package webauthntest provides a software passkey authenticator for tests
+// of the WebAuthn ceremonies.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"sanctor/internal/webauthn"
+)
+
+// Authenticator is a software authenticator holding one P-256 passkey. It
+// answers ceremonies the way a browser and a platform authenticator would
+// together. Tests change its fields to play a misbehaving one.
+type Authenticator struct {
+	RPID        string // hashed into the authenticator data
+	Origin      string // reported in the client data
+	Attestation string // "packed" (self attestation) or "none"
+	SignCount   uint32 // incremented before each assertion
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+}
+
+// NewAuthenticator creates an authenticator for the site rpID, used from
+// origin. Like httptest.NewServer it panics if it cannot be set up.
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		panic(err)
+	}
+	return &Authenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		Attestation:  "packed",
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+// CredentialID returns the ID of the authenticator's passkey
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// PublicKey returns the passkey's public key as a COSE_Key
+func (a *Authenticator) PublicKey() []byte {
+	return EncodeCBOR(map[interface{}]interface{}{
+		int64(1):  int64(2), // kty: EC2
+		int64(3):  webauthn.AlgES256,
+		int64(-1): int64(1), // crv: P-256
+		int64(-2): a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		int64(-3): a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+}
+
+// Create answers navigator.credentials.create() with the passkey
+func (a *Authenticator) Create(options *webauthn.CreationOptions) *webauthn.RegistrationCredential {
+	a.userHandle = options.User.ID
+	clientData := a.clientData("webauthn.create", options.Challenge)
+
+	attested := make([]byte, 18, 18+len(a.credentialID))
+	binary.BigEndian.PutUint16(attested[16:], uint16(len(a.credentialID)))
+	attested = append(append(attested, a.credentialID...), a.PublicKey()...)
+	authData := append(a.authData(0x45), attested...) // UP, UV, AT
+
+	statement := map[interface{}]interface{}{}
+	if a.Attestation == "packed" {
+		statement["alg"] = webauthn.AlgES256
+		statement["sig"] = a.sign(authData, clientData)
+	}
+	object := EncodeCBOR(map[interface{}]interface{}{
+		"fmt":      a.Attestation,
+		"attStmt":  statement,
+		"authData": authData,
+	})
+
+	return &webauthn.RegistrationCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+		Response: webauthn.AttestationResponse{
+			ClientDataJSON:    clientData,
+			AttestationObject: object,
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// Get answers navigator.credentials.get() with the passkey
+func (a *Authenticator) Get(options *webauthn.RequestOptions) *webauthn.AuthenticationCredential {
+	a.SignCount++
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	authData := a.authData(0x05) // UP, UV
+
+	return &webauthn.AuthenticationCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+		Response: webauthn.AssertionResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         a.sign(authData, clientData),
+			UserHandle:        a.userHandle,
+		},
+	}
+}
+
+// clientData serializes the CollectedClientData the browser would sign over
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// authData returns the fixed part of the authenticator data
+func (a *Authenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.SignCount)
+	return data
+}
+
+// sign signs authenticator data and the client data hash with the passkey
+func (a *Authenticator) sign(authData, clientData []byte) []byte {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
@@ -0,0 +1,80 @@
+package webauthntest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// EncodeCBOR encodes a value the way an authenticator would (RFC 8949),
+// with map keys in CTAP2 canonical order so the output is deterministic. It
+// supports int and int64, []byte, string, bool, nil, []interface{} and
+// map[interface{}]interface{}, and panics on anything else.
+func EncodeCBOR(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		return EncodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return encodeHead(1, uint64(-1-v))
+		}
+		return encodeHead(0, uint64(v))
+	case []byte:
+		return append(encodeHead(2, uint64(len(v))), v...)
+	case string:
+		return append(encodeHead(3, uint64(len(v))), v...)
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	case []interface{}:
+		out := encodeHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, EncodeCBOR(item)...)
+		}
+		return out
+	case map[interface{}]interface{}:
+		keys := make([][]byte, 0, len(v))
+		values := make(map[string][]byte, len(v))
+		for key, value := range v {
+			encoded := EncodeCBOR(key)
+			keys = append(keys, encoded)
+			values[string(encoded)] = EncodeCBOR(value)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return bytes.Compare(keys[i], keys[j]) < 0
+		})
+
+		out := encodeHead(5, uint64(len(v)))
+		for _, key := range keys {
+			out = append(append(out, key...), values[string(key)]...)
+		}
+		return out
+	default:
+		panic(fmt.Sprintf("webauthntest: cannot encode %T as CBOR", v))
+	}
+}
+
+// encodeHead encodes an initial byte and its argument in the shortest form
+func encodeHead(major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major | 26}, uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major | 27}, arg)
+	}
+}
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS users (
+    id UUID DEFAULT gen_random_uuid(),
+    email VARCHAR(255) NOT NULL,
+    username VARCHAR(100) NOT NULL,
+    first_name VARCHAR(100),
+    last_name VARCHAR(100),
+    password_hash VARCHAR(255) NOT NULL,
+    avatar VARCHAR(500),
+    bio TEXT,
+    is_active BOOLEAN DEFAULT true,
+    is_verified BOOLEAN DEFAULT false,
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
+    last_login_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    gender VARCHAR(20),
+    age BIGINT,
+    university VARCHAR(200),
+    major VARCHAR(100),
+    university_email VARCHAR(255),
+    university_verified_at TIMESTAMPTZ,
+    deactivated_at TIMESTAMPTZ,
+    deactivated_by VARCHAR(20) NOT NULL DEFAULT '',
+    deletion_scheduled_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users (deletion_scheduled_at);
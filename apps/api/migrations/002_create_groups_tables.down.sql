@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_groups;
+DROP TABLE IF EXISTS groups;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS groups (
+    id UUID DEFAULT gen_random_uuid(),
+    name VARCHAR(200) NOT NULL,
+    description TEXT,
+    is_private BOOLEAN DEFAULT false,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_groups_created_by ON groups (created_by);
+
+CREATE TABLE IF NOT EXISTS user_groups (
+    user_id UUID,
+    group_id UUID,
+    role VARCHAR(20) DEFAULT 'member',
+    joined_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, group_id)
+);
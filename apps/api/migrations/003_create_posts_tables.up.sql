@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS posts (
+    id UUID DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    address VARCHAR(500) NOT NULL,
+    is_sublet BOOLEAN DEFAULT false,
+    price VARCHAR(50),
+    rooms VARCHAR(20),
+    rooms_occupied BIGINT DEFAULT 0,
+    bathrooms VARCHAR(20),
+    description TEXT,
+    gender VARCHAR(20),
+    property_type VARCHAR(50),
+    term VARCHAR(20),
+    hidden BOOLEAN DEFAULT false,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id);
+CREATE INDEX IF NOT EXISTS idx_posts_hidden ON posts (hidden);
+
+CREATE TABLE IF NOT EXISTS pictures (
+    id UUID DEFAULT gen_random_uuid(),
+    post_id UUID NOT NULL,
+    url VARCHAR(500) NOT NULL,
+    caption TEXT,
+    "order" BIGINT DEFAULT 0,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pictures_post_id ON pictures (post_id);
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS auth_login_events;
+DROP TABLE IF EXISTS auth_passkeys;
+DROP TABLE IF EXISTS auth_api_keys;
+DROP TABLE IF EXISTS auth_login_attempts;
+DROP TABLE IF EXISTS auth_oidc_identities;
+DROP TABLE IF EXISTS auth_recovery_codes;
+DROP TABLE IF EXISTS auth_two_factors;
+DROP TABLE IF EXISTS auth_magic_links;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS auth_sessions;
@@ -0,0 +1,144 @@
+CREATE TABLE IF NOT EXISTS auth_sessions (
+    id UUID,
+    user_id UUID NOT NULL,
+    user_agent VARCHAR(500),
+    ip_address VARCHAR(64),
+    last_seen_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_user_id ON auth_sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID,
+    session_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id UUID,
+    user_id UUID NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS auth_magic_links (
+    id UUID,
+    user_id UUID NOT NULL,
+    binding_hash VARCHAR(64),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_magic_links_user_id ON auth_magic_links (user_id);
+
+CREATE TABLE IF NOT EXISTS auth_two_factors (
+    user_id UUID,
+    secret VARCHAR(64) NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    confirmed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS auth_recovery_codes (
+    id UUID,
+    user_id UUID NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_recovery_codes_user_id ON auth_recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS auth_oidc_identities (
+    id UUID,
+    user_id UUID NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oidc_provider_subject ON auth_oidc_identities (provider, subject);
+CREATE INDEX IF NOT EXISTS idx_auth_oidc_identities_user_id ON auth_oidc_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS auth_login_attempts (
+    key VARCHAR(300),
+    failures BIGINT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (key)
+);
+
+CREATE TABLE IF NOT EXISTS auth_api_keys (
+    id UUID,
+    user_id UUID NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auth_api_keys_key_hash ON auth_api_keys (key_hash);
+CREATE INDEX IF NOT EXISTS idx_auth_api_keys_user_id ON auth_api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS auth_passkeys (
+    id UUID,
+    user_id UUID NOT NULL,
+    credential_id VARCHAR(1400) NOT NULL,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports VARCHAR(200),
+    name VARCHAR(100) NOT NULL,
+    backed_up BOOLEAN NOT NULL DEFAULT false,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auth_passkeys_credential_id ON auth_passkeys (credential_id);
+CREATE INDEX IF NOT EXISTS idx_auth_passkeys_user_id ON auth_passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS auth_login_events (
+    id UUID,
+    user_id UUID,
+    method VARCHAR(50) NOT NULL,
+    success BOOLEAN NOT NULL,
+    failure_reason VARCHAR(100),
+    user_agent VARCHAR(500),
+    ip_address VARCHAR(64),
+    new_device BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_login_events_user_id ON auth_login_events (user_id);
+CREATE INDEX IF NOT EXISTS idx_auth_login_events_created_at ON auth_login_events (created_at);
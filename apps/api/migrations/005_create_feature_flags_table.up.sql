@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name VARCHAR(100),
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    environments TEXT NOT NULL DEFAULT '',
+    universities TEXT NOT NULL DEFAULT '',
+    percentage INTEGER,
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY (name)
+);
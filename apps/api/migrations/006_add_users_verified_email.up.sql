@@ -0,0 +1,5 @@
+-- The address a user last confirmed. Privileges tied to an address, such as
+-- bootstrap admins, require it to match the current email.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_email VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE users SET verified_email = email WHERE is_verified;
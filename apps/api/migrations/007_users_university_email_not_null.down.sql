@@ -0,0 +1,2 @@
+ALTER TABLE users ALTER COLUMN university_email DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN university_email DROP DEFAULT;
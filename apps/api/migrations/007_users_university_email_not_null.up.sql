@@ -0,0 +1,6 @@
+-- Rows created before university verification have no address. The
+-- repository reads the column into a plain string, so it must not be NULL.
+UPDATE users SET university_email = '' WHERE university_email IS NULL;
+
+ALTER TABLE users ALTER COLUMN university_email SET DEFAULT '';
+ALTER TABLE users ALTER COLUMN university_email SET NOT NULL;
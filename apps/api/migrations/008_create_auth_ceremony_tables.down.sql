@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS auth_oidc_login_states;
+DROP TABLE IF EXISTS auth_passkey_challenges;
@@ -0,0 +1,25 @@
+-- Started passkey ceremonies and provider logins, so any API instance can
+-- finish them and they survive a restart. Both are keyed by a token hash.
+CREATE TABLE IF NOT EXISTS auth_passkey_challenges (
+    id_hash VARCHAR(64),
+    user_id VARCHAR(36) NOT NULL DEFAULT '',
+    challenge BYTEA NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_passkey_challenges_expires_at ON auth_passkey_challenges (expires_at);
+
+CREATE TABLE IF NOT EXISTS auth_oidc_login_states (
+    state_hash VARCHAR(64),
+    provider VARCHAR(50) NOT NULL,
+    nonce VARCHAR(100) NOT NULL,
+    verifier VARCHAR(100) NOT NULL,
+    binding_hash VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (state_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_oidc_login_states_expires_at ON auth_oidc_login_states (expires_at);
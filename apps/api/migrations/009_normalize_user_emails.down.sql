@@ -0,0 +1 @@
+-- The original case of the addresses is gone; lower case stays valid.
@@ -0,0 +1,6 @@
+-- Email addresses are stored in lower case so that addresses differing only
+-- in case belong to one account. If two accounts already share an address
+-- this way, the unique index on email makes this fail until they are merged.
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+UPDATE users SET verified_email = lower(trim(verified_email)) WHERE verified_email <> lower(trim(verified_email));
+UPDATE users SET university_email = lower(trim(university_email)) WHERE university_email <> lower(trim(university_email));
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_users_verified_university_email;
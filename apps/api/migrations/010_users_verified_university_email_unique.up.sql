@@ -0,0 +1,13 @@
+-- A university address can verify one account only. Where several accounts
+-- verified the same address, the earliest keeps the badge and the others
+-- have to verify again.
+UPDATE users SET university_verified_at = NULL
+WHERE university_verified_at IS NOT NULL AND EXISTS (
+    SELECT 1 FROM users earlier
+    WHERE earlier.university_email = users.university_email
+      AND earlier.university_verified_at IS NOT NULL
+      AND (earlier.university_verified_at, earlier.id) < (users.university_verified_at, users.id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_university_email ON users (university_email)
+WHERE university_verified_at IS NOT NULL;
@@ -0,0 +1,13 @@
+-- University confirmation links that were mailed and not opened yet. A link
+-- is a signed token whose ID is the row's ID; taking the row when the link
+-- is opened makes it single use.
+CREATE TABLE IF NOT EXISTS auth_university_verifications (
+    id UUID,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_university_verifications_user_id ON auth_university_verifications (user_id);
+CREATE INDEX IF NOT EXISTS idx_auth_university_verifications_expires_at ON auth_university_verifications (expires_at);
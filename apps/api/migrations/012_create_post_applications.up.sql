@@ -0,0 +1,15 @@
+-- Applications for a room in a post's listing. Accepting one also raises
+-- posts.rooms_occupied, in the same transaction.
+CREATE TABLE IF NOT EXISTS post_applications (
+    id UUID DEFAULT gen_random_uuid(),
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_applications_post_id ON post_applications (post_id);
+CREATE INDEX IF NOT EXISTS idx_post_applications_user_id ON post_applications (user_id);
@@ -0,0 +1,21 @@
+-- Runs once, before the first migration, on a database without any applied
+-- migrations. A database created by the former GORM auto-migration already
+-- has users and posts, but without the columns added to them since, so the
+-- CREATE TABLE IF NOT EXISTS in 001 and 003 leaves them as they are. This
+-- adds those columns first so that the migrations apply unchanged. On an
+-- empty database it does nothing.
+DO $$
+BEGIN
+    IF to_regclass('users') IS NOT NULL THEN
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS university_email VARCHAR(255);
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS university_verified_at TIMESTAMPTZ;
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_by VARCHAR(20) NOT NULL DEFAULT '';
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ;
+    END IF;
+
+    IF to_regclass('posts') IS NOT NULL THEN
+        ALTER TABLE posts ADD COLUMN IF NOT EXISTS hidden BOOLEAN DEFAULT false;
+    END IF;
+END $$;
@@ -0,0 +1,11 @@
+// Package migrations holds the versioned SQL migrations for the API's
+// database. They are embedded in the binary and applied by
+// database.Migrator; see README.md for the file layout.
+package migrations
+
+import "embed"
+
+// FS contains every migration file
+//
+//go:embed *.sql
+var FS embed.FS
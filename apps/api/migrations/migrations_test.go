@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"testing"
+
+	"sanctor/internal/database"
+)
+
+func TestMigrationsLoad(t *testing.T) {
+	migrations, err := database.LoadMigrations(FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %03d_%s should be version %d", migration.Version, migration.Name, i+1)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %03d_%s has no down file", migration.Version, migration.Name)
+		}
+	}
+}
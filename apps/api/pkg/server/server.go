@@ -0,0 +1,109 @@
+// Package server runs a complete Sanctor API in-process. cmd/api is a thin
+// wrapper around it; integration tests can use it to start an instance
+// against in-memory storage:
+//
+//	cfg := config.Default()
+//	srv, err := server.New(server.Options{Config: cfg, Mailer: mail.NewLogSender()})
+//	ts := httptest.NewServer(srv.Handler())
+//	defer srv.Close()
+//
+// Each instance keeps its own keys, sessions and settings, so several can
+// run side by side in one process.
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+
+	"sanctor/internal/app"
+	"sanctor/internal/config"
+	"sanctor/internal/mail"
+)
+
+// Options configures a server
+type Options struct {
+	// Config is the application configuration; nil loads it from the config
+	// file named by CONFIG_FILE and the environment
+	Config *config.Config
+	// Mailer, when set, replaces the configured mail delivery
+	Mailer mail.Sender
+}
+
+// Server is a Sanctor API instance
+type Server struct {
+	// App exposes the shared services, e.g. to seed data in tests
+	App *app.App
+
+	handler http.Handler
+	http    *http.Server
+}
+
+// New builds a server and all of its services
+func New(opts Options) (*Server, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(flag.NewFlagSet("sanctor", flag.ContinueOnError), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	a, err := app.New(cfg, opts.Mailer)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{App: a, handler: a.Routes()}
+	s.http = &http.Server{Addr: net.JoinHostPort(cfg.Server.Host, cfg.Server.Port), Handler: s.handler}
+	return s, nil
+}
+
+// Handler returns the API's HTTP handler
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// ListenAndServe serves the API on the configured host and port until the
+// server is shut down
+func (s *Server) ListenAndServe() error {
+	fmt.Printf("Server starting on port %s...\n", s.App.Config.Server.Port)
+	return ignoreClosed(s.http.ListenAndServe())
+}
+
+// Serve serves the API on l until the server is shut down
+func (s *Server) Serve(l net.Listener) error {
+	return ignoreClosed(s.http.Serve(l))
+}
+
+// Shutdown stops accepting requests, waits for those in flight and for
+// emails still being sent, and then releases the application's resources
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
+	if waitErr := s.App.Auth.Wait(ctx); err == nil {
+		err = waitErr
+	}
+	if closeErr := s.App.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close stops the server immediately and releases the application's resources
+func (s *Server) Close() error {
+	err := s.http.Close()
+	if closeErr := s.App.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ignoreClosed hides the error a listener returns after a regular shutdown
+func ignoreClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
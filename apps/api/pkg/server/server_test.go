@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"sanctor/internal/config"
+	"sanctor/internal/mail"
+)
+
+// recorder keeps the messages a server sends
+type recorder struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (r *recorder) Send(msg *mail.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+// newTestServer starts a server on in-memory storage
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Server.Env = "test"
+	// Cheap hashing keeps the test fast
+	cfg.Password.Argon2Memory = 64
+	cfg.Password.Argon2Iterations = 1
+	cfg.Password.Argon2Parallelism = 1
+
+	srv, err := New(Options{Config: cfg, Mailer: &recorder{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+	return srv, ts
+}
+
+// call sends a JSON request and decodes the JSON response into out
+func call(t *testing.T, ts *httptest.Server, method, path, token string, body, out interface{}) int {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, ts.URL+path, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "server-test")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func TestRegisterLoginAndCallTheAPI(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	var registered tokens
+	status := call(t, ts, "POST", "/api/auth/register", "", map[string]string{
+		"email":     "ada@example.com",
+		"username":  "ada",
+		"password":  "analytical-engine-1843",
+		"firstName": "Ada",
+		"lastName":  "Lovelace",
+	}, &registered)
+	if status != http.StatusOK || registered.Token == "" {
+		t.Fatalf("register: status %d, token %q", status, registered.Token)
+	}
+
+	var loggedIn tokens
+	status = call(t, ts, "POST", "/api/auth/login", "", map[string]string{
+		"email":    "ada@example.com",
+		"password": "analytical-engine-1843",
+	}, &loggedIn)
+	if status != http.StatusOK || loggedIn.Token == "" {
+		t.Fatalf("login: status %d, token %q", status, loggedIn.Token)
+	}
+	if status := call(t, ts, "POST", "/api/auth/login", "", map[string]string{
+		"email":    "ada@example.com",
+		"password": "difference-engine-1822",
+	}, nil); status != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password: status %d, want 401", status)
+	}
+
+	var sessions []struct {
+		UserAgent string `json:"userAgent"`
+		Current   bool   `json:"current"`
+	}
+	if status := call(t, ts, "GET", "/api/auth/sessions", loggedIn.Token, nil, &sessions); status != http.StatusOK {
+		t.Fatalf("sessions: status %d, want 200", status)
+	}
+	current := 0
+	for _, session := range sessions {
+		if session.Current {
+			current++
+		}
+	}
+	if len(sessions) != 2 || current != 1 {
+		t.Errorf("sessions = %+v, want the registration and the login, one of them current", sessions)
+	}
+
+	for name, token := range map[string]string{"no token": "", "bad token": "not-a-token"} {
+		if status := call(t, ts, "GET", "/api/auth/sessions", token, nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", name, status)
+		}
+	}
+}